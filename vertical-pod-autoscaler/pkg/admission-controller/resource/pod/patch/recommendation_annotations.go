@@ -0,0 +1,89 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+
+	resource_admission "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource/pod/recommendation"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+const (
+	// RecommendationAnnotationPrefix is the prefix of the pod annotations
+	// holding the recommended resources of each container in the
+	// AnnotationRecommendation update mode.
+	RecommendationAnnotationPrefix = "vpa.autoscaling.k8s.io/recommendation"
+)
+
+type recommendationAnnotationsPatchCalculator struct {
+	recommendationProvider recommendation.Provider
+}
+
+// NewRecommendationAnnotationsCalculator returns a calculator for patches
+// writing the recommended resources to pod annotations. Patches are only
+// calculated for VPAs in the AnnotationRecommendation update mode. Containers
+// whose names are too long to be part of a valid annotation name are skipped.
+func NewRecommendationAnnotationsCalculator(recommendationProvider recommendation.Provider) Calculator {
+	return &recommendationAnnotationsPatchCalculator{
+		recommendationProvider: recommendationProvider,
+	}
+}
+
+func (*recommendationAnnotationsPatchCalculator) PatchResourceTarget() PatchResourceTarget {
+	return Pod
+}
+
+func (c *recommendationAnnotationsPatchCalculator) CalculatePatches(pod *core.Pod, vpa *vpa_types.VerticalPodAutoscaler) ([]resource_admission.PatchRecord, error) {
+	result := []resource_admission.PatchRecord{}
+	if vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeAnnotationRecommendation {
+		return result, nil
+	}
+
+	containersResources, _, err := c.recommendationProvider.GetContainersResourcesForPod(pod, vpa)
+	if err != nil {
+		return []resource_admission.PatchRecord{}, fmt.Errorf("failed to calculate recommendation annotations for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+	}
+
+	for i, containerResources := range containersResources {
+		for _, resourceName := range []core.ResourceName{core.ResourceCPU, core.ResourceMemory} {
+			quantity, found := containerResources.Requests[resourceName]
+			if !found {
+				continue
+			}
+			annotationName := GetRecommendationAnnotationName(pod.Spec.Containers[i].Name, resourceName)
+			if errs := validation.IsQualifiedName(annotationName); len(errs) > 0 {
+				klog.V(2).InfoS("Skipping recommendation annotation with an invalid name", "pod", klog.KObj(pod), "annotation", annotationName, "errors", errs)
+				continue
+			}
+			result = append(result, GetAddAnnotationPatch(annotationName, quantity.String()))
+		}
+	}
+	return result, nil
+}
+
+// GetRecommendationAnnotationName returns the name of the pod annotation
+// holding the recommendation of the given resource for the given container.
+func GetRecommendationAnnotationName(containerName string, resourceName core.ResourceName) string {
+	return fmt.Sprintf("%s.%s.%s", RecommendationAnnotationPrefix, containerName, resourceName)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package patch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	resource_admission "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/admission-controller/resource"
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+func addRecommendationAnnotationPatch(containerName, res, amount string) resource_admission.PatchRecord {
+	return resource_admission.PatchRecord{
+		Op:    "add",
+		Path:  fmt.Sprintf("/metadata/annotations/vpa.autoscaling.k8s.io~1recommendation.%s.%s", containerName, res),
+		Value: amount,
+	}
+}
+
+func TestCalculatePatches_RecommendationAnnotations(t *testing.T) {
+	pod := &core.Pod{
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: "container-1"}, {Name: "container-2"}},
+		},
+	}
+	recommendResources := []vpa_api_util.ContainerResources{
+		{
+			Requests: core.ResourceList{
+				core.ResourceCPU:    resource.MustParse("1"),
+				core.ResourceMemory: resource.MustParse("1Gi"),
+			},
+		},
+		{
+			Requests: core.ResourceList{
+				core.ResourceCPU: resource.MustParse("250m"),
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		updateMode    vpa_types.UpdateMode
+		expectPatches []resource_admission.PatchRecord
+	}{
+		{
+			name:       "annotation recommendation mode",
+			updateMode: vpa_types.UpdateModeAnnotationRecommendation,
+			expectPatches: []resource_admission.PatchRecord{
+				addRecommendationAnnotationPatch("container-1", "cpu", "1"),
+				addRecommendationAnnotationPatch("container-1", "memory", "1Gi"),
+				addRecommendationAnnotationPatch("container-2", "cpu", "250m"),
+			},
+		},
+		{
+			name:          "auto mode",
+			updateMode:    vpa_types.UpdateModeAuto,
+			expectPatches: []resource_admission.PatchRecord{},
+		},
+		{
+			name:          "initial mode",
+			updateMode:    vpa_types.UpdateModeInitial,
+			expectPatches: []resource_admission.PatchRecord{},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			frp := fakeRecommendationProvider{recommendResources, vpa_api_util.ContainerToAnnotationsMap{}, nil}
+			c := NewRecommendationAnnotationsCalculator(&frp)
+			vpa := test.VerticalPodAutoscaler().WithName("name").WithContainer("test").WithUpdateMode(tc.updateMode).Get()
+			patches, err := c.CalculatePatches(pod, vpa)
+			assert.NoError(t, err)
+			if assert.Len(t, patches, len(tc.expectPatches)) {
+				for i, gotPatch := range patches {
+					AssertEqPatch(t, gotPatch, tc.expectPatches[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCalculatePatches_RecommendationAnnotationsLongContainerName(t *testing.T) {
+	// The name part of an annotation key can't exceed 63 characters, which
+	// leaves room for container names of up to 41 characters.
+	longestName := strings.Repeat("a", 41)
+	tooLongName := strings.Repeat("b", 63)
+	pod := &core.Pod{
+		Spec: core.PodSpec{
+			Containers: []core.Container{{Name: longestName}, {Name: tooLongName}},
+		},
+	}
+	requests := core.ResourceList{
+		core.ResourceCPU:    resource.MustParse("1"),
+		core.ResourceMemory: resource.MustParse("1Gi"),
+	}
+	frp := fakeRecommendationProvider{[]vpa_api_util.ContainerResources{{Requests: requests}, {Requests: requests}}, vpa_api_util.ContainerToAnnotationsMap{}, nil}
+	c := NewRecommendationAnnotationsCalculator(&frp)
+	vpa := test.VerticalPodAutoscaler().WithName("name").WithContainer("test").
+		WithUpdateMode(vpa_types.UpdateModeAnnotationRecommendation).Get()
+	patches, err := c.CalculatePatches(pod, vpa)
+	assert.NoError(t, err)
+	expectPatches := []resource_admission.PatchRecord{
+		addRecommendationAnnotationPatch(longestName, "cpu", "1"),
+		addRecommendationAnnotationPatch(longestName, "memory", "1Gi"),
+	}
+	if assert.Len(t, patches, len(expectPatches)) {
+		for i, gotPatch := range patches {
+			AssertEqPatch(t, gotPatch, expectPatches[i])
+		}
+	}
+}
+
+func TestCalculatePatches_RecommendationAnnotationsError(t *testing.T) {
+	frp := fakeRecommendationProvider{nil, nil, fmt.Errorf("recommendation error")}
+	c := NewRecommendationAnnotationsCalculator(&frp)
+	vpa := test.VerticalPodAutoscaler().WithName("name").WithContainer("test").
+		WithUpdateMode(vpa_types.UpdateModeAnnotationRecommendation).Get()
+	_, err := c.CalculatePatches(&core.Pod{}, vpa)
+	assert.Error(t, err)
+}
@@ -53,6 +53,10 @@ func (*resourcesUpdatesPatchCalculator) PatchResourceTarget() PatchResourceTarge
 
 func (c *resourcesUpdatesPatchCalculator) CalculatePatches(pod *core.Pod, vpa *vpa_types.VerticalPodAutoscaler) ([]resource_admission.PatchRecord, error) {
 	result := []resource_admission.PatchRecord{}
+	if vpa_api_util.GetUpdateMode(vpa) == vpa_types.UpdateModeAnnotationRecommendation {
+		// Recommendations are only written to annotations in this mode.
+		return result, nil
+	}
 
 	containersResources, annotationsPerContainer, err := c.recommendationProvider.GetContainersResourcesForPod(pod, vpa)
 	if err != nil {
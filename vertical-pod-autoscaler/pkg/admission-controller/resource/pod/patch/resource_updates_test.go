@@ -350,3 +350,25 @@ func TestGetPatches_TwoReplacementResources(t *testing.T) {
 		AssertPatchOneOf(t, patches[2], []resource_admission.PatchRecord{cpuFirstUnobtaniumSecond, unobtaniumFirstCpuSecond})
 	}
 }
+
+func TestCalculatePatches_ResourceUpdatesAnnotationRecommendationMode(t *testing.T) {
+	recommendResources := []vpa_api_util.ContainerResources{
+		{
+			Requests: core.ResourceList{
+				cpu: resource.MustParse("1"),
+			},
+		},
+	}
+	pod := &core.Pod{
+		Spec: core.PodSpec{
+			Containers: []core.Container{{}},
+		},
+	}
+	frp := fakeRecommendationProvider{recommendResources, vpa_api_util.ContainerToAnnotationsMap{}, nil}
+	c := NewResourceUpdatesCalculator(&frp)
+	vpa := test.VerticalPodAutoscaler().WithName("name").WithContainer("test").
+		WithUpdateMode(vpa_types.UpdateModeAnnotationRecommendation).Get()
+	patches, err := c.CalculatePatches(pod, vpa)
+	assert.NoError(t, err)
+	assert.Empty(t, patches)
+}
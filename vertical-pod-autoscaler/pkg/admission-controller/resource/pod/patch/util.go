@@ -18,6 +18,7 @@ package patch
 
 import (
 	"fmt"
+	"strings"
 
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -36,9 +37,11 @@ func GetAddEmptyAnnotationsPatch() resource_admission.PatchRecord {
 
 // GetAddAnnotationPatch returns a patch for an annotation.
 func GetAddAnnotationPatch(annotationName, annotationValue string) resource_admission.PatchRecord {
+	// Annotation names may contain '/', which has to be escaped in JSON pointers.
+	escapedName := strings.NewReplacer("~", "~0", "/", "~1").Replace(annotationName)
 	return resource_admission.PatchRecord{
 		Op:    "add",
-		Path:  fmt.Sprintf("/metadata/annotations/%s", annotationName),
+		Path:  fmt.Sprintf("/metadata/annotations/%s", escapedName),
 		Value: annotationValue,
 	}
 }
@@ -72,6 +72,10 @@ func (m *matcher) GetMatchingVPA(ctx context.Context, pod *core.Pod) *vpa_types.
 		if vpa_api_util.GetUpdateMode(vpaConfig) == vpa_types.UpdateModeOff {
 			continue
 		}
+		if vpa_api_util.IsDryRun(vpaConfig.Annotations) {
+			klog.V(5).InfoS("Skipping VPA object in dry-run mode", "vpa", klog.KObj(vpaConfig))
+			continue
+		}
 		if vpaConfig.Spec.TargetRef == nil {
 			klog.V(5).InfoS("Skipping VPA object because targetRef is not defined. If this is a v1beta1 object, switch to v1", "vpa", klog.KObj(vpaConfig))
 			continue
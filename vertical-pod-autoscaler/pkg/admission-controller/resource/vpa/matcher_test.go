@@ -129,6 +129,26 @@ func TestGetMatchingVpa(t *testing.T) {
 			labelSelector:   "app = test",
 			expectedFound:   true,
 			expectedVpaName: "auto-vpa",
+		}, {
+			name: "dry-run vpa",
+			pod:  podBuilder.Get(),
+			vpas: []*vpa_types.VerticalPodAutoscaler{
+				vpaBuilder.WithUpdateMode(vpa_types.UpdateModeAuto).WithName("dry-run-vpa").WithTargetRef(targetRef).
+					WithAnnotations(map[string]string{"vpa.autoscaling.k8s.io/dry-run": "true"}).Get(),
+			},
+			labelSelector: "app = test",
+			expectedFound: false,
+		}, {
+			name: "two vpas, one in dry-run mode",
+			pod:  podBuilder.Get(),
+			vpas: []*vpa_types.VerticalPodAutoscaler{
+				vpaBuilder.WithUpdateMode(vpa_types.UpdateModeAuto).WithName("dry-run-vpa").WithTargetRef(targetRef).
+					WithAnnotations(map[string]string{"vpa.autoscaling.k8s.io/dry-run": "true"}).Get(),
+				vpaBuilder.WithUpdateMode(vpa_types.UpdateModeAuto).WithName("auto-vpa").WithTargetRef(targetRef).Get(),
+			},
+			labelSelector:   "app = test",
+			expectedFound:   true,
+			expectedVpaName: "auto-vpa",
 		}, {
 			name: "initial mode",
 			pod:  podBuilder.Get(),
@@ -151,7 +151,7 @@ type PodUpdatePolicy struct {
 }
 
 // UpdateMode controls when autoscaler applies changes to the pod resources.
-// +kubebuilder:validation:Enum=Off;Initial;Recreate;InPlaceOrRecreate;Auto
+// +kubebuilder:validation:Enum=Off;Initial;Recreate;InPlaceOrRecreate;Auto;AnnotationRecommendation;InPlace
 type UpdateMode string
 
 const (
@@ -178,6 +178,19 @@ const (
 	// on the admission and updater pods.
 	// Requires cluster feature gate "InPlacePodVerticalScaling" to be enabled.
 	UpdateModeInPlaceOrRecreate UpdateMode = "InPlaceOrRecreate"
+	// UpdateModeAnnotationRecommendation means that autoscaler never changes
+	// Pod resources, but on pod creation writes the recommended resources of
+	// each container to the pod annotations
+	// "vpa.autoscaling.k8s.io/recommendation.{container}.cpu" and
+	// "vpa.autoscaling.k8s.io/recommendation.{container}.memory".
+	UpdateModeAnnotationRecommendation UpdateMode = "AnnotationRecommendation"
+	// UpdateModeInPlace means that autoscaler assigns resources on pod
+	// creation and additionally updates them during the lifetime of the pod
+	// only in-place, never by deleting and recreating the pod. Pods which
+	// can't be resized in-place keep their resources until a later resize
+	// succeeds.
+	// Requires cluster feature gate "InPlacePodVerticalScaling" to be enabled.
+	UpdateModeInPlace UpdateMode = "InPlace"
 )
 
 // PodResourcePolicy controls how autoscaler computes the recommended resources
@@ -214,6 +227,7 @@ type ContainerResourcePolicy struct {
 	// Specifies the type of recommendations that will be computed
 	// (and possibly applied) by VPA.
 	// If not specified, the default of [ResourceCPU, ResourceMemory] will be used.
+	// ResourceEphemeralStorage can be controlled in addition.
 	// +patchStrategy=merge
 	ControlledResources *[]v1.ResourceName `json:"controlledResources,omitempty" patchStrategy:"merge" protobuf:"bytes,5,rep,name=controlledResources"`
 
@@ -221,6 +235,11 @@ type ContainerResourcePolicy struct {
 	// The default is "RequestsAndLimits".
 	// +optional
 	ControlledValues *ContainerControlledValues `json:"controlledValues,omitempty" protobuf:"bytes,6,rep,name=controlledValues"`
+
+	// Specifies how the recommendation is computed from the usage samples
+	// of the container. The default is "HistogramPercentile".
+	// +optional
+	SamplingStrategy *SamplingStrategy `json:"samplingStrategy,omitempty" protobuf:"bytes,7,opt,name=samplingStrategy"`
 }
 
 const (
@@ -253,6 +272,24 @@ const (
 	ContainerControlledValuesRequestsOnly ContainerControlledValues = "RequestsOnly"
 )
 
+// SamplingStrategy controls how the recommendation for a container is
+// computed from its usage samples.
+// +kubebuilder:validation:Enum=HistogramPercentile;RunningMaximum;DecayWeightedAverage
+type SamplingStrategy string
+
+const (
+	// SamplingStrategyHistogramPercentile means the recommendation is based
+	// on percentiles of the decaying histogram of usage samples.
+	SamplingStrategyHistogramPercentile SamplingStrategy = "HistogramPercentile"
+	// SamplingStrategyRunningMaximum means the recommendation is based on the
+	// maximum usage observed. Suitable for containers with bursty usage.
+	SamplingStrategyRunningMaximum SamplingStrategy = "RunningMaximum"
+	// SamplingStrategyDecayWeightedAverage means the recommendation is based
+	// on the average usage, weighted so that newer samples count more.
+	// Suitable for containers with smooth usage.
+	SamplingStrategyDecayWeightedAverage SamplingStrategy = "DecayWeightedAverage"
+)
+
 // VerticalPodAutoscalerStatus describes the runtime state of the autoscaler.
 type VerticalPodAutoscalerStatus struct {
 	// The most recently computed amount of resources recommended by the
@@ -317,6 +354,9 @@ var (
 	// LowConfidence indicates whether the VPA recommender has low confidence in the recommendation for
 	// some of containers.
 	LowConfidence VerticalPodAutoscalerConditionType = "LowConfidence"
+	// HighConfidence indicates that the recommendations of all containers are
+	// based on enough history to be considered reliable.
+	HighConfidence VerticalPodAutoscalerConditionType = "HighConfidence"
 	// NoPodsMatched indicates that label selector used with VPA object didn't match any pods.
 	NoPodsMatched VerticalPodAutoscalerConditionType = "NoPodsMatched"
 	// FetchingHistory indicates that VPA recommender is in the process of loading additional history samples.
@@ -327,6 +367,9 @@ var (
 	// ConfigUnsupported indicates that this VPA configuration is unsupported
 	// and recommendations will not be provided for it.
 	ConfigUnsupported VerticalPodAutoscalerConditionType = "ConfigUnsupported"
+	// WaitingForInitialData indicates that the VPA is too young for its
+	// recommendation to be based on enough samples.
+	WaitingForInitialData VerticalPodAutoscalerConditionType = "WaitingForInitialData"
 )
 
 // VerticalPodAutoscalerCondition describes the state of
@@ -63,6 +63,11 @@ func (in *ContainerResourcePolicy) DeepCopyInto(out *ContainerResourcePolicy) {
 		*out = new(ContainerControlledValues)
 		**out = **in
 	}
+	if in.SamplingStrategy != nil {
+		in, out := &in.SamplingStrategy, &out.SamplingStrategy
+		*out = new(SamplingStrategy)
+		**out = **in
+	}
 	return
 }
 
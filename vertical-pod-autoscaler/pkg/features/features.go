@@ -46,6 +46,14 @@ const (
 	// InPlaceOrRecreate enables the InPlaceOrRecreate update mode to be used.
 	// Requires KEP-1287 InPlacePodVerticalScaling feature-gate to be enabled on the cluster.
 	InPlaceOrRecreate featuregate.Feature = "InPlaceOrRecreate"
+
+	// alpha: v1.5.0
+	// components: recommender
+
+	// SmoothPercentile makes the recommender interpolate the percentiles of the
+	// usage histograms within their buckets, so that recommendations change
+	// gradually instead of jumping between bucket boundaries.
+	SmoothPercentile featuregate.Feature = "SmoothPercentile"
 )
 
 // MutableFeatureGate is a mutable, versioned, global FeatureGate.
@@ -18,6 +18,7 @@ package input
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 	"time"
@@ -94,7 +95,7 @@ type ClusterStateFeederFactory struct {
 
 // Make creates new ClusterStateFeeder with internal data providers, based on kube client.
 func (m ClusterStateFeederFactory) Make() *clusterStateFeeder {
-	return &clusterStateFeeder{
+	feeder := &clusterStateFeeder{
 		coreClient:          m.KubeClient.CoreV1(),
 		metricsClient:       m.MetricsClient,
 		oomChan:             m.OOMObserver.GetObservedOomsChannel(),
@@ -109,6 +110,8 @@ func (m ClusterStateFeederFactory) Make() *clusterStateFeeder {
 		ignoredNamespaces:   m.IgnoredNamespaces,
 		vpaObjectNamespace:  m.VpaObjectNamespace,
 	}
+	m.ClusterState.SetVpaSelectorFetcher(feeder.fetchVpaSelector)
+	return feeder
 }
 
 // WatchEvictionEventsWithRetries watches new Events with reason=Evicted and passes them to the observer.
@@ -214,6 +217,9 @@ type clusterStateFeeder struct {
 	recommenderName     string
 	ignoredNamespaces   []string
 	vpaObjectNamespace  string
+	// vpaConditions holds the conditions found while fetching the selectors of
+	// the VPAs in the current LoadVPAs call.
+	vpaConditions map[model.VpaID][]condition
 }
 
 func (feeder *clusterStateFeeder) InitFromHistoryProvider(historyProvider history.HistoryProvider) {
@@ -224,13 +230,16 @@ func (feeder *clusterStateFeeder) InitFromHistoryProvider(historyProvider histor
 	}
 	for podID, podHistory := range clusterHistory {
 		klog.V(4).InfoS("Adding pod with labels", "pod", podID, "labels", podHistory.LastLabels)
-		feeder.clusterState.AddOrUpdatePod(podID, podHistory.LastLabels, apiv1.PodUnknown)
+		if err = feeder.clusterState.AddOrUpdatePod(podID, podHistory.LastLabels, apiv1.PodUnknown); err != nil {
+			klog.V(0).InfoS("Failed to add pod", "pod", klog.KRef(podID.Namespace, podID.PodName), "error", err)
+			continue
+		}
 		for containerName, sampleList := range podHistory.Samples {
 			containerID := model.ContainerID{
 				PodID:         podID,
 				ContainerName: containerName,
 			}
-			if err = feeder.clusterState.AddOrUpdateContainer(containerID, nil); err != nil {
+			if _, err = feeder.clusterState.AddOrUpdateContainer(containerID, nil); err != nil {
 				klog.V(0).InfoS("Failed to add container", "container", containerID, "error", err)
 			}
 			klog.V(4).InfoS("Adding samples for container", "sampleCount", len(sampleList), "container", containerID)
@@ -247,22 +256,6 @@ func (feeder *clusterStateFeeder) InitFromHistoryProvider(historyProvider histor
 	}
 }
 
-func (feeder *clusterStateFeeder) setVpaCheckpoint(checkpoint *vpa_types.VerticalPodAutoscalerCheckpoint) error {
-	vpaID := model.VpaID{Namespace: checkpoint.Namespace, VpaName: checkpoint.Spec.VPAObjectName}
-	vpa, exists := feeder.clusterState.VPAs()[vpaID]
-	if !exists {
-		return fmt.Errorf("cannot load checkpoint to missing VPA object %s/%s", vpaID.Namespace, vpaID.VpaName)
-	}
-
-	cs := model.NewAggregateContainerState()
-	err := cs.LoadFromCheckpoint(&checkpoint.Status)
-	if err != nil {
-		return fmt.Errorf("cannot load checkpoint for VPA %s/%s. Reason: %v", vpaID.Namespace, vpaID.VpaName, err)
-	}
-	vpa.ContainersInitialAggregateState[checkpoint.Spec.ContainerName] = cs
-	return nil
-}
-
 func (feeder *clusterStateFeeder) InitFromCheckpoints(ctx context.Context) {
 	klog.V(3).InfoS("Initializing VPA from checkpoints")
 	feeder.LoadVPAs(ctx)
@@ -272,20 +265,28 @@ func (feeder *clusterStateFeeder) InitFromCheckpoints(ctx context.Context) {
 		namespaces[v.ID.Namespace] = true
 	}
 
+	checkpoints := []*vpa_types.VerticalPodAutoscalerCheckpoint{}
 	for namespace := range namespaces {
 		klog.V(3).InfoS("Fetching checkpoints", "namespace", namespace)
 		checkpointList, err := feeder.vpaCheckpointClient.VerticalPodAutoscalerCheckpoints(namespace).List(ctx, metav1.ListOptions{})
 		if err != nil {
 			klog.ErrorS(err, "Cannot list VPA checkpoints", "namespace", namespace)
+			continue
 		}
-		for _, checkpoint := range checkpointList.Items {
-
+		for i := range checkpointList.Items {
+			checkpoint := &checkpointList.Items[i]
 			klog.V(3).InfoS("Loading checkpoint for VPA", "checkpoint", klog.KRef(checkpoint.Namespace, checkpoint.Spec.VPAObjectName), "container", checkpoint.Spec.ContainerName)
-			err = feeder.setVpaCheckpoint(&checkpoint)
-			if err != nil {
-				klog.ErrorS(err, "Error while loading checkpoint")
+			checkpoints = append(checkpoints, checkpoint)
+		}
+	}
+	if err := feeder.clusterState.ImportVpaCheckpoints(ctx, checkpoints); err != nil {
+		// The errors of individual checkpoints are joined, log them one by one.
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, checkpointErr := range joined.Unwrap() {
+				klog.ErrorS(checkpointErr, "Error while loading checkpoint")
 			}
-
+		} else {
+			klog.ErrorS(err, "Error while loading checkpoints")
 		}
 	}
 }
@@ -419,40 +420,43 @@ func (feeder *clusterStateFeeder) LoadVPAs(ctx context.Context) {
 	vpaCRDs := filterVPAs(feeder, allVpaCRDs)
 
 	klog.V(3).InfoS("Fetching VPAs", "count", len(vpaCRDs))
-	// Add or update existing VPAs in the model.
-	vpaKeys := make(map[model.VpaID]bool)
-	for _, vpaCRD := range vpaCRDs {
-		vpaID := model.VpaID{
-			Namespace: vpaCRD.Namespace,
-			VpaName:   vpaCRD.Name,
-		}
-
-		selector, conditions := feeder.getSelector(ctx, vpaCRD)
-		klog.V(4).InfoS("Using selector", "selector", selector.String(), "vpa", klog.KObj(vpaCRD))
-
-		if feeder.clusterState.AddOrUpdateVpa(vpaCRD, selector) == nil {
-			// Successfully added VPA to the model.
-			vpaKeys[vpaID] = true
-
-			for _, condition := range conditions {
-				if condition.delete {
-					delete(feeder.clusterState.VPAs()[vpaID].Conditions, condition.conditionType)
-				} else {
-					feeder.clusterState.VPAs()[vpaID].Conditions.Set(condition.conditionType, true, "", condition.message)
-				}
+	feeder.vpaConditions = make(map[model.VpaID][]condition)
+	// Add, update and delete VPAs in the model.
+	if err := feeder.clusterState.SyncObservedVPAs(ctx, vpaCRDs); err != nil {
+		// The errors of individual VPAs are joined, log them one by one.
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, vpaErr := range joined.Unwrap() {
+				klog.ErrorS(vpaErr, "Syncing VPA failed")
 			}
+		} else {
+			klog.ErrorS(err, "Syncing VPAs failed")
 		}
 	}
-	// Delete non-existent VPAs from the model.
-	for vpaID := range feeder.clusterState.VPAs() {
-		if _, exists := vpaKeys[vpaID]; !exists {
-			klog.V(3).InfoS("Deleting VPA", "vpa", klog.KRef(vpaID.Namespace, vpaID.VpaName))
-			if err := feeder.clusterState.DeleteVpa(vpaID); err != nil {
-				klog.ErrorS(err, "Deleting VPA failed", "vpa", klog.KRef(vpaID.Namespace, vpaID.VpaName))
+	for vpaID, conditions := range feeder.vpaConditions {
+		vpa, found := feeder.clusterState.VPAs()[vpaID]
+		if !found {
+			continue
+		}
+		for _, condition := range conditions {
+			if condition.delete {
+				delete(vpa.Conditions, condition.conditionType)
+			} else {
+				vpa.Conditions.Set(condition.conditionType, true, "", condition.message)
 			}
 		}
 	}
-	feeder.clusterState.SetObservedVPAs(vpaCRDs)
+}
+
+// fetchVpaSelector is the selector fetcher of the cluster state. It records the
+// conditions found while fetching the selector, to be applied by LoadVPAs once
+// the VPA is synced.
+func (feeder *clusterStateFeeder) fetchVpaSelector(ctx context.Context, vpaCRD *vpa_types.VerticalPodAutoscaler) labels.Selector {
+	selector, conditions := feeder.getSelector(ctx, vpaCRD)
+	klog.V(4).InfoS("Using selector", "selector", selector.String(), "vpa", klog.KObj(vpaCRD))
+	if feeder.vpaConditions != nil {
+		feeder.vpaConditions[model.VpaID{Namespace: vpaCRD.Namespace, VpaName: vpaCRD.Name}] = conditions
+	}
+	return selector
 }
 
 // LoadPods loads pod into the cluster state.
@@ -475,10 +479,20 @@ func (feeder *clusterStateFeeder) LoadPods() {
 		if feeder.memorySaveMode && !feeder.matchesVPA(pod) {
 			continue
 		}
-		feeder.clusterState.AddOrUpdatePod(pod.ID, pod.PodLabels, pod.Phase)
+		if err = feeder.clusterState.AddOrUpdatePod(pod.ID, pod.PodLabels, pod.Phase); err != nil {
+			klog.V(0).InfoS("Failed to add pod", "pod", klog.KRef(pod.ID.Namespace, pod.ID.PodName), "error", err)
+			continue
+		}
+		if err = feeder.clusterState.SetPodNodeName(pod.ID, pod.NodeName); err != nil {
+			klog.V(0).InfoS("Failed to set node of pod", "pod", klog.KRef(pod.ID.Namespace, pod.ID.PodName), "error", err)
+		}
 		for _, container := range pod.Containers {
-			if err = feeder.clusterState.AddOrUpdateContainer(container.ID, container.Request); err != nil {
+			if _, err = feeder.clusterState.AddOrUpdateContainer(container.ID, container.Request); err != nil {
 				klog.V(0).InfoS("Failed to add container", "container", container.ID, "error", err)
+				continue
+			}
+			if err = feeder.clusterState.SetContainerLimit(container.ID, container.Limit); err != nil {
+				klog.V(0).InfoS("Failed to set limits of container", "container", container.ID, "error", err)
 			}
 		}
 		for _, initContainer := range pod.InitContainers {
@@ -509,7 +523,12 @@ func (feeder *clusterStateFeeder) LoadRealTimeMetrics(ctx context.Context) {
 		for _, sample := range newContainerUsageSamplesWithKey(containerMetrics) {
 			if err := feeder.clusterState.AddSample(sample); err != nil {
 				// Not all pod states are tracked in memory saver mode.
-				if _, isKeyError := err.(model.KeyError); isKeyError && feeder.memorySaveMode {
+				if errors.As(err, &model.KeyError{}) && feeder.memorySaveMode {
+					continue
+				}
+				// Throttled samples are expected when a sample rate limit is set.
+				if errors.As(err, &model.SampleThrottledError{}) {
+					droppedSampleCount++
 					continue
 				}
 				klog.V(0).InfoS("Error adding metric sample", "sample", sample, "error", err)
@@ -520,18 +539,26 @@ func (feeder *clusterStateFeeder) LoadRealTimeMetrics(ctx context.Context) {
 		}
 	}
 	klog.V(3).InfoS("ClusterSpec fed with ContainerUsageSamples", "sampleCount", sampleCount, "containerCount", len(containersMetrics), "droppedSampleCount", droppedSampleCount)
+	var oomInfos []oom.OomInfo
 Loop:
 	for {
 		select {
 		case oomInfo := <-feeder.oomChan:
 			klog.V(3).InfoS("OOM detected", "oomInfo", oomInfo)
-			if err = feeder.clusterState.RecordOOM(oomInfo.ContainerID, oomInfo.Timestamp, oomInfo.Memory); err != nil {
-				klog.V(0).InfoS("Failed to record OOM", "oomInfo", oomInfo, "error", err)
-			}
+			oomInfos = append(oomInfos, oomInfo)
 		default:
 			break Loop
 		}
 	}
+	oomEvents := make([]model.OOMEvent, 0, len(oomInfos))
+	for _, oomInfo := range oomInfos {
+		oomEvents = append(oomEvents, model.OOMEvent{ContainerID: oomInfo.ContainerID, Timestamp: oomInfo.Timestamp, RequestedMemory: oomInfo.Memory})
+	}
+	for i, err := range feeder.clusterState.RecordOOMs(oomEvents) {
+		if err != nil {
+			klog.V(0).InfoS("Failed to record OOM", "oomInfo", oomInfos[i], "error", err)
+		}
+	}
 	metrics_recommender.RecordAggregateContainerStatesCount(feeder.clusterState.StateMapSize())
 }
 
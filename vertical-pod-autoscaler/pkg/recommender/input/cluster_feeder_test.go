@@ -44,15 +44,6 @@ import (
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
 )
 
-type fakeControllerFetcher struct {
-	key *controllerfetcher.ControllerKeyWithAPIVersion
-	err error
-}
-
-func (f *fakeControllerFetcher) FindTopMostWellKnownOrScalable(_ context.Context, _ *controllerfetcher.ControllerKeyWithAPIVersion) (*controllerfetcher.ControllerKeyWithAPIVersion, error) {
-	return f.key, f.err
-}
-
 func parseLabelSelector(selector string) labels.Selector {
 	labelSelector, _ := metav1.ParseToLabelSelector(selector)
 	parsedSelector, _ := metav1.LabelSelectorAsSelector(labelSelector)
@@ -105,8 +96,17 @@ func (cs *fakeClusterState) AddSample(sample *model.ContainerUsageSampleWithKey)
 	return nil
 }
 
-func (cs *fakeClusterState) AddOrUpdatePod(podID model.PodID, _ labels.Set, _ v1.PodPhase) {
+func (cs *fakeClusterState) AddOrUpdatePod(podID model.PodID, _ labels.Set, _ v1.PodPhase) error {
 	cs.addedPods = append(cs.addedPods, podID)
+	return nil
+}
+
+func (cs *fakeClusterState) RecordOOMs(events []model.OOMEvent) []error {
+	return make([]error, len(events))
+}
+
+func (cs *fakeClusterState) SetPodNodeName(_ model.PodID, _ string) error {
+	return nil
 }
 
 func (cs *fakeClusterState) Pods() map[model.PodID]*model.PodState {
@@ -347,15 +347,30 @@ func TestLoadVPAs(t *testing.T) {
 			targetSelectorFetcher := target_mock.NewMockVpaTargetSelectorFetcher(ctrl)
 			clusterState := model.NewClusterState(testGcPeriod)
 
+			controllerFetcher := test.NewFakeControllerFetcher()
+			if tc.targetRef != nil {
+				targetKey := controllerfetcher.ControllerKeyWithAPIVersion{
+					ControllerKey: controllerfetcher.ControllerKey{
+						Namespace: vpa.Namespace,
+						Kind:      tc.targetRef.Kind,
+						Name:      tc.targetRef.Name,
+					},
+					ApiVersion: tc.targetRef.APIVersion,
+				}
+				if tc.findTopMostWellKnownOrScalableError != nil {
+					controllerFetcher.WithControllerError(targetKey, tc.findTopMostWellKnownOrScalableError)
+				} else {
+					controllerFetcher.WithController(targetKey, tc.topMostWellKnownOrScalableKey)
+				}
+			}
+
 			clusterStateFeeder := clusterStateFeeder{
-				vpaLister:       vpaLister,
-				clusterState:    clusterState,
-				selectorFetcher: targetSelectorFetcher,
-				controllerFetcher: &fakeControllerFetcher{
-					key: tc.topMostWellKnownOrScalableKey,
-					err: tc.findTopMostWellKnownOrScalableError,
-				},
+				vpaLister:         vpaLister,
+				clusterState:      clusterState,
+				selectorFetcher:   targetSelectorFetcher,
+				controllerFetcher: controllerFetcher,
 			}
+			clusterState.SetVpaSelectorFetcher(clusterStateFeeder.fetchVpaSelector)
 			if tc.recommenderName == nil {
 				clusterStateFeeder.recommenderName = DefaultRecommenderName
 			} else {
@@ -403,6 +418,43 @@ func TestLoadVPAs(t *testing.T) {
 	}
 }
 
+// The selector fetcher is installed once and the conditions of each LoadVPAs
+// call are applied to the VPAs synced by that call.
+func TestLoadVPAsAppliesConditionsOfEachCall(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	vpa := test.VerticalPodAutoscaler().WithName("testVpa").WithContainer("container").WithNamespace("testNamespace").Get()
+	vpaID := model.VpaID{Namespace: vpa.Namespace, VpaName: vpa.Name}
+	vpaLister := &test.VerticalPodAutoscalerListerMock{}
+	vpaLister.On("List").Return([]*vpa_types.VerticalPodAutoscaler{vpa}, nil).Once()
+	vpaLister.On("List").Return([]*vpa_types.VerticalPodAutoscaler{}, nil).Once()
+	vpaLister.On("List").Return([]*vpa_types.VerticalPodAutoscaler{vpa}, nil).Once()
+
+	targetSelectorFetcher := target_mock.NewMockVpaTargetSelectorFetcher(ctrl)
+	targetSelectorFetcher.EXPECT().Fetch(vpa).Return(nil, fmt.Errorf("targetRef not defined")).Times(2)
+	clusterState := model.NewClusterState(testGcPeriod)
+	feeder := &clusterStateFeeder{
+		vpaLister:         vpaLister,
+		clusterState:      clusterState,
+		selectorFetcher:   targetSelectorFetcher,
+		controllerFetcher: test.NewFakeControllerFetcher(),
+		recommenderName:   DefaultRecommenderName,
+	}
+	clusterState.SetVpaSelectorFetcher(feeder.fetchVpaSelector)
+
+	feeder.LoadVPAs(context.Background())
+	assert.Contains(t, clusterState.VPAs()[vpaID].Conditions, vpa_types.ConfigUnsupported)
+
+	feeder.LoadVPAs(context.Background())
+	assert.NotContains(t, clusterState.VPAs(), vpaID)
+	assert.Empty(t, feeder.vpaConditions)
+
+	feeder.LoadVPAs(context.Background())
+	assert.Contains(t, clusterState.VPAs(), vpaID)
+	assert.Equal(t, unsupportedConditionTextFromFetcher, clusterState.VPAs()[vpaID].Conditions[vpa_types.ConfigUnsupported].Message)
+}
+
 type testSpecClient struct {
 	pods []*spec.BasicPodSpec
 }
@@ -37,6 +37,8 @@ type BasicPodSpec struct {
 	InitContainers []BasicContainerSpec
 	// PodPhase describing current life cycle phase of the Pod.
 	Phase v1.PodPhase
+	// Name of the node the pod is scheduled on, empty if it isn't scheduled.
+	NodeName string
 }
 
 // BasicContainerSpec contains basic information defining a container.
@@ -47,6 +49,9 @@ type BasicContainerSpec struct {
 	Image string
 	// Currently requested resources for this container.
 	Request model.Resources
+	// Current CPU and memory limits of this container. Resources without a
+	// limit are absent.
+	Limit model.Resources
 }
 
 // SpecClient provides information about pods and containers Specification
@@ -91,6 +96,7 @@ func newBasicPodSpec(pod *v1.Pod) *BasicPodSpec {
 		Containers:     containerSpecs,
 		InitContainers: initContainerSpecs,
 		Phase:          pod.Status.Phase,
+		NodeName:       pod.Spec.NodeName,
 	}
 	return basicPodSpec
 }
@@ -112,6 +118,7 @@ func newContainerSpec(pod *v1.Pod, container v1.Container, isInitContainer bool)
 		},
 		Image:   container.Image,
 		Request: calculateRequestedResources(pod, container, isInitContainer),
+		Limit:   calculateLimitResources(pod, container, isInitContainer),
 	}
 	return containerSpec
 }
@@ -129,11 +136,31 @@ func calculateRequestedResources(pod *v1.Pod, container v1.Container, isInitCont
 	memoryQuantity := requests[v1.ResourceMemory]
 	memoryBytes := memoryQuantity.Value()
 
-	return model.Resources{
+	resources := model.Resources{
 		model.ResourceCPU:    model.ResourceAmount(cpuMillicores),
 		model.ResourceMemory: model.ResourceAmount(memoryBytes),
 	}
+	if ephemeralStorageQuantity, found := requests[v1.ResourceEphemeralStorage]; found {
+		resources[model.ResourceEphemeralStorage] = model.ResourceAmount(ephemeralStorageQuantity.Value())
+	}
+	return resources
+}
 
+func calculateLimitResources(pod *v1.Pod, container v1.Container, isInitContainer bool) model.Resources {
+	requestsAndLimitsFn := resourcehelpers.ContainerRequestsAndLimits
+	if isInitContainer {
+		requestsAndLimitsFn = resourcehelpers.InitContainerRequestsAndLimits
+	}
+	_, limits := requestsAndLimitsFn(container.Name, pod)
+
+	resources := model.Resources{}
+	if cpuQuantity, found := limits[v1.ResourceCPU]; found {
+		resources[model.ResourceCPU] = model.ResourceAmount(cpuQuantity.MilliValue())
+	}
+	if memoryQuantity, found := limits[v1.ResourceMemory]; found {
+		resources[model.ResourceMemory] = model.ResourceAmount(memoryQuantity.Value())
+	}
+	return resources
 }
 
 func podID(pod *v1.Pod) model.PodID {
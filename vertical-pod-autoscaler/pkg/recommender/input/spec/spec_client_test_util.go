@@ -52,6 +52,9 @@ spec:
       requests:
         memory: "512Mi"
         cpu: "500m"
+      limits:
+        memory: "1024Mi"
+        cpu: "1000m"
   - name: Name12
     image: Name12Image
     resources:
@@ -147,6 +150,10 @@ func newSpecClientTestCase() *specClientTestCase {
 	podID2 := model.PodID{Namespace: "", PodName: "Pod2"}
 
 	containerSpec11 := newTestContainerSpec(podID1, "Name11", 500, 512*1024*1024)
+	containerSpec11.Limit = model.Resources{
+		model.ResourceCPU:    model.ResourceAmount(1000),
+		model.ResourceMemory: model.ResourceAmount(1024 * 1024 * 1024),
+	}
 	containerSpec12 := newTestContainerSpec(podID1, "Name12", 1000, 1024*1024*1024)
 	containerSpec21 := newTestContainerSpec(podID2, "Name21", 2000, 2048*1024*1024)
 	containerSpec22 := newTestContainerSpec(podID2, "Name22", 4000, 4096*1024*1024)
@@ -177,6 +184,7 @@ func newTestContainerSpec(podID model.PodID, containerName string, milicores int
 		ID:      containerID,
 		Image:   containerName + "Image",
 		Request: requestedResources,
+		Limit:   model.Resources{},
 	}
 }
 
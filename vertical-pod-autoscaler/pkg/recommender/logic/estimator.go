@@ -20,7 +20,12 @@ import (
 	"math"
 	"time"
 
+	"k8s.io/klog/v2"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/features"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/util"
 )
 
 // ResourceEstimator is a function from AggregateContainerState to
@@ -155,11 +160,40 @@ func WithMemoryConfidenceMultiplier(multiplier, exponent float64, baseEstimator
 }
 
 func (e *percentileCPUEstimator) GetCPUEstimation(s *model.AggregateContainerState) model.ResourceAmount {
-	return model.CPUAmountFromCores(s.AggregateCPUUsage.Percentile(e.percentile))
+	return model.CPUAmountFromCores(sampledValue(s.AggregateCPUUsage, model.GetAggregationsConfig().CPUHistogramOptions, s.GetSamplingStrategy(), e.percentile))
 }
 
 func (e *percentileMemoryEstimator) GetMemoryEstimation(s *model.AggregateContainerState) model.ResourceAmount {
-	return model.MemoryAmountFromBytes(s.AggregateMemoryPeaks.Percentile(e.percentile))
+	return model.MemoryAmountFromBytes(sampledValue(s.AggregateMemoryPeaks, model.GetAggregationsConfig().MemoryHistogramOptions, s.GetSamplingStrategy(), e.percentile))
+}
+
+// sampledValue returns the value of the histogram selected by the sampling
+// strategy: the given percentile, the maximum or the weighted average. With
+// the SmoothPercentile feature gate the percentile is interpolated within its
+// bucket.
+func sampledValue(h util.Histogram, options util.HistogramOptions, strategy vpa_types.SamplingStrategy, percentile float64) float64 {
+	switch strategy {
+	case vpa_types.SamplingStrategyRunningMaximum:
+		return h.Percentile(1.0)
+	case vpa_types.SamplingStrategyDecayWeightedAverage:
+		average, err := util.Average(h, options)
+		if err != nil {
+			klog.V(4).InfoS("Failed to compute the average of the histogram, falling back to percentile", "error", err)
+			return percentileValue(h, percentile)
+		}
+		return average
+	default:
+		return percentileValue(h, percentile)
+	}
+}
+
+// percentileValue returns the given percentile of the histogram, interpolated
+// if the SmoothPercentile feature gate is enabled.
+func percentileValue(h util.Histogram, percentile float64) float64 {
+	if features.Enabled(features.SmoothPercentile) {
+		return h.InterpolatedPercentile(percentile)
+	}
+	return h.Percentile(percentile)
 }
 
 // Returns resources computed by the underlying estimators, scaled based on the
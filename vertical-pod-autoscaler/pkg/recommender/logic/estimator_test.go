@@ -21,7 +21,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
 
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/features"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/util"
 )
@@ -62,6 +65,81 @@ func TestPercentileEstimator(t *testing.T) {
 	assert.InEpsilon(t, 2e9, model.BytesFromMemoryAmount(resourceEstimation[model.ResourceMemory]), maxRelativeError)
 }
 
+// Verifies that with the SmoothPercentile feature gate the PercentileEstimator
+// returns percentiles interpolated within their buckets.
+func TestPercentileEstimatorSmoothPercentile(t *testing.T) {
+	config := model.GetAggregationsConfig()
+	cpuHistogram := util.NewHistogram(config.CPUHistogramOptions)
+	cpuHistogram.AddSample(1.0, 1.0, anyTime)
+	cpuHistogram.AddSample(2.0, 1.0, anyTime)
+	state := &model.AggregateContainerState{
+		AggregateCPUUsage:    cpuHistogram,
+		AggregateMemoryPeaks: util.NewHistogram(config.MemoryHistogramOptions),
+	}
+	cpuEstimator := NewPercentileCPUEstimator(0.9)
+
+	assert.Equal(t, model.CPUAmountFromCores(cpuHistogram.Percentile(0.9)), cpuEstimator.GetCPUEstimation(state))
+	featuregatetesting.SetFeatureGateDuringTest(t, features.MutableFeatureGate, features.SmoothPercentile, true)
+	assert.Equal(t, model.CPUAmountFromCores(cpuHistogram.InterpolatedPercentile(0.9)), cpuEstimator.GetCPUEstimation(state))
+	assert.Less(t, cpuHistogram.InterpolatedPercentile(0.9), cpuHistogram.Percentile(0.9))
+}
+
+// Verifies that the PercentileEstimator uses the value of the distributions
+// selected by the sampling strategy of the aggregation.
+func TestPercentileEstimatorSamplingStrategy(t *testing.T) {
+	config := model.GetAggregationsConfig()
+	cpuHistogram := util.NewHistogram(config.CPUHistogramOptions)
+	memoryPeaksHistogram := util.NewHistogram(config.MemoryHistogramOptions)
+	for i := 1; i <= 3; i++ {
+		cpuHistogram.AddSample(float64(i), 1.0, anyTime)
+		memoryPeaksHistogram.AddSample(float64(i)*1e9, 1.0, anyTime)
+	}
+	estimator := NewCombinedEstimator(NewPercentileCPUEstimator(0.2), NewPercentileMemoryEstimator(0.2))
+	percentile := vpa_types.SamplingStrategyHistogramPercentile
+	runningMaximum := vpa_types.SamplingStrategyRunningMaximum
+	decayWeightedAverage := vpa_types.SamplingStrategyDecayWeightedAverage
+	testCases := []struct {
+		name           string
+		strategy       *vpa_types.SamplingStrategy
+		expectedCPU    float64
+		expectedMemory float64
+	}{
+		{
+			name:           "default",
+			expectedCPU:    1.0,
+			expectedMemory: 1e9,
+		}, {
+			name:           "histogram percentile",
+			strategy:       &percentile,
+			expectedCPU:    1.0,
+			expectedMemory: 1e9,
+		}, {
+			name:           "running maximum",
+			strategy:       &runningMaximum,
+			expectedCPU:    3.0,
+			expectedMemory: 3e9,
+		}, {
+			name:           "decay weighted average",
+			strategy:       &decayWeightedAverage,
+			expectedCPU:    2.0,
+			expectedMemory: 2e9,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resourceEstimation := estimator.GetResourceEstimation(
+				&model.AggregateContainerState{
+					AggregateCPUUsage:    cpuHistogram,
+					AggregateMemoryPeaks: memoryPeaksHistogram,
+					SamplingStrategy:     tc.strategy,
+				})
+			maxRelativeError := 0.05 // Allow 5% relative error to account for histogram rounding.
+			assert.InEpsilon(t, tc.expectedCPU, model.CoresFromCPUAmount(resourceEstimation[model.ResourceCPU]), maxRelativeError)
+			assert.InEpsilon(t, tc.expectedMemory, model.BytesFromMemoryAmount(resourceEstimation[model.ResourceMemory]), maxRelativeError)
+		})
+	}
+}
+
 // Verifies that the confidenceMultiplier calculates the internal
 // confidence based on the amount of historical samples and scales the resources
 // returned by the base estimator according to the formula, using the calculated
@@ -77,7 +155,7 @@ func TestConfidenceMultiplier(t *testing.T) {
 	testedMemory2 := WithMemoryConfidenceMultiplier(1.0, -1.0, baseMemoryEstimator, defaultConfidenceInterval)
 	testedEstimator2 := NewCombinedEstimator(testedCPU2, testedMemory2)
 
-	s := model.NewAggregateContainerState()
+	s := model.NewAggregateContainerState(model.DecayingHistogramType)
 	// Expect testedEstimator1 to return the maximum possible resource amount.
 	assert.Equal(t, model.ResourceAmount(1e14),
 		testedEstimator1.GetResourceEstimation(s)[model.ResourceCPU])
@@ -117,7 +195,7 @@ func TestConfidenceMultiplierWithCustomInterval(t *testing.T) {
 	baseCPUEstimator := NewConstCPUEstimator(model.CPUAmountFromCores(3.14))
 	baseMemoryEstimator := NewConstMemoryEstimator(model.MemoryAmountFromBytes(3.14e9))
 
-	s := model.NewAggregateContainerState()
+	s := model.NewAggregateContainerState(model.DecayingHistogramType)
 
 	timestamp := anyTime
 	testedCPU4 := WithCPUConfidenceMultiplier(0.1, 2.0, baseCPUEstimator, customConfidenceInterval)
@@ -153,7 +231,7 @@ func TestConfidenceMultiplierNoHistory(t *testing.T) {
 	testedCPU := WithCPUConfidenceMultiplier(0.1, 2.0, baseCPUEstimator, defaultConfidenceInterval)
 	testedMemory := WithMemoryConfidenceMultiplier(0.1, 2.0, baseMemoryEstimator, defaultConfidenceInterval)
 	testedEstimator := NewCombinedEstimator(testedCPU, testedMemory)
-	s := model.NewAggregateContainerState()
+	s := model.NewAggregateContainerState(model.DecayingHistogramType)
 	// Expect testedEstimator to return the maximum possible resource amount.
 	assert.Equal(t, model.ResourceAmount(1e14),
 		testedEstimator.GetResourceEstimation(s)[model.ResourceCPU])
@@ -170,7 +248,7 @@ func TestMarginEstimator(t *testing.T) {
 	testedCPU := WithCPUMargin(marginFraction, baseCPUEstimator)
 	testedMemory := WithMemoryMargin(marginFraction, baseMemoryEstimator)
 	testedEstimator := NewCombinedEstimator(testedCPU, testedMemory)
-	s := model.NewAggregateContainerState()
+	s := model.NewAggregateContainerState(model.DecayingHistogramType)
 	resourceEstimation := testedEstimator.GetResourceEstimation(s)
 	assert.Equal(t, 3.14*1.1, model.CoresFromCPUAmount(resourceEstimation[model.ResourceCPU]))
 	assert.Equal(t, 3.14e9*1.1, model.BytesFromMemoryAmount(resourceEstimation[model.ResourceMemory]))
@@ -181,7 +259,7 @@ func TestMinResourcesEstimator(t *testing.T) {
 	constCPUEstimator := NewConstCPUEstimator(model.CPUAmountFromCores(3.14))
 	minCPU := model.CPUAmountFromCores(0.2)
 	cpuEstimator := WithCPUMinResource(minCPU, constCPUEstimator)
-	s := model.NewAggregateContainerState()
+	s := model.NewAggregateContainerState(model.DecayingHistogramType)
 	cpuEstimation := cpuEstimator.GetCPUEstimation(s)
 	assert.Equal(t, 3.14, model.CoresFromCPUAmount(cpuEstimation))
 
@@ -101,6 +101,11 @@ func (r *podResourceRecommender) estimateContainerResources(s *model.AggregateCo
 	target := model.Resources{model.ResourceCPU: r.targetCPU.GetCPUEstimation(s), model.ResourceMemory: r.targetMemory.GetMemoryEstimation(s)}
 	lowerBound := model.Resources{model.ResourceCPU: r.lowerBoundCPU.GetCPUEstimation(s), model.ResourceMemory: r.lowerBoundMemory.GetMemoryEstimation(s)}
 	upperBound := model.Resources{model.ResourceCPU: r.upperBoundCPU.GetCPUEstimation(s), model.ResourceMemory: r.upperBoundMemory.GetMemoryEstimation(s)}
+	if s.AggregateEphemeralStorageUsage != nil && !s.AggregateEphemeralStorageUsage.IsEmpty() {
+		target[model.ResourceEphemeralStorage] = estimateEphemeralStorage(s, *targetMemoryPercentile)
+		lowerBound[model.ResourceEphemeralStorage] = estimateEphemeralStorage(s, *lowerBoundMemoryPercentile)
+		upperBound[model.ResourceEphemeralStorage] = estimateEphemeralStorage(s, *upperBoundMemoryPercentile)
+	}
 	return RecommendedContainerResources{
 		FilterControlledResources(target, resources),
 		FilterControlledResources(lowerBound, resources),
@@ -108,6 +113,14 @@ func (r *podResourceRecommender) estimateContainerResources(s *model.AggregateCo
 	}
 }
 
+// estimateEphemeralStorage returns the given percentile of the ephemeral
+// storage usage of the aggregation, increased by the safety margin. It uses the
+// memory percentiles, as there are no separate flags for ephemeral storage.
+func estimateEphemeralStorage(s *model.AggregateContainerState, percentile float64) model.ResourceAmount {
+	usage := percentileValue(s.AggregateEphemeralStorageUsage, percentile)
+	return model.MemoryAmountFromBytes(usage * (1 + *safetyMarginFraction))
+}
+
 // FilterControlledResources returns estimations from 'estimation' only for resources present in 'controlledResources'.
 func FilterControlledResources(estimation model.Resources, controlledResources []model.ResourceName) model.Resources {
 	result := make(model.Resources)
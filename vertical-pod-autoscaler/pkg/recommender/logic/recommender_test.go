@@ -17,7 +17,10 @@ limitations under the License.
 package logic
 
 import (
+	"maps"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -129,6 +132,46 @@ func TestControlledResourcesFilteredDefault(t *testing.T) {
 	assert.Contains(t, recommendedResources[containerName].UpperBound, model.ResourceCPU)
 }
 
+func TestControlledResourcesEphemeralStorage(t *testing.T) {
+	constCPUEstimator := NewConstCPUEstimator(model.CPUAmountFromCores(0.001))
+	constMemoryEstimator := NewConstMemoryEstimator(model.MemoryAmountFromBytes(1e6))
+
+	recommender := podResourceRecommender{
+		targetCPU:        constCPUEstimator,
+		targetMemory:     constMemoryEstimator,
+		lowerBoundCPU:    constCPUEstimator,
+		lowerBoundMemory: constMemoryEstimator,
+		upperBoundCPU:    constCPUEstimator,
+		upperBoundMemory: constMemoryEstimator,
+	}
+	newState := func(controlledResources *[]model.ResourceName) *model.AggregateContainerState {
+		state := model.NewAggregateContainerState(model.DecayingHistogramType)
+		state.ControlledResources = controlledResources
+		state.AddSample(&model.ContainerUsageSample{
+			MeasureStart: time.Unix(0, 0), Usage: model.MemoryAmountFromBytes(1e9), Resource: model.ResourceEphemeralStorage})
+		return state
+	}
+
+	containerNameToAggregateStateMap := model.ContainerNameToAggregateStateMap{
+		"default":    newState(nil),
+		"controlled": newState(&[]model.ResourceName{model.ResourceCPU, model.ResourceMemory, model.ResourceEphemeralStorage}),
+	}
+
+	recommendedResources := recommender.GetRecommendedPodResources(containerNameToAggregateStateMap)
+	// Without ephemeral storage in the controlled resources the
+	// recommendation is unchanged.
+	assert.Equal(t, []model.ResourceName{model.ResourceCPU, model.ResourceMemory}, slices.Sorted(maps.Keys(recommendedResources["default"].Target)))
+	assert.NotContains(t, recommendedResources["default"].LowerBound, model.ResourceEphemeralStorage)
+	assert.NotContains(t, recommendedResources["default"].UpperBound, model.ResourceEphemeralStorage)
+	for _, resources := range []model.Resources{
+		recommendedResources["controlled"].Target, recommendedResources["controlled"].LowerBound, recommendedResources["controlled"].UpperBound,
+	} {
+		assert.Greater(t, resources[model.ResourceEphemeralStorage], model.MemoryAmountFromBytes(1e9))
+		assert.Contains(t, resources, model.ResourceCPU)
+		assert.Contains(t, resources, model.ResourceMemory)
+	}
+}
+
 func TestMapToListOfRecommendedContainerResources(t *testing.T) {
 	cases := []struct {
 		name         string
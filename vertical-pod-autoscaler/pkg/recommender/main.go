@@ -21,7 +21,10 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -60,13 +63,16 @@ import (
 )
 
 var (
-	recommenderName        = flag.String("recommender-name", input.DefaultRecommenderName, "Set the recommender name. Recommender will generate recommendations for VPAs that configure the same recommender name. If the recommender name is left as default it will also generate recommendations that don't explicitly specify recommender. You shouldn't run two recommenders with the same name in a cluster.")
-	metricsFetcherInterval = flag.Duration("recommender-interval", 1*time.Minute, `How often metrics should be fetched`)
-	checkpointsGCInterval  = flag.Duration("checkpoints-gc-interval", 10*time.Minute, `How often orphaned checkpoints should be garbage collected`)
-	address                = flag.String("address", ":8942", "The address to expose Prometheus metrics.")
-	storage                = flag.String("storage", "", `Specifies storage mode. Supported values: prometheus, checkpoint (default)`)
-	memorySaver            = flag.Bool("memory-saver", false, `If true, only track pods which have an associated VPA`)
-	updateWorkerCount      = flag.Int("update-worker-count", 10, "Number of concurrent workers to update VPA recommendations and checkpoints. When increasing this setting, make sure the client-side rate limits (`kube-api-qps` and `kube-api-burst`) are either increased or turned off as well. Determines the minimum number of VPA checkpoints written per recommender loop.")
+	recommenderName              = flag.String("recommender-name", input.DefaultRecommenderName, "Set the recommender name. Recommender will generate recommendations for VPAs that configure the same recommender name. If the recommender name is left as default it will also generate recommendations that don't explicitly specify recommender. You shouldn't run two recommenders with the same name in a cluster.")
+	metricsFetcherInterval       = flag.Duration("recommender-interval", 1*time.Minute, `How often metrics should be fetched`)
+	checkpointsGCInterval        = flag.Duration("checkpoints-gc-interval", 10*time.Minute, `How often orphaned checkpoints should be garbage collected`)
+	address                      = flag.String("address", ":8942", "The address to expose Prometheus metrics.")
+	storage                      = flag.String("storage", "", `Specifies storage mode. Supported values: prometheus, checkpoint (default)`)
+	memorySaver                  = flag.Bool("memory-saver", false, `If true, only track pods which have an associated VPA`)
+	aggregationMemoryGCThreshold = flag.Int64("aggregation-memory-gc-threshold", 0, `Estimated size in bytes of the aggregate container state histograms above which they are garbage collected regardless of the GC interval. 0 disables the threshold`)
+	memoryPressureThreshold      = flag.Int64("memory-pressure-threshold", 0, `Estimated size in bytes of the aggregate container state histograms above which they are garbage collected regardless of the GC interval, expiring them twice as fast as usual. 0 disables the threshold`)
+	gracefulShutdownTimeout      = flag.Duration("graceful-shutdown-timeout", 30*time.Second, `How long to wait for in-flight updates of the cluster state and the final checkpoint after receiving SIGTERM`)
+	updateWorkerCount            = flag.Int("update-worker-count", 10, "Number of concurrent workers to update VPA recommendations and checkpoints. When increasing this setting, make sure the client-side rate limits (`kube-api-qps` and `kube-api-burst`) are either increased or turned off as well. Determines the minimum number of VPA checkpoints written per recommender loop.")
 )
 
 // Prometheus history provider flags
@@ -105,6 +111,8 @@ var (
 	cpuHistogramDecayHalfLife      = flag.Duration("cpu-histogram-decay-half-life", model.DefaultCPUHistogramDecayHalfLife, `The amount of time it takes a historical CPU usage sample to lose half of its weight.`)
 	oomBumpUpRatio                 = flag.Float64("oom-bump-up-ratio", model.DefaultOOMBumpUpRatio, `The memory bump up ratio when OOM occurred, default is 1.2.`)
 	oomMinBumpUp                   = flag.Float64("oom-min-bump-up-bytes", model.DefaultOOMMinBumpUp, `The minimal increase of memory when OOM occurred in bytes, default is 100 * 1024 * 1024`)
+	histogramType                  = flag.String("histogram-type", string(model.DefaultHistogramType), `The implementation of the usage histograms. Supported values: decaying, bounded. Bounded histograms don't decay and keep at most bounded-histogram-max-buckets buckets`)
+	boundedHistogramMaxBuckets     = flag.Int("bounded-histogram-max-buckets", model.DefaultBoundedHistogramMaxBuckets, `The maximum number of buckets kept by a single usage histogram when histogram-type is bounded`)
 )
 
 // Post processors flags
@@ -157,6 +165,16 @@ func main() {
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
+	if ht := model.HistogramType(*histogramType); ht != model.DecayingHistogramType && ht != model.BoundedHistogramType {
+		klog.ErrorS(nil, "--histogram-type must be one of: decaying, bounded.", "histogramType", *histogramType)
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
+	if *boundedHistogramMaxBuckets <= 0 {
+		klog.ErrorS(nil, "--bounded-histogram-max-buckets must be positive.", "boundedHistogramMaxBuckets", *boundedHistogramMaxBuckets)
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
 	if *prometheusBearerTokenFile != "" {
 		fileContent, err := os.ReadFile(*prometheusBearerTokenFile)
 		if err != nil {
@@ -246,6 +264,8 @@ func run(ctx context.Context, healthCheck *metrics.HealthCheck, commonFlag *comm
 	config := common.CreateKubeConfigOrDie(commonFlag.KubeConfig, float32(commonFlag.KubeApiQps), int(commonFlag.KubeApiBurst))
 	kubeClient := kube_client.NewForConfigOrDie(config)
 	clusterState := model.NewClusterState(aggregateContainerStateGCInterval)
+	clusterState.SetAggregationMemoryGCThreshold(*aggregationMemoryGCThreshold)
+	clusterState.SetMemoryPressureThreshold(*memoryPressureThreshold)
 	factory := informers.NewSharedInformerFactoryWithOptions(kubeClient, defaultResyncPeriod, informers.WithNamespace(commonFlag.VpaObjectNamespace))
 	controllerFetcher := controllerfetcher.NewControllerFetcher(config, kubeClient, factory, scaleCacheEntryFreshnessTime, scaleCacheEntryLifetime, scaleCacheEntryJitterFactor)
 	podLister, oomObserver := input.NewPodListerAndOOMObserver(ctx, kubeClient, commonFlag.VpaObjectNamespace, stopCh)
@@ -259,7 +279,10 @@ func run(ctx context.Context, healthCheck *metrics.HealthCheck, commonFlag *comm
 		}
 	}
 
-	model.InitializeAggregationsConfig(model.NewAggregationsConfig(*memoryAggregationInterval, *memoryAggregationIntervalCount, *memoryHistogramDecayHalfLife, *cpuHistogramDecayHalfLife, *oomBumpUpRatio, *oomMinBumpUp))
+	aggregationsConfig := model.NewAggregationsConfig(*memoryAggregationInterval, *memoryAggregationIntervalCount, *memoryHistogramDecayHalfLife, *cpuHistogramDecayHalfLife, *oomBumpUpRatio, *oomMinBumpUp)
+	aggregationsConfig.HistogramType = model.HistogramType(*histogramType)
+	aggregationsConfig.BoundedHistogramMaxBuckets = *boundedHistogramMaxBuckets
+	model.InitializeAggregationsConfig(aggregationsConfig)
 
 	useCheckpoints := *storage != "prometheus"
 
@@ -307,11 +330,19 @@ func run(ctx context.Context, healthCheck *metrics.HealthCheck, commonFlag *comm
 	}.Make()
 	controllerFetcher.Start(ctx, scaleCacheLoopPeriod)
 
+	checkpointWriter := checkpoint.NewCheckpointWriter(clusterState, vpa_clientset.NewForConfigOrDie(config).AutoscalingV1())
+	if useCheckpoints {
+		clusterState.SetShutdownCheckpointer(func(ctx context.Context) error {
+			checkpointWriter.StoreCheckpoints(ctx, *updateWorkerCount)
+			return nil
+		})
+	}
+
 	recommender := routines.RecommenderFactory{
 		ClusterState:                 clusterState,
 		ClusterStateFeeder:           clusterStateFeeder,
 		ControllerFetcher:            controllerFetcher,
-		CheckpointWriter:             checkpoint.NewCheckpointWriter(clusterState, vpa_clientset.NewForConfigOrDie(config).AutoscalingV1()),
+		CheckpointWriter:             checkpointWriter,
 		VpaClient:                    vpa_clientset.NewForConfigOrDie(config).AutoscalingV1(),
 		PodResourceRecommender:       logic.CreatePodResourceRecommender(),
 		RecommendationPostProcessors: postProcessors,
@@ -358,13 +389,33 @@ func run(ctx context.Context, healthCheck *metrics.HealthCheck, commonFlag *comm
 		recommender.GetClusterStateFeeder().InitFromHistoryProvider(provider)
 	}
 
-	// Start updating health check endpoint.
+	// Start updating health check endpoint. The cluster state isn't safe for
+	// concurrent use, so its health is checked after each iteration.
+	var clusterStateHealth atomic.Value
+	clusterStateHealth.Store(model.HealthStatus{})
+	healthCheck.AddCheck(func() error {
+		return clusterStateHealth.Load().(model.HealthStatus).Err()
+	})
 	healthCheck.StartMonitoring()
 
+	sigTermCh := make(chan os.Signal, 1)
+	signal.Notify(sigTermCh, syscall.SIGTERM)
 	ticker := time.Tick(*metricsFetcherInterval)
-	for range ticker {
-		recommender.RunOnce()
-		healthCheck.UpdateLastActivity()
+	for {
+		select {
+		case <-ticker:
+			recommender.RunOnce()
+			healthCheck.UpdateLastActivity()
+			clusterStateHealth.Store(clusterState.HealthCheck())
+		case <-sigTermCh:
+			klog.InfoS("Received SIGTERM, shutting down")
+			shutdownCtx, cancel := context.WithTimeout(ctx, *gracefulShutdownTimeout)
+			if err := clusterState.GracefulShutdown(shutdownCtx); err != nil {
+				klog.ErrorS(err, "Failed to shut down the cluster state gracefully")
+			}
+			cancel()
+			return
+		}
 	}
 }
 
@@ -37,6 +37,7 @@ package model
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -56,6 +57,27 @@ const (
 	// version of the recommender binary can't initialize from the old checkpoint format or the
 	// previous version of the recommender binary can't initialize from the new checkpoint format.
 	SupportedCheckpointVersion = "v3"
+	// confidenceReferenceSamples and confidenceReferenceLifespan are the
+	// sample count and the history length at which the corresponding factors
+	// of RecommendationConfidence reach 1-1/e.
+	confidenceReferenceSamples  = 24 * 60
+	confidenceReferenceLifespan = 24 * time.Hour
+	// HighConfidenceThreshold is the RecommendationConfidence above which the
+	// HighConfidence condition of the VPA is set.
+	HighConfidenceThreshold = 0.9
+)
+
+// HistogramType selects the implementation of the histograms used by
+// AggregateContainerState.
+type HistogramType string
+
+const (
+	// DecayingHistogramType uses decaying histograms, which give newer samples
+	// a higher weight than the old samples.
+	DecayingHistogramType HistogramType = "decaying"
+	// BoundedHistogramType uses histograms which cap the number of buckets kept
+	// in memory by merging adjacent buckets. Samples do not decay.
+	BoundedHistogramType HistogramType = "bounded"
 )
 
 var (
@@ -110,6 +132,25 @@ type AggregateContainerState struct {
 	UpdateMode          *vpa_types.UpdateMode
 	ScalingMode         *vpa_types.ContainerScalingMode
 	ControlledResources *[]ResourceName
+	SamplingStrategy    *vpa_types.SamplingStrategy
+
+	// startupCPUUsage and startupMemoryUsage are distributions of the
+	// samples taken during the startup of the containers, which are not
+	// part of the histograms above. They are nil until the first startup
+	// sample is added.
+	startupCPUUsage    util.Histogram
+	startupMemoryUsage util.Histogram
+
+	// AggregateEphemeralStorageUsage is a distribution of all ephemeral
+	// storage samples. It is nil until the first ephemeral storage sample is
+	// added.
+	AggregateEphemeralStorageUsage util.Histogram
+
+	// Ring buffer with the times of the most recent OOM events and the total
+	// number of OOM events recorded. The next OOM is stored at
+	// oomTimes[oomCount%OOMHistorySize].
+	oomTimes [OOMHistorySize]time.Time
+	oomCount int
 }
 
 // GetLastRecommendation returns last recorded recommendation.
@@ -143,6 +184,15 @@ func (a *AggregateContainerState) GetControlledResources() []ResourceName {
 	return DefaultControlledResources
 }
 
+// GetSamplingStrategy returns the strategy used to compute recommendations
+// from the samples of this aggregator. Returns default if not set.
+func (a *AggregateContainerState) GetSamplingStrategy() vpa_types.SamplingStrategy {
+	if a.SamplingStrategy != nil {
+		return *a.SamplingStrategy
+	}
+	return vpa_types.SamplingStrategyHistogramPercentile
+}
+
 // MarkNotAutoscaled registers that this container state is not controlled by
 // a VPA object.
 func (a *AggregateContainerState) MarkNotAutoscaled() {
@@ -151,12 +201,19 @@ func (a *AggregateContainerState) MarkNotAutoscaled() {
 	a.UpdateMode = nil
 	a.ScalingMode = nil
 	a.ControlledResources = nil
+	a.SamplingStrategy = nil
 }
 
 // MergeContainerState merges two AggregateContainerStates.
 func (a *AggregateContainerState) MergeContainerState(other *AggregateContainerState) {
 	a.AggregateCPUUsage.Merge(other.AggregateCPUUsage)
 	a.AggregateMemoryPeaks.Merge(other.AggregateMemoryPeaks)
+	if other.AggregateEphemeralStorageUsage != nil {
+		if a.AggregateEphemeralStorageUsage == nil {
+			a.AggregateEphemeralStorageUsage = newEphemeralStorageHistogram()
+		}
+		a.AggregateEphemeralStorageUsage.Merge(other.AggregateEphemeralStorageUsage)
+	}
 
 	if a.FirstSampleStart.IsZero() ||
 		(!other.FirstSampleStart.IsZero() && other.FirstSampleStart.Before(a.FirstSampleStart)) {
@@ -168,14 +225,23 @@ func (a *AggregateContainerState) MergeContainerState(other *AggregateContainerS
 	a.TotalSamplesCount += other.TotalSamplesCount
 }
 
-// NewAggregateContainerState returns a new, empty AggregateContainerState.
-func NewAggregateContainerState() *AggregateContainerState {
+// NewAggregateContainerState returns a new, empty AggregateContainerState
+// using histograms of the given type. Unknown types fall back to
+// DecayingHistogramType.
+func NewAggregateContainerState(histType HistogramType) *AggregateContainerState {
 	config := GetAggregationsConfig()
-	return &AggregateContainerState{
-		AggregateCPUUsage:    util.NewDecayingHistogram(config.CPUHistogramOptions, config.CPUHistogramDecayHalfLife),
-		AggregateMemoryPeaks: util.NewDecayingHistogram(config.MemoryHistogramOptions, config.MemoryHistogramDecayHalfLife),
-		CreationTime:         time.Now(),
+	state := &AggregateContainerState{
+		CreationTime: time.Now(),
+	}
+	switch histType {
+	case BoundedHistogramType:
+		state.AggregateCPUUsage = util.NewBoundedHistogram(config.CPUHistogramOptions, config.BoundedHistogramMaxBuckets)
+		state.AggregateMemoryPeaks = util.NewBoundedHistogram(config.MemoryHistogramOptions, config.BoundedHistogramMaxBuckets)
+	default:
+		state.AggregateCPUUsage = util.NewDecayingHistogram(config.CPUHistogramOptions, config.CPUHistogramDecayHalfLife)
+		state.AggregateMemoryPeaks = util.NewDecayingHistogram(config.MemoryHistogramOptions, config.MemoryHistogramDecayHalfLife)
 	}
+	return state
 }
 
 // AddSample aggregates a single usage sample.
@@ -185,11 +251,33 @@ func (a *AggregateContainerState) AddSample(sample *ContainerUsageSample) {
 		a.addCPUSample(sample)
 	case ResourceMemory:
 		a.AggregateMemoryPeaks.AddSample(BytesFromMemoryAmount(sample.Usage), 1.0, sample.MeasureStart)
+	case ResourceEphemeralStorage:
+		if a.AggregateEphemeralStorageUsage == nil {
+			a.AggregateEphemeralStorageUsage = newEphemeralStorageHistogram()
+		}
+		a.AggregateEphemeralStorageUsage.AddSample(BytesFromMemoryAmount(sample.Usage), 1.0, sample.MeasureStart)
 	default:
 		panic(fmt.Sprintf("AddSample doesn't support resource '%s'", sample.Resource))
 	}
 }
 
+// newEphemeralStorageHistogram returns an empty histogram for ephemeral
+// storage samples, which are measured in bytes like memory.
+func newEphemeralStorageHistogram() util.Histogram {
+	return NewAggregateContainerState(GetAggregationsConfig().HistogramType).AggregateMemoryPeaks
+}
+
+// LastSampleTime returns the start of the latest sample added to the
+// aggregation, or the zero time if there are no samples. Like the other
+// sample timestamps it is based only on CPU samples, as memory peaks are
+// added with the end of their aggregation interval.
+func (a *AggregateContainerState) LastSampleTime() time.Time {
+	if a.isEmpty() {
+		return time.Time{}
+	}
+	return a.LastSampleStart
+}
+
 // SubtractSample removes a single usage sample from an aggregation.
 // The subtracted sample should be equal to some sample that was aggregated with
 // AddSample() in the past.
@@ -217,6 +305,46 @@ func (a *AggregateContainerState) addCPUSample(sample *ContainerUsageSample) {
 	a.TotalSamplesCount++
 }
 
+// TrimSamplesBefore removes the samples of the aggregation if all of them
+// started before the given time and returns the number of removed samples.
+// The histograms don't keep the times of individual samples, so aggregations
+// with any sample started at or after the given time are left intact. When
+// the samples are removed, all histograms are reset, including the ephemeral
+// storage and startup ones, and only the OOM events at or after the given
+// time are kept.
+func (a *AggregateContainerState) TrimSamplesBefore(t time.Time) int {
+	if a.isEmpty() || !a.LastSampleTime().Before(t) {
+		return 0
+	}
+	removed := a.TotalSamplesCount
+	empty := NewAggregateContainerState(GetAggregationsConfig().HistogramType)
+	a.AggregateCPUUsage = empty.AggregateCPUUsage
+	a.AggregateMemoryPeaks = empty.AggregateMemoryPeaks
+	a.AggregateEphemeralStorageUsage = nil
+	a.startupCPUUsage = nil
+	a.startupMemoryUsage = nil
+	a.trimOOMsBefore(t)
+	a.FirstSampleStart = time.Time{}
+	a.LastSampleStart = time.Time{}
+	a.TotalSamplesCount = 0
+	return removed
+}
+
+// trimOOMsBefore removes the kept OOM events which happened before the given
+// time. The OOM count is reduced to the number of the remaining events.
+func (a *AggregateContainerState) trimOOMsBefore(t time.Time) {
+	var kept [OOMHistorySize]time.Time
+	keptCount := 0
+	for i := 0; i < a.oomCount && i < OOMHistorySize; i++ {
+		if !a.oomTimes[i].Before(t) {
+			kept[keptCount] = a.oomTimes[i]
+			keptCount++
+		}
+	}
+	a.oomTimes = kept
+	a.oomCount = keptCount
+}
+
 // SaveToCheckpoint serializes AggregateContainerState as VerticalPodAutoscalerCheckpointStatus.
 // The serialization may result in loss of precission of the histograms.
 func (a *AggregateContainerState) SaveToCheckpoint() (*vpa_types.VerticalPodAutoscalerCheckpointStatus, error) {
@@ -259,19 +387,60 @@ func (a *AggregateContainerState) LoadFromCheckpoint(checkpoint *vpa_types.Verti
 	return nil
 }
 
+// RecommendationConfidence returns a score in [0, 1] describing how reliable
+// a recommendation based on the aggregated samples is. It is the geometric
+// mean of three factors, each approaching 1:
+//   - the number of samples, compared to one day of samples taken every minute,
+//   - the time between the first and the last sample, compared to one day,
+//   - the density of the samples over that time, compared to one per minute.
+func (a *AggregateContainerState) RecommendationConfidence() float64 {
+	if a.TotalSamplesCount <= 0 {
+		return 0
+	}
+	samples := float64(a.TotalSamplesCount)
+	lifespan := a.LastSampleStart.Sub(a.FirstSampleStart)
+	countFactor := 1 - math.Exp(-samples/confidenceReferenceSamples)
+	lifespanFactor := 1 - math.Exp(-float64(lifespan)/float64(confidenceReferenceLifespan))
+	densityFactor := math.Min(1, samples/(lifespan.Minutes()+1))
+	return math.Cbrt(countFactor * lifespanFactor * densityFactor)
+}
+
+// bytesPerHistogramBucket is the size of the weight of a single histogram
+// bucket.
+const bytesPerHistogramBucket = 8
+
+// estimatedHistogramMemoryBytes returns the estimated size of the buckets kept
+// by all histograms of the aggregation.
+func (a *AggregateContainerState) estimatedHistogramMemoryBytes() int64 {
+	buckets := 0
+	for _, histogram := range []util.Histogram{a.AggregateCPUUsage, a.AggregateMemoryPeaks,
+		a.AggregateEphemeralStorageUsage, a.startupCPUUsage, a.startupMemoryUsage} {
+		if histogram != nil {
+			buckets += histogram.BucketCount()
+		}
+	}
+	return int64(buckets) * bytesPerHistogramBucket
+}
+
 func (a *AggregateContainerState) isExpired(now time.Time) bool {
+	return a.isExpiredAfter(now, GetAggregationsConfig().GetMemoryAggregationWindowLength())
+}
+
+// isExpiredAfter returns true if the last sample, or the creation if there
+// are no samples, happened at least historyLength before now.
+func (a *AggregateContainerState) isExpiredAfter(now time.Time, historyLength time.Duration) bool {
 	if a.isEmpty() {
-		return now.Sub(a.CreationTime) >= GetAggregationsConfig().GetMemoryAggregationWindowLength()
+		return now.Sub(a.CreationTime) >= historyLength
 	}
-	return now.Sub(a.LastSampleStart) >= GetAggregationsConfig().GetMemoryAggregationWindowLength()
+	return now.Sub(a.LastSampleStart) >= historyLength
 }
 
 func (a *AggregateContainerState) isEmpty() bool {
 	return a.TotalSamplesCount == 0
 }
 
-// UpdateFromPolicy updates container state scaling mode and controlled resources based on resource
-// policy of the VPA object.
+// UpdateFromPolicy updates container state scaling mode, controlled resources and sampling strategy
+// based on resource policy of the VPA object.
 func (a *AggregateContainerState) UpdateFromPolicy(resourcePolicy *vpa_types.ContainerResourcePolicy) {
 	// ContainerScalingModeAuto is the default scaling mode
 	scalingModeAuto := vpa_types.ContainerScalingModeAuto
@@ -283,6 +452,10 @@ func (a *AggregateContainerState) UpdateFromPolicy(resourcePolicy *vpa_types.Con
 	if resourcePolicy != nil && resourcePolicy.ControlledResources != nil {
 		a.ControlledResources = ResourceNamesApiToModel(*resourcePolicy.ControlledResources)
 	}
+	a.SamplingStrategy = nil
+	if resourcePolicy != nil && resourcePolicy.SamplingStrategy != nil {
+		a.SamplingStrategy = resourcePolicy.SamplingStrategy
+	}
 }
 
 // AggregateStateByContainerName takes a set of AggregateContainerStates and merge them
@@ -294,7 +467,7 @@ func AggregateStateByContainerName(aggregateContainerStateMap aggregateContainer
 		containerName := aggregationKey.ContainerName()
 		aggregateContainerState, isInitialized := containerNameToAggregateStateMap[containerName]
 		if !isInitialized {
-			aggregateContainerState = NewAggregateContainerState()
+			aggregateContainerState = NewAggregateContainerState(GetAggregationsConfig().HistogramType)
 			containerNameToAggregateStateMap[containerName] = aggregateContainerState
 		}
 		aggregateContainerState.MergeContainerState(aggregation)
@@ -85,7 +85,8 @@ func TestAggregateStateByContainerName(t *testing.T) {
 		{testPodID2, "app-C"},
 	}
 	for _, c := range containers {
-		assert.NoError(t, cluster.AddOrUpdateContainer(c, testRequest))
+		_, err := cluster.AddOrUpdateContainer(c, testRequest)
+		assert.NoError(t, err)
 	}
 
 	// Add CPU usage samples to all containers.
@@ -100,7 +101,7 @@ func TestAggregateStateByContainerName(t *testing.T) {
 	assert.NoError(t, addTestMemorySample(cluster, containers[3], 10e9)) // app-C
 
 	// Build the AggregateContainerStateMap.
-	aggregateResources := AggregateStateByContainerName(cluster.aggregateStateMap)
+	aggregateResources := AggregateStateByContainerName(cluster.aggregateStates.snapshot())
 	assert.Contains(t, aggregateResources, "app-A")
 	assert.Contains(t, aggregateResources, "app-B")
 	assert.Contains(t, aggregateResources, "app-C")
@@ -128,7 +129,7 @@ func TestAggregateStateByContainerName(t *testing.T) {
 
 func TestAggregateContainerStateSaveToCheckpoint(t *testing.T) {
 	location, _ := time.LoadLocation("UTC")
-	cs := NewAggregateContainerState()
+	cs := NewAggregateContainerState(DecayingHistogramType)
 	t1, t2 := time.Date(2018, time.January, 1, 2, 3, 4, 0, location), time.Date(2018, time.February, 1, 2, 3, 4, 0, location)
 	cs.FirstSampleStart = t1
 	cs.LastSampleStart = t2
@@ -158,7 +159,7 @@ func TestAggregateContainerStateLoadFromCheckpointFailsForVersionMismatch(t *tes
 	checkpoint := vpa_types.VerticalPodAutoscalerCheckpointStatus{
 		Version: "foo",
 	}
-	cs := NewAggregateContainerState()
+	cs := NewAggregateContainerState(DecayingHistogramType)
 	err := cs.LoadFromCheckpoint(&checkpoint)
 	assert.Error(t, err)
 }
@@ -187,7 +188,7 @@ func TestAggregateContainerStateLoadFromCheckpoint(t *testing.T) {
 		},
 	}
 
-	cs := NewAggregateContainerState()
+	cs := NewAggregateContainerState(DecayingHistogramType)
 	err := cs.LoadFromCheckpoint(&checkpoint)
 	assert.NoError(t, err)
 
@@ -198,20 +199,81 @@ func TestAggregateContainerStateLoadFromCheckpoint(t *testing.T) {
 	assert.False(t, cs.AggregateMemoryPeaks.IsEmpty())
 }
 
+func TestNewAggregateContainerStateBoundedHistogram(t *testing.T) {
+	config := GetAggregationsConfig()
+	cs := NewAggregateContainerState(BoundedHistogramType)
+	assert.True(t, util.NewBoundedHistogram(config.CPUHistogramOptions, config.BoundedHistogramMaxBuckets).Equals(cs.AggregateCPUUsage))
+	assert.True(t, util.NewBoundedHistogram(config.MemoryHistogramOptions, config.BoundedHistogramMaxBuckets).Equals(cs.AggregateMemoryPeaks))
+
+	other := NewAggregateContainerState(BoundedHistogramType)
+	other.AggregateCPUUsage.AddSample(1.0, 1.0, testTimestamp)
+	other.TotalSamplesCount = 1
+	cs.MergeContainerState(other)
+	assert.False(t, cs.AggregateCPUUsage.IsEmpty())
+	assert.Equal(t, 1, cs.TotalSamplesCount)
+}
+
 func TestAggregateContainerStateIsExpired(t *testing.T) {
-	cs := NewAggregateContainerState()
+	cs := NewAggregateContainerState(DecayingHistogramType)
 	cs.LastSampleStart = testTimestamp
 	cs.TotalSamplesCount = 1
 	assert.False(t, cs.isExpired(testTimestamp.Add(7*24*time.Hour)))
 	assert.True(t, cs.isExpired(testTimestamp.Add(8*24*time.Hour)))
 
-	csEmpty := NewAggregateContainerState()
+	csEmpty := NewAggregateContainerState(DecayingHistogramType)
 	csEmpty.TotalSamplesCount = 0
 	csEmpty.CreationTime = testTimestamp
 	assert.False(t, csEmpty.isExpired(testTimestamp.Add(7*24*time.Hour)))
 	assert.True(t, csEmpty.isExpired(testTimestamp.Add(8*24*time.Hour)))
 }
 
+func TestAggregateContainerStateLastSampleTime(t *testing.T) {
+	cs := NewAggregateContainerState(DecayingHistogramType)
+	assert.True(t, cs.LastSampleTime().IsZero())
+	for i := 0; i < 3; i++ {
+		ts := testTimestamp.Add(time.Duration(i) * time.Minute)
+		cs.AddSample(&ContainerUsageSample{ts, CPUAmountFromCores(1), ResourceCPU})
+		assert.Equal(t, ts, cs.LastSampleTime())
+	}
+	// Older samples and memory peaks don't change it.
+	cs.AddSample(&ContainerUsageSample{testTimestamp, CPUAmountFromCores(1), ResourceCPU})
+	cs.AddSample(&ContainerUsageSample{testTimestamp.Add(time.Hour), MemoryAmountFromBytes(1e9), ResourceMemory})
+	assert.Equal(t, testTimestamp.Add(2*time.Minute), cs.LastSampleTime())
+}
+
+func TestAggregateContainerStateTrimSamplesBefore(t *testing.T) {
+	cs := NewAggregateContainerState(DecayingHistogramType)
+	assert.Equal(t, 0, cs.TrimSamplesBefore(testTimestamp))
+	for i := 0; i < 3; i++ {
+		ts := testTimestamp.Add(time.Duration(i) * time.Minute)
+		cs.AddSample(&ContainerUsageSample{ts, CPUAmountFromCores(1), ResourceCPU})
+		cs.AddSample(&ContainerUsageSample{ts, MemoryAmountFromBytes(1e9), ResourceMemory})
+	}
+
+	// The newest sample is not older than the given time.
+	assert.Equal(t, 0, cs.TrimSamplesBefore(testTimestamp.Add(2*time.Minute)))
+	assert.Equal(t, 3, cs.TotalSamplesCount)
+	assert.False(t, cs.AggregateCPUUsage.IsEmpty())
+
+	cs.AddSample(&ContainerUsageSample{testTimestamp, MemoryAmountFromBytes(1e9), ResourceEphemeralStorage})
+	cs.addStartupSample(&ContainerUsageSample{testTimestamp, CPUAmountFromCores(1), ResourceCPU})
+	cs.recordOOM(testTimestamp)
+	cs.recordOOM(testTimestamp.Add(5 * time.Minute))
+
+	assert.Equal(t, 3, cs.TrimSamplesBefore(testTimestamp.Add(3*time.Minute)))
+	assert.Equal(t, 0, cs.TotalSamplesCount)
+	assert.True(t, cs.AggregateCPUUsage.IsEmpty())
+	assert.True(t, cs.AggregateMemoryPeaks.IsEmpty())
+	assert.Nil(t, cs.AggregateEphemeralStorageUsage)
+	assert.Nil(t, cs.startupCPUUsage)
+	assert.Nil(t, cs.startupMemoryUsage)
+	// Only the OOM after the given time is kept.
+	assert.Equal(t, 1, cs.GetOOMCount())
+	assert.InDelta(t, 1.0, cs.GetOOMRate(time.Hour, testTimestamp.Add(time.Hour)), 1e-9)
+	assert.True(t, cs.FirstSampleStart.IsZero())
+	assert.True(t, cs.LastSampleStart.IsZero())
+}
+
 func TestUpdateFromPolicyScalingMode(t *testing.T) {
 	scalingModeAuto := vpa_types.ContainerScalingModeAuto
 	scalingModeOff := vpa_types.ContainerScalingModeOff
@@ -244,13 +306,46 @@ func TestUpdateFromPolicyScalingMode(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			cs := NewAggregateContainerState()
+			cs := NewAggregateContainerState(DecayingHistogramType)
 			cs.UpdateFromPolicy(tc.policy)
 			assert.Equal(t, tc.expected, cs.GetScalingMode())
 		})
 	}
 }
 
+func TestUpdateFromPolicySamplingStrategy(t *testing.T) {
+	runningMaximum := vpa_types.SamplingStrategyRunningMaximum
+	testCases := []struct {
+		name     string
+		policy   *vpa_types.ContainerResourcePolicy
+		expected vpa_types.SamplingStrategy
+	}{
+		{
+			name: "Explicit sampling strategy",
+			policy: &vpa_types.ContainerResourcePolicy{
+				SamplingStrategy: &runningMaximum,
+			},
+			expected: vpa_types.SamplingStrategyRunningMaximum,
+		}, {
+			name:     "No sampling strategy specified - default to HistogramPercentile",
+			policy:   &vpa_types.ContainerResourcePolicy{},
+			expected: vpa_types.SamplingStrategyHistogramPercentile,
+		}, {
+			name:     "Nil policy - default to HistogramPercentile",
+			policy:   nil,
+			expected: vpa_types.SamplingStrategyHistogramPercentile,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cs := NewAggregateContainerState(DecayingHistogramType)
+			cs.UpdateFromPolicy(&vpa_types.ContainerResourcePolicy{SamplingStrategy: &runningMaximum})
+			cs.UpdateFromPolicy(tc.policy)
+			assert.Equal(t, tc.expected, cs.GetSamplingStrategy())
+		})
+	}
+}
+
 func TestUpdateFromPolicyControlledResources(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -287,9 +382,39 @@ func TestUpdateFromPolicyControlledResources(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			cs := NewAggregateContainerState()
+			cs := NewAggregateContainerState(DecayingHistogramType)
 			cs.UpdateFromPolicy(tc.policy)
 			assert.Equal(t, tc.expected, cs.GetControlledResources())
 		})
 	}
 }
+
+// Returns an aggregation with the given number of CPU samples taken every
+// interval.
+func aggregationWithSamples(count int, interval time.Duration) *AggregateContainerState {
+	state := NewAggregateContainerState(DecayingHistogramType)
+	for i := 0; i < count; i++ {
+		state.AddSample(&ContainerUsageSample{testTimestamp.Add(time.Duration(i) * interval), CPUAmountFromCores(1.0), ResourceCPU})
+	}
+	return state
+}
+
+func TestRecommendationConfidence(t *testing.T) {
+	state := NewAggregateContainerState(DecayingHistogramType)
+	assert.Equal(t, 0.0, state.RecommendationConfidence())
+
+	// Confidence increases monotonically with the sample count.
+	previous := 0.0
+	for i := 0; i < 3*24*60; i++ {
+		state.AddSample(&ContainerUsageSample{testTimestamp.Add(time.Duration(i) * time.Minute), CPUAmountFromCores(1.0), ResourceCPU})
+		confidence := state.RecommendationConfidence()
+		assert.GreaterOrEqual(t, confidence, previous)
+		assert.LessOrEqual(t, confidence, 1.0)
+		previous = confidence
+	}
+	assert.Greater(t, previous, HighConfidenceThreshold)
+	assert.Less(t, aggregationWithSamples(3, time.Minute).RecommendationConfidence(), 0.1)
+
+	// Sparse samples give a lower confidence than dense ones over the same time.
+	assert.Less(t, aggregationWithSamples(72, time.Hour).RecommendationConfidence(), previous)
+}
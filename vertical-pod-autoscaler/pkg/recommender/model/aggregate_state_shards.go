@@ -0,0 +1,177 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"hash/fnv"
+	"maps"
+	"sync"
+)
+
+// DefaultAggregateStateShardCount is the default number of shards the
+// aggregation key space is divided into.
+const DefaultAggregateStateShardCount = 256
+
+// aggregateStateShards is a map from AggregateStateKey to
+// AggregateContainerState divided into shards, each guarded by its own
+// mutexes, so that samples of containers using different shards can be added
+// concurrently.
+type aggregateStateShards struct {
+	shards []aggregateStateShard
+	// namespaceMutex guards byNamespace.
+	namespaceMutex sync.Mutex
+	// Index of the aggregations in each namespace.
+	byNamespace map[string]aggregateContainerStatesMap
+}
+
+// aggregateStateShard holds the aggregations for a part of the key space.
+type aggregateStateShard struct {
+	// mapMutex guards the states map.
+	mapMutex sync.Mutex
+	// samplesMutex guards the content of the aggregations in the shard. It
+	// must be held while adding samples to any of them.
+	samplesMutex sync.Mutex
+	states       aggregateContainerStatesMap
+}
+
+// newAggregateStateShards returns an empty aggregateStateShards with the given
+// number of shards. Requires shardCount >= 1.
+func newAggregateStateShards(shardCount int) *aggregateStateShards {
+	if shardCount < 1 {
+		panic("shardCount must be positive")
+	}
+	s := &aggregateStateShards{
+		shards:      make([]aggregateStateShard, shardCount),
+		byNamespace: make(map[string]aggregateContainerStatesMap),
+	}
+	for i := range s.shards {
+		s.shards[i].states = make(aggregateContainerStatesMap)
+	}
+	return s
+}
+
+// shard returns the shard the given key belongs to.
+func (s *aggregateStateShards) shard(key AggregateStateKey) *aggregateStateShard {
+	if len(s.shards) == 1 {
+		return &s.shards[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key.Namespace()))
+	h.Write([]byte{0})
+	h.Write([]byte(key.ContainerName()))
+	h.Write([]byte{0})
+	// Other implementations of AggregateStateKey are sharded by namespace and
+	// container name only.
+	if k, ok := key.(aggregateStateKey); ok {
+		h.Write([]byte(k.labelSetKey))
+	}
+	return &s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// get returns the aggregation with the given key, if present.
+func (s *aggregateStateShards) get(key AggregateStateKey) (*AggregateContainerState, bool) {
+	shard := s.shard(key)
+	shard.mapMutex.Lock()
+	defer shard.mapMutex.Unlock()
+	state, found := shard.states[key]
+	return state, found
+}
+
+// getOrCreate returns the aggregation with the given key. If it is not present
+// a new one is created using newState and true is returned as the second value.
+func (s *aggregateStateShards) getOrCreate(key AggregateStateKey, newState func() *AggregateContainerState) (*AggregateContainerState, bool) {
+	shard := s.shard(key)
+	shard.mapMutex.Lock()
+	defer shard.mapMutex.Unlock()
+	if state, found := shard.states[key]; found {
+		return state, false
+	}
+	state := newState()
+	shard.states[key] = state
+	s.namespaceMutex.Lock()
+	defer s.namespaceMutex.Unlock()
+	namespaceStates, found := s.byNamespace[key.Namespace()]
+	if !found {
+		namespaceStates = make(aggregateContainerStatesMap)
+		s.byNamespace[key.Namespace()] = namespaceStates
+	}
+	namespaceStates[key] = state
+	return state, true
+}
+
+// delete removes the aggregation with the given key.
+func (s *aggregateStateShards) delete(key AggregateStateKey) {
+	shard := s.shard(key)
+	shard.mapMutex.Lock()
+	defer shard.mapMutex.Unlock()
+	delete(shard.states, key)
+	s.namespaceMutex.Lock()
+	defer s.namespaceMutex.Unlock()
+	if namespaceStates, found := s.byNamespace[key.Namespace()]; found {
+		delete(namespaceStates, key)
+		if len(namespaceStates) == 0 {
+			delete(s.byNamespace, key.Namespace())
+		}
+	}
+}
+
+// len returns the total number of aggregations in all shards.
+func (s *aggregateStateShards) len() int {
+	total := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mapMutex.Lock()
+		total += len(shard.states)
+		shard.mapMutex.Unlock()
+	}
+	return total
+}
+
+// snapshot returns all aggregations as a single map. Changes to the returned
+// map are not reflected in the shards.
+func (s *aggregateStateShards) snapshot() aggregateContainerStatesMap {
+	result := make(aggregateContainerStatesMap)
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mapMutex.Lock()
+		for key, state := range shard.states {
+			result[key] = state
+		}
+		shard.mapMutex.Unlock()
+	}
+	return result
+}
+
+// snapshotByNamespace returns all aggregations grouped by namespace. Changes to
+// the returned maps are not reflected in the shards.
+func (s *aggregateStateShards) snapshotByNamespace() map[string]aggregateContainerStatesMap {
+	s.namespaceMutex.Lock()
+	defer s.namespaceMutex.Unlock()
+	result := make(map[string]aggregateContainerStatesMap, len(s.byNamespace))
+	for namespace, namespaceStates := range s.byNamespace {
+		result[namespace] = maps.Clone(namespaceStates)
+	}
+	return result
+}
+
+// lockSamples acquires the mutex guarding the content of the aggregation with
+// the given key and returns a function releasing it.
+func (s *aggregateStateShards) lockSamples(key AggregateStateKey) func() {
+	shard := s.shard(key)
+	shard.samplesMutex.Lock()
+	return shard.samplesMutex.Unlock
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const shardTestPodCount = 64
+
+// Creates a cluster with shardTestPodCount pods, each with a single container
+// and a distinct label set, so that every container uses its own aggregation.
+func newShardTestCluster(t testing.TB, shardCount int) (*clusterState, []ContainerID) {
+	cluster := NewClusterStateWithShards(testGcPeriod, shardCount)
+	addTestVpa(cluster)
+	containerIDs := make([]ContainerID, shardTestPodCount)
+	for i := range containerIDs {
+		podID := PodID{"namespace-1", fmt.Sprintf("pod-%d", i)}
+		podLabels := map[string]string{"label-1": "value-1", "pod": podID.PodName}
+		assert.NoError(t, cluster.AddOrUpdatePod(podID, podLabels, apiv1.PodRunning))
+		containerIDs[i] = ContainerID{podID, "container-1"}
+		_, err := cluster.AddOrUpdateContainer(containerIDs[i], testRequest)
+		assert.NoError(t, err)
+	}
+	return cluster, containerIDs
+}
+
+// Adds samples to all containers from the given number of goroutines. Each
+// goroutine handles a disjoint subset of containers.
+func addSamplesConcurrently(cluster *clusterState, containerIDs []ContainerID, goroutines, samplesPerGoroutine int) {
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < samplesPerGoroutine; i++ {
+				containerID := containerIDs[(g+i*goroutines)%len(containerIDs)]
+				_ = cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+					MeasureStart: testTimestamp.Add(time.Duration(i) * time.Second),
+					Usage:        CPUAmountFromCores(1.0),
+					Resource:     ResourceCPU}, containerID})
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestAggregateStateShards(t *testing.T) {
+	shards := newAggregateStateShards(8)
+	key := aggregateStateKey{namespace: "namespace-1", containerName: "container-1", labelSetKey: "a"}
+	_, found := shards.get(key)
+	assert.False(t, found)
+	state, created := shards.getOrCreate(key, func() *AggregateContainerState {
+		return NewAggregateContainerState(DecayingHistogramType)
+	})
+	assert.True(t, created)
+	sameState, created := shards.getOrCreate(key, func() *AggregateContainerState {
+		t.Fatal("unexpected creation of an existing aggregation")
+		return nil
+	})
+	assert.False(t, created)
+	assert.Same(t, state, sameState)
+	assert.Equal(t, 1, shards.len())
+	assert.Equal(t, aggregateContainerStatesMap{key: state}, shards.snapshot())
+	shards.delete(key)
+	assert.Equal(t, 0, shards.len())
+}
+
+// Verifies that adding samples concurrently from many goroutines doesn't lose
+// any of them. Run with -race to detect unguarded accesses.
+func TestConcurrentAddSample(t *testing.T) {
+	for _, shardCount := range []int{1, 8, DefaultAggregateStateShardCount} {
+		t.Run(fmt.Sprintf("shards=%d", shardCount), func(t *testing.T) {
+			cluster, containerIDs := newShardTestCluster(t, shardCount)
+			addSamplesConcurrently(cluster, containerIDs, 8, 100)
+			assert.Equal(t, shardTestPodCount, cluster.StateMapSize())
+			totalSamples := 0
+			for _, state := range cluster.aggregateStates.snapshot() {
+				totalSamples += state.TotalSamplesCount
+				assert.True(t, state.IsUnderVPA)
+			}
+			assert.Equal(t, 8*100, totalSamples)
+		})
+	}
+}
+
+// Only AddSample runs concurrently here: pods, containers and VPAs are not
+// modified while samples are added, as cluster.pods and cluster.vpas are not
+// guarded by any lock.
+func BenchmarkConcurrentAddSample(b *testing.B) {
+	for _, shardCount := range []int{1, 8, DefaultAggregateStateShardCount} {
+		for _, goroutines := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("shards=%d/goroutines=%d", shardCount, goroutines), func(b *testing.B) {
+				cluster, containerIDs := newShardTestCluster(b, shardCount)
+				b.ResetTimer()
+				addSamplesConcurrently(cluster, containerIDs, goroutines, b.N/goroutines+1)
+			})
+		}
+	}
+}
+
+// Same as BenchmarkConcurrentAddSample, but using b.RunParallel, so that
+// the number of goroutines follows GOMAXPROCS.
+func BenchmarkParallelAddSample(b *testing.B) {
+	for _, shardCount := range []int{1, 8, DefaultAggregateStateShardCount} {
+		for _, parallelism := range []int{1, 4, 16} {
+			b.Run(fmt.Sprintf("shards=%d/parallelism=%d", shardCount, parallelism), func(b *testing.B) {
+				workers := parallelism * runtime.GOMAXPROCS(0)
+				if workers > shardTestPodCount {
+					b.Skipf("%d goroutines would share containers", workers)
+				}
+				cluster, containerIDs := newShardTestCluster(b, shardCount)
+				var nextWorker atomic.Int64
+				b.SetParallelism(parallelism)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					// Each goroutine handles a disjoint subset of containers.
+					worker := int(nextWorker.Add(1) - 1)
+					workerContainers := shardTestPodCount / workers
+					for i := 0; pb.Next(); i++ {
+						containerID := containerIDs[worker+(i%workerContainers)*workers]
+						_ = cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+							MeasureStart: testTimestamp.Add(time.Duration(i) * time.Second),
+							Usage:        CPUAmountFromCores(1.0),
+							Resource:     ResourceCPU}, containerID})
+					}
+				})
+			})
+		}
+	}
+}
@@ -55,6 +55,11 @@ type AggregationsConfig struct {
 	OOMBumpUpRatio float64
 	// OOMMinBumpUp specifies the minimal increase of memory when OOM occurred in bytes.
 	OOMMinBumpUp float64
+	// HistogramType selects the histogram implementation used by aggregations.
+	HistogramType HistogramType
+	// BoundedHistogramMaxBuckets is the maximum number of buckets kept by a
+	// single histogram when HistogramType is BoundedHistogramType.
+	BoundedHistogramMaxBuckets int
 }
 
 const (
@@ -79,6 +84,10 @@ const (
 	DefaultOOMBumpUpRatio float64 = 1.2 // Memory is increased by 20% after an OOMKill.
 	// DefaultOOMMinBumpUp is the default value for OOMMinBumpUp.
 	DefaultOOMMinBumpUp float64 = 100 * 1024 * 1024 // Memory is increased by at least 100MB after an OOMKill.
+	// DefaultHistogramType is the default value for HistogramType.
+	DefaultHistogramType = DecayingHistogramType
+	// DefaultBoundedHistogramMaxBuckets is the default value for BoundedHistogramMaxBuckets.
+	DefaultBoundedHistogramMaxBuckets = 64
 )
 
 // GetMemoryAggregationWindowLength returns the total length of the memory usage history aggregated by VPA.
@@ -120,6 +129,8 @@ func NewAggregationsConfig(memoryAggregationInterval time.Duration, memoryAggreg
 		CPUHistogramDecayHalfLife:      cpuHistogramDecayHalfLife,
 		OOMBumpUpRatio:                 oomBumpUpRatio,
 		OOMMinBumpUp:                   oomMinBumpUp,
+		HistogramType:                  DefaultHistogramType,
+		BoundedHistogramMaxBuckets:     DefaultBoundedHistogramMaxBuckets,
 	}
 	a.CPUHistogramOptions = a.cpuHistogramOptions()
 	a.MemoryHistogramOptions = a.memoryHistogramOptions()
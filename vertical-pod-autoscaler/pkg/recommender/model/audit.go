@@ -0,0 +1,146 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"maps"
+	"time"
+
+	autoscaling "k8s.io/api/autoscaling/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+// AuditEventType is the kind of mutation of the cluster state described by an
+// AuditEvent.
+type AuditEventType string
+
+const (
+	// AuditEventVpaAdded is recorded when a new VPA is added.
+	AuditEventVpaAdded AuditEventType = "VpaAdded"
+	// AuditEventVpaUpdated is recorded when an existing VPA is changed.
+	AuditEventVpaUpdated AuditEventType = "VpaUpdated"
+	// AuditEventVpaDeleted is recorded when a VPA is deleted.
+	AuditEventVpaDeleted AuditEventType = "VpaDeleted"
+	// AuditEventPodAdded is recorded when a new pod is added.
+	AuditEventPodAdded AuditEventType = "PodAdded"
+	// AuditEventPodUpdated is recorded when the labels or the phase of an
+	// existing pod change.
+	AuditEventPodUpdated AuditEventType = "PodUpdated"
+	// AuditEventPodDeleted is recorded when a pod is deleted.
+	AuditEventPodDeleted AuditEventType = "PodDeleted"
+	// AuditEventRecommendationRecorded is recorded when a non-empty
+	// recommendation of a VPA is recorded.
+	AuditEventRecommendationRecorded AuditEventType = "RecommendationRecorded"
+)
+
+// AuditEvent describes a single mutation of the cluster state.
+type AuditEvent struct {
+	// Type of the mutation.
+	Type AuditEventType
+	// ID of the affected object, a VpaID or a PodID.
+	ID interface{}
+	// Time of the mutation.
+	Timestamp time.Time
+	// State of the affected object before the mutation, a VpaSnapshot or a
+	// PodSnapshot. Nil for added objects. For recorded recommendations it
+	// holds the recommendation before it was smoothed and adjusted.
+	Before interface{}
+	// State of the affected object after the mutation, a VpaSnapshot or a
+	// PodSnapshot. Nil for deleted objects.
+	After interface{}
+}
+
+// AuditLog receives the mutations of the cluster state, e.g. to keep an audit
+// trail of the recommendations. Record is called synchronously by the
+// mutating methods, from any goroutine they are called from.
+type AuditLog interface {
+	Record(event AuditEvent)
+}
+
+// VpaSnapshot is a copy of the audited state of a VPA.
+type VpaSnapshot struct {
+	PodSelector    string
+	TargetRef      *autoscaling.CrossVersionObjectReference
+	Annotations    map[string]string
+	UpdateMode     *vpa_types.UpdateMode
+	ResourcePolicy *vpa_types.PodResourcePolicy
+	Recommendation *vpa_types.RecommendedPodResources
+	PodCount       int
+}
+
+// PodSnapshot is a copy of the audited state of a pod.
+type PodSnapshot struct {
+	Labels labels.Set
+	Phase  apiv1.PodPhase
+}
+
+// SetAuditLog sets the log receiving all mutations of VPAs, pods and
+// recommendations. Nil disables auditing.
+func (cluster *clusterState) SetAuditLog(auditLog AuditLog) {
+	cluster.auditLog = auditLog
+}
+
+func snapshotVpa(vpa *Vpa) VpaSnapshot {
+	snapshot := VpaSnapshot{
+		Annotations:    maps.Clone(vpa.Annotations),
+		ResourcePolicy: vpa.ResourcePolicy.DeepCopy(),
+		Recommendation: vpa.Recommendation.DeepCopy(),
+		PodCount:       vpa.PodCount,
+	}
+	if vpa.PodSelector != nil {
+		snapshot.PodSelector = vpa.PodSelector.String()
+	}
+	if vpa.TargetRef != nil {
+		targetRef := *vpa.TargetRef
+		snapshot.TargetRef = &targetRef
+	}
+	if vpa.UpdateMode != nil {
+		updateMode := *vpa.UpdateMode
+		snapshot.UpdateMode = &updateMode
+	}
+	return snapshot
+}
+
+func (cluster *clusterState) snapshotPod(pod *PodState) PodSnapshot {
+	return PodSnapshot{
+		Labels: maps.Clone(cluster.labelSetMap[pod.labelSetKey]),
+		Phase:  pod.Phase,
+	}
+}
+
+// recordAudit passes the event to the audit log, if there is one.
+func (cluster *clusterState) recordAudit(eventType AuditEventType, id interface{}, timestamp time.Time, before, after interface{}) {
+	if cluster.auditLog == nil {
+		return
+	}
+	cluster.auditLog.Record(AuditEvent{Type: eventType, ID: id, Timestamp: timestamp, Before: before, After: after})
+}
+
+// recordAuditUpdate records addedType if there was no object before and
+// updatedType if the object changed. Nothing is recorded for unchanged
+// objects.
+func (cluster *clusterState) recordAuditUpdate(addedType, updatedType AuditEventType, id interface{}, before, after interface{}) {
+	if before == nil {
+		cluster.recordAudit(addedType, id, time.Now(), nil, after)
+	} else if !apiequality.Semantic.DeepEqual(before, after) {
+		cluster.recordAudit(updatedType, id, time.Now(), before, after)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+type fakeAuditLog struct {
+	events []AuditEvent
+}
+
+func (l *fakeAuditLog) Record(event AuditEvent) {
+	l.events = append(l.events, event)
+}
+
+// takeEvents returns the events recorded since the last call.
+func (l *fakeAuditLog) takeEvents() []AuditEvent {
+	events := l.events
+	l.events = nil
+	return events
+}
+
+func TestAuditLog(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	auditLog := &fakeAuditLog{}
+	cluster.SetAuditLog(auditLog)
+
+	// Pods.
+	addTestPod(cluster)
+	events := auditLog.takeEvents()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, AuditEventPodAdded, events[0].Type)
+		assert.Equal(t, testPodID, events[0].ID)
+		assert.False(t, events[0].Timestamp.IsZero())
+		assert.Nil(t, events[0].Before)
+		assert.Equal(t, PodSnapshot{Labels: testLabels, Phase: apiv1.PodRunning}, events[0].After)
+	}
+	addTestPod(cluster)
+	assert.Empty(t, auditLog.takeEvents(), "unchanged pods are not audited")
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodSucceeded))
+	events = auditLog.takeEvents()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, AuditEventPodUpdated, events[0].Type)
+		assert.Equal(t, PodSnapshot{Labels: testLabels, Phase: apiv1.PodRunning}, events[0].Before)
+		assert.Equal(t, PodSnapshot{Labels: testLabels, Phase: apiv1.PodSucceeded}, events[0].After)
+	}
+
+	// VPAs.
+	vpa := addTestVpa(cluster)
+	events = auditLog.takeEvents()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, AuditEventVpaAdded, events[0].Type)
+		assert.Equal(t, testVpaID, events[0].ID)
+		assert.Nil(t, events[0].Before)
+		assert.Equal(t, "label-1=value-1", events[0].After.(VpaSnapshot).PodSelector)
+		assert.Equal(t, 1, events[0].After.(VpaSnapshot).PodCount)
+	}
+	addTestVpa(cluster)
+	assert.Empty(t, auditLog.takeEvents(), "unchanged VPAs are not audited")
+	addVpa(cluster, testVpaID, vpaAnnotationsMap{"key": "value"}, testSelectorStr, testTargetRef)
+	events = auditLog.takeEvents()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, AuditEventVpaUpdated, events[0].Type)
+		assert.NotContains(t, events[0].Before.(VpaSnapshot).Annotations, "key")
+		assert.Equal(t, "value", events[0].After.(VpaSnapshot).Annotations["key"])
+	}
+
+	// Recommendations.
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("1", "1Gi").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	events = auditLog.takeEvents()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, AuditEventRecommendationRecorded, events[0].Type)
+		assert.Equal(t, testVpaID, events[0].ID)
+		assert.Equal(t, testTimestamp, events[0].Timestamp)
+		assert.Equal(t, vpa.Recommendation, events[0].After.(VpaSnapshot).Recommendation)
+	}
+	vpa.Recommendation = nil
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.Empty(t, auditLog.takeEvents(), "empty recommendations are not audited")
+
+	// Deletions.
+	cluster.DeletePod(testPodID)
+	assert.NoError(t, cluster.DeleteVpa(testVpaID))
+	events = auditLog.takeEvents()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, AuditEventPodDeleted, events[0].Type)
+		assert.Equal(t, testPodID, events[0].ID)
+		assert.Equal(t, PodSnapshot{Labels: testLabels, Phase: apiv1.PodSucceeded}, events[0].Before)
+		assert.Nil(t, events[0].After)
+		assert.Equal(t, AuditEventVpaDeleted, events[1].Type)
+		assert.Equal(t, testVpaID, events[1].ID)
+		assert.Equal(t, "value", events[1].Before.(VpaSnapshot).Annotations["key"])
+		assert.Nil(t, events[1].After)
+	}
+}
+
+func TestAuditLogVpaSelectorChange(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	auditLog := &fakeAuditLog{}
+	addTestVpa(cluster)
+	cluster.SetAuditLog(auditLog)
+
+	// The VPA is recreated with the new selector.
+	addVpa(cluster, testVpaID, testAnnotations, "label-1 = value-2", testTargetRef)
+	events := auditLog.takeEvents()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, AuditEventVpaDeleted, events[0].Type)
+		assert.Equal(t, AuditEventVpaAdded, events[1].Type)
+		assert.Equal(t, "label-1=value-2", events[1].After.(VpaSnapshot).PodSelector)
+	}
+
+	cluster.SetAuditLog(nil)
+	addTestVpa(cluster)
+	assert.Empty(t, auditLog.takeEvents())
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+// ImportVpaCheckpoints seeds the VPAs with the histograms stored in the given
+// checkpoints, so that the first recommendations after a restart aren't
+// computed from scratch. The histograms of each checkpoint become the initial
+// aggregation of its container, merged with the live aggregations whenever
+// the VPA aggregates its state by container name. Importing a checkpoint
+// replaces the previously imported one of the same container. It should be
+// called after the VPAs are loaded and before the first recommendations are
+// computed.
+// A checkpoint of a missing VPA or with invalid data doesn't stop the import
+// of the remaining ones: their errors are joined into the returned error.
+// Only the cancellation of the context aborts the import.
+func (cluster *clusterState) ImportVpaCheckpoints(ctx context.Context, checkpoints []*vpa_types.VerticalPodAutoscalerCheckpoint) error {
+	var errs []error
+	for _, checkpoint := range checkpoints {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		vpaID := VpaID{Namespace: checkpoint.Namespace, VpaName: checkpoint.Spec.VPAObjectName}
+		vpa, vpaExists := cluster.vpas[vpaID]
+		if !vpaExists {
+			errs = append(errs, fmt.Errorf("cannot load checkpoint: %w", NewVpaNotFoundError(vpaID)))
+			continue
+		}
+		aggregation := NewAggregateContainerState(GetAggregationsConfig().HistogramType)
+		if err := aggregation.LoadFromCheckpoint(&checkpoint.Status); err != nil {
+			errs = append(errs, fmt.Errorf("cannot load checkpoint for VPA %s/%s: %w", vpaID.Namespace, vpaID.VpaName, err))
+			continue
+		}
+		vpa.ContainersInitialAggregateState[checkpoint.Spec.ContainerName] = aggregation
+	}
+	return errors.Join(errs...)
+}
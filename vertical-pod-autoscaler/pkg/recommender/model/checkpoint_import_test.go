@@ -0,0 +1,84 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+func TestImportVpaCheckpoints(t *testing.T) {
+	// Aggregate the original samples.
+	original := NewClusterState(testGcPeriod)
+	originalVpa := addTestVpa(original)
+	addTestPod(original)
+	addTestContainer(t, original)
+	for i := 0; i < 100; i++ {
+		ts := testTimestamp.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, original.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{ts, CPUAmountFromCores(0.1 * float64(i%10+1)), ResourceCPU}, testContainerID}))
+		assert.NoError(t, original.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{ts, MemoryAmountFromBytes(float64(i%7+1) * 1e8), ResourceMemory}, testContainerID}))
+	}
+	originalAggregation := originalVpa.AggregateStateByContainerName()[testContainerID.ContainerName]
+	status, err := originalAggregation.SaveToCheckpoint()
+	assert.NoError(t, err)
+	checkpoint := &vpa_types.VerticalPodAutoscalerCheckpoint{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testVpaID.Namespace, Name: "checkpoint-1"},
+		Spec:       vpa_types.VerticalPodAutoscalerCheckpointSpec{VPAObjectName: testVpaID.VpaName, ContainerName: testContainerID.ContainerName},
+		Status:     *status,
+	}
+
+	// Restore them in a cluster without samples.
+	restored := NewClusterState(testGcPeriod)
+	restoredVpa := addTestVpa(restored)
+	assert.NoError(t, restored.ImportVpaCheckpoints(context.Background(), []*vpa_types.VerticalPodAutoscalerCheckpoint{checkpoint}))
+	restoredAggregation := restoredVpa.AggregateStateByContainerName()[testContainerID.ContainerName]
+	if assert.NotNil(t, restoredAggregation) {
+		for _, percentile := range []float64{0.5, 0.9, 0.95} {
+			assert.Equal(t, originalAggregation.AggregateCPUUsage.Percentile(percentile), restoredAggregation.AggregateCPUUsage.Percentile(percentile))
+			assert.Equal(t, originalAggregation.AggregateMemoryPeaks.Percentile(percentile), restoredAggregation.AggregateMemoryPeaks.Percentile(percentile))
+		}
+		assert.Equal(t, originalAggregation.TotalSamplesCount, restoredAggregation.TotalSamplesCount)
+	}
+
+	// Invalid checkpoints don't stop the import of the valid ones.
+	missingVpa := checkpoint.DeepCopy()
+	missingVpa.Spec.VPAObjectName = "vpa-2"
+	invalid := checkpoint.DeepCopy()
+	invalid.Spec.ContainerName = "container-2"
+	invalid.Status.Version = "v0"
+	valid := checkpoint.DeepCopy()
+	valid.Spec.ContainerName = "container-3"
+	restored = NewClusterState(testGcPeriod)
+	restoredVpa = addTestVpa(restored)
+	err = restored.ImportVpaCheckpoints(context.Background(), []*vpa_types.VerticalPodAutoscalerCheckpoint{missingVpa, invalid, valid})
+	if assert.Error(t, err) {
+		assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 2)
+		assert.ErrorAs(t, err, &KeyError{})
+	}
+	assert.Len(t, restoredVpa.ContainersInitialAggregateState, 1)
+	assert.Contains(t, restoredVpa.ContainersInitialAggregateState, "container-3")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, restored.ImportVpaCheckpoints(ctx, []*vpa_types.VerticalPodAutoscalerCheckpoint{checkpoint}), context.Canceled)
+}
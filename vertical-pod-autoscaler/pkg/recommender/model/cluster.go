@@ -17,15 +17,32 @@ limitations under the License.
 package model
 
 import (
+	"cmp"
+	"container/heap"
 	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/time/rate"
+	autoscaling "k8s.io/api/autoscaling/v1"
 	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	labels "k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
 	controllerfetcher "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/target/controller_fetcher"
 	vpa_utils "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
 )
@@ -33,6 +50,9 @@ import (
 const (
 	// RecommendationMissingMaxDuration is maximum time that we accept the recommendation can be missing.
 	RecommendationMissingMaxDuration = 30 * time.Minute
+	// EvictionCooldownPeriod is the minimum time between two evictions of the
+	// same pod. Pods evicted more recently are not eviction candidates.
+	EvictionCooldownPeriod = 10 * time.Minute
 )
 
 // ClusterState holds all runtime information about the cluster required for the
@@ -42,17 +62,20 @@ const (
 // All input to the VPA Recommender algorithm lives in this structure.
 type ClusterState interface {
 	StateMapSize() int
-	AddOrUpdatePod(podID PodID, newLabels labels.Set, phase apiv1.PodPhase)
+	AddOrUpdatePod(podID PodID, newLabels labels.Set, phase apiv1.PodPhase) error
 	GetContainer(containerID ContainerID) *ContainerState
 	DeletePod(podID PodID)
-	AddOrUpdateContainer(containerID ContainerID, request Resources) error
+	AddOrUpdateContainer(containerID ContainerID, request Resources) (requestChanged bool, err error)
 	AddSample(sample *ContainerUsageSampleWithKey) error
+	// Deprecated: use RecordOOMWithContext, passing context.Background() if
+	// recording the OOM shouldn't be cancelled.
 	RecordOOM(containerID ContainerID, timestamp time.Time, requestedMemory ResourceAmount) error
 	AddOrUpdateVpa(apiObject *vpa_types.VerticalPodAutoscaler, selector labels.Selector) error
 	DeleteVpa(vpaID VpaID) error
 	MakeAggregateStateKey(pod *PodState, containerName string) AggregateStateKey
 	RateLimitedGarbageCollectAggregateCollectionStates(ctx context.Context, now time.Time, controllerFetcher controllerfetcher.ControllerFetcher)
 	RecordRecommendation(vpa *Vpa, now time.Time) error
+	SetMinVpaAgeForRecommendation(age time.Duration)
 	GetMatchingPods(vpa *Vpa) []PodID
 	GetControllerForPodUnderVPA(ctx context.Context, pod *PodState, controllerFetcher controllerfetcher.ControllerFetcher) *controllerfetcher.ControllerKeyWithAPIVersion
 	GetControllingVPA(pod *PodState) *Vpa
@@ -60,6 +83,102 @@ type ClusterState interface {
 	SetObservedVPAs([]*vpa_types.VerticalPodAutoscaler)
 	ObservedVPAs() []*vpa_types.VerticalPodAutoscaler
 	Pods() map[PodID]*PodState
+	CountContainersWithoutRecommendation() (count int, containerIDs []ContainerID)
+	SimulateAdmission(pod *apiv1.Pod) (*apiv1.Pod, *Vpa, error)
+	AddOrUpdateNode(nodeID string, allocatable apiv1.ResourceList)
+	DeleteNode(nodeID string)
+	SetNamespaceLimitRange(namespace string, limitRange apiv1.LimitRange)
+	DeleteNamespaceLimitRange(namespace string)
+	GetNamespaceStats(namespace string) NamespaceStats
+	SetStrictNamespaceMode(namespaces []string)
+	GetTopNContainersByUsage(n int, resource apiv1.ResourceName) []ContainerUsageRank
+	GetUpdateMode(vpaID VpaID) (*vpa_types.UpdateMode, error)
+	FilterVPAsByUpdateMode(mode vpa_types.UpdateMode) []VpaID
+	IsRecommendationFresh(vpaID VpaID, maxAge time.Duration, now time.Time) bool
+	DetachVpaFromAggregations(vpaID VpaID) error
+	ReattachVpaToAggregations(vpaID VpaID) error
+	RecordEviction(podID PodID, timestamp time.Time) error
+	GetCandidatePodsForEviction(vpaID VpaID, now time.Time) ([]EvictionCandidate, error)
+	GetCandidatesForInPlaceUpdate(vpaID VpaID) ([]PodID, error)
+	CheckRecommendationSafety(vpaID VpaID, safetyMarginFraction float64) []SafetyViolation
+	GetVpaForPod(podID PodID) (*Vpa, error)
+	RecordCrash(containerID ContainerID, timestamp time.Time, exitCode int32) error
+	GetOrphanedPods() []PodID
+	SetAutoDeleteOrphans(after time.Duration)
+	DeleteOrphanedPods(now time.Time) []PodID
+	MigrateVpa(oldID VpaID, newID VpaID) error
+	SetResourceBudget(vpaID VpaID, budget apiv1.ResourceList) error
+	GetRecommendationForPod(podID PodID) (*apiv1.ResourceRequirements, error)
+	LabelSetMapSize() int
+	SetShutdownCheckpointer(checkpointer func(ctx context.Context) error)
+	GracefulShutdown(ctx context.Context) error
+	GetPodsWithoutSamples(minAge time.Duration, now time.Time) []PodID
+	RenamePod(oldID PodID, newID PodID) error
+	ListStaleVPAs(ctx context.Context, controllerFetcher controllerfetcher.ControllerFetcher) ([]VpaID, error)
+	RegisterExternalRecommender(vpaID VpaID, recommender ExternalRecommender)
+	GetExternalRecommender(vpaID VpaID) ExternalRecommender
+	RecordRestart(containerID ContainerID, timestamp time.Time) error
+	SetRestartCPUBump(threshold int, window time.Duration, bumpFraction float64)
+	FilterAggregations(predicate func(AggregateStateKey, *AggregateContainerState) bool) []AggregateStateKey
+	ForEachAggregation(fn func(AggregateStateKey, *AggregateContainerState) bool)
+	GetContainerStats(containerID ContainerID) (ContainerStats, error)
+	GetPodsInPhase(phase apiv1.PodPhase) []PodID
+	SetSampleRateLimit(containerID ContainerID, maxSamplesPerMinute int)
+	SetOutOfOrderTolerance(tolerance time.Duration)
+	GetVpaCoverageStats() CoverageStats
+	WithNamespacePrefix(prefix string) ScopedClusterState
+	TotalAggregationMemoryBytes() int64
+	SetAggregationMemoryGCThreshold(thresholdBytes int64)
+	SetMemoryPressureThreshold(thresholdBytes int64)
+	SetPodNodeName(podID PodID, nodeName string) error
+	GetContainersByNode(nodeName string) []ContainerID
+	GetAggregationsForVpa(vpaID VpaID) (map[AggregateStateKey]*AggregateContainerState, error)
+	SetVpaSelectorFetcher(fetcher VpaSelectorFetcher)
+	SyncObservedVPAs(ctx context.Context, observed []*vpa_types.VerticalPodAutoscaler) error
+	GetRecommendationQuality(vpaID VpaID) (RecommendationQuality, error)
+	RecordOOMs(events []OOMEvent) []error
+	GetSampleCountByNamespace() map[string]int
+	RecordCPUThrottling(containerID ContainerID, timestamp time.Time, throttledFraction float64) error
+	SetCPUThrottlingBump(threshold float64, observations int, multiplier float64)
+	AddOrUpdateVpaFromUnstructured(obj *unstructured.Unstructured) error
+	SetAuditLog(auditLog AuditLog)
+	GetContainerRecommendationDelta(containerID ContainerID) (cpuDelta int64, memoryDelta int64, err error)
+	SortContainersByRecommendationDelta(containerIDs []ContainerID)
+	TrimSamples(before time.Time) int
+	GetContainerLastSampleTime(containerID ContainerID) (time.Time, error)
+	SetMutationRateLimit(operationsPerSecond int)
+	SetMutationQueueDepth(depth int)
+	FlushRecommendationsToStatus(ctx context.Context, client versioned.Interface) error
+	ForceGC(ctx context.Context, controllerFetcher controllerfetcher.ControllerFetcher)
+	GetVpaByTargetRef(kind string, name string, namespace string) (*Vpa, error)
+	HealthCheck() HealthStatus
+	RebalanceAggregations(oldLabelKey, newLabelKey string)
+	GetHistogramForContainer(containerID ContainerID, resource apiv1.ResourceName) (HistogramView, error)
+	RecordOOMWithContext(ctx context.Context, containerID ContainerID, timestamp time.Time, requestedMemory ResourceAmount) error
+	GetUnderutilizedVPAs(thresholdFraction float64) []VpaUnderutilizationReport
+	GetOverutilizedContainers(resourceName apiv1.ResourceName, riskFraction float64) []ContainerRiskReport
+	GetPodAgeDistribution(now time.Time) []time.Duration
+	GetPodAgePercentile(percentile float64, now time.Time) time.Duration
+	RecordContainerStartup(containerID ContainerID, startTime time.Time, endTime time.Time) error
+	GetStartupRecommendation(key AggregateStateKey) (Resources, error)
+	PrintDebugSummary(w io.Writer) error
+	EmptyVpaCount() int
+	GetEmptyVpas() []VpaID
+	RecommendationUpdates() <-chan VpaID
+	CloseRecommendationUpdates()
+	SetLabelNormalization(normalizer func(labels.Set) labels.Set)
+	GetContainerOOMStats(containerID ContainerID) (count int, rate float64, err error)
+	GetRecommendationSummary() RecommendationSummary
+	GetContainersNeedingUpdate(tolerance float64) []ContainerUpdateCandidate
+	SetAdditionalTargetRefs(vpaID VpaID, targetRefs []autoscaling.CrossVersionObjectReference) error
+	RecordCPUSaturation(containerID ContainerID, timestamp time.Time, cpuUsageFraction float64) error
+	GetContainersByCPUSaturation(top int) []CPUSaturationReport
+	SetContainerLimit(containerID ContainerID, limit Resources) error
+	ImportVpaCheckpoints(ctx context.Context, checkpoints []*vpa_types.VerticalPodAutoscalerCheckpoint) error
+	GetStalePods(maxSampleAge time.Duration, now time.Time) []PodID
+	GetAggregationsExpiringBefore(t time.Time) []AggregateStateKey
+	RegisterResourceTransformer(resource apiv1.ResourceName, transform ResourceTransformer)
+	GetVpaHistory(vpaID VpaID, limit int) ([]HistoricalRecommendation, error)
 }
 
 type clusterState struct {
@@ -67,26 +186,147 @@ type clusterState struct {
 	pods map[PodID]*PodState
 	// VPA objects in the cluster.
 	vpas map[VpaID]*Vpa
+	// Index of the pods by their phase.
+	podsByPhase map[apiv1.PodPhase]map[PodID]bool
+	// Index of the pods scheduled on each node.
+	podsByNode map[string]map[PodID]bool
+	// Index of the VPAs by their target ref. Normally there is a single VPA
+	// for each target.
+	targetRefToVPA map[targetRefKey]map[VpaID]*Vpa
+	// Cache of the VPA controlling each pod. Pods not matching any VPA are
+	// not present.
+	podToVpa map[PodID]*Vpa
 	// VPA objects in the cluster that have no recommendation mapped to the first
 	// time we've noticed the recommendation missing or last time we logged
-	// a warning about it.
-	emptyVPAs map[VpaID]time.Time
+	// a warning about it. Guarded by emptyVPAsMutex, as RecordRecommendation
+	// is called concurrently.
+	emptyVPAs      map[VpaID]time.Time
+	emptyVPAsMutex sync.Mutex
 	// Observed VPAs. Used to check if there are updates needed.
 	observedVPAs []*vpa_types.VerticalPodAutoscaler
 
 	// All container aggregations where the usage samples are stored.
-	aggregateStateMap aggregateContainerStatesMap
+	aggregateStates *aggregateStateShards
+	// Guards linking newly created aggregations to the VPAs, which may happen
+	// concurrently when samples are added from multiple goroutines.
+	aggregationLinkMutex sync.Mutex
 	// Map with all label sets used by the aggregations. It serves as a cache
 	// that allows to quickly access labels.Set corresponding to a labelSetKey.
 	labelSetMap labelSetMap
+	// Canonical copies of the label keys and values stored in labelSetMap
+	// and of the label set keys.
+	labelInterner *stringInterner
+	// Applied to the labels of pods before they are put in labelSetMap. Nil
+	// keeps the labels as they are.
+	labelNormalizer func(labels.Set) labels.Set
+	// Allocatable resources of the nodes in the cluster, keyed by node name.
+	// Used to cap recommendations to what the largest node can provide.
+	nodes map[string]apiv1.ResourceList
+	// LimitRanges of the namespaces, keyed by namespace. Used to cap
+	// recommendations returned by GetRecommendationForPod.
+	namespaceLimitRanges map[string]apiv1.LimitRange
+	// Namespaces from which pods are accepted. If nil, pods from all
+	// namespaces are accepted.
+	strictNamespaces map[string]bool
+	// Pods which don't match any VPA for at least this long are deleted by
+	// DeleteOrphanedPods. Zero disables the deletion.
+	autoDeleteOrphansAfter time.Duration
+
+	// Guards shuttingDown and adding to inFlightMutations.
+	shutdownMutex sync.RWMutex
+	// Set by GracefulShutdown. No mutations are accepted afterwards.
+	shuttingDown bool
+	// Mutations of pods, containers and their samples in progress.
+	inFlightMutations sync.WaitGroup
+	// Saves the final checkpoint in GracefulShutdown. Can be nil.
+	shutdownCheckpointer func(ctx context.Context) error
+	// CPU recommendations of containers restarted more than
+	// restartBumpThreshold times within restartBumpWindow are increased by
+	// restartBumpFraction. A zero threshold disables the bump.
+	restartBumpThreshold int
+	restartBumpWindow    time.Duration
+	restartBumpFraction  float64
+	// CPU recommendations of containers throttled more than
+	// throttlingBumpThreshold in each of the last throttlingBumpObservations
+	// observations are increased by throttlingBumpMultiplier times their
+	// average throttled fraction. Zero observations disable the bump.
+	throttlingBumpThreshold    float64
+	throttlingBumpObservations int
+	throttlingBumpMultiplier   float64
+	// VPAs younger than minVpaAgeForRecommendation get the
+	// WaitingForInitialData condition. Zero disables the condition.
+	minVpaAgeForRecommendation time.Duration
+	// Limits the rate of AddOrUpdatePod and AddOrUpdateVpa calls. Calls
+	// exceeding the rate wait, unless mutationQueueDepth calls are waiting
+	// already. Nil means no limit.
+	mutationLimiter    *rate.Limiter
+	mutationQueueDepth int
+	queuedMutations    atomic.Int32
+	// Samples started up to outOfOrderTolerance before the latest sample of
+	// the container are accepted instead of discarded.
+	outOfOrderTolerance time.Duration
+	// Limits of the rate at which samples are added to the aggregations.
+	sampleRateLimits      map[AggregateStateKey]*rate.Limiter
+	sampleRateLimitsMutex sync.RWMutex
+	// Transformers applied to the usage of samples before they are stored,
+	// keyed by resource, see RegisterResourceTransformer.
+	resourceTransformers      map[ResourceName]ResourceTransformer
+	resourceTransformersMutex sync.RWMutex
+	// External recommenders used instead of the built-in one, keyed by VPA.
+	externalRecommenders      map[VpaID]ExternalRecommender
+	externalRecommendersMutex sync.RWMutex
 
 	lastAggregateContainerStateGC time.Time
 	gcInterval                    time.Duration
+	// Estimated size of the aggregations above which they are garbage
+	// collected regardless of gcInterval. Zero means no threshold.
+	aggregationMemoryGCThreshold int64
+	// Estimated size of the aggregations above which they are garbage
+	// collected regardless of gcInterval, using a shorter history length.
+	// Zero means no threshold.
+	memoryPressureThreshold int64
+	// Source of the pod selectors of the VPAs synced by SyncObservedVPAs.
+	vpaSelectorFetcher VpaSelectorFetcher
+	// Receives all mutations of VPAs, pods and recommendations. Can be nil.
+	auditLog AuditLog
+	// Recommendations last written by FlushRecommendationsToStatus.
+	flushedRecommendations map[VpaID]*vpa_types.RecommendedPodResources
+	// Receives the IDs of the VPAs whose recommendation changed, see
+	// RecommendationUpdates. Nil until the first call of
+	// RecommendationUpdates.
+	recommendationUpdates       chan VpaID
+	recommendationUpdatesClosed bool
+	// Recommendations last sent to recommendationUpdates.
+	notifiedRecommendations map[VpaID]*vpa_types.RecommendedPodResources
+	// Guards recommendationUpdates, recommendationUpdatesClosed and
+	// notifiedRecommendations, which are used by concurrent
+	// RecordRecommendation calls.
+	recommendationUpdatesMutex sync.Mutex
+	// Recent recommendations recorded for each VPA, see GetVpaHistory.
+	// Guarded by vpaHistoriesMutex, as RecordRecommendation is called
+	// concurrently.
+	vpaHistories      map[VpaID]*vpaHistory
+	vpaHistoriesMutex sync.Mutex
 }
 
+// VpaSelectorFetcher returns the selector of the pods controlled by the given
+// VPA.
+type VpaSelectorFetcher func(ctx context.Context, vpa *vpa_types.VerticalPodAutoscaler) labels.Selector
+
+// ErrClusterStateShutDown is returned by mutations of the cluster state
+// started after GracefulShutdown was called.
+var ErrClusterStateShutDown = errors.New("cluster state is shut down")
+
+// ErrNilPod is returned by SimulateAdmission when it is called with a nil pod.
+var ErrNilPod = errors.New("cannot simulate admission of a nil pod")
+
+// DefaultMutationQueueDepth is the default number of rate limited mutations
+// which can wait at the same time, see SetMutationRateLimit.
+const DefaultMutationQueueDepth = 1000
+
 // StateMapSize is the number of pods being tracked by the VPA
 func (cluster *clusterState) StateMapSize() int {
-	return len(cluster.aggregateStateMap)
+	return cluster.aggregateStates.len()
 }
 
 // AggregateStateKey determines the set of containers for which the usage samples
@@ -119,21 +359,117 @@ type PodState struct {
 	InitContainers []string
 	// PodPhase describing current life cycle phase of the Pod.
 	Phase apiv1.PodPhase
+	// Time of the last eviction of the Pod, zero if it was never evicted.
+	LastEvictionTime time.Time
+	// Time when the Pod was added to the cluster state.
+	AddedTime time.Time
+	// Name of the node the Pod is scheduled on, empty if it isn't scheduled.
+	NodeName string
+	// Time at which DeleteOrphanedPods first noticed the Pod doesn't match any
+	// VPA, zero if it matches one.
+	orphanedSince time.Time
 }
 
 // NewClusterState returns a new clusterState with no pods.
 func NewClusterState(gcInterval time.Duration) *clusterState {
+	return NewClusterStateWithShards(gcInterval, DefaultAggregateStateShardCount)
+}
+
+// NewClusterStateWithShards returns a new clusterState with no pods, which
+// divides the aggregation key space into the given number of shards.
+// Requires shardCount >= 1.
+func NewClusterStateWithShards(gcInterval time.Duration, shardCount int) *clusterState {
 	return &clusterState{
 		pods:                          make(map[PodID]*PodState),
 		vpas:                          make(map[VpaID]*Vpa),
+		podToVpa:                      make(map[PodID]*Vpa),
+		targetRefToVPA:                make(map[targetRefKey]map[VpaID]*Vpa),
+		podsByPhase:                   make(map[apiv1.PodPhase]map[PodID]bool),
+		podsByNode:                    make(map[string]map[PodID]bool),
 		emptyVPAs:                     make(map[VpaID]time.Time),
-		aggregateStateMap:             make(aggregateContainerStatesMap),
+		aggregateStates:               newAggregateStateShards(shardCount),
 		labelSetMap:                   make(labelSetMap),
+		labelInterner:                 &stringInterner{},
+		nodes:                         make(map[string]apiv1.ResourceList),
+		namespaceLimitRanges:          make(map[string]apiv1.LimitRange),
+		externalRecommenders:          make(map[VpaID]ExternalRecommender),
+		sampleRateLimits:              make(map[AggregateStateKey]*rate.Limiter),
+		resourceTransformers:          make(map[ResourceName]ResourceTransformer),
+		mutationQueueDepth:            DefaultMutationQueueDepth,
+		vpaHistories:                  make(map[VpaID]*vpaHistory),
 		lastAggregateContainerStateGC: time.Unix(0, 0),
 		gcInterval:                    gcInterval,
 	}
 }
 
+// NamespaceStats holds aggregated information about VPAs and pods in a single
+// namespace.
+type NamespaceStats struct {
+	// RecommendedCPU is the total CPU recommended for all pods matched by VPAs
+	// in the namespace.
+	RecommendedCPU ResourceAmount
+	// RecommendedMemory is the total memory recommended for all pods matched
+	// by VPAs in the namespace.
+	RecommendedMemory ResourceAmount
+	// VpaCount is the number of VPA objects in the namespace.
+	VpaCount int
+	// PodCount is the number of pods in the namespace.
+	PodCount int
+}
+
+// EvictionCandidate describes a container which would benefit from applying
+// the recommendation of its VPA.
+type EvictionCandidate struct {
+	PodID       PodID
+	ContainerID ContainerID
+	// Resources currently requested by the container.
+	CurrentRequest Resources
+	// Target recommendation for the container.
+	RecommendedRequest Resources
+	// Sum over all resources of the absolute difference between the
+	// recommended and the current request, relative to the current request,
+	// so that every resource has the same weight.
+	Benefit float64
+}
+
+// SafetyViolation describes a container whose recommended resources are too
+// close to (or below) the 99th percentile of its actual usage.
+type SafetyViolation struct {
+	ContainerName string
+	Resource      ResourceName
+	// Target recommendation for the resource.
+	Recommended ResourceAmount
+	// 99th percentile of the actual usage of the resource.
+	P99Usage ResourceAmount
+}
+
+// ContainerUsageRank holds the 90th percentile of the usage of a resource by a
+// container, as observed by the aggregation the container belongs to.
+type ContainerUsageRank struct {
+	ContainerID       ContainerID
+	AggregateStateKey AggregateStateKey
+	P90Usage          ResourceAmount
+}
+
+// containerUsageRankHeap is a min-heap of ContainerUsageRanks ordered by P90Usage.
+type containerUsageRankHeap []ContainerUsageRank
+
+func (h containerUsageRankHeap) Len() int           { return len(h) }
+func (h containerUsageRankHeap) Less(i, j int) bool { return h[i].P90Usage < h[j].P90Usage }
+func (h containerUsageRankHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *containerUsageRankHeap) Push(x interface{}) {
+	*h = append(*h, x.(ContainerUsageRank))
+}
+
+func (h *containerUsageRankHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
 // ContainerUsageSampleWithKey holds a ContainerUsageSample together with the
 // ID of the container it belongs to.
 type ContainerUsageSampleWithKey struct {
@@ -146,14 +482,30 @@ type ContainerUsageSampleWithKey struct {
 // the Cluster object.
 // If the labels of the pod have changed, it updates the links between the containers
 // and the aggregations.
-func (cluster *clusterState) AddOrUpdatePod(podID PodID, newLabels labels.Set, phase apiv1.PodPhase) {
+// In strict namespace mode pods from namespaces which are not listed are
+// rejected with an error. Otherwise pods from namespaces without any VPA are
+// accepted, but a warning is logged.
+func (cluster *clusterState) AddOrUpdatePod(podID PodID, newLabels labels.Set, phase apiv1.PodPhase) error {
+	if err := cluster.waitForMutationRateLimit("AddOrUpdatePod"); err != nil {
+		return err
+	}
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
+	if err := cluster.validatePodNamespace(podID); err != nil {
+		return err
+	}
 	pod, podExists := cluster.pods[podID]
+	var before interface{}
 	if !podExists {
 		pod = newPod(podID)
 		cluster.pods[podID] = pod
+	} else if cluster.auditLog != nil {
+		before = cluster.snapshotPod(pod)
 	}
 
-	newlabelSetKey := cluster.getLabelSetKey(newLabels)
+	newlabelSetKey := cluster.getLabelSetKey(cluster.aggregationLabels(podID, newLabels))
 	if podExists && pod.labelSetKey != newlabelSetKey {
 		// This Pod is already counted in the old VPA, remove the link.
 		cluster.removePodFromItsVpa(pod)
@@ -168,26 +520,429 @@ func (cluster *clusterState) AddOrUpdatePod(podID PodID, newLabels labels.Set, p
 
 		cluster.addPodToItsVpa(pod)
 	}
-	pod.Phase = phase
+	if !podExists || pod.Phase != phase {
+		cluster.removePodFromPhaseIndex(pod)
+		pod.Phase = phase
+		cluster.addPodToPhaseIndex(pod)
+	}
+	if cluster.auditLog != nil {
+		cluster.recordAuditUpdate(AuditEventPodAdded, AuditEventPodUpdated, podID, before, cluster.snapshotPod(pod))
+	}
+	return nil
+}
+
+// addPodToPhaseIndex adds the pod to the index entry of its current phase.
+func (cluster *clusterState) addPodToPhaseIndex(pod *PodState) {
+	podIDs, found := cluster.podsByPhase[pod.Phase]
+	if !found {
+		podIDs = make(map[PodID]bool)
+		cluster.podsByPhase[pod.Phase] = podIDs
+	}
+	podIDs[pod.ID] = true
+}
+
+// removePodFromPhaseIndex removes the pod from the index entry of its current
+// phase.
+func (cluster *clusterState) removePodFromPhaseIndex(pod *PodState) {
+	podIDs, found := cluster.podsByPhase[pod.Phase]
+	if !found {
+		return
+	}
+	delete(podIDs, pod.ID)
+	if len(podIDs) == 0 {
+		delete(cluster.podsByPhase, pod.Phase)
+	}
+}
+
+// GetPodsInPhase returns the IDs of the pods in the given phase, in no
+// particular order.
+func (cluster *clusterState) GetPodsInPhase(phase apiv1.PodPhase) []PodID {
+	result := make([]PodID, 0, len(cluster.podsByPhase[phase]))
+	for podID := range cluster.podsByPhase[phase] {
+		result = append(result, podID)
+	}
+	return result
+}
+
+// SetPodNodeName records the name of the node the pod is scheduled on. An
+// empty name means the pod isn't scheduled.
+func (cluster *clusterState) SetPodNodeName(podID PodID, nodeName string) error {
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
+	pod, podExists := cluster.pods[podID]
+	if !podExists {
+		return NewPodNotFoundError(podID)
+	}
+	if pod.NodeName == nodeName {
+		return nil
+	}
+	cluster.removePodFromNodeIndex(pod)
+	pod.NodeName = nodeName
+	cluster.addPodToNodeIndex(pod)
+	return nil
+}
+
+// addPodToNodeIndex adds the pod to the index entry of its current node, if
+// it is scheduled.
+func (cluster *clusterState) addPodToNodeIndex(pod *PodState) {
+	if pod.NodeName == "" {
+		return
+	}
+	podIDs, found := cluster.podsByNode[pod.NodeName]
+	if !found {
+		podIDs = make(map[PodID]bool)
+		cluster.podsByNode[pod.NodeName] = podIDs
+	}
+	podIDs[pod.ID] = true
+}
+
+// removePodFromNodeIndex removes the pod from the index entry of its current
+// node.
+func (cluster *clusterState) removePodFromNodeIndex(pod *PodState) {
+	podIDs, found := cluster.podsByNode[pod.NodeName]
+	if !found {
+		return
+	}
+	delete(podIDs, pod.ID)
+	if len(podIDs) == 0 {
+		delete(cluster.podsByNode, pod.NodeName)
+	}
+}
+
+// GetContainersByNode returns the IDs of the containers of the pods scheduled
+// on the given node, in no particular order.
+func (cluster *clusterState) GetContainersByNode(nodeName string) []ContainerID {
+	result := []ContainerID{}
+	for podID := range cluster.podsByNode[nodeName] {
+		for containerName := range cluster.pods[podID].Containers {
+			result = append(result, ContainerID{PodID: podID, ContainerName: containerName})
+		}
+	}
+	return result
+}
+
+// SetStrictNamespaceMode makes AddOrUpdatePod reject pods from namespaces
+// which are not listed. An empty list disables the strict namespace mode.
+func (cluster *clusterState) SetStrictNamespaceMode(namespaces []string) {
+	if len(namespaces) == 0 {
+		cluster.strictNamespaces = nil
+		return
+	}
+	cluster.strictNamespaces = make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		cluster.strictNamespaces[namespace] = true
+	}
+}
+
+// validatePodNamespace returns an error if pods from the namespace of the
+// given pod are not accepted in strict namespace mode. Logs a warning if no
+// VPA exists in the namespace.
+func (cluster *clusterState) validatePodNamespace(podID PodID) error {
+	if cluster.strictNamespaces != nil && !cluster.strictNamespaces[podID.Namespace] {
+		return NewNamespaceNotAllowedError(podID)
+	}
+	for vpaID := range cluster.vpas {
+		if vpaID.Namespace == podID.Namespace {
+			return nil
+		}
+	}
+	klog.V(4).InfoS("Pod added to a namespace without any VPA", "pod", klog.KRef(podID.Namespace, podID.PodName))
+	return nil
 }
 
-// addPodToItsVpa increases the count of Pods associated with a VPA object.
+// addPodToItsVpa increases the count of Pods associated with a VPA object
+// and caches the VPA controlling the pod.
 // Does a scan similar to findOrCreateAggregateContainerState so could be optimized if needed.
 func (cluster *clusterState) addPodToItsVpa(pod *PodState) {
 	for _, vpa := range cluster.vpas {
 		if vpa_utils.PodLabelsMatchVPA(pod.ID.Namespace, cluster.labelSetMap[pod.labelSetKey], vpa.ID.Namespace, vpa.PodSelector) {
 			vpa.PodCount++
+			vpa.updateNoPodsMatchedCondition()
+			cluster.cacheVpaForPod(pod.ID, vpa)
 		}
 	}
 }
 
-// removePodFromItsVpa decreases the count of Pods associated with a VPA object.
+// removePodFromItsVpa decreases the count of Pods associated with a VPA object
+// and drops the pod from the cache of controlling VPAs.
 func (cluster *clusterState) removePodFromItsVpa(pod *PodState) {
 	for _, vpa := range cluster.vpas {
 		if vpa_utils.PodLabelsMatchVPA(pod.ID.Namespace, cluster.labelSetMap[pod.labelSetKey], vpa.ID.Namespace, vpa.PodSelector) {
 			vpa.PodCount--
+			vpa.updateNoPodsMatchedCondition()
+		}
+	}
+	delete(cluster.podToVpa, pod.ID)
+}
+
+// cacheVpaForPod records the VPA as controlling the pod, unless another VPA
+// with a lower ID is already cached for it, see GetControllingVPA. If the pod
+// matches multiple VPAs, a warning is logged.
+func (cluster *clusterState) cacheVpaForPod(podID PodID, vpa *Vpa) {
+	if cached, found := cluster.podToVpa[podID]; found && cached != vpa {
+		used, ignored := cached, vpa
+		if compareVpaIDs(vpa.ID, cached.ID) < 0 {
+			used, ignored = vpa, cached
+		}
+		klog.V(2).InfoS("Pod matches multiple VPAs, using the one with the lowest name", "pod", klog.KRef(podID.Namespace, podID.PodName),
+			"vpa", klog.KRef(used.ID.Namespace, used.ID.VpaName), "ignoredVpa", klog.KRef(ignored.ID.Namespace, ignored.ID.VpaName))
+		vpa = used
+	}
+	cluster.podToVpa[podID] = vpa
+}
+
+// compareVpaIDs orders VPA IDs by namespace and name.
+func compareVpaIDs(a, b VpaID) int {
+	return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.VpaName, b.VpaName))
+}
+
+// GetOrphanedPods returns the IDs of the pods which don't match any VPA and
+// so will never receive a recommendation.
+func (cluster *clusterState) GetOrphanedPods() []PodID {
+	orphans := []PodID{}
+	for podID := range cluster.pods {
+		if _, found := cluster.podToVpa[podID]; !found {
+			orphans = append(orphans, podID)
+		}
+	}
+	return orphans
+}
+
+// GetPodsWithoutSamples returns the IDs of the pods added more than minAge
+// before now, none of whose containers received any usage sample. Such pods
+// indicate a problem with fetching the metrics.
+func (cluster *clusterState) GetPodsWithoutSamples(minAge time.Duration, now time.Time) []PodID {
+	result := []PodID{}
+	for podID, pod := range cluster.pods {
+		if now.Sub(pod.AddedTime) <= minAge {
+			continue
+		}
+		sampled := false
+		for _, container := range pod.Containers {
+			if container.hasSamples() {
+				sampled = true
+				break
+			}
+		}
+		if !sampled {
+			result = append(result, podID)
+		}
+	}
+	return result
+}
+
+// GetPodAgeDistribution returns the ages of all pods, i.e. the time elapsed
+// between adding each pod to the cluster state and now, sorted ascending.
+func (cluster *clusterState) GetPodAgeDistribution(now time.Time) []time.Duration {
+	ages := make([]time.Duration, 0, len(cluster.pods))
+	for _, pod := range cluster.pods {
+		ages = append(ages, now.Sub(pod.AddedTime))
+	}
+	sort.Slice(ages, func(i, j int) bool { return ages[i] < ages[j] })
+	return ages
+}
+
+// GetPodAgePercentile returns the given percentile of the pod ages, see
+// GetPodAgeDistribution, using the nearest-rank method. The percentile is a
+// number between 0 and 1, e.g. 0.5 corresponds to the median. Returns 0 if
+// there are no pods.
+func (cluster *clusterState) GetPodAgePercentile(percentile float64, now time.Time) time.Duration {
+	ages := cluster.GetPodAgeDistribution(now)
+	if len(ages) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(percentile*float64(len(ages)))) - 1
+	return ages[max(0, min(rank, len(ages)-1))]
+}
+
+// SetAutoDeleteOrphans makes DeleteOrphanedPods delete pods which haven't
+// matched any VPA for at least the given duration. Zero or a negative duration
+// disables the deletion.
+func (cluster *clusterState) SetAutoDeleteOrphans(after time.Duration) {
+	cluster.autoDeleteOrphansAfter = after
+}
+
+// DeleteOrphanedPods deletes the pods which haven't matched any VPA since at
+// least the duration set with SetAutoDeleteOrphans and returns their IDs. The
+// time a pod became orphaned is the time of the first call noticing it, so
+// this should be called periodically. Does nothing if auto deletion of orphans
+// is disabled.
+// Note: deleted pods are tracked again if the cluster state feeder adds them
+// back.
+func (cluster *clusterState) DeleteOrphanedPods(now time.Time) []PodID {
+	deleted := []PodID{}
+	if cluster.autoDeleteOrphansAfter <= 0 {
+		return deleted
+	}
+	for podID, pod := range cluster.pods {
+		if _, found := cluster.podToVpa[podID]; found {
+			pod.orphanedSince = time.Time{}
+			continue
+		}
+		if pod.orphanedSince.IsZero() {
+			pod.orphanedSince = now
+		}
+		if now.Sub(pod.orphanedSince) >= cluster.autoDeleteOrphansAfter {
+			deleted = append(deleted, podID)
+		}
+	}
+	for _, podID := range deleted {
+		klog.V(3).InfoS("Deleting orphaned Pod", "pod", klog.KRef(podID.Namespace, podID.PodName))
+		cluster.DeletePod(podID)
+	}
+	return deleted
+}
+
+// GetVpaForPod returns the VPA controlling the pod with the given ID, or nil
+// if the pod doesn't match any VPA. Unlike GetControllingVPA it doesn't scan
+// all VPAs. Returns an error if the pod doesn't exist.
+func (cluster *clusterState) GetVpaForPod(podID PodID) (*Vpa, error) {
+	if _, podExists := cluster.pods[podID]; !podExists {
+		return nil, NewPodNotFoundError(podID)
+	}
+	return cluster.podToVpa[podID], nil
+}
+
+// TrimSamples removes the samples started before the given time from all
+// aggregations, without removing the aggregations themselves, see
+// AggregateContainerState.TrimSamplesBefore. Returns the number of removed
+// samples. The histograms don't keep the times of individual samples, so only
+// aggregations whose samples all started before the given time are trimmed,
+// and they are emptied. Old samples of aggregations which still receive
+// samples are not removed; with decaying histograms they only lose weight
+// over time.
+func (cluster *clusterState) TrimSamples(before time.Time) int {
+	if err := cluster.startMutation(); err != nil {
+		klog.V(4).InfoS("Not trimming samples", "error", err)
+		return 0
+	}
+	defer cluster.inFlightMutations.Done()
+	removed := 0
+	cluster.ForEachAggregation(func(key AggregateStateKey, aggregation *AggregateContainerState) bool {
+		unlock := cluster.aggregateStates.lockSamples(key)
+		removed += aggregation.TrimSamplesBefore(before)
+		unlock()
+		return true
+	})
+	return removed
+}
+
+// RebalanceAggregations merges aggregations which became split after the label
+// key oldLabelKey was renamed to newLabelKey. For every aggregation keyed by
+// labels containing oldLabelKey, the aggregation of the same container in the
+// same namespace with that label renamed to newLabelKey (and otherwise equal
+// labels) absorbs its samples, and the old aggregation is removed. Aggregations
+// still used by pods present in the cluster state are left untouched, since
+// these pods keep adding samples to them.
+func (cluster *clusterState) RebalanceAggregations(oldLabelKey, newLabelKey string) {
+	if oldLabelKey == newLabelKey {
+		return
+	}
+	if err := cluster.startMutation(); err != nil {
+		klog.V(4).InfoS("Not rebalancing aggregations", "error", err)
+		return
+	}
+	defer cluster.inFlightMutations.Done()
+	inUse := make(map[AggregateStateKey]bool)
+	for _, pod := range cluster.pods {
+		for containerName := range pod.Containers {
+			inUse[cluster.MakeAggregateStateKey(pod, containerName)] = true
+		}
+	}
+	merged := 0
+	cluster.ForEachAggregation(func(key AggregateStateKey, oldAggregation *AggregateContainerState) bool {
+		oldKey, ok := key.(aggregateStateKey)
+		if !ok || inUse[oldKey] || oldKey.labelSetMap == nil {
+			return true
+		}
+		oldLabels := (*oldKey.labelSetMap)[oldKey.labelSetKey]
+		if !oldLabels.Has(oldLabelKey) || oldLabels.Has(newLabelKey) {
+			return true
+		}
+		renamed := make(labels.Set, len(oldLabels))
+		for name, value := range oldLabels {
+			renamed[name] = value
+		}
+		renamed[newLabelKey] = renamed[oldLabelKey]
+		delete(renamed, oldLabelKey)
+		// Label set keys are the string representation of the label set.
+		newKey := aggregateStateKey{
+			namespace:     oldKey.namespace,
+			containerName: oldKey.containerName,
+			labelSetKey:   labelSetKey(renamed.String()),
+			labelSetMap:   oldKey.labelSetMap,
+		}
+		newAggregation, found := cluster.aggregateStates.get(newKey)
+		if !found {
+			return true
+		}
+		// The old aggregation isn't used by any pod, so only the merged one
+		// can receive samples concurrently.
+		unlock := cluster.aggregateStates.lockSamples(newKey)
+		newAggregation.MergeContainerState(oldAggregation)
+		unlock()
+		cluster.aggregateStates.delete(oldKey)
+		for _, vpa := range cluster.vpas {
+			vpa.DeleteAggregation(oldKey)
+		}
+		merged++
+		return true
+	})
+	klog.V(2).InfoS("Rebalanced aggregations after label key rename", "oldLabelKey", oldLabelKey, "newLabelKey", newLabelKey, "merged", merged)
+}
+
+// GetContainerLastSampleTime returns the start of the latest sample added to
+// the aggregation of the given container, or the zero time if it has no
+// samples. Returns an error if the container doesn't exist.
+func (cluster *clusterState) GetContainerLastSampleTime(containerID ContainerID) (time.Time, error) {
+	pod, podExists := cluster.pods[containerID.PodID]
+	if !podExists {
+		return time.Time{}, NewPodNotFoundError(containerID.PodID)
+	}
+	if _, containerExists := pod.Containers[containerID.ContainerName]; !containerExists {
+		return time.Time{}, NewContainerNotFoundError(containerID)
+	}
+	aggregationKey := cluster.MakeAggregateStateKey(pod, containerID.ContainerName)
+	aggregation, found := cluster.aggregateStates.get(aggregationKey)
+	if !found {
+		return time.Time{}, nil
+	}
+	unlock := cluster.aggregateStates.lockSamples(aggregationKey)
+	defer unlock()
+	return aggregation.LastSampleTime(), nil
+}
+
+// GetStalePods returns the IDs of the pods, sorted, whose containers all
+// received their latest usage sample at least maxSampleAge before now. The
+// time the pod was added to the cluster state stands in for the latest sample
+// of containers without samples. Pods without containers are skipped.
+func (cluster *clusterState) GetStalePods(maxSampleAge time.Duration, now time.Time) []PodID {
+	stale := []PodID{}
+	for podID, pod := range cluster.pods {
+		if len(pod.Containers) == 0 {
+			continue
+		}
+		fresh := false
+		for _, container := range pod.Containers {
+			lastSample := container.lastSampleStart()
+			if lastSample.IsZero() {
+				lastSample = pod.AddedTime
+			}
+			if now.Sub(lastSample) < maxSampleAge {
+				fresh = true
+				break
+			}
+		}
+		if !fresh {
+			stale = append(stale, podID)
 		}
 	}
+	slices.SortFunc(stale, func(a, b PodID) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.PodName, b.PodName))
+	})
+	return stale
 }
 
 // GetContainer returns the ContainerState object for a given ContainerID or
@@ -205,72 +960,383 @@ func (cluster *clusterState) GetContainer(containerID ContainerID) *ContainerSta
 
 // DeletePod removes an existing pod from the cluster.
 func (cluster *clusterState) DeletePod(podID PodID) {
+	if err := cluster.startMutation(); err != nil {
+		klog.V(4).InfoS("Not deleting pod", "pod", podID, "error", err)
+		return
+	}
+	defer cluster.inFlightMutations.Done()
 	pod, found := cluster.pods[podID]
 	if found {
 		cluster.removePodFromItsVpa(pod)
+		cluster.removePodFromPhaseIndex(pod)
+		cluster.removePodFromNodeIndex(pod)
+		if cluster.auditLog != nil {
+			cluster.recordAudit(AuditEventPodDeleted, podID, time.Now(), cluster.snapshotPod(pod), nil)
+		}
 	}
 	delete(cluster.pods, podID)
 }
 
+// RenamePod changes the ID of the pod with the given oldID to newID, keeping
+// its containers, their samples, labels and the link to the VPA. Both IDs must
+// be in the same namespace, so that the aggregations used by the containers
+// don't change.
+func (cluster *clusterState) RenamePod(oldID PodID, newID PodID) error {
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
+	pod, podExists := cluster.pods[oldID]
+	if !podExists {
+		return NewPodNotFoundError(oldID)
+	}
+	if oldID == newID {
+		return nil
+	}
+	if oldID.Namespace != newID.Namespace {
+		return NewNamespaceChangeError("pod", oldID.Namespace, oldID.PodName, newID.Namespace)
+	}
+	if _, found := cluster.pods[newID]; found {
+		return NewAlreadyExistsError("pod", newID.Namespace, newID.PodName)
+	}
+	cluster.removePodFromPhaseIndex(pod)
+	cluster.removePodFromNodeIndex(pod)
+	pod.ID = newID
+	cluster.addPodToPhaseIndex(pod)
+	cluster.addPodToNodeIndex(pod)
+	cluster.pods[newID] = pod
+	delete(cluster.pods, oldID)
+	for containerName, container := range pod.Containers {
+		// Proxies look the aggregation up by the container ID.
+		if _, isProxy := container.aggregator.(*ContainerStateAggregatorProxy); isProxy {
+			container.aggregator = NewContainerStateAggregatorProxy(cluster, ContainerID{PodID: newID, ContainerName: containerName})
+		}
+	}
+	if vpa, found := cluster.podToVpa[oldID]; found {
+		cluster.podToVpa[newID] = vpa
+		delete(cluster.podToVpa, oldID)
+	}
+	return nil
+}
+
 // AddOrUpdateContainer creates a new container with the given ContainerID and
 // adds it to the parent pod in the clusterState object, if not yet present.
 // Requires the pod to be added to the clusterState first. Otherwise an error is
-// returned.
-func (cluster *clusterState) AddOrUpdateContainer(containerID ContainerID, request Resources) error {
+// returned. Returns true if the stored request of the container changed, which
+// is always the case for a new container.
+func (cluster *clusterState) AddOrUpdateContainer(containerID ContainerID, request Resources) (requestChanged bool, err error) {
+	if err := cluster.startMutation(); err != nil {
+		return false, err
+	}
+	defer cluster.inFlightMutations.Done()
 	pod, podExists := cluster.pods[containerID.PodID]
 	if !podExists {
-		return NewKeyError(containerID.PodID)
+		return false, NewPodNotFoundError(containerID.PodID)
 	}
-	if container, containerExists := pod.Containers[containerID.ContainerName]; !containerExists {
+	container, containerExists := pod.Containers[containerID.ContainerName]
+	if !containerExists {
 		cluster.findOrCreateAggregateContainerState(containerID)
 		pod.Containers[containerID.ContainerName] = NewContainerState(request, NewContainerStateAggregatorProxy(cluster, containerID))
-	} else {
-		// Container aleady exists. Possibly update the request.
-		container.Request = request
+		return true, nil
 	}
-	return nil
+	// Container aleady exists. Possibly update the request.
+	requestChanged = !maps.Equal(container.Request, request)
+	container.Request = request
+	container.EphemeralStorageRequest = request[ResourceEphemeralStorage]
+	return requestChanged, nil
 }
 
 // AddSample adds a new usage sample to the proper container in the clusterState
 // object. Requires the container as well as the parent pod to be added to the
-// clusterState first. Otherwise an error is returned.
+// clusterState first. Otherwise an error is returned. The usage is converted
+// by the transformer registered for the resource of the sample, if any.
+// AddSample may be called from multiple goroutines, but not concurrently with
+// methods adding or removing pods, containers or VPAs, which are not guarded.
 func (cluster *clusterState) AddSample(sample *ContainerUsageSampleWithKey) error {
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
 	pod, podExists := cluster.pods[sample.Container.PodID]
 	if !podExists {
-		return NewKeyError(sample.Container.PodID)
+		return NewPodNotFoundError(sample.Container.PodID)
 	}
 	containerState, containerExists := pod.Containers[sample.Container.ContainerName]
 	if !containerExists {
-		return NewKeyError(sample.Container)
+		return NewContainerNotFoundError(sample.Container)
+	}
+	aggregationKey := cluster.MakeAggregateStateKey(pod, sample.Container.ContainerName)
+	unlock := cluster.aggregateStates.lockSamples(aggregationKey)
+	defer unlock()
+	if limiter := cluster.getSampleRateLimit(aggregationKey); limiter != nil && !limiter.AllowN(sample.MeasureStart, 1) {
+		return NewSampleThrottledError(sample.Container)
+	}
+	sample = cluster.transformSample(sample)
+	if sample.Resource != ResourceEphemeralStorage && containerState.inStartupWindow(sample.MeasureStart) {
+		if !sample.isValid(ResourceCPU) && !sample.isValid(ResourceMemory) {
+			return NewSampleDiscardedError(sample)
+		}
+		cluster.findOrCreateAggregateContainerState(sample.Container).addStartupSample(&sample.ContainerUsageSample)
+		return nil
+	}
+	if !containerState.AddSampleWithTolerance(&sample.ContainerUsageSample, cluster.outOfOrderTolerance) {
+		return NewSampleDiscardedError(sample)
+	}
+	return nil
+}
+
+// SetOutOfOrderTolerance makes AddSample accept samples started up to the
+// given duration before the latest sample of the container, e.g. to tolerate
+// clock skew between nodes. See ContainerState.AddSampleWithTolerance. Zero
+// or a negative tolerance discards all out-of-order samples.
+func (cluster *clusterState) SetOutOfOrderTolerance(tolerance time.Duration) {
+	cluster.outOfOrderTolerance = max(tolerance, 0)
+}
+
+// SetSampleRateLimit limits the rate at which samples are added to the
+// aggregation of the given container to maxSamplesPerMinute, measured by the
+// sample start times. Bursts of up to maxSamplesPerMinute samples are allowed.
+// The limit is shared by all containers using the same aggregation, i.e. with
+// the same name and pod labels. Zero or a negative limit removes it.
+func (cluster *clusterState) SetSampleRateLimit(containerID ContainerID, maxSamplesPerMinute int) {
+	if _, podExists := cluster.pods[containerID.PodID]; !podExists {
+		klog.V(2).InfoS("Cannot set sample rate limit of a container of an unknown pod", "pod", klog.KRef(containerID.Namespace, containerID.PodName), "container", containerID.ContainerName)
+		return
+	}
+	key := cluster.aggregateStateKeyForContainerID(containerID)
+	cluster.sampleRateLimitsMutex.Lock()
+	defer cluster.sampleRateLimitsMutex.Unlock()
+	if maxSamplesPerMinute <= 0 {
+		delete(cluster.sampleRateLimits, key)
+		return
+	}
+	cluster.sampleRateLimits[key] = rate.NewLimiter(rate.Limit(float64(maxSamplesPerMinute)/time.Minute.Seconds()), maxSamplesPerMinute)
+}
+
+// SetMutationRateLimit limits the rate of AddOrUpdatePod and AddOrUpdateVpa
+// calls to operationsPerSecond, allowing bursts of the same size, e.g. to
+// smooth the processing of all pods and VPAs on startup. Calls exceeding the
+// limit wait for their turn; if too many of them are waiting already, see
+// SetMutationQueueDepth, they fail with RateLimitedError. Zero or a negative
+// limit removes it.
+func (cluster *clusterState) SetMutationRateLimit(operationsPerSecond int) {
+	if operationsPerSecond <= 0 {
+		cluster.mutationLimiter = nil
+		return
+	}
+	cluster.mutationLimiter = rate.NewLimiter(rate.Limit(operationsPerSecond), operationsPerSecond)
+}
+
+// SetMutationQueueDepth sets the number of rate limited mutations which can
+// wait at the same time. Defaults to DefaultMutationQueueDepth.
+func (cluster *clusterState) SetMutationQueueDepth(depth int) {
+	cluster.mutationQueueDepth = depth
+}
+
+// waitForMutationRateLimit waits until the operation is allowed by the
+// mutation rate limit. Returns RateLimitedError without waiting if the queue
+// of waiting operations is full.
+func (cluster *clusterState) waitForMutationRateLimit(operation string) error {
+	limiter := cluster.mutationLimiter
+	if limiter == nil {
+		return nil
+	}
+	reservation := limiter.Reserve()
+	delay := reservation.Delay()
+	if delay == 0 {
+		return nil
 	}
-	if !containerState.AddSample(&sample.ContainerUsageSample) {
-		return fmt.Errorf("sample discarded (invalid or out of order)")
+	if int(cluster.queuedMutations.Add(1)) > cluster.mutationQueueDepth {
+		cluster.queuedMutations.Add(-1)
+		reservation.Cancel()
+		return NewRateLimitedError(operation)
 	}
+	defer cluster.queuedMutations.Add(-1)
+	time.Sleep(delay)
 	return nil
 }
 
+// getSampleRateLimit returns the rate limiter of the aggregation with the given
+// key, or nil if its samples are not limited.
+func (cluster *clusterState) getSampleRateLimit(key AggregateStateKey) *rate.Limiter {
+	cluster.sampleRateLimitsMutex.RLock()
+	defer cluster.sampleRateLimitsMutex.RUnlock()
+	return cluster.sampleRateLimits[key]
+}
+
 // RecordOOM adds info regarding OOM event in the model as an artificial memory sample.
+//
+// Deprecated: use RecordOOMWithContext, passing context.Background() if
+// recording the OOM shouldn't be cancelled.
 func (cluster *clusterState) RecordOOM(containerID ContainerID, timestamp time.Time, requestedMemory ResourceAmount) error {
+	return cluster.RecordOOMWithContext(context.Background(), containerID, timestamp, requestedMemory)
+}
+
+// RecordOOMWithContext adds info regarding OOM event in the model as an
+// artificial memory sample. Returns ctx.Err() without recording the OOM if the
+// context is done.
+func (cluster *clusterState) RecordOOMWithContext(ctx context.Context, containerID ContainerID, timestamp time.Time, requestedMemory ResourceAmount) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
 	pod, podExists := cluster.pods[containerID.PodID]
 	if !podExists {
-		return NewKeyError(containerID.PodID)
+		return NewPodNotFoundError(containerID.PodID)
+	}
+	return cluster.recordOOM(pod, containerID, timestamp, requestedMemory)
+}
+
+// OOMEvent describes an OOM kill of a container recorded with RecordOOMs.
+type OOMEvent struct {
+	ContainerID     ContainerID
+	Timestamp       time.Time
+	RequestedMemory ResourceAmount
+}
+
+// RecordOOMs records the given OOM events like RecordOOM, looking each pod up
+// only once. Returns the error of recording each event, nil if it was
+// recorded. A failure to record an event doesn't affect the other events.
+func (cluster *clusterState) RecordOOMs(events []OOMEvent) []error {
+	errs := make([]error, len(events))
+	if err := cluster.startMutation(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	defer cluster.inFlightMutations.Done()
+	pods := make(map[PodID]*PodState)
+	for i, event := range events {
+		pod, found := pods[event.ContainerID.PodID]
+		if !found {
+			pod = cluster.pods[event.ContainerID.PodID]
+			pods[event.ContainerID.PodID] = pod
+		}
+		if pod == nil {
+			errs[i] = NewPodNotFoundError(event.ContainerID.PodID)
+			continue
+		}
+		errs[i] = cluster.recordOOM(pod, event.ContainerID, event.Timestamp, event.RequestedMemory)
 	}
+	return errs
+}
+
+func (cluster *clusterState) recordOOM(pod *PodState, containerID ContainerID, timestamp time.Time, requestedMemory ResourceAmount) error {
 	containerState, containerExists := pod.Containers[containerID.ContainerName]
 	if !containerExists {
-		return NewKeyError(containerID.ContainerName)
+		return NewContainerNotFoundError(containerID)
 	}
+	unlock := cluster.aggregateStates.lockSamples(cluster.MakeAggregateStateKey(pod, containerID.ContainerName))
+	defer unlock()
 	err := containerState.RecordOOM(timestamp, requestedMemory)
 	if err != nil {
-		return fmt.Errorf("error while recording OOM for %v, Reason: %v", containerID, err)
+		return NewOOMRecordError(containerID, timestamp, err)
+	}
+	cluster.findOrCreateAggregateContainerState(containerID).recordOOM(timestamp)
+	return nil
+}
+
+// RecordCrash records a crash of the container in the model. Crashes caused
+// by the OOM killer are recorded like RecordOOM with the memory request of the
+// container, see ContainerState.RecordCrash. Other crashes are ignored.
+func (cluster *clusterState) RecordCrash(containerID ContainerID, timestamp time.Time, exitCode int32) error {
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
+	pod, podExists := cluster.pods[containerID.PodID]
+	if !podExists {
+		return NewPodNotFoundError(containerID.PodID)
+	}
+	containerState, containerExists := pod.Containers[containerID.ContainerName]
+	if !containerExists {
+		return NewContainerNotFoundError(containerID)
+	}
+	if exitCode != oomKillExitCode {
+		return nil
+	}
+	return cluster.recordOOM(pod, containerID, timestamp, containerState.Request[ResourceMemory])
+}
+
+// RecordCPUThrottling records the fraction of time the container with the
+// given ID was CPU throttled. Sustained throttling increases the CPU
+// recommendation, see SetCPUThrottlingBump.
+func (cluster *clusterState) RecordCPUThrottling(containerID ContainerID, timestamp time.Time, throttledFraction float64) error {
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
+	pod, podExists := cluster.pods[containerID.PodID]
+	if !podExists {
+		return NewPodNotFoundError(containerID.PodID)
+	}
+	containerState, containerExists := pod.Containers[containerID.ContainerName]
+	if !containerExists {
+		return NewContainerNotFoundError(containerID)
+	}
+	if err := containerState.RecordCPUThrottling(timestamp, throttledFraction); err != nil {
+		return NewThrottlingRecordError(containerID, timestamp, err)
+	}
+	return nil
+}
+
+// SetCPUThrottlingBump makes RecordRecommendation increase the recommended CPU
+// of containers throttled more than the threshold fraction of time in each of
+// the given number of the most recent observations. The CPU is multiplied by
+// 1 + multiplier * the average throttled fraction over these observations.
+// The number of observations is capped to ThrottlingHistorySize. Zero or a
+// negative number of observations disables the bump.
+func (cluster *clusterState) SetCPUThrottlingBump(threshold float64, observations int, multiplier float64) {
+	cluster.throttlingBumpThreshold = threshold
+	cluster.throttlingBumpObservations = min(observations, ThrottlingHistorySize)
+	cluster.throttlingBumpMultiplier = multiplier
+}
+
+// RecordRestart records a restart of the container with the given ID. Frequent
+// restarts not caused by OOMs may indicate CPU throttling, see
+// SetRestartCPUBump.
+func (cluster *clusterState) RecordRestart(containerID ContainerID, timestamp time.Time) error {
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
+	pod, podExists := cluster.pods[containerID.PodID]
+	if !podExists {
+		return NewPodNotFoundError(containerID.PodID)
+	}
+	containerState, containerExists := pod.Containers[containerID.ContainerName]
+	if !containerExists {
+		return NewContainerNotFoundError(containerID)
 	}
+	containerState.RecordRestart(timestamp)
 	return nil
 }
 
+// SetRestartCPUBump makes RecordRecommendation increase the recommended CPU
+// of containers which restarted more than threshold times within the window
+// before the recommendation time by the given fraction, e.g. 0.1 for 10%. The
+// threshold is capped to RestartHistorySize - 1. Zero or a negative threshold
+// disables the bump.
+func (cluster *clusterState) SetRestartCPUBump(threshold int, window time.Duration, bumpFraction float64) {
+	cluster.restartBumpThreshold = min(threshold, RestartHistorySize-1)
+	cluster.restartBumpWindow = window
+	cluster.restartBumpFraction = bumpFraction
+}
+
 // AddOrUpdateVpa adds a new VPA with a given ID to the clusterState if it
 // didn't yet exist. If the VPA already existed but had a different pod
 // selector, the pod selector is updated. Updates the links between the VPA and
 // all aggregations it matches.
 func (cluster *clusterState) AddOrUpdateVpa(apiObject *vpa_types.VerticalPodAutoscaler, selector labels.Selector) error {
+	if err := cluster.waitForMutationRateLimit("AddOrUpdateVpa"); err != nil {
+		return err
+	}
 	vpaID := VpaID{Namespace: apiObject.Namespace, VpaName: apiObject.Name}
 	annotationsMap := apiObject.Annotations
 	conditionsMap := make(vpaConditionsMap)
@@ -283,43 +1349,420 @@ func (cluster *clusterState) AddOrUpdateVpa(apiObject *vpa_types.VerticalPodAuto
 	}
 
 	vpa, vpaExists := cluster.vpas[vpaID]
+	var before interface{}
+	if vpaExists && cluster.auditLog != nil {
+		before = snapshotVpa(vpa)
+	}
+	if vpaExists && vpa.PodSelector.String() == selector.String() && isAnnotationOnlyChange(vpa, apiObject) {
+		vpa.Annotations = annotationsMap
+		if cluster.auditLog != nil {
+			cluster.recordAuditUpdate(AuditEventVpaAdded, AuditEventVpaUpdated, vpaID, before, snapshotVpa(vpa))
+		}
+		return nil
+	}
+	var additionalTargetRefs []autoscaling.CrossVersionObjectReference
 	if vpaExists && (vpa.PodSelector.String() != selector.String()) {
 		// Pod selector was changed. Delete the VPA object and recreate
-		// it with the new selector.
+		// it with the new selector. The additional target refs, the
+		// recommendation history and the external recommender aren't part
+		// of the API object, carry them over.
+		additionalTargetRefs = vpa.AdditionalTargetRefs
+		cluster.vpaHistoriesMutex.Lock()
+		history, hasHistory := cluster.vpaHistories[vpaID]
+		cluster.vpaHistoriesMutex.Unlock()
+		externalRecommender := cluster.GetExternalRecommender(vpaID)
 		if err := cluster.DeleteVpa(vpaID); err != nil {
 			return err
 		}
+		cluster.RegisterExternalRecommender(vpaID, externalRecommender)
+		if hasHistory {
+			cluster.vpaHistoriesMutex.Lock()
+			cluster.vpaHistories[vpaID] = history
+			cluster.vpaHistoriesMutex.Unlock()
+		}
 		vpaExists = false
+		// The deletion was audited, the new VPA is audited as added.
+		before = nil
 	}
 	if !vpaExists {
 		vpa = NewVpa(vpaID, selector, apiObject.CreationTimestamp.Time)
+		vpa.AdditionalTargetRefs = additionalTargetRefs
 		cluster.vpas[vpaID] = vpa
-		for aggregationKey, aggregation := range cluster.aggregateStateMap {
-			vpa.UseAggregationIfMatching(aggregationKey, aggregation)
+		vpa.AttachAggregations(cluster.aggregateStates.snapshot())
+		matchingPods := cluster.GetMatchingPods(vpa)
+		vpa.PodCount = len(matchingPods)
+		for _, podID := range matchingPods {
+			cluster.cacheVpaForPod(podID, vpa)
 		}
-		vpa.PodCount = len(cluster.GetMatchingPods(vpa))
 	}
-	vpa.TargetRef = apiObject.Spec.TargetRef
+	// Updating the spec walks all aggregations of the VPA, skip it for
+	// updates which only touch the status, e.g. a new recommendation.
+	specChanged := !vpaExists || vpaSpecChanged(vpa, apiObject)
+	if specChanged {
+		cluster.removeVpaFromTargetRefIndex(vpa)
+		vpa.TargetRef = apiObject.Spec.TargetRef
+		cluster.addVpaToTargetRefIndex(vpa)
+	}
 	vpa.Annotations = annotationsMap
+	vpa.SetSmoothingWindow(annotationsMap)
+	vpa.SetNeverDecreaseBelowRequest(annotationsMap)
+	vpa.SetCronJobAggregation(annotationsMap)
+	vpa.SetHistoryLength(annotationsMap)
+	vpa.DryRun = vpa_utils.IsDryRun(annotationsMap)
 	vpa.Conditions = conditionsMap
+	vpa.updateNoPodsMatchedCondition()
 	vpa.Recommendation = currentRecommendation
-	vpa.SetUpdateMode(apiObject.Spec.UpdatePolicy)
-	vpa.SetResourcePolicy(apiObject.Spec.ResourcePolicy)
+	if specChanged {
+		vpa.SetUpdateMode(apiObject.Spec.UpdatePolicy)
+		vpa.SetResourcePolicy(apiObject.Spec.ResourcePolicy)
+	}
 	vpa.SetAPIVersion(apiObject.GetObjectKind().GroupVersionKind().Version)
+	if cluster.auditLog != nil {
+		cluster.recordAuditUpdate(AuditEventVpaAdded, AuditEventVpaUpdated, vpaID, before, snapshotVpa(vpa))
+	}
 	return nil
 }
 
+// functionalVpaAnnotations are the VPA annotations which affect the behavior
+// of the VPA in the cluster state.
+var functionalVpaAnnotations = []string{
+	SmoothingWindowAnnotation,
+	NeverDecreaseBelowRequestAnnotation,
+	CronJobAggregationAnnotation,
+	HistoryLengthAnnotation,
+	vpa_utils.DryRunAnnotation,
+}
+
+// vpaSpecChanged returns true if the target ref, the resource policy or the
+// update mode of the VPA API object differ from the existing VPA.
+func vpaSpecChanged(existing *Vpa, apiObject *vpa_types.VerticalPodAutoscaler) bool {
+	if !apiequality.Semantic.DeepEqual(existing.TargetRef, apiObject.Spec.TargetRef) ||
+		!apiequality.Semantic.DeepEqual(existing.ResourcePolicy, apiObject.Spec.ResourcePolicy) {
+		return true
+	}
+	var updateMode *vpa_types.UpdateMode
+	if apiObject.Spec.UpdatePolicy != nil {
+		updateMode = apiObject.Spec.UpdatePolicy.UpdateMode
+	}
+	return !apiequality.Semantic.DeepEqual(existing.UpdateMode, updateMode)
+}
+
+// isAnnotationOnlyChange returns true if the VPA API object differs from the
+// existing VPA at most in annotations which don't affect the behavior of the
+// VPA, so that it doesn't need to be processed again. The pod selector is not
+// compared.
+func isAnnotationOnlyChange(existing *Vpa, apiObject *vpa_types.VerticalPodAutoscaler) bool {
+	for _, annotation := range functionalVpaAnnotations {
+		existingValue, existingFound := existing.Annotations[annotation]
+		newValue, newFound := apiObject.Annotations[annotation]
+		if existingFound != newFound || existingValue != newValue {
+			return false
+		}
+	}
+	if vpaSpecChanged(existing, apiObject) {
+		return false
+	}
+	if version := apiObject.GetObjectKind().GroupVersionKind().Version; version != "" && version != existing.APIVersion {
+		return false
+	}
+	conditionsMap := make(vpaConditionsMap)
+	for _, condition := range apiObject.Status.Conditions {
+		conditionsMap[condition.Type] = condition
+	}
+	// NoPodsMatched is derived from the matching pods, not the API object.
+	existingConditions := maps.Clone(existing.Conditions)
+	delete(existingConditions, vpa_types.NoPodsMatched)
+	delete(conditionsMap, vpa_types.NoPodsMatched)
+	if !apiequality.Semantic.DeepEqual(existingConditions, conditionsMap) {
+		return false
+	}
+	var recommendation *vpa_types.RecommendedPodResources
+	if conditionsMap[vpa_types.RecommendationProvided].Status == apiv1.ConditionTrue {
+		recommendation = apiObject.Status.Recommendation
+	}
+	return apiequality.Semantic.DeepEqual(existing.Recommendation, recommendation)
+}
+
 // DeleteVpa removes a VPA with the given ID from the clusterState.
 func (cluster *clusterState) DeleteVpa(vpaID VpaID) error {
 	vpa, vpaExists := cluster.vpas[vpaID]
 	if !vpaExists {
-		return NewKeyError(vpaID)
+		return NewVpaNotFoundError(vpaID)
 	}
 	for _, state := range vpa.aggregateContainerStates {
 		state.MarkNotAutoscaled()
 	}
 	delete(cluster.vpas, vpaID)
+	cluster.emptyVPAsMutex.Lock()
 	delete(cluster.emptyVPAs, vpaID)
+	cluster.emptyVPAsMutex.Unlock()
+	cluster.recommendationUpdatesMutex.Lock()
+	delete(cluster.notifiedRecommendations, vpaID)
+	cluster.recommendationUpdatesMutex.Unlock()
+	cluster.vpaHistoriesMutex.Lock()
+	delete(cluster.vpaHistories, vpaID)
+	cluster.vpaHistoriesMutex.Unlock()
+	cluster.RegisterExternalRecommender(vpaID, nil)
+	cluster.removeVpaFromTargetRefIndex(vpa)
+	if cluster.auditLog != nil {
+		cluster.recordAudit(AuditEventVpaDeleted, vpaID, time.Now(), snapshotVpa(vpa), nil)
+	}
+	// Pods controlled by the deleted VPA may still match another one.
+	for podID, cached := range cluster.podToVpa {
+		if cached != vpa {
+			continue
+		}
+		delete(cluster.podToVpa, podID)
+		if pod, podExists := cluster.pods[podID]; podExists {
+			if newVpa := cluster.GetControllingVPA(pod); newVpa != nil {
+				cluster.podToVpa[podID] = newVpa
+			}
+		}
+	}
+	return nil
+}
+
+// MigrateVpa changes the ID of a VPA in place, e.g. after it was renamed. The
+// VPA keeps its aggregations, recommendation, history, external recommender
+// and matched pods; pod matching is not re-evaluated. Returns an error if the
+// old VPA doesn't exist, a VPA with the new ID already exists or the new ID is
+// in another namespace, as the VPA only matches aggregations of its own
+// namespace.
+func (cluster *clusterState) MigrateVpa(oldID VpaID, newID VpaID) error {
+	vpa, vpaExists := cluster.vpas[oldID]
+	if !vpaExists {
+		return NewVpaNotFoundError(oldID)
+	}
+	if oldID == newID {
+		return nil
+	}
+	if oldID.Namespace != newID.Namespace {
+		return NewNamespaceChangeError("VPA", oldID.Namespace, oldID.VpaName, newID.Namespace)
+	}
+	if _, found := cluster.vpas[newID]; found {
+		return NewAlreadyExistsError("VPA", newID.Namespace, newID.VpaName)
+	}
+	cluster.removeVpaFromTargetRefIndex(vpa)
+	vpa.ID = newID
+	cluster.addVpaToTargetRefIndex(vpa)
+	cluster.vpas[newID] = vpa
+	delete(cluster.vpas, oldID)
+	cluster.emptyVPAsMutex.Lock()
+	if emptySince, found := cluster.emptyVPAs[oldID]; found {
+		cluster.emptyVPAs[newID] = emptySince
+		delete(cluster.emptyVPAs, oldID)
+	}
+	cluster.emptyVPAsMutex.Unlock()
+	cluster.vpaHistoriesMutex.Lock()
+	if history, found := cluster.vpaHistories[oldID]; found {
+		cluster.vpaHistories[newID] = history
+		delete(cluster.vpaHistories, oldID)
+	}
+	cluster.vpaHistoriesMutex.Unlock()
+	if flushed, found := cluster.flushedRecommendations[oldID]; found {
+		cluster.flushedRecommendations[newID] = flushed
+		delete(cluster.flushedRecommendations, oldID)
+	}
+	cluster.recommendationUpdatesMutex.Lock()
+	if notified, found := cluster.notifiedRecommendations[oldID]; found {
+		cluster.notifiedRecommendations[newID] = notified
+		delete(cluster.notifiedRecommendations, oldID)
+	}
+	cluster.recommendationUpdatesMutex.Unlock()
+	cluster.RegisterExternalRecommender(newID, cluster.GetExternalRecommender(oldID))
+	cluster.RegisterExternalRecommender(oldID, nil)
+	return nil
+}
+
+// targetRefKey identifies the target of a VPA.
+type targetRefKey struct {
+	namespace string
+	kind      string
+	name      string
+}
+
+// targetRefKeys returns the index keys of the target ref and the additional
+// target refs of the VPA.
+func targetRefKeys(vpa *Vpa) []targetRefKey {
+	keys := make([]targetRefKey, 0, len(vpa.AdditionalTargetRefs)+1)
+	if vpa.TargetRef != nil {
+		keys = append(keys, targetRefKey{namespace: vpa.ID.Namespace, kind: vpa.TargetRef.Kind, name: vpa.TargetRef.Name})
+	}
+	for _, targetRef := range vpa.AdditionalTargetRefs {
+		keys = append(keys, targetRefKey{namespace: vpa.ID.Namespace, kind: targetRef.Kind, name: targetRef.Name})
+	}
+	return keys
+}
+
+// addVpaToTargetRefIndex adds the VPA to the index entries of its current
+// target ref and additional target refs.
+func (cluster *clusterState) addVpaToTargetRefIndex(vpa *Vpa) {
+	for _, key := range targetRefKeys(vpa) {
+		vpas, found := cluster.targetRefToVPA[key]
+		if !found {
+			vpas = make(map[VpaID]*Vpa)
+			cluster.targetRefToVPA[key] = vpas
+		}
+		vpas[vpa.ID] = vpa
+	}
+}
+
+// removeVpaFromTargetRefIndex removes the VPA from the index entries of its
+// current target ref and additional target refs.
+func (cluster *clusterState) removeVpaFromTargetRefIndex(vpa *Vpa) {
+	for _, key := range targetRefKeys(vpa) {
+		vpas, found := cluster.targetRefToVPA[key]
+		if !found {
+			continue
+		}
+		delete(vpas, vpa.ID)
+		if len(vpas) == 0 {
+			delete(cluster.targetRefToVPA, key)
+		}
+	}
+}
+
+// SetAdditionalTargetRefs replaces the additional target refs of the VPA with
+// the given ID, in preparation for VPAs targeting multiple controllers. The
+// VPA is found by GetVpaByTargetRef for each of them as well as for its
+// TargetRef. Returns an error if the VPA doesn't exist.
+func (cluster *clusterState) SetAdditionalTargetRefs(vpaID VpaID, targetRefs []autoscaling.CrossVersionObjectReference) error {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists {
+		return NewVpaNotFoundError(vpaID)
+	}
+	cluster.removeVpaFromTargetRefIndex(vpa)
+	vpa.AdditionalTargetRefs = slices.Clone(targetRefs)
+	cluster.addVpaToTargetRefIndex(vpa)
+	return nil
+}
+
+// GetVpaByTargetRef returns the VPA targeting the controller of the given kind
+// and name in the given namespace, with its TargetRef or one of its
+// AdditionalTargetRefs. Returns a TargetRefNotFoundError if there is no such
+// VPA and a MultipleMatchesError if there are several of them.
+func (cluster *clusterState) GetVpaByTargetRef(kind string, name string, namespace string) (*Vpa, error) {
+	key := targetRefKey{namespace: namespace, kind: kind, name: name}
+	vpas := cluster.targetRefToVPA[key]
+	switch len(vpas) {
+	case 0:
+		return nil, NewTargetRefNotFoundError(namespace, kind, name)
+	case 1:
+		for _, vpa := range vpas {
+			return vpa, nil
+		}
+	}
+	return nil, NewMultipleMatchesError(key, len(vpas))
+}
+
+// AddOrUpdateNode sets the allocatable resources of the node with the given
+// name. Recommendations are capped to the allocatable resources of the largest
+// known node.
+func (cluster *clusterState) AddOrUpdateNode(nodeID string, allocatable apiv1.ResourceList) {
+	cluster.nodes[nodeID] = allocatable.DeepCopy()
+}
+
+// DeleteNode removes the node with the given name from the clusterState.
+// If no nodes are left, recommendations are no longer capped.
+func (cluster *clusterState) DeleteNode(nodeID string) {
+	delete(cluster.nodes, nodeID)
+}
+
+// SetNamespaceLimitRange sets the LimitRange of the given namespace.
+// Recommendations returned by GetRecommendationForPod are capped to its
+// maximum values for containers and pods.
+func (cluster *clusterState) SetNamespaceLimitRange(namespace string, limitRange apiv1.LimitRange) {
+	cluster.namespaceLimitRanges[namespace] = *limitRange.DeepCopy()
+}
+
+// DeleteNamespaceLimitRange removes the LimitRange of the given namespace.
+func (cluster *clusterState) DeleteNamespaceLimitRange(namespace string) {
+	delete(cluster.namespaceLimitRanges, namespace)
+}
+
+// limitRangeMax returns the lowest maximum of each resource over the items of
+// the LimitRange of the given namespace with the given type. Returns nil if
+// there is no such item.
+func (cluster *clusterState) limitRangeMax(namespace string, limitType apiv1.LimitType) apiv1.ResourceList {
+	limitRange, found := cluster.namespaceLimitRanges[namespace]
+	if !found {
+		return nil
+	}
+	var result apiv1.ResourceList
+	for _, item := range limitRange.Spec.Limits {
+		if item.Type != limitType {
+			continue
+		}
+		if result == nil {
+			result = apiv1.ResourceList{}
+		}
+		for resourceName, quantity := range item.Max {
+			if current, found := result[resourceName]; !found || quantity.Cmp(current) < 0 {
+				result[resourceName] = quantity
+			}
+		}
+	}
+	return result
+}
+
+// GetUpdateMode returns the update mode of the VPA with the given ID. The
+// returned mode is nil if the VPA doesn't specify it.
+func (cluster *clusterState) GetUpdateMode(vpaID VpaID) (*vpa_types.UpdateMode, error) {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists {
+		return nil, NewVpaNotFoundError(vpaID)
+	}
+	return vpa.UpdateMode, nil
+}
+
+// GetAggregationsForVpa returns a copy of the map of the aggregations linked
+// to the VPA with the given ID. The aggregations themselves are not copied.
+func (cluster *clusterState) GetAggregationsForVpa(vpaID VpaID) (map[AggregateStateKey]*AggregateContainerState, error) {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists {
+		return nil, NewVpaNotFoundError(vpaID)
+	}
+	return maps.Clone(vpa.aggregateContainerStates), nil
+}
+
+// FilterVPAsByUpdateMode returns the IDs of VPAs in the given update mode.
+// VPAs which don't specify the update mode are considered to be in the
+// default Auto mode.
+func (cluster *clusterState) FilterVPAsByUpdateMode(mode vpa_types.UpdateMode) []VpaID {
+	vpaIDs := []VpaID{}
+	for vpaID, vpa := range cluster.vpas {
+		vpaMode := vpa_types.UpdateModeAuto
+		if vpa.UpdateMode != nil && *vpa.UpdateMode != "" {
+			vpaMode = *vpa.UpdateMode
+		}
+		if vpaMode == mode {
+			vpaIDs = append(vpaIDs, vpaID)
+		}
+	}
+	return vpaIDs
+}
+
+// DetachVpaFromAggregations stops the VPA with the given ID from influencing
+// the aggregations without deleting the VPA. All aggregations of the VPA are
+// marked as not autoscaled and the VPA won't use new aggregations until it is
+// reattached with ReattachVpaToAggregations.
+func (cluster *clusterState) DetachVpaFromAggregations(vpaID VpaID) error {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists {
+		return NewVpaNotFoundError(vpaID)
+	}
+	vpa.DetachAggregations()
+	return nil
+}
+
+// ReattachVpaToAggregations links a VPA detached with DetachVpaFromAggregations
+// to all aggregations it matches.
+func (cluster *clusterState) ReattachVpaToAggregations(vpaID VpaID) error {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists {
+		return NewVpaNotFoundError(vpaID)
+	}
+	vpa.AttachAggregations(cluster.aggregateStates.snapshot())
 	return nil
 }
 
@@ -335,6 +1778,92 @@ func (cluster *clusterState) SetObservedVPAs(observedVPAs []*vpa_types.VerticalP
 	cluster.observedVPAs = observedVPAs
 }
 
+// SetVpaSelectorFetcher sets the source of the pod selectors of the VPAs
+// synced by SyncObservedVPAs.
+func (cluster *clusterState) SetVpaSelectorFetcher(fetcher VpaSelectorFetcher) {
+	cluster.vpaSelectorFetcher = fetcher
+}
+
+// SyncObservedVPAs makes the VPAs in the cluster state match the observed VPA
+// objects: VPAs which were not observed before are added, the ones observed
+// before are updated and the ones which are no longer observed are deleted.
+// Each VPA is added, updated or deleted at most once, even if it is observed
+// more than once. VPAs which fail to be added or updated, including the ones
+// for which the fetcher returns no selector, are deleted. A failure for one VPA
+// doesn't stop the sync of the remaining ones: the errors of all VPAs are
+// joined into the returned error. Only the cancellation of the context aborts
+// the sync.
+// The selectors of the VPAs are obtained from the fetcher set with
+// SetVpaSelectorFetcher. Without a fetcher updated VPAs keep their selectors
+// and added VPAs don't match any pods.
+// The observed VPAs are stored only once all of them are synced.
+func (cluster *clusterState) SyncObservedVPAs(ctx context.Context, observed []*vpa_types.VerticalPodAutoscaler) error {
+	previouslyObserved := make(map[VpaID]bool, len(cluster.observedVPAs))
+	for _, apiObject := range cluster.observedVPAs {
+		previouslyObserved[VpaID{Namespace: apiObject.Namespace, VpaName: apiObject.Name}] = true
+	}
+	// Whether each observed VPA was successfully added or updated.
+	synced := make(map[VpaID]bool, len(observed))
+	var errs []error
+	added, updated, deleted := 0, 0, 0
+	for _, apiObject := range observed {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		vpaID := VpaID{Namespace: apiObject.Namespace, VpaName: apiObject.Name}
+		if _, seen := synced[vpaID]; seen {
+			klog.V(4).InfoS("Skipping VPA observed more than once", "vpa", klog.KRef(vpaID.Namespace, vpaID.VpaName))
+			continue
+		}
+		synced[vpaID] = false
+		selector := cluster.getVpaSelector(ctx, vpaID, apiObject)
+		if selector == nil {
+			errs = append(errs, fmt.Errorf("cannot sync VPA %s/%s: no pod selector", vpaID.Namespace, vpaID.VpaName))
+			continue
+		}
+		if err := cluster.AddOrUpdateVpa(apiObject, selector); err != nil {
+			errs = append(errs, fmt.Errorf("cannot sync VPA %s/%s: %w", vpaID.Namespace, vpaID.VpaName, err))
+			// Rate limited VPAs are kept as they are until the next sync.
+			synced[vpaID] = errors.As(err, &RateLimitedError{})
+			continue
+		}
+		synced[vpaID] = true
+		if previouslyObserved[vpaID] {
+			updated++
+		} else {
+			added++
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for vpaID := range cluster.vpas {
+		if synced[vpaID] {
+			continue
+		}
+		klog.V(3).InfoS("Deleting VPA", "vpa", klog.KRef(vpaID.Namespace, vpaID.VpaName))
+		if err := cluster.DeleteVpa(vpaID); err != nil {
+			errs = append(errs, fmt.Errorf("cannot delete VPA %s/%s: %w", vpaID.Namespace, vpaID.VpaName, err))
+			continue
+		}
+		deleted++
+	}
+	cluster.observedVPAs = observed
+	klog.V(3).InfoS("Synced observed VPAs", "added", added, "updated", updated, "deleted", deleted)
+	return errors.Join(errs...)
+}
+
+// getVpaSelector returns the pod selector of the VPA object with the given ID.
+func (cluster *clusterState) getVpaSelector(ctx context.Context, vpaID VpaID, apiObject *vpa_types.VerticalPodAutoscaler) labels.Selector {
+	if cluster.vpaSelectorFetcher != nil {
+		return cluster.vpaSelectorFetcher(ctx, apiObject)
+	}
+	if vpa, vpaExists := cluster.vpas[vpaID]; vpaExists {
+		return vpa.PodSelector
+	}
+	return labels.Nothing()
+}
+
 func (cluster *clusterState) ObservedVPAs() []*vpa_types.VerticalPodAutoscaler {
 	return cluster.observedVPAs
 }
@@ -343,17 +1872,41 @@ func newPod(id PodID) *PodState {
 	return &PodState{
 		ID:         id,
 		Containers: make(map[string]*ContainerState),
+		AddedTime:  time.Now(),
 	}
 }
 
 // getLabelSetKey puts the given labelSet in the global labelSet map and returns a
 // corresponding labelSetKey.
+// The labels are normalized with the normalizer set with SetLabelNormalization
+// first.
 func (cluster *clusterState) getLabelSetKey(labelSet labels.Set) labelSetKey {
-	labelSetKey := labelSetKey(labelSet.String())
-	cluster.labelSetMap[labelSetKey] = labelSet
+	if cluster.labelNormalizer != nil {
+		labelSet = cluster.labelNormalizer(labelSet)
+	}
+	labelSetKey := labelSetKey(cluster.labelInterner.intern(labelSet.String()))
+	if _, found := cluster.labelSetMap[labelSetKey]; !found {
+		cluster.labelSetMap[labelSetKey] = cluster.labelInterner.internLabels(labelSet)
+	}
 	return labelSetKey
 }
 
+// SetLabelNormalization makes the cluster state normalize the labels of pods
+// added or updated afterwards with the given function, e.g. to strip labels
+// which vary between rollouts and shouldn't split aggregations. Pods with equal
+// normalized labels share aggregations, and VPA selectors are matched against
+// the normalized labels. The normalizer must not modify its argument. Nil
+// restores the default, which keeps the labels as they are.
+func (cluster *clusterState) SetLabelNormalization(normalizer func(labels.Set) labels.Set) {
+	cluster.labelNormalizer = normalizer
+}
+
+// LabelSetMapSize returns the number of distinct label sets stored in the
+// cluster state.
+func (cluster *clusterState) LabelSetMapSize() int {
+	return len(cluster.labelSetMap)
+}
+
 // MakeAggregateStateKey returns the AggregateStateKey that should be used
 // to aggregate usage samples from a container with the given name in a given pod.
 func (cluster *clusterState) MakeAggregateStateKey(pod *PodState, containerName string) AggregateStateKey {
@@ -378,13 +1931,17 @@ func (cluster *clusterState) aggregateStateKeyForContainerID(containerID Contain
 // findOrCreateAggregateContainerState returns (possibly newly created) AggregateContainerState
 // that should be used to aggregate usage samples from container with a given ID.
 // The pod with the corresponding PodID must already be present in the clusterState.
+// Only the mutex of the shard the aggregation belongs to is acquired, unless
+// a new aggregation has to be linked to the VPAs.
 func (cluster *clusterState) findOrCreateAggregateContainerState(containerID ContainerID) *AggregateContainerState {
 	aggregateStateKey := cluster.aggregateStateKeyForContainerID(containerID)
-	aggregateContainerState, aggregateStateExists := cluster.aggregateStateMap[aggregateStateKey]
-	if !aggregateStateExists {
-		aggregateContainerState = NewAggregateContainerState()
-		cluster.aggregateStateMap[aggregateStateKey] = aggregateContainerState
+	aggregateContainerState, created := cluster.aggregateStates.getOrCreate(aggregateStateKey, func() *AggregateContainerState {
+		return NewAggregateContainerState(GetAggregationsConfig().HistogramType)
+	})
+	if created {
 		// Link the new aggregation to the existing VPAs.
+		cluster.aggregationLinkMutex.Lock()
+		defer cluster.aggregationLinkMutex.Unlock()
 		for _, vpa := range cluster.vpas {
 			vpa.UseAggregationIfMatching(aggregateStateKey, aggregateContainerState)
 		}
@@ -392,6 +1949,32 @@ func (cluster *clusterState) findOrCreateAggregateContainerState(containerID Con
 	return aggregateContainerState
 }
 
+// FilterAggregations returns the keys of the aggregations for which the
+// predicate returns true, in no particular order. The predicate must not
+// modify the cluster state.
+func (cluster *clusterState) FilterAggregations(predicate func(AggregateStateKey, *AggregateContainerState) bool) []AggregateStateKey {
+	keys := []AggregateStateKey{}
+	cluster.ForEachAggregation(func(key AggregateStateKey, aggregateContainerState *AggregateContainerState) bool {
+		if predicate(key, aggregateContainerState) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// ForEachAggregation calls fn for each aggregation, in no particular order,
+// until fn returns false. It iterates over a snapshot of the aggregations, so
+// fn may add or remove aggregations, but those changes are not reflected in
+// the iteration.
+func (cluster *clusterState) ForEachAggregation(fn func(AggregateStateKey, *AggregateContainerState) bool) {
+	for key, aggregateContainerState := range cluster.aggregateStates.snapshot() {
+		if !fn(key, aggregateContainerState) {
+			return
+		}
+	}
+}
+
 // garbageCollectAggregateCollectionStates removes obsolete AggregateCollectionStates from the clusterState.
 // AggregateCollectionState is obsolete in following situations:
 // 1) It has no samples and there are no more contributive pods - a pod is contributive in any of following situations:
@@ -402,31 +1985,98 @@ func (cluster *clusterState) findOrCreateAggregateContainerState(containerID Con
 // 2) The last sample is too old to give meaningful recommendation (>8 days),
 // 3) There are no samples and the aggregate state was created >8 days ago.
 func (cluster *clusterState) garbageCollectAggregateCollectionStates(ctx context.Context, now time.Time, controllerFetcher controllerfetcher.ControllerFetcher) {
-	klog.V(1).InfoS("Garbage collection of AggregateCollectionStates triggered")
-	keysToDelete := make([]AggregateStateKey, 0)
+	cluster.garbageCollectAggregateCollectionStatesWithPressure(ctx, now, controllerFetcher, false)
+}
+
+// memoryPressureHistoryLengthDivisor is the factor by which the history
+// length of the aggregations is shortened when the garbage collection is
+// triggered by memory pressure, see SetMemoryPressureThreshold.
+const memoryPressureHistoryLengthDivisor = 2
+
+// garbageCollectAggregateCollectionStatesWithPressure removes obsolete
+// AggregateCollectionStates like garbageCollectAggregateCollectionStates. Unless
+// a VPA overrides their history length, aggregations of BestEffort pods expire
+// sooner and of Guaranteed pods later, see qosHistoryLength. Under memory
+// pressure the aggregations expire memoryPressureHistoryLengthDivisor times
+// sooner.
+func (cluster *clusterState) garbageCollectAggregateCollectionStatesWithPressure(ctx context.Context, now time.Time, controllerFetcher controllerfetcher.ControllerFetcher, underPressure bool) {
+	klog.V(1).InfoS("Garbage collection of AggregateCollectionStates triggered", "underMemoryPressure", underPressure)
 	contributiveKeys := cluster.getContributiveAggregateStateKeys(ctx, controllerFetcher)
-	for key, aggregateContainerState := range cluster.aggregateStateMap {
+	historyLengths := cluster.getAggregationHistoryLengths()
+	qosClasses := cluster.getAggregationQoSClasses()
+	keysToDelete := cluster.FilterAggregations(func(key AggregateStateKey, aggregateContainerState *AggregateContainerState) bool {
 		isKeyContributive := contributiveKeys[key]
 		if !isKeyContributive && aggregateContainerState.isEmpty() {
-			keysToDelete = append(keysToDelete, key)
 			klog.V(1).InfoS("Removing empty and not contributive AggregateCollectionState", "key", key)
-			continue
+			return true
 		}
-		if aggregateContainerState.isExpired(now) {
-			keysToDelete = append(keysToDelete, key)
-			klog.V(1).InfoS("Removing expired AggregateCollectionState", "key", key)
+		historyLength := aggregationHistoryLength(key, historyLengths, qosClasses)
+		if underPressure {
+			historyLength /= memoryPressureHistoryLengthDivisor
 		}
-	}
+		if aggregateContainerState.isExpiredAfter(now, historyLength) {
+			klog.V(1).InfoS("Removing expired AggregateCollectionState", "key", key, "historyLength", historyLength)
+			return true
+		}
+		return false
+	})
 	for _, key := range keysToDelete {
-		delete(cluster.aggregateStateMap, key)
+		cluster.aggregateStates.delete(key)
 		for _, vpa := range cluster.vpas {
 			vpa.DeleteAggregation(key)
 		}
 	}
 }
 
+// GetAggregationsExpiringBefore returns the keys of the aggregations, in no
+// particular order, which are expired at the given time: their last sample,
+// or their creation if they have no samples, is older than their history
+// length. It previews which aggregations a garbage collection without memory
+// pressure would delete at that time unless they receive new samples.
+// Aggregations deleted only because they are empty and have no contributive
+// pods are not included.
+func (cluster *clusterState) GetAggregationsExpiringBefore(t time.Time) []AggregateStateKey {
+	historyLengths := cluster.getAggregationHistoryLengths()
+	qosClasses := cluster.getAggregationQoSClasses()
+	return cluster.FilterAggregations(func(key AggregateStateKey, aggregateContainerState *AggregateContainerState) bool {
+		return aggregateContainerState.isExpiredAfter(t, aggregationHistoryLength(key, historyLengths, qosClasses))
+	})
+}
+
+// aggregationHistoryLength returns the history length of the aggregation with
+// the given key: the one overridden by its VPAs if any, otherwise the memory
+// aggregation window adjusted to the QoS class of its pods.
+func aggregationHistoryLength(key AggregateStateKey, historyLengths map[AggregateStateKey]time.Duration, qosClasses map[AggregateStateKey]apiv1.PodQOSClass) time.Duration {
+	if historyLength, found := historyLengths[key]; found {
+		return historyLength
+	}
+	historyLength := GetAggregationsConfig().GetMemoryAggregationWindowLength()
+	if qosClass, found := qosClasses[key]; found {
+		historyLength = qosHistoryLength(qosClass, historyLength)
+	}
+	return historyLength
+}
+
+// getAggregationHistoryLengths returns the history lengths overridden by the
+// VPAs using the aggregations, keyed by the aggregation. If several VPAs use
+// an aggregation, the longest history length is kept.
+func (cluster *clusterState) getAggregationHistoryLengths() map[AggregateStateKey]time.Duration {
+	historyLengths := make(map[AggregateStateKey]time.Duration)
+	for _, vpa := range cluster.vpas {
+		if vpa.HistoryLength <= 0 {
+			continue
+		}
+		for key := range vpa.aggregateContainerStates {
+			historyLengths[key] = max(historyLengths[key], vpa.HistoryLength)
+		}
+	}
+	return historyLengths
+}
+
 // RateLimitedGarbageCollectAggregateCollectionStates removes obsolete AggregateCollectionStates from the clusterState.
-// It performs clean up only if more than `gcInterval` passed since the last time it performed a cleanup.
+// It performs clean up only if more than `gcInterval` passed since the last time it performed a cleanup,
+// or if the estimated size of the aggregations exceeds the threshold set with SetAggregationMemoryGCThreshold
+// or SetMemoryPressureThreshold. Above the latter, aggregations expire sooner.
 // AggregateCollectionState is obsolete in following situations:
 // 1) It has no samples and there are no more contributive pods - a pod is contributive in any of following situations:
 //
@@ -436,13 +2086,68 @@ func (cluster *clusterState) garbageCollectAggregateCollectionStates(ctx context
 // 2) The last sample is too old to give meaningful recommendation (>8 days),
 // 3) There are no samples and the aggregate state was created >8 days ago.
 func (cluster *clusterState) RateLimitedGarbageCollectAggregateCollectionStates(ctx context.Context, now time.Time, controllerFetcher controllerfetcher.ControllerFetcher) {
-	if now.Sub(cluster.lastAggregateContainerStateGC) < cluster.gcInterval {
-		return
+	underPressure := false
+	if cluster.memoryPressureThreshold > 0 {
+		memoryBytes := cluster.TotalAggregationMemoryBytes()
+		if memoryBytes > cluster.memoryPressureThreshold {
+			klog.V(1).InfoS("Memory pressure, collecting garbage of aggregate container states", "estimatedMemoryBytes", memoryBytes, "thresholdBytes", cluster.memoryPressureThreshold)
+			underPressure = true
+		}
+	}
+	if !underPressure && now.Sub(cluster.lastAggregateContainerStateGC) < cluster.gcInterval {
+		if cluster.aggregationMemoryGCThreshold <= 0 {
+			return
+		}
+		memoryBytes := cluster.TotalAggregationMemoryBytes()
+		if memoryBytes <= cluster.aggregationMemoryGCThreshold {
+			return
+		}
+		klog.V(1).InfoS("Forcing garbage collection of aggregate container states", "estimatedMemoryBytes", memoryBytes, "thresholdBytes", cluster.aggregationMemoryGCThreshold)
 	}
+	cluster.garbageCollectAggregateCollectionStatesWithPressure(ctx, now, controllerFetcher, underPressure)
+	cluster.lastAggregateContainerStateGC = now
+}
+
+// ForceGC removes obsolete AggregateCollectionStates like
+// RateLimitedGarbageCollectAggregateCollectionStates, but regardless of the
+// time of the previous garbage collection, e.g. to reclaim memory right after
+// a large scale-down. The next rate limited garbage collection happens at
+// least gcInterval later.
+func (cluster *clusterState) ForceGC(ctx context.Context, controllerFetcher controllerfetcher.ControllerFetcher) {
+	now := time.Now()
 	cluster.garbageCollectAggregateCollectionStates(ctx, now, controllerFetcher)
 	cluster.lastAggregateContainerStateGC = now
 }
 
+// TotalAggregationMemoryBytes returns the estimated size in bytes of the
+// histograms of all aggregate container states.
+func (cluster *clusterState) TotalAggregationMemoryBytes() int64 {
+	var total int64
+	cluster.ForEachAggregation(func(key AggregateStateKey, aggregateContainerState *AggregateContainerState) bool {
+		unlock := cluster.aggregateStates.lockSamples(key)
+		total += aggregateContainerState.estimatedHistogramMemoryBytes()
+		unlock()
+		return true
+	})
+	return total
+}
+
+// SetAggregationMemoryGCThreshold makes RateLimitedGarbageCollectAggregateCollectionStates
+// collect garbage regardless of the GC interval once TotalAggregationMemoryBytes
+// exceeds the given threshold. Zero or a negative threshold disables it.
+func (cluster *clusterState) SetAggregationMemoryGCThreshold(thresholdBytes int64) {
+	cluster.aggregationMemoryGCThreshold = thresholdBytes
+}
+
+// SetMemoryPressureThreshold makes RateLimitedGarbageCollectAggregateCollectionStates
+// collect garbage regardless of the GC interval once TotalAggregationMemoryBytes
+// exceeds the given threshold, expiring the aggregations
+// memoryPressureHistoryLengthDivisor times sooner than usual. Zero or a
+// negative threshold disables it.
+func (cluster *clusterState) SetMemoryPressureThreshold(thresholdBytes int64) {
+	cluster.memoryPressureThreshold = thresholdBytes
+}
+
 func (cluster *clusterState) getContributiveAggregateStateKeys(ctx context.Context, controllerFetcher controllerfetcher.ControllerFetcher) map[AggregateStateKey]bool {
 	contributiveKeys := map[AggregateStateKey]bool{}
 	for _, pod := range cluster.pods {
@@ -460,14 +2165,73 @@ func (cluster *clusterState) getContributiveAggregateStateKeys(ctx context.Conte
 	return contributiveKeys
 }
 
+// SetMinVpaAgeForRecommendation makes RecordRecommendation set the
+// WaitingForInitialData condition of VPAs younger than the given age. Zero
+// or a negative age disables the condition.
+func (cluster *clusterState) SetMinVpaAgeForRecommendation(age time.Duration) {
+	cluster.minVpaAgeForRecommendation = age
+}
+
+const waitingForInitialDataReason = "VpaTooYoung"
+
+// updateWaitingForInitialDataCondition sets the WaitingForInitialData
+// condition of the VPA if it is younger than minVpaAgeForRecommendation and
+// removes it otherwise.
+func (cluster *clusterState) updateWaitingForInitialDataCondition(vpa *Vpa, now time.Time) {
+	age := vpa.CreationAge(now)
+	if cluster.minVpaAgeForRecommendation <= 0 || age >= cluster.minVpaAgeForRecommendation {
+		delete(vpa.Conditions, vpa_types.WaitingForInitialData)
+		return
+	}
+	vpa.Conditions.Set(vpa_types.WaitingForInitialData, true, waitingForInitialDataReason,
+		fmt.Sprintf("VPA was created %v ago, recommendations are reliable after %v", age.Truncate(time.Second), cluster.minVpaAgeForRecommendation))
+}
+
 // RecordRecommendation marks the state of recommendation in the cluster. We
 // keep track of empty recommendations and log information about them
-// periodically.
+// periodically. VPAs younger than the age set with
+// SetMinVpaAgeForRecommendation get the WaitingForInitialData condition.
+// Non-empty recommendations are smoothed according to the
+// smoothing window of the VPA, raised to the current requests if the VPA
+// requires it, increased for frequently restarting and throttled containers,
+// capped to the resource policy of the VPA and to the node capacity. Changed recommendations are notified
+// through RecommendationUpdates.
 func (cluster *clusterState) RecordRecommendation(vpa *Vpa, now time.Time) error {
+	cluster.updateWaitingForInitialDataCondition(vpa, now)
 	if vpa.Recommendation != nil && len(vpa.Recommendation.ContainerRecommendations) > 0 {
+		var before interface{}
+		if cluster.auditLog != nil {
+			before = snapshotVpa(vpa)
+		}
+		// The recommendation may be shared with the VPA API object, so the
+		// steps below modify a copy of it in place.
+		vpa.Recommendation = vpa.Recommendation.DeepCopy()
+		// GetMatchingPods traverses all pods, so they are listed once and
+		// only if needed.
+		var matchingPods []PodID
+		if vpa.NeverDecreaseBelowRequest || cluster.restartBumpEnabled() || cluster.throttlingBumpEnabled() {
+			matchingPods = cluster.GetMatchingPods(vpa)
+		}
+		vpa.smoothRecommendation()
+		cluster.raiseRecommendationToRequests(vpa, matchingPods)
+		cluster.bumpRecommendationForRestarts(vpa, matchingPods, now)
+		cluster.bumpRecommendationForThrottling(vpa, matchingPods)
+		cluster.applyResourcePolicy(vpa)
+		cluster.capRecommendationToNodeCapacity(vpa)
+		cluster.scaleRecommendationToBudget(vpa)
+		vpa.RecommendationTimestamp = &now
+		cluster.emptyVPAsMutex.Lock()
 		delete(cluster.emptyVPAs, vpa.ID)
+		cluster.emptyVPAsMutex.Unlock()
+		cluster.notifyRecommendationUpdate(vpa)
+		cluster.recordVpaHistory(vpa, now)
+		if cluster.auditLog != nil {
+			cluster.recordAudit(AuditEventRecommendationRecorded, vpa.ID, now, before, snapshotVpa(vpa))
+		}
 		return nil
 	}
+	cluster.emptyVPAsMutex.Lock()
+	defer cluster.emptyVPAsMutex.Unlock()
 	lastLogged, ok := cluster.emptyVPAs[vpa.ID]
 	if !ok {
 		cluster.emptyVPAs[vpa.ID] = now
@@ -480,6 +2244,270 @@ func (cluster *clusterState) RecordRecommendation(vpa *Vpa, now time.Time) error
 	return nil
 }
 
+// EmptyVpaCount returns the number of VPAs noticed by RecordRecommendation to
+// have no recommendation.
+func (cluster *clusterState) EmptyVpaCount() int {
+	cluster.emptyVPAsMutex.Lock()
+	defer cluster.emptyVPAsMutex.Unlock()
+	return len(cluster.emptyVPAs)
+}
+
+// GetEmptyVpas returns the IDs of the VPAs noticed by RecordRecommendation to
+// have no recommendation.
+func (cluster *clusterState) GetEmptyVpas() []VpaID {
+	cluster.emptyVPAsMutex.Lock()
+	defer cluster.emptyVPAsMutex.Unlock()
+	return slices.Collect(maps.Keys(cluster.emptyVPAs))
+}
+
+// raiseRecommendationToRequests raises the recommended CPU and memory of each
+// container, including the lower bound, to the highest current request of the
+// containers with the same name in the given pods matched by the VPA. Does
+// nothing unless the VPA has NeverDecreaseBelowRequest set.
+func (cluster *clusterState) raiseRecommendationToRequests(vpa *Vpa, matchingPods []PodID) {
+	if !vpa.NeverDecreaseBelowRequest {
+		return
+	}
+	requests := make(map[string]apiv1.ResourceList)
+	for _, podID := range matchingPods {
+		for containerName, container := range cluster.pods[podID].Containers {
+			current, found := requests[containerName]
+			if !found {
+				current = apiv1.ResourceList{}
+				requests[containerName] = current
+			}
+			for resourceName, quantity := range ResourcesAsResourceList(container.Request, false, 1, 1) {
+				if old, found := current[resourceName]; !found || quantity.Cmp(old) > 0 {
+					current[resourceName] = quantity
+				}
+			}
+		}
+	}
+	recommendation := vpa.Recommendation
+	for i := range recommendation.ContainerRecommendations {
+		containerRecommendation := &recommendation.ContainerRecommendations[i]
+		request, found := requests[containerRecommendation.ContainerName]
+		if !found {
+			continue
+		}
+		raiseResourceList(containerRecommendation.Target, request)
+		raiseResourceList(containerRecommendation.LowerBound, request)
+		raiseResourceList(containerRecommendation.UpperBound, request)
+	}
+}
+
+// restartBumpEnabled returns true if the CPU bump of restarting containers is
+// enabled with SetRestartCPUBump.
+func (cluster *clusterState) restartBumpEnabled() bool {
+	return cluster.restartBumpThreshold > 0 && cluster.restartBumpFraction > 0
+}
+
+// bumpRecommendationForRestarts increases the recommended CPU of each container
+// with the same name as a container in the given pods matched by the VPA which
+// restarted too often, as set with SetRestartCPUBump.
+func (cluster *clusterState) bumpRecommendationForRestarts(vpa *Vpa, matchingPods []PodID, now time.Time) {
+	if !cluster.restartBumpEnabled() {
+		return
+	}
+	restarting := make(map[string]bool)
+	for _, podID := range matchingPods {
+		for containerName, container := range cluster.pods[podID].Containers {
+			if container.RestartsSince(now.Add(-cluster.restartBumpWindow)) > cluster.restartBumpThreshold {
+				restarting[containerName] = true
+			}
+		}
+	}
+	if len(restarting) == 0 {
+		return
+	}
+	factors := map[apiv1.ResourceName]float64{apiv1.ResourceCPU: 1 + cluster.restartBumpFraction}
+	recommendation := vpa.Recommendation
+	for i := range recommendation.ContainerRecommendations {
+		containerRecommendation := &recommendation.ContainerRecommendations[i]
+		if !restarting[containerRecommendation.ContainerName] {
+			continue
+		}
+		scaleResourceList(containerRecommendation.Target, factors)
+		scaleResourceList(containerRecommendation.LowerBound, factors)
+		scaleResourceList(containerRecommendation.UpperBound, factors)
+	}
+}
+
+// throttlingBumpEnabled returns true if the CPU bump of throttled containers
+// is enabled with SetCPUThrottlingBump.
+func (cluster *clusterState) throttlingBumpEnabled() bool {
+	return cluster.throttlingBumpObservations > 0 && cluster.throttlingBumpMultiplier > 0
+}
+
+// bumpRecommendationForThrottling increases the recommended CPU of each
+// container with the same name as a container in the given pods matched by
+// the VPA which was throttled too much, as set with SetCPUThrottlingBump. If
+// several such containers were throttled, the highest throttling is used.
+func (cluster *clusterState) bumpRecommendationForThrottling(vpa *Vpa, matchingPods []PodID) {
+	if !cluster.throttlingBumpEnabled() {
+		return
+	}
+	throttling := make(map[string]float64)
+	for _, podID := range matchingPods {
+		for containerName, container := range cluster.pods[podID].Containers {
+			if fraction, sustained := container.SustainedCPUThrottling(cluster.throttlingBumpThreshold, cluster.throttlingBumpObservations); sustained {
+				throttling[containerName] = math.Max(throttling[containerName], fraction)
+			}
+		}
+	}
+	if len(throttling) == 0 {
+		return
+	}
+	recommendation := vpa.Recommendation
+	for i := range recommendation.ContainerRecommendations {
+		containerRecommendation := &recommendation.ContainerRecommendations[i]
+		fraction, throttled := throttling[containerRecommendation.ContainerName]
+		if !throttled {
+			continue
+		}
+		factors := map[apiv1.ResourceName]float64{apiv1.ResourceCPU: 1 + cluster.throttlingBumpMultiplier*fraction}
+		scaleResourceList(containerRecommendation.Target, factors)
+		scaleResourceList(containerRecommendation.LowerBound, factors)
+		scaleResourceList(containerRecommendation.UpperBound, factors)
+	}
+}
+
+// applyResourcePolicy caps the recommendation of the VPA to the minimum and
+// maximum allowed by its resource policy. The recommender applies the policy
+// before the recommendation is recorded, but raising it to the requests or
+// bumping it for restarts and throttling may exceed the maximum allowed again.
+func (cluster *clusterState) applyResourcePolicy(vpa *Vpa) {
+	if vpa.ResourcePolicy == nil {
+		return
+	}
+	recommendation, err := vpa_utils.ApplyVPAPolicy(vpa.Recommendation, vpa.ResourcePolicy, nil)
+	if err != nil {
+		klog.ErrorS(err, "Failed to apply policy for VPA", "vpa", klog.KRef(vpa.ID.Namespace, vpa.ID.VpaName))
+		return
+	}
+	vpa.Recommendation = recommendation
+}
+
+// raiseResourceList raises the quantities in resources which are lower than
+// the corresponding quantities in minimums.
+func raiseResourceList(resources apiv1.ResourceList, minimums apiv1.ResourceList) {
+	for resourceName, quantity := range resources {
+		if minimum, found := minimums[resourceName]; found && quantity.Cmp(minimum) < 0 {
+			resources[resourceName] = minimum.DeepCopy()
+		}
+	}
+}
+
+// capRecommendationToNodeCapacity caps the recommendation of the VPA to the
+// allocatable resources of the largest known node. Does nothing if no nodes
+// are known.
+func (cluster *clusterState) capRecommendationToNodeCapacity(vpa *Vpa) {
+	if len(cluster.nodes) == 0 {
+		return
+	}
+	maxAllocatable := apiv1.ResourceList{}
+	for _, allocatable := range cluster.nodes {
+		for resourceName, quantity := range allocatable {
+			if current, found := maxAllocatable[resourceName]; !found || quantity.Cmp(current) > 0 {
+				maxAllocatable[resourceName] = quantity
+			}
+		}
+	}
+	recommendation := vpa.Recommendation
+	for i := range recommendation.ContainerRecommendations {
+		containerRecommendation := &recommendation.ContainerRecommendations[i]
+		capResourceList(containerRecommendation.Target, maxAllocatable)
+		capResourceList(containerRecommendation.LowerBound, maxAllocatable)
+		capResourceList(containerRecommendation.UpperBound, maxAllocatable)
+	}
+}
+
+// capResourceList lowers the quantities in resources which exceed the
+// corresponding quantities in limits.
+func capResourceList(resources apiv1.ResourceList, limits apiv1.ResourceList) {
+	for resourceName, quantity := range resources {
+		if limit, found := limits[resourceName]; found && quantity.Cmp(limit) > 0 {
+			resources[resourceName] = limit.DeepCopy()
+		}
+	}
+}
+
+// SetResourceBudget sets the budget capping the total recommendation of the
+// VPA with the given ID summed over all pods it matches. A nil or empty budget
+// removes the cap.
+func (cluster *clusterState) SetResourceBudget(vpaID VpaID, budget apiv1.ResourceList) error {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists {
+		return NewVpaNotFoundError(vpaID)
+	}
+	if len(budget) == 0 {
+		vpa.ResourceBudget = nil
+		return nil
+	}
+	budgetCopy := budget.DeepCopy()
+	vpa.ResourceBudget = &budgetCopy
+	return nil
+}
+
+// scaleRecommendationToBudget scales the recommendation of all containers down
+// proportionally, for each resource whose target summed over all containers
+// and pods of the VPA exceeds its ResourceBudget.
+func (cluster *clusterState) scaleRecommendationToBudget(vpa *Vpa) {
+	if vpa.ResourceBudget == nil || vpa.PodCount == 0 {
+		return
+	}
+	factors := make(map[apiv1.ResourceName]float64)
+	for resourceName, budget := range *vpa.ResourceBudget {
+		total := 0.0
+		for _, containerRecommendation := range vpa.Recommendation.ContainerRecommendations {
+			if target, found := containerRecommendation.Target[resourceName]; found {
+				total += float64(target.MilliValue()) * float64(vpa.PodCount)
+			}
+		}
+		if limit := float64(budget.MilliValue()); total > limit {
+			factors[resourceName] = limit / total
+		}
+	}
+	if len(factors) == 0 {
+		return
+	}
+	recommendation := vpa.Recommendation
+	for i := range recommendation.ContainerRecommendations {
+		containerRecommendation := &recommendation.ContainerRecommendations[i]
+		scaleResourceList(containerRecommendation.Target, factors)
+		scaleResourceList(containerRecommendation.LowerBound, factors)
+		scaleResourceList(containerRecommendation.UpperBound, factors)
+	}
+}
+
+// scaleResourceList multiplies the quantities in resources by the factors of
+// the corresponding resources, rounding down to millicores for CPU and to
+// whole units for other resources.
+func scaleResourceList(resources apiv1.ResourceList, factors map[apiv1.ResourceName]float64) {
+	for resourceName, quantity := range resources {
+		factor, found := factors[resourceName]
+		if !found {
+			continue
+		}
+		if resourceName == apiv1.ResourceCPU {
+			resources[resourceName] = *resource.NewMilliQuantity(int64(math.Floor(float64(quantity.MilliValue())*factor)), quantity.Format)
+		} else {
+			resources[resourceName] = *resource.NewQuantity(int64(math.Floor(float64(quantity.Value())*factor)), quantity.Format)
+		}
+	}
+}
+
+// IsRecommendationFresh returns true if the recommendation of the VPA with the
+// given ID was recorded no longer than maxAge before now. Returns false if
+// the VPA doesn't exist or has no recorded recommendation.
+func (cluster *clusterState) IsRecommendationFresh(vpaID VpaID, maxAge time.Duration, now time.Time) bool {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists || vpa.RecommendationTimestamp == nil {
+		return false
+	}
+	return now.Sub(*vpa.RecommendationTimestamp) <= maxAge
+}
+
 // GetMatchingPods returns a list of currently active pods that match the
 // given VPA. Traverses through all pods in the cluster - use sparingly.
 func (cluster *clusterState) GetMatchingPods(vpa *Vpa) []PodID {
@@ -493,6 +2521,289 @@ func (cluster *clusterState) GetMatchingPods(vpa *Vpa) []PodID {
 	return matchingPods
 }
 
+// CountContainersWithoutRecommendation returns the number and the IDs of
+// containers controlled by a VPA whose aggregation has no samples or no
+// recommendation yet. Traverses through all pods in the cluster - use sparingly.
+func (cluster *clusterState) CountContainersWithoutRecommendation() (count int, containerIDs []ContainerID) {
+	containerIDs = []ContainerID{}
+	for podID, pod := range cluster.pods {
+		for containerName := range pod.Containers {
+			aggregationKey := cluster.MakeAggregateStateKey(pod, containerName)
+			for _, vpa := range cluster.vpas {
+				state, found := vpa.aggregateContainerStates[aggregationKey]
+				if !found {
+					continue
+				}
+				if state.isEmpty() || len(state.LastRecommendation) == 0 {
+					containerIDs = append(containerIDs, ContainerID{PodID: podID, ContainerName: containerName})
+				}
+				break
+			}
+		}
+	}
+	return len(containerIDs), containerIDs
+}
+
+// GetNamespaceStats returns aggregated stats of the given namespace. The total
+// recommendation of a VPA is its pod recommendation target multiplied by the
+// number of pods it matches.
+func (cluster *clusterState) GetNamespaceStats(namespace string) NamespaceStats {
+	stats := NamespaceStats{}
+	for vpaID, vpa := range cluster.vpas {
+		if vpaID.Namespace != namespace {
+			continue
+		}
+		stats.VpaCount++
+		if !vpa.HasRecommendation() {
+			continue
+		}
+		for _, containerRecommendation := range vpa.Recommendation.ContainerRecommendations {
+			if cpu, found := containerRecommendation.Target[apiv1.ResourceCPU]; found {
+				stats.RecommendedCPU += ResourceAmount(cpu.MilliValue()) * ResourceAmount(vpa.PodCount)
+			}
+			if memory, found := containerRecommendation.Target[apiv1.ResourceMemory]; found {
+				stats.RecommendedMemory += ResourceAmount(memory.Value()) * ResourceAmount(vpa.PodCount)
+			}
+		}
+	}
+	for podID := range cluster.pods {
+		if podID.Namespace == namespace {
+			stats.PodCount++
+		}
+	}
+	return stats
+}
+
+// GetSampleCountByNamespace returns the total number of samples aggregated in
+// all aggregations in each namespace. Namespaces without aggregations are
+// omitted.
+func (cluster *clusterState) GetSampleCountByNamespace() map[string]int {
+	counts := make(map[string]int)
+	for namespace, namespaceStates := range cluster.aggregateStates.snapshotByNamespace() {
+		for _, state := range namespaceStates {
+			counts[namespace] += state.TotalSamplesCount
+		}
+	}
+	return counts
+}
+
+// RecordEviction records that the pod with the given ID was evicted at the
+// given time.
+func (cluster *clusterState) RecordEviction(podID PodID, timestamp time.Time) error {
+	pod, podExists := cluster.pods[podID]
+	if !podExists {
+		return NewPodNotFoundError(podID)
+	}
+	pod.LastEvictionTime = timestamp
+	return nil
+}
+
+// GetCandidatePodsForEviction returns the containers of pods matching the given
+// VPA whose requests differ from the VPA recommendation, sorted by the benefit
+// of evicting them (largest first). Pods evicted less than
+// EvictionCooldownPeriod ago are skipped to prevent thrashing. Only VPAs in the
+// Auto or Recreate update mode which are not in dry-run have eviction
+// candidates.
+func (cluster *clusterState) GetCandidatePodsForEviction(vpaID VpaID, now time.Time) ([]EvictionCandidate, error) {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists {
+		return nil, NewVpaNotFoundError(vpaID)
+	}
+	candidates := []EvictionCandidate{}
+	if vpa.DryRun || !vpa.HasRecommendation() ||
+		!(vpa.hasUpdateMode(vpa_types.UpdateModeAuto) || vpa.hasUpdateMode(vpa_types.UpdateModeRecreate)) {
+		return candidates, nil
+	}
+	for _, podID := range cluster.GetMatchingPods(vpa) {
+		pod := cluster.pods[podID]
+		if !pod.LastEvictionTime.IsZero() && now.Sub(pod.LastEvictionTime) < EvictionCooldownPeriod {
+			continue
+		}
+		for containerName, container := range pod.Containers {
+			containerRecommendation := vpa_utils.GetRecommendationForContainer(containerName, vpa.Recommendation)
+			if containerRecommendation == nil {
+				continue
+			}
+			recommended := resourcesFromResourceList(containerRecommendation.Target)
+			benefit := 0.0
+			for resource, recommendedAmount := range recommended {
+				benefit += relativeDifference(container.Request[resource], recommendedAmount)
+			}
+			if benefit == 0.0 {
+				continue
+			}
+			candidates = append(candidates, EvictionCandidate{
+				PodID:              podID,
+				ContainerID:        ContainerID{PodID: podID, ContainerName: containerName},
+				CurrentRequest:     container.Request,
+				RecommendedRequest: recommended,
+				Benefit:            benefit,
+			})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Benefit != candidates[j].Benefit {
+			return candidates[i].Benefit > candidates[j].Benefit
+		}
+		if candidates[i].PodID != candidates[j].PodID {
+			return candidates[i].PodID.PodName < candidates[j].PodID.PodName
+		}
+		return candidates[i].ContainerID.ContainerName < candidates[j].ContainerID.ContainerName
+	})
+	return candidates, nil
+}
+
+// GetCandidatesForInPlaceUpdate returns the IDs of the running pods matching
+// the given VPA, sorted, whose requests can be updated in-place to the VPA
+// recommendation. A pod is a candidate if the requests of at least one of its
+// containers differ from the recommended targets and the targets of all its
+// containers fit within their limits. Only VPAs in the InPlace update mode
+// which are not in dry-run have candidates.
+func (cluster *clusterState) GetCandidatesForInPlaceUpdate(vpaID VpaID) ([]PodID, error) {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists {
+		return nil, NewVpaNotFoundError(vpaID)
+	}
+	candidates := []PodID{}
+	if vpa.DryRun || !vpa.HasRecommendation() || !vpa.hasUpdateMode(vpa_types.UpdateModeInPlace) {
+		return candidates, nil
+	}
+	for _, podID := range cluster.GetMatchingPods(vpa) {
+		pod := cluster.pods[podID]
+		if pod.Phase != apiv1.PodRunning {
+			continue
+		}
+		changed, fits := false, true
+		for containerName, container := range pod.Containers {
+			containerRecommendation := vpa_utils.GetRecommendationForContainer(containerName, vpa.Recommendation)
+			if containerRecommendation == nil {
+				continue
+			}
+			for resource, recommendedAmount := range resourcesFromResourceList(containerRecommendation.Target) {
+				if recommendedAmount != container.Request[resource] {
+					changed = true
+				}
+				if limit, found := container.Limit[resource]; found && recommendedAmount > limit {
+					fits = false
+				}
+			}
+		}
+		if changed && fits {
+			candidates = append(candidates, podID)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b PodID) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.PodName, b.PodName))
+	})
+	return candidates, nil
+}
+
+func resourcesFromResourceList(resources apiv1.ResourceList) Resources {
+	result := make(Resources)
+	if cpu, found := resources[apiv1.ResourceCPU]; found {
+		result[ResourceCPU] = ResourceAmount(cpu.MilliValue())
+	}
+	if memory, found := resources[apiv1.ResourceMemory]; found {
+		result[ResourceMemory] = ResourceAmount(memory.Value())
+	}
+	return result
+}
+
+// relativeDifference returns |recommended - current| / current, or 1 if the
+// current amount is zero and the recommended one isn't.
+func relativeDifference(current, recommended ResourceAmount) float64 {
+	if current == recommended {
+		return 0.0
+	}
+	if current == 0 {
+		return 1.0
+	}
+	return math.Abs(float64(recommended-current)) / float64(current)
+}
+
+// CheckRecommendationSafety returns the containers of the given VPA whose
+// target recommendation is lower than the 99th percentile of their usage
+// increased by safetyMarginFraction. A recommendation exactly at the margin is
+// considered safe. Containers without samples or without a recommendation are
+// skipped. Returns an empty list if the VPA doesn't exist.
+func (cluster *clusterState) CheckRecommendationSafety(vpaID VpaID, safetyMarginFraction float64) []SafetyViolation {
+	violations := []SafetyViolation{}
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists || !vpa.HasRecommendation() {
+		return violations
+	}
+	for containerName, aggregation := range AggregateStateByContainerName(vpa.aggregateContainerStates) {
+		if aggregation.isEmpty() {
+			continue
+		}
+		containerRecommendation := vpa_utils.GetRecommendationForContainer(containerName, vpa.Recommendation)
+		if containerRecommendation == nil {
+			continue
+		}
+		p99Usage := Resources{
+			ResourceCPU:    CPUAmountFromCores(aggregation.AggregateCPUUsage.Percentile(0.99)),
+			ResourceMemory: MemoryAmountFromBytes(aggregation.AggregateMemoryPeaks.Percentile(0.99)),
+		}
+		for resource, recommended := range resourcesFromResourceList(containerRecommendation.Target) {
+			if float64(recommended) < float64(p99Usage[resource])*(1.0+safetyMarginFraction) {
+				violations = append(violations, SafetyViolation{
+					ContainerName: containerName,
+					Resource:      resource,
+					Recommended:   recommended,
+					P99Usage:      p99Usage[resource],
+				})
+			}
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].ContainerName != violations[j].ContainerName {
+			return violations[i].ContainerName < violations[j].ContainerName
+		}
+		return violations[i].Resource < violations[j].Resource
+	})
+	return violations
+}
+
+// GetTopNContainersByUsage returns up to n containers with the highest 90th
+// percentile of the usage of the given resource, sorted by the usage in
+// descending order. Only CPU and memory are supported; containers whose
+// aggregations have no samples are skipped.
+func (cluster *clusterState) GetTopNContainersByUsage(n int, resource apiv1.ResourceName) []ContainerUsageRank {
+	if n <= 0 || (resource != apiv1.ResourceCPU && resource != apiv1.ResourceMemory) {
+		return []ContainerUsageRank{}
+	}
+	topN := make(containerUsageRankHeap, 0, n)
+	for podID, pod := range cluster.pods {
+		for containerName := range pod.Containers {
+			aggregationKey := cluster.MakeAggregateStateKey(pod, containerName)
+			aggregation, found := cluster.aggregateStates.get(aggregationKey)
+			if !found || aggregation.isEmpty() {
+				continue
+			}
+			rank := ContainerUsageRank{
+				ContainerID:       ContainerID{PodID: podID, ContainerName: containerName},
+				AggregateStateKey: aggregationKey,
+			}
+			if resource == apiv1.ResourceCPU {
+				rank.P90Usage = CPUAmountFromCores(aggregation.AggregateCPUUsage.Percentile(0.9))
+			} else {
+				rank.P90Usage = MemoryAmountFromBytes(aggregation.AggregateMemoryPeaks.Percentile(0.9))
+			}
+			if topN.Len() < n {
+				heap.Push(&topN, rank)
+			} else if rank.P90Usage > topN[0].P90Usage {
+				topN[0] = rank
+				heap.Fix(&topN, 0)
+			}
+		}
+	}
+	result := []ContainerUsageRank(topN)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].P90Usage > result[j].P90Usage
+	})
+	return result
+}
+
 // GetControllerForPodUnderVPA returns controller associated with given Pod. Returns nil if Pod is not controlled by a VPA object.
 func (cluster *clusterState) GetControllerForPodUnderVPA(ctx context.Context, pod *PodState, controllerFetcher controllerfetcher.ControllerFetcher) *controllerfetcher.ControllerKeyWithAPIVersion {
 	controllingVPA := cluster.GetControllingVPA(pod)
@@ -511,17 +2822,213 @@ func (cluster *clusterState) GetControllerForPodUnderVPA(ctx context.Context, po
 	return nil
 }
 
-// GetControllingVPA returns a VPA object controlling given Pod.
+// ListStaleVPAs returns the IDs of the VPAs whose target controller no longer
+// exists, sorted by namespace and name. Like in the garbage collection of the
+// aggregations, a target is considered missing if the controller fetcher
+// doesn't find it. VPAs without a TargetRef are skipped. The VPAs are not
+// modified; the list is only advisory. Returns ctx.Err() if the context is
+// done before all VPAs are checked.
+func (cluster *clusterState) ListStaleVPAs(ctx context.Context, controllerFetcher controllerfetcher.ControllerFetcher) ([]VpaID, error) {
+	stale := []VpaID{}
+	for vpaID, vpa := range cluster.vpas {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if vpa.TargetRef == nil {
+			continue
+		}
+		controller := &controllerfetcher.ControllerKeyWithAPIVersion{
+			ControllerKey: controllerfetcher.ControllerKey{
+				Namespace: vpaID.Namespace,
+				Kind:      vpa.TargetRef.Kind,
+				Name:      vpa.TargetRef.Name,
+			},
+			ApiVersion: vpa.TargetRef.APIVersion,
+		}
+		topLevelController, err := controllerFetcher.FindTopMostWellKnownOrScalable(ctx, controller)
+		if err != nil {
+			klog.V(4).InfoS("Cannot find target of VPA", "vpa", klog.KRef(vpaID.Namespace, vpaID.VpaName), "error", err)
+		}
+		if topLevelController == nil {
+			stale = append(stale, vpaID)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].Namespace != stale[j].Namespace {
+			return stale[i].Namespace < stale[j].Namespace
+		}
+		return stale[i].VpaName < stale[j].VpaName
+	})
+	return stale, nil
+}
+
+// GetControllingVPA returns a VPA object controlling given Pod. If the pod
+// matches multiple VPAs, the one with the lowest ID is returned, so the
+// choice doesn't depend on the order in which the VPAs were added.
 func (cluster *clusterState) GetControllingVPA(pod *PodState) *Vpa {
+	return cluster.getControllingVPAForLabels(pod.ID.Namespace, cluster.labelSetMap[pod.labelSetKey])
+}
+
+// getControllingVPAForLabels returns the VPA controlling pods with the given
+// labels in the given namespace, see GetControllingVPA.
+func (cluster *clusterState) getControllingVPAForLabels(namespace string, podLabels labels.Set) *Vpa {
+	var controlling *Vpa
 	for _, vpa := range cluster.vpas {
-		if vpa_utils.PodLabelsMatchVPA(pod.ID.Namespace, cluster.labelSetMap[pod.labelSetKey],
-			vpa.ID.Namespace, vpa.PodSelector) {
-			return vpa
+		if vpa_utils.PodLabelsMatchVPA(namespace, podLabels, vpa.ID.Namespace, vpa.PodSelector) {
+			if controlling == nil || compareVpaIDs(vpa.ID, controlling.ID) < 0 {
+				controlling = vpa
+			}
+		}
+	}
+	return controlling
+}
+
+// SimulateAdmission returns a copy of the given pod with resource requests set
+// to the current recommendation of the VPA controlling it, see
+// GetControllingVPA, together with that VPA. The recommendation is capped to
+// the resource policy of the VPA. Neither the pod nor the cluster state are
+// modified. If no VPA matches the pod, an unmodified copy of the pod and a nil
+// VPA are returned. The copy is unmodified as well if the VPA doesn't apply
+// recommendations at admission, i.e. is in dry-run, Off or
+// AnnotationRecommendation mode.
+func (cluster *clusterState) SimulateAdmission(pod *apiv1.Pod) (*apiv1.Pod, *Vpa, error) {
+	if pod == nil {
+		return nil, nil, ErrNilPod
+	}
+	simulatedPod := pod.DeepCopy()
+	controllingVPA := cluster.getControllingVPAForLabels(pod.Namespace, labels.Set(pod.Labels))
+	if controllingVPA == nil || !controllingVPA.HasRecommendation() || controllingVPA.DryRun ||
+		controllingVPA.hasUpdateMode(vpa_types.UpdateModeOff) || controllingVPA.hasUpdateMode(vpa_types.UpdateModeAnnotationRecommendation) {
+		return simulatedPod, controllingVPA, nil
+	}
+	cappedRecommendation, err := vpa_utils.ApplyVPAPolicy(controllingVPA.Recommendation, controllingVPA.ResourcePolicy, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range simulatedPod.Spec.Containers {
+		container := &simulatedPod.Spec.Containers[i]
+		policy := vpa_utils.GetContainerResourcePolicy(container.Name, controllingVPA.ResourcePolicy)
+		if policy != nil && policy.Mode != nil && *policy.Mode == vpa_types.ContainerScalingModeOff {
+			continue
+		}
+		recommendation := vpa_utils.GetRecommendationForContainer(container.Name, cappedRecommendation)
+		if recommendation == nil {
+			continue
+		}
+		controlledResources := DefaultControlledResources
+		if policy != nil && policy.ControlledResources != nil {
+			controlledResources = *ResourceNamesApiToModel(*policy.ControlledResources)
+		}
+		if container.Resources.Requests == nil {
+			container.Resources.Requests = apiv1.ResourceList{}
+		}
+		for _, resourceName := range controlledResources {
+			if quantity, found := recommendation.Target[apiv1.ResourceName(resourceName)]; found {
+				container.Resources.Requests[apiv1.ResourceName(resourceName)] = quantity.DeepCopy()
+			}
+		}
+	}
+	return simulatedPod, controllingVPA, nil
+}
+
+// GetRecommendationForPod returns the total resource requests of the given
+// pod as they would be after applying the recommendation of the VPA
+// controlling it. The recommendation of each container is clamped to the
+// min/max allowed values of the VPA resource policy and only the controlled
+// resources are applied. Containers with scaling mode Off or without a
+// recommendation keep their current requests. The recommendation of each
+// container and the total are capped to the maximum of the LimitRange of the
+// namespace for containers and pods respectively. Returns an error if the
+// pod doesn't exist or isn't controlled by any VPA.
+func (cluster *clusterState) GetRecommendationForPod(podID PodID) (*apiv1.ResourceRequirements, error) {
+	pod, found := cluster.pods[podID]
+	if !found {
+		return nil, NewPodNotFoundError(podID)
+	}
+	vpa := cluster.podToVpa[podID]
+	if vpa == nil {
+		return nil, NewPodNotControlledError(podID)
+	}
+	recommendation, err := vpa_utils.ApplyVPAPolicy(vpa.Recommendation, vpa.ResourcePolicy, nil)
+	if err != nil {
+		return nil, err
+	}
+	containerMax := cluster.limitRangeMax(podID.Namespace, apiv1.LimitTypeContainer)
+	total := apiv1.ResourceList{}
+	for containerName, container := range pod.Containers {
+		requests := ResourcesAsResourceList(container.Request, false, 1, 1)
+		policy := vpa_utils.GetContainerResourcePolicy(containerName, vpa.ResourcePolicy)
+		containerRecommendation := vpa_utils.GetRecommendationForContainer(containerName, recommendation)
+		if containerRecommendation != nil && (policy == nil || policy.Mode == nil || *policy.Mode != vpa_types.ContainerScalingModeOff) {
+			controlledResources := DefaultControlledResources
+			if policy != nil && policy.ControlledResources != nil {
+				controlledResources = *ResourceNamesApiToModel(*policy.ControlledResources)
+			}
+			recommended := apiv1.ResourceList{}
+			for _, resourceName := range controlledResources {
+				if quantity, found := containerRecommendation.Target[apiv1.ResourceName(resourceName)]; found {
+					recommended[apiv1.ResourceName(resourceName)] = quantity
+				}
+			}
+			capResourceList(recommended, containerMax)
+			maps.Copy(requests, recommended)
+		}
+		for resourceName, quantity := range requests {
+			sum := total[resourceName]
+			sum.Add(quantity)
+			total[resourceName] = sum
 		}
 	}
+	capResourceList(total, cluster.limitRangeMax(podID.Namespace, apiv1.LimitTypePod))
+	return &apiv1.ResourceRequirements{Requests: total}, nil
+}
+
+// startMutation registers a mutation of the cluster state in progress, which
+// must be finished by calling inFlightMutations.Done(). Returns
+// ErrClusterStateShutDown after GracefulShutdown was called.
+func (cluster *clusterState) startMutation() error {
+	cluster.shutdownMutex.RLock()
+	defer cluster.shutdownMutex.RUnlock()
+	if cluster.shuttingDown {
+		return ErrClusterStateShutDown
+	}
+	cluster.inFlightMutations.Add(1)
 	return nil
 }
 
+// SetShutdownCheckpointer sets the function saving the final checkpoint of
+// the cluster state in GracefulShutdown.
+func (cluster *clusterState) SetShutdownCheckpointer(checkpointer func(ctx context.Context) error) {
+	cluster.shutdownCheckpointer = checkpointer
+}
+
+// GracefulShutdown stops accepting mutations of pods, containers and samples,
+// waits for the ones in progress to complete and saves the final checkpoint.
+// Returns ctx.Err() if the context is done before that.
+func (cluster *clusterState) GracefulShutdown(ctx context.Context) error {
+	cluster.shutdownMutex.Lock()
+	cluster.shuttingDown = true
+	cluster.shutdownMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		cluster.inFlightMutations.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if cluster.shutdownCheckpointer == nil {
+		return nil
+	}
+	if err := cluster.shutdownCheckpointer(ctx); err != nil {
+		return fmt.Errorf("cannot save the final checkpoint: %v", err)
+	}
+	return ctx.Err()
+}
+
 // Implementation of the AggregateStateKey interface. It can be used as a map key.
 type aggregateStateKey struct {
 	namespace     string
@@ -549,3 +3056,22 @@ func (k aggregateStateKey) Labels() labels.Labels {
 	}
 	return (*k.labelSetMap)[k.labelSetKey]
 }
+
+// Equal returns true if both keys have the same namespace, container name and
+// labels. Unlike ==, it doesn't compare the label set maps, so keys created by
+// different cluster states can be equal.
+func (k aggregateStateKey) Equal(other aggregateStateKey) bool {
+	// The label set key is the string representation of the labels.
+	return k.namespace == other.namespace && k.containerName == other.containerName && k.labelSetKey == other.labelSetKey
+}
+
+// Hash returns a hash of the key, equal for keys which are Equal.
+func (k aggregateStateKey) Hash() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(k.namespace))
+	h.Write([]byte{0})
+	h.Write([]byte(k.containerName))
+	h.Write([]byte{0})
+	h.Write([]byte(k.labelSetKey))
+	return h.Sum64()
+}
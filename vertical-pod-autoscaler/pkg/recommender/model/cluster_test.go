@@ -19,12 +19,15 @@ package model
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	autoscaling "k8s.io/api/autoscaling/v1"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
@@ -32,6 +35,7 @@ import (
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	controllerfetcher "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/target/controller_fetcher"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+	vpa_utils "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
 )
 
 var (
@@ -57,21 +61,9 @@ var (
 		},
 		ApiVersion: "apiVersion-1",
 	}
-	testControllerFetcher = &fakeControllerFetcher{
-		key: testControllerKey,
-		err: nil,
-	}
+	testControllerFetcher = test.NewFakeControllerFetcher().WithController(*testControllerKey, testControllerKey)
 )
 
-type fakeControllerFetcher struct {
-	key *controllerfetcher.ControllerKeyWithAPIVersion
-	err error
-}
-
-func (f *fakeControllerFetcher) FindTopMostWellKnownOrScalable(_ context.Context, _ *controllerfetcher.ControllerKeyWithAPIVersion) (*controllerfetcher.ControllerKeyWithAPIVersion, error) {
-	return f.key, f.err
-}
-
 const testGcPeriod = time.Minute
 
 func makeTestUsageSample() *ContainerUsageSampleWithKey {
@@ -86,7 +78,8 @@ func TestClusterAddSample(t *testing.T) {
 	// Create a pod with a single container.
 	cluster := NewClusterState(testGcPeriod)
 	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
-	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
 
 	// Add a usage sample to the container.
 	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
@@ -96,6 +89,37 @@ func TestClusterAddSample(t *testing.T) {
 	assert.Equal(t, testTimestamp, containerStats.LastCPUSampleStart)
 }
 
+func TestClusterAddSampleOutOfOrderTolerance(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	sample := func(offset time.Duration, usage ResourceAmount, resource ResourceName) *ContainerUsageSampleWithKey {
+		return &ContainerUsageSampleWithKey{ContainerUsageSample{
+			MeasureStart: testTimestamp.Add(offset), Usage: usage, Resource: resource}, testContainerID}
+	}
+	assert.NoError(t, cluster.AddSample(sample(5*time.Minute, CPUAmountFromCores(1), ResourceCPU)))
+	assert.NoError(t, cluster.AddSample(sample(5*time.Minute, MemoryAmountFromBytes(1e8), ResourceMemory)))
+	// Without tolerance out-of-order samples are discarded.
+	assert.Error(t, cluster.AddSample(sample(4*time.Minute, CPUAmountFromCores(1), ResourceCPU)))
+	assert.Error(t, cluster.AddSample(sample(4*time.Minute, MemoryAmountFromBytes(2e8), ResourceMemory)))
+
+	cluster.SetOutOfOrderTolerance(2 * time.Minute)
+	assert.NoError(t, cluster.AddSample(sample(3*time.Minute, CPUAmountFromCores(2), ResourceCPU)))
+	assert.NoError(t, cluster.AddSample(sample(4*time.Minute, MemoryAmountFromBytes(2e8), ResourceMemory)))
+	// Duplicates and samples beyond the tolerance are still discarded.
+	assert.Error(t, cluster.AddSample(sample(5*time.Minute, CPUAmountFromCores(1), ResourceCPU)))
+	assert.Error(t, cluster.AddSample(sample(2*time.Minute, CPUAmountFromCores(1), ResourceCPU)))
+	assert.Error(t, cluster.AddSample(sample(2*time.Minute, MemoryAmountFromBytes(3e8), ResourceMemory)))
+
+	container := cluster.GetContainer(testContainerID)
+	assert.Equal(t, testTimestamp.Add(5*time.Minute), container.LastCPUSampleStart)
+	assert.Equal(t, MemoryAmountFromBytes(2e8), container.GetMaxMemoryPeak())
+	aggregation := cluster.findOrCreateAggregateContainerState(testContainerID)
+	assert.Equal(t, 2, aggregation.TotalSamplesCount)
+	assert.Equal(t, testTimestamp.Add(3*time.Minute), aggregation.FirstSampleStart)
+	assert.Equal(t, testTimestamp.Add(5*time.Minute), aggregation.LastSampleStart)
+}
+
 func TestClusterGCAggregateContainerStateDeletesOld(t *testing.T) {
 	ctx := context.Background()
 
@@ -104,23 +128,67 @@ func TestClusterGCAggregateContainerStateDeletesOld(t *testing.T) {
 	vpa := addTestVpa(cluster)
 	addTestPod(cluster)
 
-	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
 	usageSample := makeTestUsageSample()
 
 	// Add a usage sample to the container.
 	assert.NoError(t, cluster.AddSample(usageSample))
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// AggregateContainerState are valid for 8 days since last sample
 	cluster.garbageCollectAggregateCollectionStates(ctx, usageSample.MeasureStart.Add(9*24*time.Hour), testControllerFetcher)
 
 	// AggregateContainerState should be deleted from both cluster and vpa
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStates.snapshot())
 	assert.Empty(t, vpa.aggregateContainerStates)
 }
 
+func TestClusterGCAggregateContainerStateHistoryLength(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name          string
+		annotations   vpaAnnotationsMap
+		expectDeleted bool
+	}{
+		{
+			name:          "default history length",
+			annotations:   testAnnotations,
+			expectDeleted: false,
+		},
+		{
+			name:          "history length of one day",
+			annotations:   vpaAnnotationsMap{HistoryLengthAnnotation: "1d"},
+			expectDeleted: true,
+		},
+		{
+			name:          "invalid history length",
+			annotations:   vpaAnnotationsMap{HistoryLengthAnnotation: "soon"},
+			expectDeleted: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			vpa := addVpa(cluster, testVpaID, tc.annotations, testSelectorStr, testTargetRef)
+			addTestPod(cluster)
+			addTestContainer(t, cluster)
+			usageSample := makeTestUsageSample()
+			assert.NoError(t, cluster.AddSample(usageSample))
+
+			cluster.garbageCollectAggregateCollectionStates(ctx, usageSample.MeasureStart.Add(2*24*time.Hour), testControllerFetcher)
+			if tc.expectDeleted {
+				assert.Empty(t, cluster.aggregateStates.snapshot())
+				assert.Empty(t, vpa.aggregateContainerStates)
+			} else {
+				assert.NotEmpty(t, cluster.aggregateStates.snapshot())
+				assert.NotEmpty(t, vpa.aggregateContainerStates)
+			}
+		})
+	}
+}
+
 func TestClusterGCAggregateContainerStateDeletesOldEmpty(t *testing.T) {
 	ctx := context.Background()
 
@@ -129,28 +197,29 @@ func TestClusterGCAggregateContainerStateDeletesOldEmpty(t *testing.T) {
 	vpa := addTestVpa(cluster)
 	addTestPod(cluster)
 
-	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
 	// No usage samples added.
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
-	assert.Len(t, cluster.aggregateStateMap, 1)
+	assert.Len(t, cluster.aggregateStates.snapshot(), 1)
 	var creationTime time.Time
-	for _, aggregateState := range cluster.aggregateStateMap {
+	for _, aggregateState := range cluster.aggregateStates.snapshot() {
 		creationTime = aggregateState.CreationTime
 	}
 
 	// Verify empty aggregate states are not removed right away.
 	cluster.garbageCollectAggregateCollectionStates(ctx, creationTime.Add(1*time.Minute), testControllerFetcher) // AggregateContainerState should be deleted from both cluster and vpa
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// AggregateContainerState are valid for 8 days since creation
 	cluster.garbageCollectAggregateCollectionStates(ctx, creationTime.Add(9*24*time.Hour), testControllerFetcher)
 
 	// AggregateContainerState should be deleted from both cluster and vpa
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStates.snapshot())
 	assert.Empty(t, vpa.aggregateContainerStates)
 }
 
@@ -162,21 +231,19 @@ func TestClusterGCAggregateContainerStateDeletesEmptyInactiveWithoutController(t
 	vpa := addTestVpa(cluster)
 	pod := addTestPod(cluster)
 	// Controller Fetcher returns nil, meaning that there is no corresponding controller alive.
-	controller := &fakeControllerFetcher{
-		key: nil,
-		err: nil,
-	}
+	controller := test.NewFakeControllerFetcher().WithController(*testControllerKey, nil)
 
-	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
 	// No usage samples added.
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	cluster.garbageCollectAggregateCollectionStates(ctx, testTimestamp, controller)
 
 	// AggregateContainerState should not be deleted as the pod is still active.
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	cluster.pods[pod.ID].Phase = apiv1.PodSucceeded
@@ -184,7 +251,7 @@ func TestClusterGCAggregateContainerStateDeletesEmptyInactiveWithoutController(t
 
 	// AggregateContainerState should be empty as the pod is no longer active, controller is not alive
 	// and there are no usage samples.
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStates.snapshot())
 	assert.Empty(t, vpa.aggregateContainerStates)
 }
 
@@ -198,23 +265,24 @@ func TestClusterGCAggregateContainerStateLeavesEmptyInactiveWithController(t *te
 	// Controller Fetcher returns existing controller, meaning that there is a corresponding controller alive.
 	controller := testControllerFetcher
 
-	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
 	// No usage samples added.
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	cluster.garbageCollectAggregateCollectionStates(ctx, testTimestamp, controller)
 
 	// AggregateContainerState should not be deleted as the pod is still active.
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	cluster.pods[pod.ID].Phase = apiv1.PodSucceeded
 	cluster.garbageCollectAggregateCollectionStates(ctx, testTimestamp, controller)
 
 	// AggregateContainerState should not be deleted as the controller is still alive.
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 }
 
@@ -226,19 +294,20 @@ func TestClusterGCAggregateContainerStateLeavesValid(t *testing.T) {
 	vpa := addTestVpa(cluster)
 	addTestPod(cluster)
 
-	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
 	usageSample := makeTestUsageSample()
 
 	// Add a usage sample to the container.
 	assert.NoError(t, cluster.AddSample(usageSample))
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// AggregateContainerState are valid for 8 days since last sample
 	cluster.garbageCollectAggregateCollectionStates(ctx, usageSample.MeasureStart.Add(7*24*time.Hour), testControllerFetcher)
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 }
 
@@ -251,13 +320,14 @@ func TestAddSampleAfterAggregateContainerStateGCed(t *testing.T) {
 	pod := addTestPod(cluster)
 	addTestContainer(t, cluster)
 
-	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
 	usageSample := makeTestUsageSample()
 
 	// Add a usage sample to the container.
 	assert.NoError(t, cluster.AddSample(usageSample))
 
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	aggregateStateKey := cluster.aggregateStateKeyForContainerID(testContainerID)
@@ -267,7 +337,7 @@ func TestAddSampleAfterAggregateContainerStateGCed(t *testing.T) {
 	gcTimestamp := usageSample.MeasureStart.Add(10 * 24 * time.Hour)
 	cluster.garbageCollectAggregateCollectionStates(ctx, gcTimestamp, testControllerFetcher)
 
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStates.snapshot())
 	assert.Empty(t, vpa.aggregateContainerStates)
 	assert.Contains(t, pod.Containers, testContainerID.ContainerName)
 
@@ -294,51 +364,266 @@ func TestClusterGCRateLimiting(t *testing.T) {
 	cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, sampleExpireTime, testControllerFetcher)
 	vpa := addTestVpa(cluster)
 	addTestPod(cluster)
-	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
 
 	// Add a usage sample to the container.
 	assert.NoError(t, cluster.AddSample(usageSample))
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// Sample is expired but this run doesn't remove it yet, because less than testGcPeriod
 	// elapsed since the previous run.
 	cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, sampleExpireTime.Add(testGcPeriod/2), testControllerFetcher)
-	assert.NotEmpty(t, cluster.aggregateStateMap)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
 	assert.NotEmpty(t, vpa.aggregateContainerStates)
 
 	// AggregateContainerState should be deleted from both cluster and vpa
 	cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, sampleExpireTime.Add(2*testGcPeriod), testControllerFetcher)
-	assert.Empty(t, cluster.aggregateStateMap)
+	assert.Empty(t, cluster.aggregateStates.snapshot())
+	assert.Empty(t, vpa.aggregateContainerStates)
+}
+
+func TestGetVpaByTargetRef(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	_, err := cluster.GetVpaByTargetRef(testTargetRef.Kind, testTargetRef.Name, testVpaID.Namespace)
+	assert.ErrorAs(t, err, &TargetRefNotFoundError{})
+
+	vpa := addTestVpa(cluster)
+	found, err := cluster.GetVpaByTargetRef(testTargetRef.Kind, testTargetRef.Name, testVpaID.Namespace)
+	assert.NoError(t, err)
+	assert.Equal(t, vpa, found)
+	_, err = cluster.GetVpaByTargetRef(testTargetRef.Kind, testTargetRef.Name, "namespace-2")
+	assert.ErrorAs(t, err, &KeyError{})
+
+	// The index follows updates of the target ref.
+	newTargetRef := &autoscaling.CrossVersionObjectReference{Kind: "kind-2", Name: "name-2", APIVersion: "apiVersion-1"}
+	addVpa(cluster, testVpaID, testAnnotations, testSelectorStr, newTargetRef)
+	_, err = cluster.GetVpaByTargetRef(testTargetRef.Kind, testTargetRef.Name, testVpaID.Namespace)
+	assert.ErrorAs(t, err, &KeyError{})
+	found, err = cluster.GetVpaByTargetRef(newTargetRef.Kind, newTargetRef.Name, testVpaID.Namespace)
+	assert.NoError(t, err)
+	assert.Equal(t, vpa, found)
+
+	// Two VPAs with the same target are a misconfiguration.
+	otherVpaID := VpaID{"namespace-1", "vpa-2"}
+	addVpa(cluster, otherVpaID, testAnnotations, testSelectorStr, newTargetRef)
+	_, err = cluster.GetVpaByTargetRef(newTargetRef.Kind, newTargetRef.Name, testVpaID.Namespace)
+	assert.ErrorAs(t, err, &MultipleMatchesError{})
+
+	assert.NoError(t, cluster.DeleteVpa(testVpaID))
+	found, err = cluster.GetVpaByTargetRef(newTargetRef.Kind, newTargetRef.Name, testVpaID.Namespace)
+	assert.NoError(t, err)
+	assert.Equal(t, otherVpaID, found.ID)
+
+	// The index follows renames of the VPA.
+	assert.NoError(t, cluster.MigrateVpa(otherVpaID, VpaID{"namespace-1", "vpa-3"}))
+	found, err = cluster.GetVpaByTargetRef(newTargetRef.Kind, newTargetRef.Name, testVpaID.Namespace)
+	assert.NoError(t, err)
+	assert.Equal(t, "vpa-3", found.ID.VpaName)
+}
+
+func TestGetVpaByAdditionalTargetRefs(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	otherTargetRef := autoscaling.CrossVersionObjectReference{Kind: "kind-2", Name: "name-2", APIVersion: "apiVersion-1"}
+	assert.ErrorAs(t, cluster.SetAdditionalTargetRefs(VpaID{"namespace-1", "vpa-2"}, nil), &KeyError{})
+	assert.NoError(t, cluster.SetAdditionalTargetRefs(testVpaID, []autoscaling.CrossVersionObjectReference{otherTargetRef}))
+
+	for _, targetRef := range []autoscaling.CrossVersionObjectReference{*testTargetRef, otherTargetRef} {
+		found, err := cluster.GetVpaByTargetRef(targetRef.Kind, targetRef.Name, testVpaID.Namespace)
+		assert.NoError(t, err)
+		assert.Equal(t, vpa, found)
+	}
+
+	// Updates of the VPA object, even recreating it, keep the additional
+	// target refs.
+	vpa = addVpa(cluster, testVpaID, testAnnotations, "label-2 = value-2", testTargetRef)
+	found, err := cluster.GetVpaByTargetRef(otherTargetRef.Kind, otherTargetRef.Name, testVpaID.Namespace)
+	assert.NoError(t, err)
+	assert.Equal(t, vpa, found)
+
+	assert.NoError(t, cluster.DeleteVpa(testVpaID))
+	for _, targetRef := range []autoscaling.CrossVersionObjectReference{*testTargetRef, otherTargetRef} {
+		_, err := cluster.GetVpaByTargetRef(targetRef.Kind, targetRef.Name, testVpaID.Namespace)
+		assert.ErrorAs(t, err, &KeyError{})
+	}
+	assert.Empty(t, cluster.targetRefToVPA)
+}
+
+func TestGetStalePods(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	now := testTimestamp.Add(time.Hour)
+	addSample := func(containerID ContainerID, ts time.Time) {
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{ts, 1.0, ResourceCPU}, containerID}))
+	}
+	// One fresh and one stale container.
+	addTestPod(cluster)
+	addSample(ContainerID{testPodID, "container-1"}, now.Add(-time.Minute))
+	addSample(ContainerID{testPodID, "container-2"}, now.Add(-30*time.Minute))
+	// Only stale containers.
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, testLabels, apiv1.PodRunning))
+	addSample(ContainerID{testPodID3, "container-1"}, now.Add(-20*time.Minute))
+	addSample(ContainerID{testPodID3, "container-2"}, now.Add(-30*time.Minute))
+	// Without containers.
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID4, testLabels, apiv1.PodRunning))
+
+	assert.Equal(t, []PodID{testPodID3}, cluster.GetStalePods(10*time.Minute, now))
+	assert.Equal(t, []PodID{testPodID, testPodID3}, cluster.GetStalePods(0, now))
+	assert.Empty(t, cluster.GetStalePods(time.Hour, now))
+
+	// Containers without samples are fresh until the pod is old enough.
+	otherPodID := PodID{"namespace-1", "pod-5"}
+	assert.NoError(t, cluster.AddOrUpdatePod(otherPodID, testLabels, apiv1.PodRunning))
+	_, err := cluster.AddOrUpdateContainer(ContainerID{otherPodID, "container-1"}, testRequest)
+	assert.NoError(t, err)
+	addedTime := cluster.pods[otherPodID].AddedTime
+	assert.NotContains(t, cluster.GetStalePods(time.Hour, addedTime.Add(time.Minute)), otherPodID)
+	assert.Contains(t, cluster.GetStalePods(time.Hour, addedTime.Add(2*time.Hour)), otherPodID)
+}
+
+func TestClusterForceGC(t *testing.T) {
+	ctx := context.Background()
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
+
+	// The expired aggregation is removed right away.
+	cluster.ForceGC(ctx, testControllerFetcher)
+	assert.Empty(t, cluster.aggregateStates.snapshot())
 	assert.Empty(t, vpa.aggregateContainerStates)
+
+	// The rate limited garbage collection right after it is a no-op.
+	otherContainerID := ContainerID{testPodID, "container-2"}
+	_, err := cluster.AddOrUpdateContainer(otherContainerID, testRequest)
+	assert.NoError(t, err)
+	sample := makeTestUsageSample()
+	sample.Container = otherContainerID
+	assert.NoError(t, cluster.AddSample(sample))
+	cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, time.Now(), testControllerFetcher)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
+
+	cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, time.Now().Add(2*testGcPeriod), testControllerFetcher)
+	assert.Empty(t, cluster.aggregateStates.snapshot())
+}
+
+func TestGetAggregationsExpiringBefore(t *testing.T) {
+	ctx := context.Background()
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	now := time.Now()
+	containerIDs := []ContainerID{{testPodID, "container-1"}, {testPodID, "container-2"}, {testPodID, "container-3"}}
+	keys := make([]AggregateStateKey, len(containerIDs))
+	addSample := func(containerID ContainerID, ts time.Time) {
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{ts, 1.0, ResourceCPU}, containerID}))
+	}
+	for i, containerID := range containerIDs {
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+		keys[i] = cluster.aggregateStateKeyForContainerID(containerID)
+	}
+	// The first and the last aggregations only have old samples.
+	addSample(containerIDs[0], testTimestamp)
+	addSample(containerIDs[1], now.Add(-time.Minute))
+	addSample(containerIDs[2], testTimestamp)
+
+	assert.ElementsMatch(t, []AggregateStateKey{keys[0], keys[2]}, cluster.GetAggregationsExpiringBefore(now))
+	// All aggregations expire once the history is long enough.
+	assert.ElementsMatch(t, keys, cluster.GetAggregationsExpiringBefore(now.Add(2*GetAggregationsConfig().GetMemoryAggregationWindowLength())))
+	// The query doesn't delete anything.
+	assert.Len(t, cluster.aggregateStates.snapshot(), 3)
+
+	// New samples keep the aggregations from expiring.
+	addSample(containerIDs[0], now)
+	assert.Equal(t, []AggregateStateKey{keys[2]}, cluster.GetAggregationsExpiringBefore(now))
+
+	cluster.ForceGC(ctx, testControllerFetcher)
+	assert.Empty(t, cluster.GetAggregationsExpiringBefore(now))
+	assert.Len(t, cluster.aggregateStates.snapshot(), 2)
 }
 
 func TestClusterRecordOOM(t *testing.T) {
 	// Create a pod with a single container.
 	cluster := NewClusterState(testGcPeriod)
 	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
-	assert.NoError(t, cluster.AddOrUpdateContainer(testContainerID, testRequest))
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
 
-	// RecordOOM
-	assert.NoError(t, cluster.RecordOOM(testContainerID, time.Unix(0, 0), ResourceAmount(10)))
+	// RecordOOMWithContext
+	assert.NoError(t, cluster.RecordOOMWithContext(context.Background(), testContainerID, time.Unix(0, 0), ResourceAmount(10)))
 
 	// Verify that OOM was aggregated into the aggregated stats.
 	aggregation := cluster.findOrCreateAggregateContainerState(testContainerID)
 	assert.NotEmpty(t, aggregation.AggregateMemoryPeaks)
 }
 
+func TestClusterRecordOOMWithCancelledContext(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := cluster.RecordOOMWithContext(ctx, testContainerID, time.Unix(0, 0), ResourceAmount(10))
+	assert.ErrorIs(t, err, context.Canceled)
+	// The context is checked before the pod is looked up.
+	err = cluster.RecordOOMWithContext(ctx, ContainerID{testPodID3, "container-1"}, time.Unix(0, 0), ResourceAmount(10))
+	assert.ErrorIs(t, err, context.Canceled)
+	aggregation := cluster.findOrCreateAggregateContainerState(testContainerID)
+	assert.True(t, aggregation.AggregateMemoryPeaks.IsEmpty())
+}
+
+func TestClusterRecordOOMs(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning))
+	otherContainerID := ContainerID{testPodID, "container-2"}
+	for _, containerID := range []ContainerID{testContainerID, otherContainerID} {
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+	}
+
+	errs := cluster.RecordOOMs([]OOMEvent{
+		{ContainerID: testContainerID, Timestamp: time.Unix(0, 0), RequestedMemory: ResourceAmount(10)},
+		{ContainerID: ContainerID{testPodID3, "container-1"}, Timestamp: time.Unix(0, 0), RequestedMemory: ResourceAmount(10)},
+		{ContainerID: ContainerID{testPodID, "unknown"}, Timestamp: time.Unix(0, 0), RequestedMemory: ResourceAmount(10)},
+		{ContainerID: otherContainerID, Timestamp: time.Unix(0, 0), RequestedMemory: ResourceAmount(10)},
+	})
+	assert.Len(t, errs, 4)
+	assert.NoError(t, errs[0])
+	assert.EqualError(t, errs[1], "pod namespace-1/pod-3 not found")
+	assert.EqualError(t, errs[2], "container namespace-1/pod-1/unknown not found")
+	assert.NoError(t, errs[3])
+
+	// OOMs of both known containers were aggregated despite the failures.
+	for _, containerID := range []ContainerID{testContainerID, otherContainerID} {
+		aggregation := cluster.findOrCreateAggregateContainerState(containerID)
+		assert.False(t, aggregation.AggregateMemoryPeaks.IsEmpty(), "container %s", containerID.ContainerName)
+	}
+}
+
 // Verifies that AddSample and AddOrUpdateContainer methods return a proper
-// KeyError when referring to a non-existent pod.
+// PodNotFoundError when referring to a non-existent pod.
 func TestMissingKeys(t *testing.T) {
 	cluster := NewClusterState(testGcPeriod)
 	err := cluster.AddSample(makeTestUsageSample())
-	assert.EqualError(t, err, "KeyError: {namespace-1 pod-1}")
+	assert.EqualError(t, err, "pod namespace-1/pod-1 not found")
 
-	err = cluster.RecordOOM(testContainerID, time.Unix(0, 0), ResourceAmount(10))
-	assert.EqualError(t, err, "KeyError: {namespace-1 pod-1}")
+	err = cluster.RecordOOMWithContext(context.Background(), testContainerID, time.Unix(0, 0), ResourceAmount(10))
+	assert.EqualError(t, err, "pod namespace-1/pod-1 not found")
 
-	err = cluster.AddOrUpdateContainer(testContainerID, testRequest)
-	assert.EqualError(t, err, "KeyError: {namespace-1 pod-1}")
+	_, err = cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.EqualError(t, err, "pod namespace-1/pod-1 not found")
+
+	var podErr PodNotFoundError
+	if assert.ErrorAs(t, err, &podErr) {
+		assert.Equal(t, testPodID, podErr.PodID)
+	}
+	assert.ErrorAs(t, err, &KeyError{})
 }
 
 func addVpa(cluster ClusterState, id VpaID, annotations vpaAnnotationsMap, selector string, targetRef *autoscaling.CrossVersionObjectReference) *Vpa {
@@ -368,7 +653,7 @@ func addTestPod(cluster ClusterState) *PodState {
 }
 
 func addTestContainer(t *testing.T, cluster ClusterState) *ContainerState {
-	err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
 	assert.NoError(t, err)
 	return cluster.GetContainer(testContainerID)
 }
@@ -645,6 +930,25 @@ func TestEqualAggregateStateKey(t *testing.T) {
 	assert.True(t, key1 == key2)
 }
 
+// Verify that keys created by different cluster states for the same labels are
+// Equal and have the same Hash.
+func TestAggregateStateKeyEqualAcrossClusterStates(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	key1 := cluster.MakeAggregateStateKey(addTestPod(cluster), "container-1").(aggregateStateKey)
+	otherCluster := NewClusterState(testGcPeriod)
+	key2 := otherCluster.MakeAggregateStateKey(addTestPod(otherCluster), "container-1").(aggregateStateKey)
+	assert.False(t, key1 == key2)
+	assert.True(t, key1.Equal(key2))
+	assert.Equal(t, key1.Hash(), key2.Hash())
+
+	otherContainerKey := otherCluster.MakeAggregateStateKey(otherCluster.Pods()[testPodID], "container-2").(aggregateStateKey)
+	assert.False(t, key1.Equal(otherContainerKey))
+	assert.NotEqual(t, key1.Hash(), otherContainerKey.Hash())
+	assert.NoError(t, otherCluster.AddOrUpdatePod(testPodID, map[string]string{"label-1": "value-2"}, apiv1.PodRunning))
+	otherLabelsKey := otherCluster.MakeAggregateStateKey(otherCluster.Pods()[testPodID], "container-1").(aggregateStateKey)
+	assert.False(t, key1.Equal(otherLabelsKey))
+}
+
 // Verify that two containers with the same name, living in two pods with the same namespace and labels
 // (although different pod names) are aggregated together.
 func TestTwoPodsWithSameLabels(t *testing.T) {
@@ -656,13 +960,13 @@ func TestTwoPodsWithSameLabels(t *testing.T) {
 	cluster := NewClusterState(testGcPeriod)
 	cluster.AddOrUpdatePod(podID1, testLabels, apiv1.PodRunning)
 	cluster.AddOrUpdatePod(podID2, testLabels, apiv1.PodRunning)
-	err := cluster.AddOrUpdateContainer(containerID1, testRequest)
+	_, err := cluster.AddOrUpdateContainer(containerID1, testRequest)
 	assert.NoError(t, err)
-	err = cluster.AddOrUpdateContainer(containerID2, testRequest)
+	_, err = cluster.AddOrUpdateContainer(containerID2, testRequest)
 	assert.NoError(t, err)
 
 	// Expect only one aggregation to be created.
-	assert.Equal(t, 1, len(cluster.aggregateStateMap))
+	assert.Equal(t, 1, len(cluster.aggregateStates.snapshot()))
 }
 
 // Verify that two identical containers in different namespaces are not aggregated together.
@@ -675,13 +979,13 @@ func TestTwoPodsWithDifferentNamespaces(t *testing.T) {
 	cluster := NewClusterState(testGcPeriod)
 	cluster.AddOrUpdatePod(podID1, testLabels, apiv1.PodRunning)
 	cluster.AddOrUpdatePod(podID2, testLabels, apiv1.PodRunning)
-	err := cluster.AddOrUpdateContainer(containerID1, testRequest)
+	_, err := cluster.AddOrUpdateContainer(containerID1, testRequest)
 	assert.NoError(t, err)
-	err = cluster.AddOrUpdateContainer(containerID2, testRequest)
+	_, err = cluster.AddOrUpdateContainer(containerID2, testRequest)
 	assert.NoError(t, err)
 
 	// Expect two separate aggregations to be created.
-	assert.Equal(t, 2, len(cluster.aggregateStateMap))
+	assert.Equal(t, 2, len(cluster.aggregateStates.snapshot()))
 	// Expect only one entry to be present in the labels set map.
 	assert.Equal(t, 1, len(cluster.labelSetMap))
 }
@@ -695,13 +999,15 @@ func TestEmptySelector(t *testing.T) {
 	// Create a pod with labels. Add a container.
 	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
 	containerID1 := ContainerID{testPodID, "foo"}
-	assert.NoError(t, cluster.AddOrUpdateContainer(containerID1, testRequest))
+	_, err := cluster.AddOrUpdateContainer(containerID1, testRequest)
+	assert.NoError(t, err)
 
 	// Create a pod without labels. Add a container.
 	anotherPodID := PodID{"namespace-1", "pod-2"}
 	cluster.AddOrUpdatePod(anotherPodID, emptyLabels, apiv1.PodRunning)
 	containerID2 := ContainerID{anotherPodID, "foo"}
-	assert.NoError(t, cluster.AddOrUpdateContainer(containerID2, testRequest))
+	_, err = cluster.AddOrUpdateContainer(containerID2, testRequest)
+	assert.NoError(t, err)
 
 	// Both pods should be matched by the VPA.
 	assert.Contains(t, vpa.aggregateContainerStates, cluster.aggregateStateKeyForContainerID(containerID1))
@@ -782,6 +1088,29 @@ func TestRecordRecommendation(t *testing.T) {
 	}
 }
 
+func TestEmptyVpaCount(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	otherVpa := addVpa(cluster, VpaID{"namespace-1", "vpa-2"}, testAnnotations, testSelectorStr, testTargetRef)
+	assert.Equal(t, 0, cluster.EmptyVpaCount())
+	assert.Empty(t, cluster.GetEmptyVpas())
+
+	// VPAs without recommendations are counted once recorded.
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.NoError(t, cluster.RecordRecommendation(otherVpa, testTimestamp))
+	assert.Equal(t, 2, cluster.EmptyVpaCount())
+	assert.ElementsMatch(t, []VpaID{testVpaID, otherVpa.ID}, cluster.GetEmptyVpas())
+
+	// A VPA stops being counted once it receives a recommendation.
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("100m", "200G").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(time.Minute)))
+	assert.Equal(t, 1, cluster.EmptyVpaCount())
+	assert.Equal(t, []VpaID{otherVpa.ID}, cluster.GetEmptyVpas())
+
+	assert.NoError(t, cluster.DeleteVpa(otherVpa.ID))
+	assert.Equal(t, 0, cluster.EmptyVpaCount())
+}
+
 type podDesc struct {
 	id     PodID
 	labels labels.Set
@@ -921,7 +1250,8 @@ func TestVPAWithMatchingPods(t *testing.T) {
 			for _, podDesc := range tc.pods {
 				cluster.AddOrUpdatePod(podDesc.id, podDesc.labels, podDesc.phase)
 				containerID := ContainerID{testPodID, "foo"}
-				assert.NoError(t, cluster.AddOrUpdateContainer(containerID, testRequest))
+				_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+				assert.NoError(t, err)
 			}
 			assert.Equal(t, tc.expectedMatch, cluster.vpas[vpa.ID].PodCount)
 		})
@@ -933,10 +1263,2114 @@ func TestVPAWithMatchingPods(t *testing.T) {
 			for _, podDesc := range tc.pods {
 				cluster.AddOrUpdatePod(podDesc.id, podDesc.labels, podDesc.phase)
 				containerID := ContainerID{testPodID, "foo"}
-				assert.NoError(t, cluster.AddOrUpdateContainer(containerID, testRequest))
+				_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+				assert.NoError(t, err)
 			}
 			vpa := addVpa(cluster, testVpaID, testAnnotations, tc.vpaSelector, testTargetRef)
 			assert.Equal(t, tc.expectedMatch, cluster.vpas[vpa.ID].PodCount)
 		})
 	}
 }
+
+func TestCountContainersWithoutRecommendation(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	otherContainerID := ContainerID{testPodID, "container-2"}
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
+	_, err = cluster.AddOrUpdateContainer(otherContainerID, testRequest)
+	assert.NoError(t, err)
+	// Containers of pods not matched by any VPA are not counted.
+	unmatchedPodID := PodID{"namespace-1", "pod-2"}
+	cluster.AddOrUpdatePod(unmatchedPodID, emptyLabels, apiv1.PodRunning)
+	_, err = cluster.AddOrUpdateContainer(ContainerID{unmatchedPodID, "container-1"}, testRequest)
+	assert.NoError(t, err)
+
+	count, containerIDs := cluster.CountContainersWithoutRecommendation()
+	assert.Equal(t, 2, count)
+	assert.ElementsMatch(t, []ContainerID{testContainerID, otherContainerID}, containerIDs)
+
+	// A recommendation alone is not enough while there are no samples.
+	vpa.UpdateRecommendation(&vpa_types.RecommendedPodResources{
+		ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+			test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("100m", "200M").GetContainerResources(),
+			test.Recommendation().WithContainer(otherContainerID.ContainerName).WithTarget("100m", "200M").GetContainerResources(),
+		},
+	})
+	count, _ = cluster.CountContainersWithoutRecommendation()
+	assert.Equal(t, 2, count)
+
+	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
+	count, containerIDs = cluster.CountContainersWithoutRecommendation()
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []ContainerID{otherContainerID}, containerIDs)
+
+	assert.NoError(t, addTestCPUSample(cluster, otherContainerID, 1.0))
+	count, containerIDs = cluster.CountContainersWithoutRecommendation()
+	assert.Equal(t, 0, count)
+	assert.Empty(t, containerIDs)
+}
+
+func TestSimulateAdmission(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("500m", "1Gi").Get()
+	aggregateStateMapSize := len(cluster.aggregateStates.snapshot())
+	vpaAggregationsSize := len(vpa.aggregateContainerStates)
+	podCount := vpa.PodCount
+
+	pod := test.Pod().WithName("pod-2").WithLabels(testLabels).
+		AddContainer(test.Container().WithName(testContainerID.ContainerName).WithCPURequest(resource.MustParse("1")).WithMemRequest(resource.MustParse("2Gi")).Get()).
+		AddContainer(test.Container().WithName("unmanaged").WithCPURequest(resource.MustParse("1")).Get()).Get()
+	pod.Namespace = testPodID.Namespace
+
+	simulatedPod, matchedVpa, err := cluster.SimulateAdmission(pod)
+	assert.NoError(t, err)
+	assert.Equal(t, vpa, matchedVpa)
+	assert.Equal(t, resource.MustParse("500m"), simulatedPod.Spec.Containers[0].Resources.Requests[apiv1.ResourceCPU])
+	assert.Equal(t, resource.MustParse("1Gi"), simulatedPod.Spec.Containers[0].Resources.Requests[apiv1.ResourceMemory])
+	assert.Equal(t, resource.MustParse("1"), simulatedPod.Spec.Containers[1].Resources.Requests[apiv1.ResourceCPU])
+
+	// The original pod and the cluster state are left intact.
+	assert.Equal(t, resource.MustParse("1"), pod.Spec.Containers[0].Resources.Requests[apiv1.ResourceCPU])
+	assert.Equal(t, podCount, vpa.PodCount)
+	assert.Len(t, cluster.pods, 1)
+	assert.Len(t, cluster.aggregateStates.snapshot(), aggregateStateMapSize)
+	assert.Len(t, vpa.aggregateContainerStates, vpaAggregationsSize)
+	assert.Equal(t, test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("500m", "1Gi").Get(), vpa.Recommendation)
+
+	// The recommendation is capped to the resource policy.
+	vpa.SetResourcePolicy(&vpa_types.PodResourcePolicy{ContainerPolicies: []vpa_types.ContainerResourcePolicy{{
+		ContainerName: testContainerID.ContainerName,
+		MinAllowed:    apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("700m")},
+	}}})
+	simulatedPod, _, err = cluster.SimulateAdmission(pod)
+	assert.NoError(t, err)
+	assert.Equal(t, resource.MustParse("700m"), simulatedPod.Spec.Containers[0].Resources.Requests[apiv1.ResourceCPU])
+	vpa.SetResourcePolicy(nil)
+
+	// The VPA with the lowest ID controls pods matching several VPAs.
+	otherVpa := addVpa(cluster, VpaID{"namespace-1", "vpa-0"}, testAnnotations, testSelectorStr, testTargetRef)
+	otherVpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("300m", "1Gi").Get()
+	for i := 0; i < 10; i++ {
+		simulatedPod, matchedVpa, err = cluster.SimulateAdmission(pod)
+		assert.NoError(t, err)
+		assert.Same(t, otherVpa, matchedVpa)
+		assert.Equal(t, resource.MustParse("300m"), simulatedPod.Spec.Containers[0].Resources.Requests[apiv1.ResourceCPU])
+	}
+	assert.NoError(t, cluster.DeleteVpa(otherVpa.ID))
+
+	// VPAs which don't apply recommendations at admission leave the pod
+	// unmodified.
+	for _, mode := range []vpa_types.UpdateMode{vpa_types.UpdateModeOff, vpa_types.UpdateModeAnnotationRecommendation} {
+		vpa.UpdateMode = &mode
+		simulatedPod, matchedVpa, err = cluster.SimulateAdmission(pod)
+		assert.NoError(t, err)
+		assert.Same(t, vpa, matchedVpa)
+		assert.Equal(t, pod, simulatedPod, "mode %s", mode)
+	}
+	vpa.UpdateMode = nil
+	vpa.DryRun = true
+	simulatedPod, _, err = cluster.SimulateAdmission(pod)
+	assert.NoError(t, err)
+	assert.Equal(t, pod, simulatedPod)
+	vpa.DryRun = false
+
+	// Pods not matched by any VPA are returned unmodified.
+	pod.Labels = emptyLabels
+	simulatedPod, matchedVpa, err = cluster.SimulateAdmission(pod)
+	assert.NoError(t, err)
+	assert.Nil(t, matchedVpa)
+	assert.Equal(t, pod, simulatedPod)
+
+	_, _, err = cluster.SimulateAdmission(nil)
+	assert.Error(t, err)
+}
+
+func TestRecordRecommendationCapsToNodeCapacity(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	cluster.AddOrUpdateNode("node-1", test.Resources("2", "4Gi"))
+	cluster.AddOrUpdateNode("node-2", test.Resources("4", "2Gi"))
+
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("8", "1Gi").WithUpperBound("10", "8Gi").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.Equal(t, test.Resources("4", "1Gi"), vpa.Recommendation.ContainerRecommendations[0].Target)
+	assert.Equal(t, test.Resources("4", "4Gi"), vpa.Recommendation.ContainerRecommendations[0].UpperBound)
+	// The uncapped target is left intact.
+	assert.Equal(t, test.Resources("8", "1Gi"), vpa.Recommendation.ContainerRecommendations[0].UncappedTarget)
+
+	// Without any nodes the recommendation is not capped.
+	cluster.DeleteNode("node-1")
+	cluster.DeleteNode("node-2")
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("8", "1Gi").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.Equal(t, test.Resources("8", "1Gi"), vpa.Recommendation.ContainerRecommendations[0].Target)
+}
+
+func TestRecordRecommendationWaitingForInitialData(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	vpa.Created = testTimestamp
+	assert.Equal(t, time.Hour, vpa.CreationAge(testTimestamp.Add(time.Hour)))
+
+	// The condition is not set unless the minimal age is configured.
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(time.Minute)))
+	assert.NotContains(t, vpa.Conditions, vpa_types.WaitingForInitialData)
+
+	cluster.SetMinVpaAgeForRecommendation(time.Hour)
+	for _, tc := range []struct {
+		age      time.Duration
+		expected bool
+	}{
+		{age: time.Minute, expected: true},
+		{age: 59 * time.Minute, expected: true},
+		{age: time.Hour, expected: false},
+		{age: 2 * time.Hour, expected: false},
+	} {
+		vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("1", "1Gi").Get()
+		assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(tc.age)))
+		if tc.expected {
+			if assert.Contains(t, vpa.Conditions, vpa_types.WaitingForInitialData, "age %v", tc.age) {
+				assert.Equal(t, apiv1.ConditionTrue, vpa.Conditions[vpa_types.WaitingForInitialData].Status)
+			}
+		} else {
+			assert.NotContains(t, vpa.Conditions, vpa_types.WaitingForInitialData, "age %v", tc.age)
+		}
+	}
+}
+
+func TestRecordRecommendationSmoothing(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addVpa(cluster, testVpaID, vpaAnnotationsMap{SmoothingWindowAnnotation: "10"}, testSelectorStr, testTargetRef)
+	assert.Equal(t, 10, vpa.SmoothingWindow)
+
+	targets := []string{"1", "10", "1", "1", "1"}
+	for i, target := range targets {
+		vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget(target, "1Gi").Get()
+		assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(time.Duration(i)*time.Minute)))
+	}
+	smoothedCPU := vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU]
+	assert.Less(t, smoothedCPU.MilliValue(), int64(3000))
+	assert.Greater(t, smoothedCPU.MilliValue(), int64(1000))
+	smoothedMemory := vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceMemory]
+	assert.Equal(t, int64(1<<30), smoothedMemory.Value())
+
+	// Removing the annotation disables smoothing.
+	addVpa(cluster, testVpaID, vpaAnnotationsMap{}, testSelectorStr, testTargetRef)
+	assert.Equal(t, 0, vpa.SmoothingWindow)
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("10", "1Gi").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.Equal(t, test.Resources("10", "1Gi"), vpa.Recommendation.ContainerRecommendations[0].Target)
+}
+
+func TestGetNamespaceStats(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa1 := addTestVpa(cluster)
+	vpa2 := addVpa(cluster, VpaID{"namespace-1", "vpa-2"}, testAnnotations, "label-2 = value-2", testTargetRef)
+	otherNamespaceVpa := addVpa(cluster, VpaID{"namespace-2", "vpa-1"}, testAnnotations, testSelectorStr, testTargetRef)
+	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
+	cluster.AddOrUpdatePod(testPodID3, testLabels, apiv1.PodRunning)
+	cluster.AddOrUpdatePod(testPodID4, map[string]string{"label-2": "value-2"}, apiv1.PodRunning)
+	cluster.AddOrUpdatePod(PodID{"namespace-2", "pod-1"}, testLabels, apiv1.PodRunning)
+
+	vpa1.Recommendation = test.Recommendation().WithContainer("container-1").WithTarget("100m", "100Mi").Get()
+	vpa2.Recommendation = test.Recommendation().WithContainer("container-1").WithTarget("1", "1Gi").Get()
+	otherNamespaceVpa.Recommendation = test.Recommendation().WithContainer("container-1").WithTarget("8", "8Gi").Get()
+
+	stats := cluster.GetNamespaceStats("namespace-1")
+	assert.Equal(t, NamespaceStats{
+		RecommendedCPU:    CPUAmountFromCores(2*0.1 + 1),
+		RecommendedMemory: MemoryAmountFromBytes(2*100*mb + 1024*mb),
+		VpaCount:          2,
+		PodCount:          3,
+	}, stats)
+	assert.Equal(t, NamespaceStats{}, cluster.GetNamespaceStats("namespace-3"))
+}
+
+func TestRecordRecommendationNeverDecreaseBelowRequest(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			annotations := vpaAnnotationsMap{}
+			if enabled {
+				annotations[NeverDecreaseBelowRequestAnnotation] = "true"
+			}
+			vpa := addVpa(cluster, testVpaID, annotations, testSelectorStr, testTargetRef)
+			assert.Equal(t, enabled, vpa.NeverDecreaseBelowRequest)
+			addTestPod(cluster)
+			addTestContainer(t, cluster)
+
+			// testRequest is 3.14 cores and 3.14GB, recommend half of it.
+			vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).
+				WithTarget("1570m", "1570M").WithLowerBound("1", "1G").Get()
+			assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+			target := vpa.Recommendation.ContainerRecommendations[0].Target
+			lowerBound := vpa.Recommendation.ContainerRecommendations[0].LowerBound
+			if enabled {
+				assert.Equal(t, int64(3140), target.Cpu().MilliValue())
+				assert.Equal(t, int64(3.14e9), target.Memory().Value())
+				assert.Equal(t, int64(3140), lowerBound.Cpu().MilliValue())
+				assert.Equal(t, int64(3.14e9), lowerBound.Memory().Value())
+			} else {
+				assert.Equal(t, int64(1570), target.Cpu().MilliValue())
+				assert.Equal(t, int64(1.57e9), target.Memory().Value())
+				assert.Equal(t, int64(1000), lowerBound.Cpu().MilliValue())
+			}
+
+			// The raised recommendation doesn't exceed the maximum allowed.
+			vpa.SetResourcePolicy(&vpa_types.PodResourcePolicy{ContainerPolicies: []vpa_types.ContainerResourcePolicy{{
+				ContainerName: testContainerID.ContainerName,
+				MaxAllowed:    apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("2")},
+			}}})
+			vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).
+				WithTarget("1570m", "1570M").WithLowerBound("1", "1G").WithUpperBound("1800m", "2G").Get()
+			assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+			containerRecommendation := vpa.Recommendation.ContainerRecommendations[0]
+			if enabled {
+				assert.Equal(t, int64(2000), containerRecommendation.Target.Cpu().MilliValue())
+				assert.Equal(t, int64(2000), containerRecommendation.LowerBound.Cpu().MilliValue())
+				assert.Equal(t, int64(2000), containerRecommendation.UpperBound.Cpu().MilliValue())
+				assert.Equal(t, int64(3.14e9), containerRecommendation.Target.Memory().Value())
+			} else {
+				assert.Equal(t, int64(1570), containerRecommendation.Target.Cpu().MilliValue())
+			}
+		})
+	}
+}
+
+func TestAddOrUpdatePodStrictNamespaceMode(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	// Pods from namespaces without VPAs are accepted by default.
+	assert.NoError(t, cluster.AddOrUpdatePod(PodID{"namespace-2", "pod-1"}, testLabels, apiv1.PodRunning))
+
+	cluster.SetStrictNamespaceMode([]string{"namespace-1"})
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning))
+	assert.Error(t, cluster.AddOrUpdatePod(PodID{"namespace-2", "pod-2"}, testLabels, apiv1.PodRunning))
+	assert.NotContains(t, cluster.pods, PodID{"namespace-2", "pod-2"})
+
+	cluster.SetStrictNamespaceMode(nil)
+	assert.NoError(t, cluster.AddOrUpdatePod(PodID{"namespace-2", "pod-2"}, testLabels, apiv1.PodRunning))
+	assert.Contains(t, cluster.pods, PodID{"namespace-2", "pod-2"})
+}
+
+func TestGetTopNContainersByUsage(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning)
+	usage := map[string]float64{"a": 1, "b": 5, "c": 3, "d": 4}
+	containerIDs := make(map[string]ContainerID)
+	for name, value := range usage {
+		containerID := ContainerID{testPodID, name}
+		containerIDs[name] = containerID
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+		assert.NoError(t, addTestCPUSample(cluster, containerID, value))
+		// Memory usage order is the reverse of the CPU usage order.
+		assert.NoError(t, addTestMemorySample(cluster, containerID, (10-value)*1e9))
+	}
+	// Containers without samples are skipped.
+	_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID, "no-samples"}, testRequest)
+	assert.NoError(t, err)
+
+	cpuRanks := cluster.GetTopNContainersByUsage(3, apiv1.ResourceCPU)
+	assert.Len(t, cpuRanks, 3)
+	for i, name := range []string{"b", "d", "c"} {
+		assert.Equal(t, containerIDs[name], cpuRanks[i].ContainerID)
+		assert.Equal(t, cluster.aggregateStateKeyForContainerID(containerIDs[name]), cpuRanks[i].AggregateStateKey)
+	}
+	assert.Greater(t, cpuRanks[0].P90Usage, cpuRanks[1].P90Usage)
+
+	memoryRanks := cluster.GetTopNContainersByUsage(2, apiv1.ResourceMemory)
+	assert.Len(t, memoryRanks, 2)
+	assert.Equal(t, containerIDs["a"], memoryRanks[0].ContainerID)
+	assert.Equal(t, containerIDs["c"], memoryRanks[1].ContainerID)
+
+	assert.Len(t, cluster.GetTopNContainersByUsage(10, apiv1.ResourceCPU), 4)
+	assert.Empty(t, cluster.GetTopNContainersByUsage(0, apiv1.ResourceCPU))
+	assert.Empty(t, cluster.GetTopNContainersByUsage(3, apiv1.ResourceEphemeralStorage))
+}
+
+func TestFilterVPAsByUpdateMode(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	makeVpa := func(id VpaID, mode vpa_types.UpdateMode) *vpa_types.VerticalPodAutoscaler {
+		return test.VerticalPodAutoscaler().WithNamespace(id.Namespace).WithName(id.VpaName).
+			WithContainer(testContainerID.ContainerName).WithTargetRef(testTargetRef).WithUpdateMode(mode).Get()
+	}
+	otherVpaID := VpaID{"namespace-1", "vpa-2"}
+	addVpaObject(cluster, testVpaID, makeVpa(testVpaID, vpa_types.UpdateModeAuto), testSelectorStr)
+	addVpaObject(cluster, otherVpaID, makeVpa(otherVpaID, vpa_types.UpdateModeOff), testSelectorStr)
+
+	mode, err := cluster.GetUpdateMode(testVpaID)
+	assert.NoError(t, err)
+	assert.Equal(t, vpa_types.UpdateModeAuto, *mode)
+	_, err = cluster.GetUpdateMode(VpaID{"namespace-1", "missing"})
+	assert.Error(t, err)
+	assert.Equal(t, []VpaID{testVpaID}, cluster.FilterVPAsByUpdateMode(vpa_types.UpdateModeAuto))
+	assert.Equal(t, []VpaID{otherVpaID}, cluster.FilterVPAsByUpdateMode(vpa_types.UpdateModeOff))
+
+	// Changing the mode via AddOrUpdateVpa is reflected by the filter.
+	addVpaObject(cluster, otherVpaID, makeVpa(otherVpaID, vpa_types.UpdateModeAuto), testSelectorStr)
+	assert.ElementsMatch(t, []VpaID{testVpaID, otherVpaID}, cluster.FilterVPAsByUpdateMode(vpa_types.UpdateModeAuto))
+	assert.Empty(t, cluster.FilterVPAsByUpdateMode(vpa_types.UpdateModeOff))
+}
+
+func TestIsRecommendationFresh(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	assert.False(t, cluster.IsRecommendationFresh(testVpaID, time.Hour, testTimestamp))
+
+	// Empty recommendations are not timestamped.
+	vpa.Recommendation = &vpa_types.RecommendedPodResources{}
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.Nil(t, vpa.RecommendationTimestamp)
+
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("100m", "200M").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.Equal(t, testTimestamp, *vpa.RecommendationTimestamp)
+	assert.True(t, cluster.IsRecommendationFresh(testVpaID, time.Hour, testTimestamp.Add(time.Hour-time.Second)))
+	assert.True(t, cluster.IsRecommendationFresh(testVpaID, time.Hour, testTimestamp.Add(time.Hour)))
+	assert.False(t, cluster.IsRecommendationFresh(testVpaID, time.Hour, testTimestamp.Add(time.Hour+time.Second)))
+	assert.False(t, cluster.IsRecommendationFresh(VpaID{"namespace-1", "missing"}, time.Hour, testTimestamp))
+}
+
+func TestDetachAndReattachVpa(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	otherContainerID := ContainerID{testPodID, "container-2"}
+	_, err := cluster.AddOrUpdateContainer(otherContainerID, testRequest)
+	assert.NoError(t, err)
+	expectedAggregations := make(aggregateContainerStatesMap)
+	for key, state := range vpa.aggregateContainerStates {
+		expectedAggregations[key] = state
+	}
+	assert.Len(t, expectedAggregations, 2)
+
+	assert.NoError(t, cluster.DetachVpaFromAggregations(testVpaID))
+	assert.Empty(t, vpa.aggregateContainerStates)
+	for _, state := range cluster.aggregateStates.snapshot() {
+		assert.False(t, state.IsUnderVPA)
+	}
+	// New aggregations are not linked to a detached VPA.
+	_, err = cluster.AddOrUpdateContainer(ContainerID{testPodID, "container-3"}, testRequest)
+	assert.NoError(t, err)
+	assert.Empty(t, vpa.aggregateContainerStates)
+	assert.Contains(t, cluster.VPAs(), testVpaID)
+
+	assert.NoError(t, cluster.ReattachVpaToAggregations(testVpaID))
+	freshCluster := NewClusterState(testGcPeriod)
+	freshCluster.aggregateStates = cluster.aggregateStates
+	freshVpa := addTestVpa(freshCluster)
+	assert.Equal(t, freshVpa.aggregateContainerStates, vpa.aggregateContainerStates)
+	assert.Len(t, vpa.aggregateContainerStates, 3)
+	for _, state := range vpa.aggregateContainerStates {
+		assert.True(t, state.IsUnderVPA)
+	}
+
+	assert.Error(t, cluster.DetachVpaFromAggregations(VpaID{"namespace-1", "missing"}))
+	assert.Error(t, cluster.ReattachVpaToAggregations(VpaID{"namespace-1", "missing"}))
+}
+
+func TestGetCandidatePodsForEviction(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	vpa.Recommendation = test.Recommendation().WithContainer("container-1").
+		WithTarget("2", "1Gi").Get()
+	for _, podID := range []PodID{testPodID, testPodID3, testPodID4} {
+		assert.NoError(t, cluster.AddOrUpdatePod(podID, testLabels, apiv1.PodRunning))
+	}
+	// Requests are off by 50% CPU, 20% memory and 0% respectively. The second
+	// pod is off by far more in absolute terms, but memory must not outweigh
+	// CPU.
+	_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID, "container-1"},
+		Resources{ResourceCPU: CPUAmountFromCores(4), ResourceMemory: MemoryAmountFromBytes(1 << 30)})
+	assert.NoError(t, err)
+	_, err = cluster.AddOrUpdateContainer(ContainerID{testPodID3, "container-1"},
+		Resources{ResourceCPU: CPUAmountFromCores(2), ResourceMemory: MemoryAmountFromBytes(5 << 28)})
+	assert.NoError(t, err)
+	_, err = cluster.AddOrUpdateContainer(ContainerID{testPodID4, "container-1"},
+		Resources{ResourceCPU: CPUAmountFromCores(2), ResourceMemory: MemoryAmountFromBytes(1 << 30)})
+	assert.NoError(t, err)
+	// Containers without a recommendation are not candidates.
+	_, err = cluster.AddOrUpdateContainer(ContainerID{testPodID, "container-2"}, testRequest)
+	assert.NoError(t, err)
+
+	candidates, err := cluster.GetCandidatePodsForEviction(testVpaID, testTimestamp)
+	assert.NoError(t, err)
+	if assert.Len(t, candidates, 2) {
+		assert.Equal(t, testPodID, candidates[0].PodID)
+		assert.InDelta(t, 0.5, candidates[0].Benefit, 1e-9)
+		assert.Equal(t, Resources{ResourceCPU: CPUAmountFromCores(2), ResourceMemory: MemoryAmountFromBytes(1 << 30)},
+			candidates[0].RecommendedRequest)
+		assert.Equal(t, CPUAmountFromCores(4), candidates[0].CurrentRequest[ResourceCPU])
+		assert.Equal(t, testPodID3, candidates[1].PodID)
+		assert.InDelta(t, 0.2, candidates[1].Benefit, 1e-9)
+	}
+
+	// Recently evicted pods are filtered out until the cooldown passes.
+	assert.NoError(t, cluster.RecordEviction(testPodID3, testTimestamp))
+	candidates, err = cluster.GetCandidatePodsForEviction(testVpaID, testTimestamp.Add(EvictionCooldownPeriod/2))
+	assert.NoError(t, err)
+	if assert.Len(t, candidates, 1) {
+		assert.Equal(t, testPodID, candidates[0].PodID)
+	}
+	candidates, err = cluster.GetCandidatePodsForEviction(testVpaID, testTimestamp.Add(EvictionCooldownPeriod))
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 2)
+
+	// Only the Auto and Recreate modes may evict pods.
+	for _, mode := range []vpa_types.UpdateMode{vpa_types.UpdateModeOff, vpa_types.UpdateModeInitial,
+		vpa_types.UpdateModeAnnotationRecommendation, vpa_types.UpdateModeInPlace, vpa_types.UpdateModeRecreate} {
+		vpa.UpdateMode = &mode
+		candidates, err = cluster.GetCandidatePodsForEviction(testVpaID, testTimestamp.Add(EvictionCooldownPeriod))
+		assert.NoError(t, err)
+		if mode == vpa_types.UpdateModeRecreate {
+			assert.Len(t, candidates, 2, mode)
+		} else {
+			assert.Empty(t, candidates, mode)
+		}
+	}
+
+	assert.Error(t, cluster.RecordEviction(PodID{"namespace-1", "missing"}, testTimestamp))
+	_, err = cluster.GetCandidatePodsForEviction(VpaID{"namespace-1", "missing"}, testTimestamp)
+	assert.Error(t, err)
+}
+
+func TestGetCandidatesForInPlaceUpdate(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	vpa.Recommendation = test.Recommendation().WithContainer("container-1").
+		WithTarget("2", "1Gi").Get()
+	request := Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(1 << 30)}
+	otherPodID := PodID{"namespace-1", "pod-5"}
+	for _, podID := range []PodID{testPodID, testPodID3, testPodID4, otherPodID} {
+		assert.NoError(t, cluster.AddOrUpdatePod(podID, testLabels, apiv1.PodRunning))
+		_, err := cluster.AddOrUpdateContainer(ContainerID{podID, "container-1"}, request)
+		assert.NoError(t, err)
+	}
+	// The recommendation fits within the limits of the first pod only.
+	assert.NoError(t, cluster.SetContainerLimit(ContainerID{testPodID, "container-1"},
+		Resources{ResourceCPU: CPUAmountFromCores(4), ResourceMemory: MemoryAmountFromBytes(2 << 30)}))
+	assert.NoError(t, cluster.SetContainerLimit(ContainerID{testPodID3, "container-1"},
+		Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(2 << 30)}))
+	// The fourth pod already uses the recommendation.
+	_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID4, "container-1"},
+		Resources{ResourceCPU: CPUAmountFromCores(2), ResourceMemory: MemoryAmountFromBytes(1 << 30)})
+	assert.NoError(t, err)
+	// Pods which are not running can't be updated.
+	assert.NoError(t, cluster.AddOrUpdatePod(otherPodID, testLabels, apiv1.PodPending))
+
+	// Auto VPAs have eviction candidates only.
+	candidates, err := cluster.GetCandidatesForInPlaceUpdate(testVpaID)
+	assert.NoError(t, err)
+	assert.Empty(t, candidates)
+	evictionCandidates, err := cluster.GetCandidatePodsForEviction(testVpaID, testTimestamp)
+	assert.NoError(t, err)
+	assert.Len(t, evictionCandidates, 3)
+
+	// InPlace VPAs have in-place candidates only.
+	inPlace := vpa_types.UpdateModeInPlace
+	vpa.SetUpdateMode(&vpa_types.PodUpdatePolicy{UpdateMode: &inPlace})
+	candidates, err = cluster.GetCandidatesForInPlaceUpdate(testVpaID)
+	assert.NoError(t, err)
+	assert.Equal(t, []PodID{testPodID}, candidates)
+	evictionCandidates, err = cluster.GetCandidatePodsForEviction(testVpaID, testTimestamp)
+	assert.NoError(t, err)
+	assert.Empty(t, evictionCandidates)
+
+	_, err = cluster.GetCandidatesForInPlaceUpdate(VpaID{"namespace-1", "missing"})
+	assert.Error(t, err)
+}
+
+func TestCheckRecommendationSafety(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp,
+		Usage:        CPUAmountFromCores(1.0),
+		Resource:     ResourceCPU}, testContainerID}))
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp,
+		Usage:        MemoryAmountFromBytes(1e9),
+		Resource:     ResourceMemory}, testContainerID}))
+	aggregation := AggregateStateByContainerName(vpa.aggregateContainerStates)["container-1"]
+	p99CPU := CPUAmountFromCores(aggregation.AggregateCPUUsage.Percentile(0.99))
+	p99Memory := MemoryAmountFromBytes(aggregation.AggregateMemoryPeaks.Percentile(0.99))
+	setRecommendation := func(cpu, memory ResourceAmount) {
+		vpa.Recommendation = &vpa_types.RecommendedPodResources{
+			ContainerRecommendations: []vpa_types.RecommendedContainerResources{{
+				ContainerName: "container-1",
+				Target: apiv1.ResourceList{
+					apiv1.ResourceCPU:    QuantityFromCPUAmount(cpu),
+					apiv1.ResourceMemory: QuantityFromMemoryAmount(memory),
+				},
+			}},
+		}
+	}
+
+	// Recommendation exactly at the margin is safe, just below it isn't.
+	setRecommendation(2*p99CPU, 2*p99Memory-1)
+	assert.Equal(t, []SafetyViolation{{
+		ContainerName: "container-1",
+		Resource:      ResourceMemory,
+		Recommended:   2*p99Memory - 1,
+		P99Usage:      p99Memory,
+	}}, cluster.CheckRecommendationSafety(testVpaID, 1.0))
+
+	// Without a margin only recommendations below the usage are violations.
+	assert.Empty(t, cluster.CheckRecommendationSafety(testVpaID, 0.0))
+	setRecommendation(p99CPU-1, p99Memory)
+	violations := cluster.CheckRecommendationSafety(testVpaID, 0.0)
+	if assert.Len(t, violations, 1) {
+		assert.Equal(t, ResourceCPU, violations[0].Resource)
+		assert.Equal(t, p99CPU, violations[0].P99Usage)
+	}
+	assert.Len(t, cluster.CheckRecommendationSafety(testVpaID, 0.5), 2)
+
+	// Missing VPAs and VPAs without recommendation have no violations.
+	vpa.Recommendation = nil
+	assert.Empty(t, cluster.CheckRecommendationSafety(testVpaID, 0.5))
+	assert.Empty(t, cluster.CheckRecommendationSafety(VpaID{"namespace-1", "missing"}, 0.5))
+}
+
+func TestGetVpaForPod(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	otherVpaID := VpaID{"namespace-1", "vpa-2"}
+	otherVpa := addVpa(cluster, otherVpaID, testAnnotations, "label-2 = value-2", testTargetRef)
+
+	_, err := cluster.GetVpaForPod(testPodID)
+	assert.Error(t, err)
+
+	// The cache follows the changes of pod labels.
+	addTestPod(cluster)
+	cached, err := cluster.GetVpaForPod(testPodID)
+	assert.NoError(t, err)
+	assert.Same(t, vpa, cached)
+	assert.Same(t, cluster.GetControllingVPA(cluster.pods[testPodID]), cached)
+
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID, emptyLabels, apiv1.PodRunning))
+	cached, err = cluster.GetVpaForPod(testPodID)
+	assert.NoError(t, err)
+	assert.Nil(t, cached)
+
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID, map[string]string{"label-2": "value-2"}, apiv1.PodRunning))
+	cached, err = cluster.GetVpaForPod(testPodID)
+	assert.NoError(t, err)
+	assert.Same(t, otherVpa, cached)
+
+	// Deleting the VPA drops it from the cache.
+	assert.NoError(t, cluster.DeleteVpa(otherVpaID))
+	cached, err = cluster.GetVpaForPod(testPodID)
+	assert.NoError(t, err)
+	assert.Nil(t, cached)
+
+	// A VPA added after the pod is cached as well.
+	otherVpa = addVpa(cluster, otherVpaID, testAnnotations, "label-2 = value-2", testTargetRef)
+	cached, err = cluster.GetVpaForPod(testPodID)
+	assert.NoError(t, err)
+	assert.Same(t, otherVpa, cached)
+
+	cluster.DeletePod(testPodID)
+	_, err = cluster.GetVpaForPod(testPodID)
+	assert.Error(t, err)
+}
+
+func TestGetVpaForPodMatchingMultipleVpas(t *testing.T) {
+	for _, vpaFirst := range []bool{true, false} {
+		t.Run(fmt.Sprintf("vpaFirst=%v", vpaFirst), func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			otherVpaID := VpaID{"namespace-1", "vpa-2"}
+			// The VPA with the lowest ID is used regardless of the order in
+			// which the VPAs and the pod were added.
+			if vpaFirst {
+				addTestVpa(cluster)
+				addTestPod(cluster)
+				addVpa(cluster, otherVpaID, testAnnotations, testSelectorStr, testTargetRef)
+			} else {
+				addVpa(cluster, otherVpaID, testAnnotations, testSelectorStr, testTargetRef)
+				addTestPod(cluster)
+				addTestVpa(cluster)
+			}
+			cached, err := cluster.GetVpaForPod(testPodID)
+			assert.NoError(t, err)
+			assert.Equal(t, testVpaID, cached.ID)
+			assert.Same(t, cached, cluster.GetControllingVPA(cluster.pods[testPodID]))
+
+			// Relabeling the pod keeps the choice.
+			assert.NoError(t, cluster.AddOrUpdatePod(testPodID, emptyLabels, apiv1.PodRunning))
+			addTestPod(cluster)
+			cached, err = cluster.GetVpaForPod(testPodID)
+			assert.NoError(t, err)
+			assert.Equal(t, testVpaID, cached.ID)
+
+			// Once the VPA is deleted, the other one takes over.
+			assert.NoError(t, cluster.DeleteVpa(testVpaID))
+			cached, err = cluster.GetVpaForPod(testPodID)
+			assert.NoError(t, err)
+			assert.Equal(t, otherVpaID, cached.ID)
+		})
+	}
+}
+
+func TestDryRunVpaHasNoEvictionCandidates(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addVpa(cluster, testVpaID, vpaAnnotationsMap{"vpa.autoscaling.k8s.io/dry-run": "true"}, testSelectorStr, testTargetRef)
+	assert.True(t, vpa.DryRun)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp,
+		Usage:        CPUAmountFromCores(1.0),
+		Resource:     ResourceCPU}, testContainerID}))
+
+	// Dry-run VPAs still get recommendations.
+	vpa.UpdateRecommendation(test.Recommendation().WithContainer("container-1").WithTarget("1", "1Gi").Get())
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.True(t, vpa.HasRecommendation())
+
+	candidates, err := cluster.GetCandidatePodsForEviction(testVpaID, testTimestamp)
+	assert.NoError(t, err)
+	assert.Empty(t, candidates)
+
+	// Removing the annotation makes the pod a candidate.
+	vpa = addVpa(cluster, testVpaID, testAnnotations, testSelectorStr, testTargetRef)
+	assert.False(t, vpa.DryRun)
+	vpa.UpdateRecommendation(test.Recommendation().WithContainer("container-1").WithTarget("1", "1Gi").Get())
+	candidates, err = cluster.GetCandidatePodsForEviction(testVpaID, testTimestamp)
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 1)
+}
+
+func TestRecordCrash(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	aggregation := vpa.aggregateContainerStates[cluster.aggregateStateKeyForContainerID(testContainerID)]
+
+	// Crashes not caused by OOM kills are ignored.
+	assert.NoError(t, cluster.RecordCrash(testContainerID, testTimestamp, 1))
+	assert.True(t, aggregation.AggregateMemoryPeaks.IsEmpty())
+	assert.Zero(t, aggregation.GetOOMCount())
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, cluster.RecordCrash(testContainerID, testTimestamp.Add(time.Duration(i)*time.Minute), 137))
+	}
+	recommendedMemory := MemoryAmountFromBytes(aggregation.AggregateMemoryPeaks.Percentile(0.9))
+	assert.Greater(t, recommendedMemory, testRequest[ResourceMemory])
+	// OOM kills are counted in the OOM stats of the aggregation.
+	count, _, err := cluster.GetContainerOOMStats(testContainerID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.InDelta(t, 3.0, aggregation.GetOOMRate(time.Hour, testTimestamp.Add(3*time.Minute)), 1e-9)
+
+	assert.Error(t, cluster.RecordCrash(ContainerID{testPodID, "missing"}, testTimestamp, 137))
+	assert.Error(t, cluster.RecordCrash(ContainerID{PodID{"namespace-1", "missing"}, "container-1"}, testTimestamp, 137))
+}
+
+func TestGetOrphanedPods(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, emptyLabels, apiv1.PodRunning))
+	assert.Equal(t, []PodID{testPodID3}, cluster.GetOrphanedPods())
+
+	// A pod stops being an orphan once a VPA matches it.
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, testLabels, apiv1.PodRunning))
+	assert.Empty(t, cluster.GetOrphanedPods())
+
+	assert.NoError(t, cluster.DeleteVpa(testVpaID))
+	assert.ElementsMatch(t, []PodID{testPodID, testPodID3}, cluster.GetOrphanedPods())
+}
+
+func TestDeleteOrphanedPods(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, emptyLabels, apiv1.PodRunning))
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID4, emptyLabels, apiv1.PodRunning))
+
+	// Disabled by default.
+	assert.Empty(t, cluster.DeleteOrphanedPods(testTimestamp))
+	assert.Empty(t, cluster.DeleteOrphanedPods(testTimestamp.Add(time.Hour)))
+	assert.Len(t, cluster.Pods(), 3)
+
+	cluster.SetAutoDeleteOrphans(10 * time.Minute)
+	assert.Empty(t, cluster.DeleteOrphanedPods(testTimestamp))
+	// testPodID4 gets adopted by a VPA before the deletion delay passes.
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID4, testLabels, apiv1.PodRunning))
+	assert.Empty(t, cluster.DeleteOrphanedPods(testTimestamp.Add(10*time.Minute-time.Second)))
+	assert.Equal(t, []PodID{testPodID3}, cluster.DeleteOrphanedPods(testTimestamp.Add(10*time.Minute)))
+	assert.NotContains(t, cluster.Pods(), testPodID3)
+	assert.Contains(t, cluster.Pods(), testPodID)
+	assert.Contains(t, cluster.Pods(), testPodID4)
+
+	// Orphan age starts over when the pod becomes orphaned again.
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID4, emptyLabels, apiv1.PodRunning))
+	assert.Empty(t, cluster.DeleteOrphanedPods(testTimestamp.Add(20*time.Minute)))
+	assert.Equal(t, []PodID{testPodID4}, cluster.DeleteOrphanedPods(testTimestamp.Add(30*time.Minute)))
+}
+
+type fakeExternalRecommender struct{}
+
+func (fakeExternalRecommender) GetRecommendation(ctx context.Context, vpaID VpaID, state *AggregateContainerState) (*vpa_types.RecommendedPodResources, error) {
+	return nil, nil
+}
+
+func TestDeleteVpaUnregistersExternalRecommender(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	cluster.RegisterExternalRecommender(testVpaID, fakeExternalRecommender{})
+
+	// The external recommender is kept when the selector changes.
+	addVpa(cluster, testVpaID, testAnnotations, "label-2 = value-2", testTargetRef)
+	assert.NotNil(t, cluster.GetExternalRecommender(testVpaID))
+
+	// A VPA recreated with the same ID doesn't inherit it after deletion.
+	assert.NoError(t, cluster.DeleteVpa(testVpaID))
+	assert.Nil(t, cluster.GetExternalRecommender(testVpaID))
+	addTestVpa(cluster)
+	assert.Nil(t, cluster.GetExternalRecommender(testVpaID))
+}
+
+func TestMigrateVpa(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
+	recommendation := test.Recommendation().WithContainer("container-1").WithTarget("1", "1Gi").Get()
+	vpa.UpdateRecommendation(recommendation)
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	aggregations := vpa.aggregateContainerStates
+
+	// Migrating to another namespace fails, the VPA only matches
+	// aggregations of its own namespace.
+	assert.Error(t, cluster.MigrateVpa(testVpaID, VpaID{"namespace-2", "vpa-renamed"}))
+	assert.Same(t, vpa, cluster.VPAs()[testVpaID])
+
+	newID := VpaID{"namespace-1", "vpa-renamed"}
+	assert.NoError(t, cluster.MigrateVpa(testVpaID, newID))
+
+	migrated, found := cluster.VPAs()[newID]
+	assert.True(t, found)
+	assert.Same(t, vpa, migrated)
+	assert.Equal(t, newID, migrated.ID)
+	assert.Equal(t, aggregations, migrated.aggregateContainerStates)
+	assert.Equal(t, recommendation, migrated.Recommendation)
+	assert.Equal(t, 1, migrated.PodCount)
+	assert.True(t, cluster.IsRecommendationFresh(newID, time.Minute, testTimestamp))
+
+	assert.NotContains(t, cluster.VPAs(), testVpaID)
+	_, err := cluster.GetUpdateMode(testVpaID)
+	assert.Error(t, err)
+	assert.Error(t, cluster.MigrateVpa(testVpaID, newID))
+
+	// The aggregations are still matched by the VPA after garbage collection.
+	cluster.garbageCollectAggregateCollectionStates(context.Background(), testTimestamp, testControllerFetcher)
+	assert.Equal(t, aggregations, migrated.aggregateContainerStates)
+
+	// Migrating onto an existing VPA fails.
+	addTestVpa(cluster)
+	assert.Error(t, cluster.MigrateVpa(newID, testVpaID))
+	assert.Same(t, vpa, cluster.VPAs()[newID])
+}
+
+func TestMigrateVpaMovesPerVpaState(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	updates := cluster.RecommendationUpdates()
+	cluster.RegisterExternalRecommender(testVpaID, fakeExternalRecommender{})
+	vpa.Recommendation = test.Recommendation().WithContainer("container-1").WithTarget("1", "1Gi").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.Equal(t, testVpaID, <-updates)
+	flushed := vpa.Recommendation.DeepCopy()
+	cluster.flushedRecommendations = map[VpaID]*vpa_types.RecommendedPodResources{testVpaID: flushed}
+
+	newID := VpaID{"namespace-1", "vpa-renamed"}
+	assert.NoError(t, cluster.MigrateVpa(testVpaID, newID))
+
+	// The external recommender is moved to the new ID.
+	assert.NotNil(t, cluster.GetExternalRecommender(newID))
+	assert.Nil(t, cluster.GetExternalRecommender(testVpaID))
+	// The flushed recommendation is moved to the new ID.
+	assert.Equal(t, map[VpaID]*vpa_types.RecommendedPodResources{newID: flushed}, cluster.flushedRecommendations)
+	// The unchanged recommendation isn't notified again.
+	vpa.Recommendation = test.Recommendation().WithContainer("container-1").WithTarget("1", "1Gi").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(time.Minute)))
+	assert.Empty(t, updates)
+	assert.NotContains(t, cluster.notifiedRecommendations, testVpaID)
+	// The history is moved to the new ID.
+	history, err := cluster.GetVpaHistory(newID, 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestScaleRecommendationToBudget(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	for _, podID := range []PodID{testPodID, testPodID3} {
+		assert.NoError(t, cluster.AddOrUpdatePod(podID, testLabels, apiv1.PodRunning))
+	}
+	recommendation := &vpa_types.RecommendedPodResources{
+		ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+			test.Recommendation().WithContainer("container-1").WithTarget("3", "1Gi").
+				WithLowerBound("2", "512Mi").WithUpperBound("4", "2Gi").GetContainerResources(),
+			test.Recommendation().WithContainer("container-2").WithTarget("1", "1Gi").GetContainerResources(),
+		},
+	}
+	// The total recommendation is 8 cores and 4Gi for two pods.
+	assert.NoError(t, cluster.SetResourceBudget(testVpaID, apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse("4"),
+		apiv1.ResourceMemory: resource.MustParse("8Gi"),
+	}))
+	vpa.Recommendation = recommendation
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+
+	// CPU is scaled down by half, memory is within the budget.
+	container1 := vpa.Recommendation.ContainerRecommendations[0]
+	container2 := vpa.Recommendation.ContainerRecommendations[1]
+	assertQuantityEqual(t, "1500m", container1.Target[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "1", container1.LowerBound[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "2", container1.UpperBound[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "500m", container2.Target[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "1Gi", container1.Target[apiv1.ResourceMemory])
+	assertQuantityEqual(t, "2Gi", container1.UpperBound[apiv1.ResourceMemory])
+	// The original recommendation is not modified.
+	assertQuantityEqual(t, "3", recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+
+	// Memory is scaled down too when the budget is exceeded.
+	assert.NoError(t, cluster.SetResourceBudget(testVpaID, apiv1.ResourceList{
+		apiv1.ResourceMemory: resource.MustParse("1Gi"),
+	}))
+	vpa.Recommendation = recommendation
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assertQuantityEqual(t, "3", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "256Mi", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceMemory])
+	assertQuantityEqual(t, "256Mi", vpa.Recommendation.ContainerRecommendations[1].Target[apiv1.ResourceMemory])
+
+	// An empty budget removes the cap.
+	assert.NoError(t, cluster.SetResourceBudget(testVpaID, nil))
+	assert.Nil(t, vpa.ResourceBudget)
+	vpa.Recommendation = recommendation
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.Equal(t, recommendation, vpa.Recommendation)
+
+	assert.Error(t, cluster.SetResourceBudget(VpaID{"namespace-1", "missing"}, nil))
+}
+
+func assertQuantityEqual(t *testing.T, expected string, actual resource.Quantity) {
+	assert.Zero(t, actual.Cmp(resource.MustParse(expected)), "expected %s, got %s", expected, actual.String())
+}
+
+func TestGetRecommendationForPod(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	for _, containerName := range []string{"unmanaged", "capped"} {
+		_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID, containerName}, testRequest)
+		assert.NoError(t, err)
+	}
+	off := vpa_types.ContainerScalingModeOff
+	vpa.ResourcePolicy = &vpa_types.PodResourcePolicy{
+		ContainerPolicies: []vpa_types.ContainerResourcePolicy{
+			{
+				ContainerName: testContainerID.ContainerName,
+				MinAllowed:    test.Resources("1", "100Mi"),
+				MaxAllowed:    test.Resources("10", "512Mi"),
+			},
+			{ContainerName: "unmanaged", Mode: &off},
+			{ContainerName: "capped", MaxAllowed: test.Resources("2", "10Gi")},
+		},
+	}
+	vpa.Recommendation = &vpa_types.RecommendedPodResources{
+		ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+			test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("500m", "1Gi").GetContainerResources(),
+			test.Recommendation().WithContainer("unmanaged").WithTarget("1", "1Gi").GetContainerResources(),
+			test.Recommendation().WithContainer("capped").WithTarget("4", "1Gi").GetContainerResources(),
+		},
+	}
+
+	recommendation, err := cluster.GetRecommendationForPod(testPodID)
+	assert.NoError(t, err)
+	// 1 (raised to min) + 3.14 (unmanaged, current request) + 2 (capped to max).
+	assertQuantityEqual(t, "6140m", recommendation.Requests[apiv1.ResourceCPU])
+	// 512Mi (capped to max) + 3.14e9 (unmanaged, current request) + 1Gi.
+	assertQuantityEqual(t, "4750612736", recommendation.Requests[apiv1.ResourceMemory])
+	// The recommendation stored in the VPA is left intact.
+	assert.Equal(t, test.Resources("4", "1Gi"), vpa.Recommendation.ContainerRecommendations[2].Target)
+
+	// Without a recommendation the pod keeps its current requests.
+	vpa.Recommendation = nil
+	recommendation, err = cluster.GetRecommendationForPod(testPodID)
+	assert.NoError(t, err)
+	assertQuantityEqual(t, "9420m", recommendation.Requests[apiv1.ResourceCPU])
+
+	_, err = cluster.GetRecommendationForPod(testPodID3)
+	assert.ErrorAs(t, err, &PodNotFoundError{})
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, emptyLabels, apiv1.PodRunning))
+	_, err = cluster.GetRecommendationForPod(testPodID3)
+	assert.ErrorAs(t, err, &PodNotControlledError{})
+}
+
+func TestGetRecommendationForPodWithLimitRange(t *testing.T) {
+	cases := []struct {
+		name           string
+		limitType      apiv1.LimitType
+		max            apiv1.ResourceList
+		expectedCPU    string
+		expectedMemory string
+	}{
+		{
+			name:      "container limit caps each container",
+			limitType: apiv1.LimitTypeContainer,
+			max:       test.Resources("2", "1Gi"),
+			// 2 (capped) + 3.14 (unmanaged, current request).
+			expectedCPU: "5140m",
+			// 1Gi (capped) + 3.14e9 (unmanaged, current request).
+			expectedMemory: "4213741824",
+		},
+		{
+			name:           "pod limit caps the total",
+			limitType:      apiv1.LimitTypePod,
+			max:            test.Resources("5", "4Gi"),
+			expectedCPU:    "5",
+			expectedMemory: "4Gi",
+		},
+		{
+			name:      "persistent volume claim limit is ignored",
+			limitType: apiv1.LimitTypePersistentVolumeClaim,
+			max:       apiv1.ResourceList{apiv1.ResourceStorage: resource.MustParse("1Gi")},
+			// 4 + 3.14 (unmanaged, current request).
+			expectedCPU: "7140m",
+			// 2Gi + 3.14e9 (unmanaged, current request).
+			expectedMemory: "5287483648",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			vpa := addTestVpa(cluster)
+			addTestPod(cluster)
+			addTestContainer(t, cluster)
+			_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID, "unmanaged"}, testRequest)
+			assert.NoError(t, err)
+			off := vpa_types.ContainerScalingModeOff
+			vpa.ResourcePolicy = &vpa_types.PodResourcePolicy{
+				ContainerPolicies: []vpa_types.ContainerResourcePolicy{{ContainerName: "unmanaged", Mode: &off}},
+			}
+			vpa.Recommendation = &vpa_types.RecommendedPodResources{
+				ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+					test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("4", "2Gi").GetContainerResources(),
+				},
+			}
+
+			cluster.SetNamespaceLimitRange(testPodID.Namespace, apiv1.LimitRange{
+				Spec: apiv1.LimitRangeSpec{Limits: []apiv1.LimitRangeItem{{Type: tc.limitType, Max: tc.max}}},
+			})
+			recommendation, err := cluster.GetRecommendationForPod(testPodID)
+			assert.NoError(t, err)
+			assertQuantityEqual(t, tc.expectedCPU, recommendation.Requests[apiv1.ResourceCPU])
+			assertQuantityEqual(t, tc.expectedMemory, recommendation.Requests[apiv1.ResourceMemory])
+
+			// Without the LimitRange the recommendation is not capped.
+			cluster.DeleteNamespaceLimitRange(testPodID.Namespace)
+			recommendation, err = cluster.GetRecommendationForPod(testPodID)
+			assert.NoError(t, err)
+			assertQuantityEqual(t, "7140m", recommendation.Requests[apiv1.ResourceCPU])
+			assertQuantityEqual(t, "5287483648", recommendation.Requests[apiv1.ResourceMemory])
+		})
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	checkpoints := 0
+	cluster.SetShutdownCheckpointer(func(ctx context.Context) error {
+		checkpoints++
+		return nil
+	})
+
+	// Simulate a mutation which doesn't complete before the timeout.
+	assert.NoError(t, cluster.startMutation())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, cluster.GracefulShutdown(ctx))
+	assert.Equal(t, 0, checkpoints)
+
+	// Mutations started after the shutdown began are rejected.
+	_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.Equal(t, ErrClusterStateShutDown, err)
+	cluster.DeletePod(testPodID)
+	assert.Len(t, cluster.Pods(), 1)
+
+	cluster.inFlightMutations.Done()
+	assert.NoError(t, cluster.GracefulShutdown(context.Background()))
+	assert.Equal(t, 1, checkpoints)
+}
+
+func TestGracefulShutdownCheckpointError(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	cluster.SetShutdownCheckpointer(func(ctx context.Context) error {
+		return fmt.Errorf("checkpoint error")
+	})
+	assert.Error(t, cluster.GracefulShutdown(context.Background()))
+}
+
+func TestGetPodsWithoutSamples(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, testLabels, apiv1.PodRunning))
+	_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID3, "container-1"}, testRequest)
+	assert.NoError(t, err)
+	cluster.pods[testPodID].AddedTime = testTimestamp
+	cluster.pods[testPodID3].AddedTime = testTimestamp
+
+	// Pods added less than minAge ago are not returned.
+	assert.Empty(t, cluster.GetPodsWithoutSamples(5*time.Minute, testTimestamp.Add(time.Minute)))
+	assert.ElementsMatch(t, []PodID{testPodID, testPodID3}, cluster.GetPodsWithoutSamples(5*time.Minute, testTimestamp.Add(10*time.Minute)))
+
+	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
+	assert.Equal(t, []PodID{testPodID3}, cluster.GetPodsWithoutSamples(5*time.Minute, testTimestamp.Add(10*time.Minute)))
+}
+
+func TestGetPodAgeDistribution(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	assert.Empty(t, cluster.GetPodAgeDistribution(testTimestamp))
+
+	for i, age := range []time.Duration{3 * time.Hour, time.Minute, 2 * time.Hour} {
+		podID := PodID{"namespace-1", fmt.Sprintf("pod-%d", i)}
+		assert.NoError(t, cluster.AddOrUpdatePod(podID, testLabels, apiv1.PodRunning))
+		cluster.pods[podID].AddedTime = testTimestamp.Add(-age)
+	}
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Hour, 3 * time.Hour}, cluster.GetPodAgeDistribution(testTimestamp))
+}
+
+func TestGetPodAgePercentile(t *testing.T) {
+	cases := []struct {
+		name       string
+		ages       []time.Duration
+		percentile float64
+		expected   time.Duration
+	}{
+		{
+			name:       "no pods",
+			percentile: 0.5,
+			expected:   0,
+		},
+		{
+			name:       "single pod",
+			ages:       []time.Duration{time.Hour},
+			percentile: 0.9,
+			expected:   time.Hour,
+		},
+		{
+			name:       "median of odd count",
+			ages:       []time.Duration{5 * time.Minute, time.Minute, 3 * time.Minute},
+			percentile: 0.5,
+			expected:   3 * time.Minute,
+		},
+		{
+			name:       "median of even count",
+			ages:       []time.Duration{4 * time.Minute, time.Minute, 3 * time.Minute, 2 * time.Minute},
+			percentile: 0.5,
+			expected:   2 * time.Minute,
+		},
+		{
+			name:       "mostly ephemeral pods",
+			ages:       []time.Duration{time.Minute, time.Minute, time.Minute, time.Minute, 48 * time.Hour},
+			percentile: 0.8,
+			expected:   time.Minute,
+		},
+		{
+			name:       "high percentile hits the long-lived tail",
+			ages:       []time.Duration{time.Minute, time.Minute, time.Minute, time.Minute, 48 * time.Hour},
+			percentile: 0.95,
+			expected:   48 * time.Hour,
+		},
+		{
+			name:       "zero percentile returns minimum",
+			ages:       []time.Duration{2 * time.Hour, time.Hour},
+			percentile: 0,
+			expected:   time.Hour,
+		},
+		{
+			name:       "out of range percentile is clamped",
+			ages:       []time.Duration{2 * time.Hour, time.Hour},
+			percentile: 1.5,
+			expected:   2 * time.Hour,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			for i, age := range tc.ages {
+				podID := PodID{"namespace-1", fmt.Sprintf("pod-%d", i)}
+				assert.NoError(t, cluster.AddOrUpdatePod(podID, testLabels, apiv1.PodRunning))
+				cluster.pods[podID].AddedTime = testTimestamp.Add(-age)
+			}
+			assert.Equal(t, tc.expected, cluster.GetPodAgePercentile(tc.percentile, testTimestamp))
+		})
+	}
+}
+
+func TestRenamePod(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
+	assert.Equal(t, 1, vpa.PodCount)
+
+	newPodID := PodID{testPodID.Namespace, "pod-renamed"}
+	assert.NoError(t, cluster.RenamePod(testPodID, newPodID))
+	assert.NotContains(t, cluster.Pods(), testPodID)
+	assert.Equal(t, newPodID, cluster.Pods()[newPodID].ID)
+	assert.Equal(t, 1, vpa.PodCount)
+	controllingVpa, err := cluster.GetVpaForPod(newPodID)
+	assert.NoError(t, err)
+	assert.Equal(t, vpa, controllingVpa)
+
+	// Samples added before the rename are still visible after it.
+	newContainerID := ContainerID{newPodID, testContainerID.ContainerName}
+	container := cluster.GetContainer(newContainerID)
+	assert.Equal(t, testTimestamp, container.LastCPUSampleStart)
+	aggregation := cluster.findOrCreateAggregateContainerState(newContainerID)
+	assert.Equal(t, 1, aggregation.TotalSamplesCount)
+	assert.Equal(t, 1, cluster.StateMapSize())
+	// New samples are added to the same aggregation.
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp.Add(time.Minute),
+		Usage:        1.0,
+		Resource:     ResourceCPU}, newContainerID}))
+	assert.Equal(t, 2, aggregation.TotalSamplesCount)
+
+	assert.Error(t, cluster.RenamePod(testPodID, newPodID))
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, testLabels, apiv1.PodRunning))
+	assert.Error(t, cluster.RenamePod(testPodID3, newPodID))
+	assert.Error(t, cluster.RenamePod(testPodID3, PodID{"namespace-2", "pod-3"}))
+}
+
+func TestListStaleVPAs(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	targetRef := func(kind, name string) *autoscaling.CrossVersionObjectReference {
+		return &autoscaling.CrossVersionObjectReference{Kind: kind, Name: name, APIVersion: "apps/v1"}
+	}
+	existing := VpaID{"namespace-1", "existing"}
+	deleted := VpaID{"namespace-1", "deleted"}
+	deletedScalable := VpaID{"namespace-2", "deleted-scalable"}
+	noTarget := VpaID{"namespace-1", "no-target"}
+	addVpa(cluster, existing, testAnnotations, testSelectorStr, targetRef("Deployment", "deployment-1"))
+	addVpa(cluster, deleted, testAnnotations, testSelectorStr, targetRef("Deployment", "deployment-2"))
+	addVpa(cluster, deletedScalable, testAnnotations, testSelectorStr, targetRef("Scalable", "scalable-1"))
+	addVpa(cluster, noTarget, testAnnotations, testSelectorStr, nil)
+	controllerKey := func(namespace, kind, name string) controllerfetcher.ControllerKeyWithAPIVersion {
+		return controllerfetcher.ControllerKeyWithAPIVersion{
+			ControllerKey: controllerfetcher.ControllerKey{Namespace: namespace, Kind: kind, Name: name},
+			ApiVersion:    "apps/v1",
+		}
+	}
+	existingKey := controllerKey("namespace-1", "Deployment", "deployment-1")
+	// Scalable resources which don't exist have no topmost controller.
+	fetcher := test.NewFakeControllerFetcher().
+		WithController(existingKey, &existingKey).
+		WithMissingController(controllerKey("namespace-1", "Deployment", "deployment-2")).
+		WithController(controllerKey("namespace-2", "Scalable", "scalable-1"), nil)
+
+	stale, err := cluster.ListStaleVPAs(context.Background(), fetcher)
+	assert.NoError(t, err)
+	assert.Equal(t, []VpaID{deleted, deletedScalable}, stale)
+	// The stale VPAs are not removed.
+	assert.Len(t, cluster.VPAs(), 4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cluster.ListStaleVPAs(ctx, fetcher)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestRecordRecommendationRestartCPUBump(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	cluster.SetRestartCPUBump(3, 10*time.Minute, 0.2)
+	recordRecommendation := func(now time.Time) {
+		vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).
+			WithTarget("1", "1Gi").WithLowerBound("500m", "1Gi").WithUpperBound("2", "1Gi").Get()
+		assert.NoError(t, cluster.RecordRecommendation(vpa, now))
+	}
+
+	// The bump is not applied until the threshold is exceeded.
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, cluster.RecordRestart(testContainerID, testTimestamp.Add(time.Duration(i)*time.Minute)))
+	}
+	recordRecommendation(testTimestamp.Add(5 * time.Minute))
+	assertQuantityEqual(t, "1", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+
+	assert.NoError(t, cluster.RecordRestart(testContainerID, testTimestamp.Add(3*time.Minute)))
+	recordRecommendation(testTimestamp.Add(5 * time.Minute))
+	assertQuantityEqual(t, "1200m", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "600m", vpa.Recommendation.ContainerRecommendations[0].LowerBound[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "2400m", vpa.Recommendation.ContainerRecommendations[0].UpperBound[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "1Gi", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceMemory])
+
+	// Restarts outside of the window don't count.
+	recordRecommendation(testTimestamp.Add(time.Hour))
+	assertQuantityEqual(t, "1", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+
+	// The bump doesn't exceed the maximum allowed.
+	vpa.SetResourcePolicy(&vpa_types.PodResourcePolicy{ContainerPolicies: []vpa_types.ContainerResourcePolicy{{
+		ContainerName: testContainerID.ContainerName,
+		MaxAllowed:    apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1100m")},
+	}}})
+	recordRecommendation(testTimestamp.Add(5 * time.Minute))
+	assertQuantityEqual(t, "1100m", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "600m", vpa.Recommendation.ContainerRecommendations[0].LowerBound[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "1100m", vpa.Recommendation.ContainerRecommendations[0].UpperBound[apiv1.ResourceCPU])
+	vpa.SetResourcePolicy(nil)
+
+	// The bump is disabled with a zero threshold.
+	cluster.SetRestartCPUBump(0, 10*time.Minute, 0.2)
+	recordRecommendation(testTimestamp.Add(5 * time.Minute))
+	assertQuantityEqual(t, "1", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+
+	assert.Error(t, cluster.RecordRestart(ContainerID{testPodID, "missing"}, testTimestamp))
+}
+
+func TestRecordRecommendationCPUThrottlingBump(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	idleContainerID := ContainerID{testPodID, "container-2"}
+	_, err := cluster.AddOrUpdateContainer(idleContainerID, testRequest)
+	assert.NoError(t, err)
+	cluster.SetCPUThrottlingBump(0.2, 3, 2)
+	recordRecommendation := func() {
+		vpa.Recommendation = &vpa_types.RecommendedPodResources{ContainerRecommendations: []vpa_types.RecommendedContainerResources{
+			test.Recommendation().WithContainer(testContainerID.ContainerName).
+				WithTarget("1", "1Gi").WithLowerBound("500m", "1Gi").WithUpperBound("2", "1Gi").GetContainerResources(),
+			test.Recommendation().WithContainer(idleContainerID.ContainerName).WithTarget("1", "1Gi").GetContainerResources(),
+		}}
+		assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	}
+	recordThrottling := func(minute int, fraction float64) {
+		ts := testTimestamp.Add(time.Duration(minute) * time.Minute)
+		assert.NoError(t, cluster.RecordCPUThrottling(testContainerID, ts, fraction))
+		assert.NoError(t, cluster.RecordCPUThrottling(idleContainerID, ts, 0))
+	}
+
+	// The bump is not applied until the throttling is sustained.
+	recordThrottling(0, 0.5)
+	recordThrottling(1, 0.1)
+	recordThrottling(2, 0.3)
+	recordRecommendation()
+	assertQuantityEqual(t, "1", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+
+	recordThrottling(3, 0.3)
+	recordThrottling(4, 0.3)
+	recordRecommendation()
+	// Average throttling of 0.3 times the multiplier of 2 bumps the CPU by 60%.
+	assertQuantityEqual(t, "1600m", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "800m", vpa.Recommendation.ContainerRecommendations[0].LowerBound[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "3200m", vpa.Recommendation.ContainerRecommendations[0].UpperBound[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "1Gi", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceMemory])
+	// Containers which are not throttled are unaffected.
+	assertQuantityEqual(t, "1", vpa.Recommendation.ContainerRecommendations[1].Target[apiv1.ResourceCPU])
+
+	// The bump doesn't exceed the maximum allowed.
+	vpa.SetResourcePolicy(&vpa_types.PodResourcePolicy{ContainerPolicies: []vpa_types.ContainerResourcePolicy{{
+		ContainerName: testContainerID.ContainerName,
+		MaxAllowed:    apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1200m")},
+	}}})
+	recordRecommendation()
+	assertQuantityEqual(t, "1200m", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "800m", vpa.Recommendation.ContainerRecommendations[0].LowerBound[apiv1.ResourceCPU])
+	assertQuantityEqual(t, "1200m", vpa.Recommendation.ContainerRecommendations[0].UpperBound[apiv1.ResourceCPU])
+	vpa.SetResourcePolicy(nil)
+
+	// The bump is disabled with zero observations.
+	cluster.SetCPUThrottlingBump(0.2, 0, 2)
+	recordRecommendation()
+	assertQuantityEqual(t, "1", vpa.Recommendation.ContainerRecommendations[0].Target[apiv1.ResourceCPU])
+
+	assert.Error(t, cluster.RecordCPUThrottling(ContainerID{testPodID, "missing"}, testTimestamp, 0.5))
+	assert.Error(t, cluster.RecordCPUThrottling(testContainerID, testTimestamp.Add(time.Hour), -0.1))
+}
+
+func TestFilterAggregations(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, emptyLabels, apiv1.PodRunning))
+	_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID3, "container-1"}, testRequest)
+	assert.NoError(t, err)
+	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
+	sampledKey := cluster.aggregateStateKeyForContainerID(testContainerID)
+
+	visited := 0
+	keys := cluster.FilterAggregations(func(key AggregateStateKey, state *AggregateContainerState) bool {
+		assert.NotNil(t, state)
+		visited++
+		return !state.isEmpty()
+	})
+	assert.Equal(t, 2, visited)
+	assert.Equal(t, []AggregateStateKey{sampledKey}, keys)
+
+	assert.Empty(t, cluster.FilterAggregations(func(AggregateStateKey, *AggregateContainerState) bool { return false }))
+	assert.Len(t, cluster.FilterAggregations(func(AggregateStateKey, *AggregateContainerState) bool { return true }), 2)
+}
+
+func TestForEachAggregation(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, emptyLabels, apiv1.PodRunning))
+	for _, containerID := range []ContainerID{testContainerID, {testPodID, "container-2"}, {testPodID3, "container-1"}} {
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+	}
+
+	visited := 0
+	cluster.ForEachAggregation(func(key AggregateStateKey, state *AggregateContainerState) bool {
+		assert.NotNil(t, state)
+		visited++
+		return true
+	})
+	assert.Equal(t, 3, visited)
+
+	// Returning false stops the iteration.
+	visited = 0
+	cluster.ForEachAggregation(func(AggregateStateKey, *AggregateContainerState) bool {
+		visited++
+		return false
+	})
+	assert.Equal(t, 1, visited)
+
+	// The aggregations may be modified during the iteration.
+	visited = 0
+	cluster.ForEachAggregation(func(key AggregateStateKey, _ *AggregateContainerState) bool {
+		visited++
+		cluster.aggregateStates.delete(key)
+		cluster.findOrCreateAggregateContainerState(ContainerID{testPodID3, fmt.Sprintf("container-new-%d", visited)})
+		return true
+	})
+	assert.Equal(t, 3, visited)
+	assert.Len(t, cluster.aggregateStates.snapshot(), 3)
+}
+
+func TestGetPodsInPhase(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodPending))
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, testLabels, apiv1.PodRunning))
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID4, testLabels, apiv1.PodRunning))
+	assert.Equal(t, []PodID{testPodID}, cluster.GetPodsInPhase(apiv1.PodPending))
+	assert.ElementsMatch(t, []PodID{testPodID3, testPodID4}, cluster.GetPodsInPhase(apiv1.PodRunning))
+
+	// Phase transitions.
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning))
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID4, testLabels, apiv1.PodSucceeded))
+	assert.Empty(t, cluster.GetPodsInPhase(apiv1.PodPending))
+	assert.ElementsMatch(t, []PodID{testPodID, testPodID3}, cluster.GetPodsInPhase(apiv1.PodRunning))
+	assert.Equal(t, []PodID{testPodID4}, cluster.GetPodsInPhase(apiv1.PodSucceeded))
+
+	newPodID := PodID{testPodID.Namespace, "pod-renamed"}
+	assert.NoError(t, cluster.RenamePod(testPodID, newPodID))
+	cluster.DeletePod(testPodID4)
+	assert.ElementsMatch(t, []PodID{newPodID, testPodID3}, cluster.GetPodsInPhase(apiv1.PodRunning))
+	assert.Empty(t, cluster.GetPodsInPhase(apiv1.PodSucceeded))
+
+	// The Running count matches iteration over all pods.
+	running := 0
+	for _, pod := range cluster.Pods() {
+		if pod.Phase == apiv1.PodRunning {
+			running++
+		}
+	}
+	assert.Len(t, cluster.GetPodsInPhase(apiv1.PodRunning), running)
+}
+
+func TestIsAnnotationOnlyChange(t *testing.T) {
+	auto := vpa_types.UpdateModeAuto
+	off := vpa_types.UpdateModeOff
+	cases := []struct {
+		name     string
+		modify   func(*vpa_types.VerticalPodAutoscaler)
+		expected bool
+	}{
+		{
+			name:     "no change",
+			modify:   func(*vpa_types.VerticalPodAutoscaler) {},
+			expected: true,
+		},
+		{
+			name: "unrelated annotation added",
+			modify: func(v *vpa_types.VerticalPodAutoscaler) {
+				v.Annotations["example.com/owner"] = "team-a"
+			},
+			expected: true,
+		},
+		{
+			name: "smoothing window annotation changed",
+			modify: func(v *vpa_types.VerticalPodAutoscaler) {
+				v.Annotations[SmoothingWindowAnnotation] = "5"
+			},
+			expected: false,
+		},
+		{
+			name: "never decrease below request annotation added",
+			modify: func(v *vpa_types.VerticalPodAutoscaler) {
+				v.Annotations[NeverDecreaseBelowRequestAnnotation] = "true"
+			},
+			expected: false,
+		},
+		{
+			name: "dry run annotation removed",
+			modify: func(v *vpa_types.VerticalPodAutoscaler) {
+				delete(v.Annotations, vpa_utils.DryRunAnnotation)
+			},
+			expected: false,
+		},
+		{
+			name: "update mode changed",
+			modify: func(v *vpa_types.VerticalPodAutoscaler) {
+				v.Spec.UpdatePolicy = &vpa_types.PodUpdatePolicy{UpdateMode: &off}
+			},
+			expected: false,
+		},
+		{
+			name: "target changed",
+			modify: func(v *vpa_types.VerticalPodAutoscaler) {
+				v.Spec.TargetRef = &autoscaling.CrossVersionObjectReference{Kind: "Deployment", Name: "other"}
+			},
+			expected: false,
+		},
+		{
+			name: "recommendation changed",
+			modify: func(v *vpa_types.VerticalPodAutoscaler) {
+				v.Status.Recommendation = test.Recommendation().WithContainer("container-1").WithTarget("2", "2Gi").Get()
+			},
+			expected: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			newApiObject := func() *vpa_types.VerticalPodAutoscaler {
+				return test.VerticalPodAutoscaler().WithNamespace(testVpaID.Namespace).WithName(testVpaID.VpaName).
+					WithContainer(testContainerID.ContainerName).WithTargetRef(testTargetRef).WithUpdateMode(auto).
+					WithAnnotations(map[string]string{vpa_utils.DryRunAnnotation: "false"}).
+					AppendRecommendation(test.Recommendation().WithContainer("container-1").WithTarget("1", "1Gi").GetContainerResources()).
+					AppendCondition(vpa_types.RecommendationProvided, apiv1.ConditionTrue, "", "", testTimestamp).Get()
+			}
+			cluster := NewClusterState(testGcPeriod)
+			vpa := addVpaObject(cluster, testVpaID, newApiObject(), testSelectorStr)
+			updated := newApiObject()
+			tc.modify(updated)
+			assert.Equal(t, tc.expected, isAnnotationOnlyChange(vpa, updated))
+
+			// AddOrUpdateVpa keeps the annotations up to date either way.
+			assert.NoError(t, cluster.AddOrUpdateVpa(updated, vpa.PodSelector))
+			assert.Equal(t, map[string]string(updated.Annotations), map[string]string(cluster.VPAs()[testVpaID].Annotations))
+		})
+	}
+}
+
+func TestAddOrUpdateVpaSkipsSpecUpdateOnStatusChange(t *testing.T) {
+	auto := vpa_types.UpdateModeAuto
+	off := vpa_types.UpdateModeOff
+	newApiObject := func() *vpa_types.VerticalPodAutoscaler {
+		return test.VerticalPodAutoscaler().WithNamespace(testVpaID.Namespace).WithName(testVpaID.VpaName).
+			WithContainer(testContainerID.ContainerName).WithTargetRef(testTargetRef).WithUpdateMode(auto).
+			WithMaxAllowed(testContainerID.ContainerName, "2", "2Gi").Get()
+	}
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addVpaObject(cluster, testVpaID, newApiObject(), testSelectorStr)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
+	aggregation := cluster.findOrCreateAggregateContainerState(testContainerID)
+	resourcePolicy := vpa.ResourcePolicy
+
+	// A status-only update refreshes the recommendation but leaves the spec alone.
+	updated := newApiObject()
+	updated.Status.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("1", "1Gi").Get()
+	updated.Status.Conditions = []vpa_types.VerticalPodAutoscalerCondition{{Type: vpa_types.RecommendationProvided, Status: apiv1.ConditionTrue}}
+	assert.False(t, vpaSpecChanged(vpa, updated))
+	assert.NoError(t, cluster.AddOrUpdateVpa(updated, vpa.PodSelector))
+	assert.Same(t, vpa, cluster.VPAs()[testVpaID])
+	assert.Equal(t, updated.Status.Recommendation, vpa.Recommendation)
+	assert.Same(t, resourcePolicy, vpa.ResourcePolicy)
+	assert.Equal(t, &auto, aggregation.UpdateMode)
+	matchedVpa, err := cluster.GetVpaByTargetRef(testTargetRef.Kind, testTargetRef.Name, testVpaID.Namespace)
+	assert.NoError(t, err)
+	assert.Same(t, vpa, matchedVpa)
+
+	// A spec change is propagated to the aggregations.
+	updated = newApiObject()
+	updated.Spec.UpdatePolicy = &vpa_types.PodUpdatePolicy{UpdateMode: &off}
+	assert.True(t, vpaSpecChanged(vpa, updated))
+	assert.NoError(t, cluster.AddOrUpdateVpa(updated, vpa.PodSelector))
+	assert.Equal(t, &off, aggregation.UpdateMode)
+}
+
+func TestNoPodsMatchedCondition(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	if assert.Contains(t, vpa.Conditions, vpa_types.NoPodsMatched) {
+		assert.Equal(t, apiv1.ConditionTrue, vpa.Conditions[vpa_types.NoPodsMatched].Status)
+		assert.Equal(t, "NoPodsMatched", vpa.Conditions[vpa_types.NoPodsMatched].Reason)
+	}
+
+	// Pods which don't match the VPA don't clear the condition.
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, emptyLabels, apiv1.PodRunning))
+	assert.Contains(t, vpa.Conditions, vpa_types.NoPodsMatched)
+
+	addTestPod(cluster)
+	assert.NotContains(t, vpa.Conditions, vpa_types.NoPodsMatched)
+	// Updates of the VPA keep the condition cleared.
+	addVpa(cluster, testVpaID, vpaAnnotationsMap{SmoothingWindowAnnotation: "3"}, testSelectorStr, testTargetRef)
+	assert.NotContains(t, vpa.Conditions, vpa_types.NoPodsMatched)
+
+	cluster.DeletePod(testPodID)
+	assert.Contains(t, vpa.Conditions, vpa_types.NoPodsMatched)
+}
+
+func TestSetMutationRateLimit(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	cluster.SetMutationRateLimit(20)
+	cluster.SetMutationQueueDepth(1)
+
+	// The burst of 20 operations is allowed immediately, the following ones
+	// wait for their turn.
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		assert.NoError(t, cluster.AddOrUpdatePod(PodID{"namespace-1", fmt.Sprintf("pod-%d", i)}, testLabels, apiv1.PodRunning))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	assert.Len(t, cluster.Pods(), 25)
+
+	// Operations exceeding the queue depth are rejected without waiting.
+	cluster.queuedMutations.Store(1)
+	var rateLimitedError RateLimitedError
+	assert.ErrorAs(t, cluster.AddOrUpdatePod(testPodID, testLabels, apiv1.PodRunning), &rateLimitedError)
+	apiObject := test.VerticalPodAutoscaler().WithNamespace(testVpaID.Namespace).WithName(testVpaID.VpaName).
+		WithContainer(testContainerID.ContainerName).WithTargetRef(testTargetRef).Get()
+	assert.ErrorAs(t, cluster.AddOrUpdateVpa(apiObject, labels.Everything()), &rateLimitedError)
+	assert.Empty(t, cluster.VPAs())
+	cluster.queuedMutations.Store(0)
+
+	// Without the limit operations are not delayed.
+	cluster.SetMutationRateLimit(0)
+	cluster.queuedMutations.Store(1)
+	assert.NoError(t, cluster.AddOrUpdateVpa(apiObject, labels.Everything()))
+}
+
+func TestSetSampleRateLimit(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	otherContainerID := ContainerID{testPodID3, testContainerID.ContainerName}
+	for _, containerID := range []ContainerID{testContainerID, otherContainerID} {
+		cluster.AddOrUpdatePod(containerID.PodID, testLabels, apiv1.PodRunning)
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+	}
+	addSample := func(containerID ContainerID, ts time.Time) error {
+		sample := makeTestUsageSample()
+		sample.Container = containerID
+		sample.MeasureStart = ts
+		return cluster.AddSample(sample)
+	}
+	cluster.SetSampleRateLimit(testContainerID, 2)
+
+	// A burst of up to the limit is accepted.
+	assert.NoError(t, addSample(testContainerID, testTimestamp))
+	assert.NoError(t, addSample(testContainerID, testTimestamp.Add(time.Second)))
+	err := addSample(testContainerID, testTimestamp.Add(2*time.Second))
+	assert.IsType(t, SampleThrottledError{}, err)
+	// The limit is shared by the containers of pods with the same labels.
+	err = addSample(otherContainerID, testTimestamp.Add(3*time.Second))
+	assert.IsType(t, SampleThrottledError{}, err)
+	// Samples are accepted again after the limit replenishes.
+	assert.NoError(t, addSample(testContainerID, testTimestamp.Add(time.Minute)))
+	assert.NoError(t, addSample(otherContainerID, testTimestamp.Add(time.Minute+time.Second)))
+	err = addSample(testContainerID, testTimestamp.Add(time.Minute+2*time.Second))
+	assert.IsType(t, SampleThrottledError{}, err)
+
+	// Removing the limit accepts all samples.
+	cluster.SetSampleRateLimit(testContainerID, 0)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, addSample(testContainerID, testTimestamp.Add(2*time.Minute+time.Duration(i)*time.Second)))
+	}
+	// Setting a limit for an unknown pod is a no-op.
+	cluster.SetSampleRateLimit(ContainerID{PodID{"namespace-1", "unknown"}, "container-1"}, 1)
+	assert.Empty(t, cluster.sampleRateLimits)
+}
+
+func TestAddOrUpdateContainerRequestChanged(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	requestWithCPU := func(cores float64) Resources {
+		return Resources{ResourceCPU: CPUAmountFromCores(cores), ResourceMemory: MemoryAmountFromBytes(1e9)}
+	}
+
+	changed, err := cluster.AddOrUpdateContainer(testContainerID, requestWithCPU(1))
+	assert.NoError(t, err)
+	assert.True(t, changed, "new container")
+	changed, err = cluster.AddOrUpdateContainer(testContainerID, requestWithCPU(1))
+	assert.NoError(t, err)
+	assert.False(t, changed, "identical request")
+	changed, err = cluster.AddOrUpdateContainer(testContainerID, requestWithCPU(2))
+	assert.NoError(t, err)
+	assert.True(t, changed, "increased request")
+	changed, err = cluster.AddOrUpdateContainer(testContainerID, requestWithCPU(0.5))
+	assert.NoError(t, err)
+	assert.True(t, changed, "decreased request")
+	assert.Equal(t, requestWithCPU(0.5), cluster.GetContainer(testContainerID).Request)
+
+	changed, err = cluster.AddOrUpdateContainer(ContainerID{testPodID3, "container-1"}, requestWithCPU(1))
+	assert.Error(t, err)
+	assert.False(t, changed)
+}
+
+func TestTotalAggregationMemoryBytes(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	assert.Equal(t, int64(0), cluster.TotalAggregationMemoryBytes())
+
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID, "container-2"}, testRequest)
+	assert.NoError(t, err)
+	config := GetAggregationsConfig()
+	bucketsPerAggregation := config.CPUHistogramOptions.NumBuckets() + config.MemoryHistogramOptions.NumBuckets()
+	assert.Equal(t, int64(2*bucketsPerAggregation*bytesPerHistogramBucket), cluster.TotalAggregationMemoryBytes())
+
+	// The ephemeral storage histogram is created with the first sample.
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp, Usage: 1e9, Resource: ResourceEphemeralStorage}, testContainerID}))
+	assert.Equal(t, int64((2*bucketsPerAggregation+config.MemoryHistogramOptions.NumBuckets())*bytesPerHistogramBucket),
+		cluster.TotalAggregationMemoryBytes())
+}
+
+func TestEstimatedHistogramMemoryBytesOfBoundedHistograms(t *testing.T) {
+	// Bounded histograms only keep non-empty buckets, so the estimate grows
+	// with the samples.
+	aggregation := NewAggregateContainerState(BoundedHistogramType)
+	assert.Zero(t, aggregation.estimatedHistogramMemoryBytes())
+	aggregation.AddSample(&ContainerUsageSample{MeasureStart: testTimestamp, Usage: CPUAmountFromCores(1), Resource: ResourceCPU})
+	assert.Equal(t, int64(bytesPerHistogramBucket), aggregation.estimatedHistogramMemoryBytes())
+	aggregation.AddSample(&ContainerUsageSample{MeasureStart: testTimestamp, Usage: CPUAmountFromCores(100), Resource: ResourceCPU})
+	assert.Equal(t, int64(2*bytesPerHistogramBucket), aggregation.estimatedHistogramMemoryBytes())
+	// Startup histograms use the configured type, decaying by default.
+	aggregation.addStartupSample(&ContainerUsageSample{MeasureStart: testTimestamp, Usage: CPUAmountFromCores(1), Resource: ResourceCPU})
+	config := GetAggregationsConfig()
+	startupBuckets := config.CPUHistogramOptions.NumBuckets() + config.MemoryHistogramOptions.NumBuckets()
+	assert.Equal(t, int64((2+startupBuckets)*bytesPerHistogramBucket), aggregation.estimatedHistogramMemoryBytes())
+}
+
+func TestClusterGCForcedByAggregationMemoryThreshold(t *testing.T) {
+	ctx := context.Background()
+	cluster := NewClusterState(testGcPeriod)
+	usageSample := makeTestUsageSample()
+	sampleExpireTime := usageSample.MeasureStart.Add(9 * 24 * time.Hour)
+	cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, sampleExpireTime, testControllerFetcher)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddSample(usageSample))
+
+	// The expired aggregation is kept while the estimate is below the threshold.
+	cluster.SetAggregationMemoryGCThreshold(cluster.TotalAggregationMemoryBytes())
+	cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, sampleExpireTime.Add(testGcPeriod/4), testControllerFetcher)
+	assert.NotEmpty(t, cluster.aggregateStates.snapshot())
+
+	// Exceeding the threshold forces garbage collection before testGcPeriod elapses.
+	cluster.SetAggregationMemoryGCThreshold(cluster.TotalAggregationMemoryBytes() - 1)
+	cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, sampleExpireTime.Add(testGcPeriod/2), testControllerFetcher)
+	assert.Empty(t, cluster.aggregateStates.snapshot())
+}
+
+func TestClusterGCUnderMemoryPressure(t *testing.T) {
+	ctx := context.Background()
+	usageSample := makeTestUsageSample()
+	// Between the shortened and the normal history length.
+	gcTime := usageSample.MeasureStart.Add(5 * 24 * time.Hour)
+	for _, tc := range []struct {
+		name          string
+		threshold     func(cluster *clusterState) int64
+		expectDeleted bool
+	}{
+		{
+			name:          "no threshold",
+			threshold:     func(*clusterState) int64 { return 0 },
+			expectDeleted: false,
+		},
+		{
+			name:          "below threshold",
+			threshold:     func(cluster *clusterState) int64 { return cluster.TotalAggregationMemoryBytes() },
+			expectDeleted: false,
+		},
+		{
+			name:          "above threshold",
+			threshold:     func(cluster *clusterState) int64 { return cluster.TotalAggregationMemoryBytes() - 1 },
+			expectDeleted: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			addTestVpa(cluster)
+			addTestPod(cluster)
+			addTestContainer(t, cluster)
+			assert.NoError(t, cluster.AddSample(usageSample))
+
+			// Collect garbage right before, so that only memory pressure can trigger it.
+			cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, gcTime.Add(-testGcPeriod/2), testControllerFetcher)
+			assert.NotEmpty(t, cluster.aggregateStates.snapshot())
+			cluster.SetMemoryPressureThreshold(tc.threshold(cluster))
+			cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, gcTime, testControllerFetcher)
+			if tc.expectDeleted {
+				assert.Empty(t, cluster.aggregateStates.snapshot())
+			} else {
+				assert.NotEmpty(t, cluster.aggregateStates.snapshot())
+				// The normal policy keeps the aggregation even when the GC runs.
+				cluster.garbageCollectAggregateCollectionStates(ctx, gcTime, testControllerFetcher)
+				assert.NotEmpty(t, cluster.aggregateStates.snapshot())
+			}
+		})
+	}
+}
+
+func TestGetContainersByNode(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	otherContainerID := ContainerID{testPodID3, "container-1"}
+	for _, containerID := range []ContainerID{testContainerID, otherContainerID} {
+		assert.NoError(t, cluster.AddOrUpdatePod(containerID.PodID, testLabels, apiv1.PodRunning))
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+	}
+	assert.Empty(t, cluster.GetContainersByNode(""))
+
+	assert.NoError(t, cluster.SetPodNodeName(testPodID, "node-1"))
+	assert.NoError(t, cluster.SetPodNodeName(testPodID3, "node-1"))
+	assert.ElementsMatch(t, []ContainerID{testContainerID, otherContainerID}, cluster.GetContainersByNode("node-1"))
+
+	// The pod migrates to another node.
+	assert.NoError(t, cluster.SetPodNodeName(testPodID, "node-2"))
+	assert.Equal(t, []ContainerID{otherContainerID}, cluster.GetContainersByNode("node-1"))
+	assert.Equal(t, []ContainerID{testContainerID}, cluster.GetContainersByNode("node-2"))
+	assert.Equal(t, "node-2", cluster.Pods()[testPodID].NodeName)
+
+	// Renamed pods stay indexed under the new ID.
+	renamedPodID := PodID{testPodID.Namespace, "pod-renamed"}
+	assert.NoError(t, cluster.RenamePod(testPodID, renamedPodID))
+	assert.Equal(t, []ContainerID{{renamedPodID, "container-1"}}, cluster.GetContainersByNode("node-2"))
+
+	// Unscheduled and deleted pods are removed from the index.
+	assert.NoError(t, cluster.SetPodNodeName(renamedPodID, ""))
+	assert.Empty(t, cluster.GetContainersByNode("node-2"))
+	cluster.DeletePod(testPodID3)
+	assert.Empty(t, cluster.GetContainersByNode("node-1"))
+	assert.Empty(t, cluster.podsByNode)
+
+	assert.Error(t, cluster.SetPodNodeName(testPodID4, "node-1"))
+}
+
+func TestGetAggregationsForVpa(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	aggregationKey := cluster.aggregateStateKeyForContainerID(testContainerID)
+
+	aggregations, err := cluster.GetAggregationsForVpa(testVpaID)
+	assert.NoError(t, err)
+	assert.Len(t, aggregations, 1)
+	assert.Contains(t, aggregations, aggregationKey)
+
+	// Modifying the returned map doesn't affect the VPA.
+	delete(aggregations, aggregationKey)
+	assert.Contains(t, vpa.aggregateContainerStates, aggregationKey)
+
+	// The aggregation is unlinked once the selector no longer matches the pod.
+	addVpa(cluster, testVpaID, testAnnotations, "label-1 = other-value", testTargetRef)
+	aggregations, err = cluster.GetAggregationsForVpa(testVpaID)
+	assert.NoError(t, err)
+	assert.Empty(t, aggregations)
+
+	_, err = cluster.GetAggregationsForVpa(VpaID{"namespace-1", "unknown"})
+	assert.Error(t, err)
+}
+
+func TestSyncObservedVPAs(t *testing.T) {
+	ctx := context.Background()
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	selector, err := labels.Parse(testSelectorStr)
+	assert.NoError(t, err)
+	fetchedSelectors := make(map[VpaID]int)
+	cluster.SetVpaSelectorFetcher(func(_ context.Context, vpa *vpa_types.VerticalPodAutoscaler) labels.Selector {
+		fetchedSelectors[VpaID{Namespace: vpa.Namespace, VpaName: vpa.Name}]++
+		return selector
+	})
+	makeVpa := func(id VpaID) *vpa_types.VerticalPodAutoscaler {
+		return test.VerticalPodAutoscaler().WithNamespace(id.Namespace).WithName(id.VpaName).
+			WithContainer(testContainerID.ContainerName).WithTargetRef(testTargetRef).Get()
+	}
+	otherVpaID := VpaID{"namespace-1", "vpa-2"}
+
+	// A VPA observed twice is added once.
+	observed := []*vpa_types.VerticalPodAutoscaler{makeVpa(testVpaID), makeVpa(testVpaID), makeVpa(otherVpaID)}
+	assert.NoError(t, cluster.SyncObservedVPAs(ctx, observed))
+	assert.ElementsMatch(t, []VpaID{testVpaID, otherVpaID}, slices.Collect(maps.Keys(cluster.VPAs())))
+	assert.Equal(t, map[VpaID]int{testVpaID: 1, otherVpaID: 1}, fetchedSelectors)
+	assert.Equal(t, observed, cluster.ObservedVPAs())
+	assert.Equal(t, 1, cluster.VPAs()[testVpaID].PodCount)
+
+	// VPAs which are no longer observed are deleted once, the rest is updated.
+	observed = []*vpa_types.VerticalPodAutoscaler{makeVpa(otherVpaID), makeVpa(otherVpaID)}
+	assert.NoError(t, cluster.SyncObservedVPAs(ctx, observed))
+	assert.Equal(t, []VpaID{otherVpaID}, slices.Collect(maps.Keys(cluster.VPAs())))
+	assert.Equal(t, map[VpaID]int{testVpaID: 1, otherVpaID: 2}, fetchedSelectors)
+	assert.Equal(t, observed, cluster.ObservedVPAs())
+
+	// Without a fetcher updated VPAs keep their selectors.
+	cluster.SetVpaSelectorFetcher(nil)
+	assert.NoError(t, cluster.SyncObservedVPAs(ctx, observed))
+	assert.Equal(t, selector, cluster.VPAs()[otherVpaID].PodSelector)
+
+	// Observed VPAs are not replaced if the sync is interrupted.
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, cluster.SyncObservedVPAs(cancelledCtx, nil))
+	assert.Equal(t, observed, cluster.ObservedVPAs())
+	assert.Contains(t, cluster.VPAs(), otherVpaID)
+}
+
+func TestSyncObservedVPAsAccumulatesErrors(t *testing.T) {
+	ctx := context.Background()
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	selector, err := labels.Parse(testSelectorStr)
+	assert.NoError(t, err)
+	invalidVpaIDs := []VpaID{{"namespace-1", "invalid-1"}, {"namespace-1", "invalid-2"}}
+	cluster.SetVpaSelectorFetcher(func(_ context.Context, vpa *vpa_types.VerticalPodAutoscaler) labels.Selector {
+		if slices.Contains(invalidVpaIDs, VpaID{Namespace: vpa.Namespace, VpaName: vpa.Name}) {
+			return nil
+		}
+		return selector
+	})
+	makeVpa := func(id VpaID) *vpa_types.VerticalPodAutoscaler {
+		return test.VerticalPodAutoscaler().WithNamespace(id.Namespace).WithName(id.VpaName).
+			WithContainer(testContainerID.ContainerName).WithTargetRef(testTargetRef).Get()
+	}
+	otherVpaID := VpaID{"namespace-1", "vpa-2"}
+	observed := []*vpa_types.VerticalPodAutoscaler{
+		makeVpa(invalidVpaIDs[0]), makeVpa(testVpaID), makeVpa(invalidVpaIDs[1]), makeVpa(otherVpaID),
+	}
+
+	err = cluster.SyncObservedVPAs(ctx, observed)
+	assert.Error(t, err)
+	// Valid VPAs are synced despite the failures of the other ones.
+	assert.ElementsMatch(t, []VpaID{testVpaID, otherVpaID}, slices.Collect(maps.Keys(cluster.VPAs())))
+	assert.Equal(t, 1, cluster.VPAs()[testVpaID].PodCount)
+	assert.Equal(t, observed, cluster.ObservedVPAs())
+	// The error of every invalid VPA is returned.
+	joined, ok := err.(interface{ Unwrap() []error })
+	assert.True(t, ok)
+	assert.Len(t, joined.Unwrap(), len(invalidVpaIDs))
+	for _, vpaID := range invalidVpaIDs {
+		assert.ErrorContains(t, err, vpaID.VpaName)
+	}
+}
+
+func TestClusterAddEphemeralStorage(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	request := Resources{ResourceCPU: 100, ResourceMemory: 1000, ResourceEphemeralStorage: 5e9}
+	_, err := cluster.AddOrUpdateContainer(testContainerID, request)
+	assert.NoError(t, err)
+	container := cluster.GetContainer(testContainerID)
+	assert.Equal(t, ResourceAmount(5e9), container.EphemeralStorageRequest)
+
+	// Ephemeral storage samples are aggregated separately.
+	sample := &ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp, Usage: 1e9, Resource: ResourceEphemeralStorage}, testContainerID}
+	assert.NoError(t, cluster.AddSample(sample))
+	assert.Error(t, cluster.AddSample(sample))
+	aggregation := cluster.findOrCreateAggregateContainerState(testContainerID)
+	assert.False(t, aggregation.AggregateEphemeralStorageUsage.IsEmpty())
+	assert.True(t, aggregation.AggregateMemoryPeaks.IsEmpty())
+	assert.Zero(t, aggregation.TotalSamplesCount)
+
+	// Removing the request from the container resets it.
+	_, err = cluster.AddOrUpdateContainer(testContainerID, testRequest)
+	assert.NoError(t, err)
+	assert.Zero(t, container.EphemeralStorageRequest)
+}
+
+func TestSetLabelNormalization(t *testing.T) {
+	podLabels := func(sha string) labels.Set {
+		return labels.Set{"label-1": "value-1", "git-commit-sha": sha}
+	}
+	otherPodID := PodID{"namespace-1", "pod-2"}
+	addPods := func(cluster *clusterState) {
+		for podID, sha := range map[PodID]string{testPodID: "abc123", otherPodID: "def456"} {
+			assert.NoError(t, cluster.AddOrUpdatePod(podID, podLabels(sha), apiv1.PodRunning))
+			_, err := cluster.AddOrUpdateContainer(ContainerID{podID, "container-1"}, testRequest)
+			assert.NoError(t, err)
+		}
+	}
+
+	// Without normalization the pods aggregate separately.
+	cluster := NewClusterState(testGcPeriod)
+	addPods(cluster)
+	assert.NotEqual(t, cluster.aggregateStateKeyForContainerID(ContainerID{testPodID, "container-1"}),
+		cluster.aggregateStateKeyForContainerID(ContainerID{otherPodID, "container-1"}))
+	assert.Equal(t, 2, cluster.StateMapSize())
+
+	// With the SHA stripped they share an aggregation.
+	cluster = NewClusterState(testGcPeriod)
+	cluster.SetLabelNormalization(func(podLabels labels.Set) labels.Set {
+		result := make(labels.Set, len(podLabels))
+		for key, value := range podLabels {
+			if key != "git-commit-sha" {
+				result[key] = value
+			}
+		}
+		return result
+	})
+	addPods(cluster)
+	key := cluster.aggregateStateKeyForContainerID(ContainerID{testPodID, "container-1"})
+	assert.Equal(t, key, cluster.aggregateStateKeyForContainerID(ContainerID{otherPodID, "container-1"}))
+	assert.Equal(t, 1, cluster.StateMapSize())
+	assert.Equal(t, labels.Set{"label-1": "value-1"}, key.Labels())
+}
+
+func TestTrimSamples(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	oldContainerID := testContainerID
+	newContainerID := ContainerID{testPodID3, testContainerID.ContainerName}
+	// The pods have different labels, so their containers use different
+	// aggregations.
+	assert.NoError(t, cluster.AddOrUpdatePod(oldContainerID.PodID, testLabels, apiv1.PodRunning))
+	assert.NoError(t, cluster.AddOrUpdatePod(newContainerID.PodID, labels.Set{"label-1": "value-1", "label-2": "value-2"}, apiv1.PodRunning))
+	for _, containerID := range []ContainerID{oldContainerID, newContainerID} {
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		ts := testTimestamp.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{
+			ContainerUsageSample{MeasureStart: ts, Usage: CPUAmountFromCores(4), Resource: ResourceCPU}, oldContainerID}))
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{
+			ContainerUsageSample{MeasureStart: ts.Add(time.Hour), Usage: CPUAmountFromCores(0.5), Resource: ResourceCPU}, newContainerID}))
+	}
+	cpuPercentile := func() float64 {
+		return vpa.AggregateStateByContainerName()[testContainerID.ContainerName].AggregateCPUUsage.Percentile(0.9)
+	}
+	assert.Greater(t, cpuPercentile(), 3.0)
+
+	// Only the aggregation of the container with old samples is trimmed.
+	assert.Equal(t, 10, cluster.TrimSamples(testTimestamp.Add(30*time.Minute)))
+	assert.Less(t, cpuPercentile(), 1.0)
+	assert.Len(t, cluster.aggregateStates.snapshot(), 2)
+	assert.Equal(t, 0, cluster.TrimSamples(testTimestamp.Add(30*time.Minute)))
+}
+
+func TestGetContainerLastSampleTime(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	_, err := cluster.GetContainerLastSampleTime(testContainerID)
+	assert.Error(t, err)
+	addTestPod(cluster)
+	_, err = cluster.GetContainerLastSampleTime(testContainerID)
+	assert.Error(t, err)
+
+	addTestContainer(t, cluster)
+	lastSampleTime, err := cluster.GetContainerLastSampleTime(testContainerID)
+	assert.NoError(t, err)
+	assert.True(t, lastSampleTime.IsZero())
+	for i := 0; i < 3; i++ {
+		ts := testTimestamp.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{
+			ContainerUsageSample{MeasureStart: ts, Usage: CPUAmountFromCores(1), Resource: ResourceCPU}, testContainerID}))
+		lastSampleTime, err = cluster.GetContainerLastSampleTime(testContainerID)
+		assert.NoError(t, err)
+		assert.Equal(t, ts, lastSampleTime)
+	}
+}
+
+func TestRebalanceAggregations(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	oldContainerID := testContainerID
+	newContainerID := ContainerID{testPodID3, testContainerID.ContainerName}
+	assert.NoError(t, cluster.AddOrUpdatePod(oldContainerID.PodID, labels.Set{"label-1": "value-1", "old-key": "app"}, apiv1.PodRunning))
+	assert.NoError(t, cluster.AddOrUpdatePod(newContainerID.PodID, labels.Set{"label-1": "value-1", "new-key": "app"}, apiv1.PodRunning))
+	samples := map[ContainerID]int{oldContainerID: 3, newContainerID: 5}
+	for containerID, count := range samples {
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+		for i := 0; i < count; i++ {
+			assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+				MeasureStart: testTimestamp.Add(time.Duration(i) * time.Minute), Usage: CPUAmountFromCores(1), Resource: ResourceCPU}, containerID}))
+		}
+	}
+	assert.Len(t, cluster.aggregateStates.snapshot(), 2)
+
+	// The old aggregation is still used by a pod, so it's kept.
+	cluster.RebalanceAggregations("old-key", "new-key")
+	assert.Len(t, cluster.aggregateStates.snapshot(), 2)
+
+	cluster.DeletePod(oldContainerID.PodID)
+	cluster.RebalanceAggregations("old-key", "new-key")
+	aggregations := cluster.aggregateStates.snapshot()
+	assert.Len(t, aggregations, 1)
+	newAggregationKey := cluster.aggregateStateKeyForContainerID(newContainerID)
+	if assert.Contains(t, aggregations, newAggregationKey) {
+		assert.Equal(t, 8, aggregations[newAggregationKey].TotalSamplesCount)
+	}
+	assert.Len(t, vpa.aggregateContainerStates, 1)
+	assert.Contains(t, vpa.aggregateContainerStates, newAggregationKey)
+}
+
+func TestGetSampleCountByNamespace(t *testing.T) {
+	ctx := context.Background()
+	cluster := NewClusterState(testGcPeriod)
+	otherNamespacePodID := PodID{"namespace-2", "pod-1"}
+	containerIDs := []ContainerID{testContainerID, {testPodID, "container-2"}, {otherNamespacePodID, "container-1"}}
+	for _, containerID := range containerIDs {
+		assert.NoError(t, cluster.AddOrUpdatePod(containerID.PodID, testLabels, apiv1.PodRunning))
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, map[string]int{"namespace-1": 0, "namespace-2": 0}, cluster.GetSampleCountByNamespace())
+
+	for i, containerID := range containerIDs {
+		for j := 0; j <= i; j++ {
+			sample := makeTestUsageSample()
+			sample.Container = containerID
+			sample.MeasureStart = testTimestamp.Add(time.Duration(j) * time.Minute)
+			assert.NoError(t, cluster.AddSample(sample))
+		}
+	}
+	assert.Equal(t, map[string]int{"namespace-1": 3, "namespace-2": 3}, cluster.GetSampleCountByNamespace())
+
+	// Aggregations removed by the GC are no longer counted.
+	gcTime := testTimestamp.Add(9 * 24 * time.Hour)
+	sample := makeTestUsageSample()
+	sample.MeasureStart = gcTime.Add(-time.Hour)
+	assert.NoError(t, cluster.AddSample(sample))
+	cluster.RateLimitedGarbageCollectAggregateCollectionStates(ctx, gcTime, testControllerFetcher)
+	assert.Equal(t, map[string]int{"namespace-1": 2}, cluster.GetSampleCountByNamespace())
+}
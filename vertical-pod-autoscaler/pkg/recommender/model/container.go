@@ -26,6 +26,14 @@ import (
 	metrics_quality "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/quality"
 )
 
+// RestartHistorySize is the number of the most recent restarts kept for each
+// container.
+const RestartHistorySize = 16
+
+// ThrottlingHistorySize is the number of the most recent CPU throttling
+// observations kept for each container.
+const ThrottlingHistorySize = 8
+
 // ContainerUsageSample is a measure of resource usage of a container over some
 // interval.
 type ContainerUsageSample struct {
@@ -46,6 +54,13 @@ type ContainerUsageSample struct {
 type ContainerState struct {
 	// Current request.
 	Request Resources
+	// Current limits, see ClusterState.SetContainerLimit. Resources without
+	// a limit are absent.
+	Limit Resources
+	// Current ephemeral storage request, also present in Request if set.
+	EphemeralStorageRequest ResourceAmount
+	// Start of the latest ephemeral storage usage sample that was aggregated.
+	lastEphemeralStorageSampleStart time.Time
 	// Start of the latest CPU usage sample that was aggregated.
 	LastCPUSampleStart time.Time
 	// Max memory usage observed in the current aggregation interval.
@@ -58,16 +73,39 @@ type ContainerState struct {
 	lastMemorySampleStart time.Time
 	// Aggregation to add usage samples to.
 	aggregator ContainerStateAggregator
+	// Ring buffer with the times of the most recent restarts.
+	restarts [RestartHistorySize]time.Time
+	// Total number of restarts recorded. The next restart is stored at
+	// restarts[restartCount%RestartHistorySize].
+	restartCount int
+	// Ring buffer with the most recent fractions of time the container was
+	// CPU throttled.
+	throttling [ThrottlingHistorySize]float64
+	// Total number of throttling observations recorded. The next one is
+	// stored at throttling[throttlingCount%ThrottlingHistorySize].
+	throttlingCount int
+	// Time of the latest throttling observation.
+	lastThrottlingTime time.Time
+	// CPU saturation observations within the last CPUSaturationWindow,
+	// oldest first, see RecordCPUSaturation.
+	cpuSaturation []cpuSaturationSample
+	// Number of OOM events recorded with RecordOOM.
+	oomCount int
+	// Startup window of the container, see RecordContainerStartup. Samples
+	// started within [startupStart, startupEnd) are aggregated separately.
+	startupStart time.Time
+	startupEnd   time.Time
 }
 
 // NewContainerState returns a new ContainerState.
 func NewContainerState(request Resources, aggregator ContainerStateAggregator) *ContainerState {
 	return &ContainerState{
-		Request:               request,
-		LastCPUSampleStart:    time.Time{},
-		WindowEnd:             time.Time{},
-		lastMemorySampleStart: time.Time{},
-		aggregator:            aggregator,
+		Request:                 request,
+		EphemeralStorageRequest: request[ResourceEphemeralStorage],
+		LastCPUSampleStart:      time.Time{},
+		WindowEnd:               time.Time{},
+		lastMemorySampleStart:   time.Time{},
+		aggregator:              aggregator,
 	}
 }
 
@@ -75,14 +113,31 @@ func (sample *ContainerUsageSample) isValid(expectedResource ResourceName) bool
 	return sample.Usage >= 0 && sample.Resource == expectedResource
 }
 
-func (container *ContainerState) addCPUSample(sample *ContainerUsageSample) bool {
+func (container *ContainerState) addCPUSample(sample *ContainerUsageSample, outOfOrderTolerance time.Duration) bool {
 	// Order should not matter for the histogram, other than deduplication.
-	if !sample.isValid(ResourceCPU) || !sample.MeasureStart.After(container.LastCPUSampleStart) {
+	if !sample.isValid(ResourceCPU) || !sample.MeasureStart.After(container.LastCPUSampleStart) &&
+		(sample.MeasureStart.Equal(container.LastCPUSampleStart) || sample.MeasureStart.Before(container.LastCPUSampleStart.Add(-outOfOrderTolerance))) {
 		return false // Discard invalid, duplicate or out-of-order samples.
 	}
 	container.observeQualityMetrics(sample.Usage, false, corev1.ResourceCPU)
 	container.aggregator.AddSample(sample)
-	container.LastCPUSampleStart = sample.MeasureStart
+	if sample.MeasureStart.After(container.LastCPUSampleStart) {
+		container.LastCPUSampleStart = sample.MeasureStart
+	}
+	return true
+}
+
+// addEphemeralStorageSample adds an ephemeral storage usage sample to the
+// aggregation. Like CPU samples, each sample is aggregated as it is.
+func (container *ContainerState) addEphemeralStorageSample(sample *ContainerUsageSample, outOfOrderTolerance time.Duration) bool {
+	if !sample.isValid(ResourceEphemeralStorage) || !sample.MeasureStart.After(container.lastEphemeralStorageSampleStart) &&
+		(sample.MeasureStart.Equal(container.lastEphemeralStorageSampleStart) || sample.MeasureStart.Before(container.lastEphemeralStorageSampleStart.Add(-outOfOrderTolerance))) {
+		return false // Discard invalid, duplicate or out-of-order samples.
+	}
+	container.aggregator.AddSample(sample)
+	if sample.MeasureStart.After(container.lastEphemeralStorageSampleStart) {
+		container.lastEphemeralStorageSampleStart = sample.MeasureStart
+	}
 	return true
 }
 
@@ -125,14 +180,19 @@ func (container *ContainerState) GetMaxMemoryPeak() ResourceAmount {
 	return ResourceAmountMax(container.memoryPeak, container.oomPeak)
 }
 
-func (container *ContainerState) addMemorySample(sample *ContainerUsageSample, isOOM bool) bool {
+func (container *ContainerState) addMemorySample(sample *ContainerUsageSample, isOOM bool, outOfOrderTolerance time.Duration) bool {
 	ts := sample.MeasureStart
+	// Out-of-order samples within the tolerance count towards the peak of
+	// the current aggregation interval, as the peaks of the previous
+	// intervals are not kept.
+	outdated := ts.Before(container.lastMemorySampleStart.Add(-outOfOrderTolerance))
 	// We always process OOM samples.
-	if !sample.isValid(ResourceMemory) ||
-		(!isOOM && ts.Before(container.lastMemorySampleStart)) {
+	if !sample.isValid(ResourceMemory) || (!isOOM && outdated) {
 		return false // Discard invalid or outdated samples.
 	}
-	container.lastMemorySampleStart = ts
+	if isOOM || ts.After(container.lastMemorySampleStart) {
+		container.lastMemorySampleStart = ts
+	}
 	if container.WindowEnd.IsZero() { // This is the first sample.
 		container.WindowEnd = ts
 	}
@@ -197,12 +257,85 @@ func (container *ContainerState) RecordOOM(timestamp time.Time, requestedMemory
 		Usage:        memoryNeeded,
 		Resource:     ResourceMemory,
 	}
-	if !container.addMemorySample(&oomMemorySample, true) {
+	if !container.addMemorySample(&oomMemorySample, true, 0) {
 		return fmt.Errorf("adding OOM sample failed")
 	}
+	container.oomCount++
 	return nil
 }
 
+// oomKillExitCode is the exit code of a container killed with SIGKILL, which is
+// how the kernel OOM killer terminates containers.
+const oomKillExitCode = 137
+
+// RecordCrash records a crash of the container with the given exit code.
+// Crashes caused by the OOM killer are recorded as OOM events with the memory
+// request of the container, so that containers crash-looping before they
+// produce any usage samples still get their memory recommendation increased.
+// Other crashes are ignored.
+func (container *ContainerState) RecordCrash(timestamp time.Time, exitCode int32) error {
+	if exitCode != oomKillExitCode {
+		return nil
+	}
+	return container.RecordOOM(timestamp, container.Request[ResourceMemory])
+}
+
+// RecordRestart records a restart of the container at the given time. Only
+// the RestartHistorySize most recent restarts are kept.
+func (container *ContainerState) RecordRestart(timestamp time.Time) {
+	container.restarts[container.restartCount%RestartHistorySize] = timestamp
+	container.restartCount++
+}
+
+// RestartsSince returns the number of the kept restarts of the container that
+// happened at or after the given time.
+func (container *ContainerState) RestartsSince(since time.Time) int {
+	count := 0
+	for i := 0; i < container.restartCount && i < RestartHistorySize; i++ {
+		if !container.restarts[i].Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// RecordCPUThrottling records the fraction of time, between 0 and 1, the
+// container was CPU throttled, observed at the given time. Observations must
+// be recorded in chronological order. Only the ThrottlingHistorySize most
+// recent observations are kept.
+func (container *ContainerState) RecordCPUThrottling(timestamp time.Time, throttledFraction float64) error {
+	if throttledFraction < 0 || throttledFraction > 1 {
+		return fmt.Errorf("throttled fraction %v out of range [0, 1]", throttledFraction)
+	}
+	if !timestamp.After(container.lastThrottlingTime) {
+		return fmt.Errorf("CPU throttling observation at %v is not newer than the previous one at %v", timestamp, container.lastThrottlingTime)
+	}
+	container.throttling[container.throttlingCount%ThrottlingHistorySize] = throttledFraction
+	container.throttlingCount++
+	container.lastThrottlingTime = timestamp
+	return nil
+}
+
+// SustainedCPUThrottling returns the average throttled fraction over the given
+// number of the most recent observations if all of them exceed the threshold.
+// Otherwise, or if fewer observations were recorded, returns false as the
+// second value. The number of observations is capped to ThrottlingHistorySize.
+func (container *ContainerState) SustainedCPUThrottling(threshold float64, observations int) (float64, bool) {
+	observations = min(observations, ThrottlingHistorySize)
+	if observations <= 0 || container.throttlingCount < observations {
+		return 0, false
+	}
+	sum := 0.0
+	for i := 1; i <= observations; i++ {
+		fraction := container.throttling[(container.throttlingCount-i)%ThrottlingHistorySize]
+		if fraction <= threshold {
+			return 0, false
+		}
+		sum += fraction
+	}
+	return sum / float64(observations), true
+}
+
 // AddSample adds a usage sample to the given ContainerState. Requires samples
 // for a single resource to be passed in chronological order (i.e. in order of
 // growing MeasureStart). Invalid samples (out of order or measure out of legal
@@ -211,12 +344,47 @@ func (container *ContainerState) RecordOOM(timestamp time.Time, requestedMemory
 // Note: usage samples don't hold their end timestamp / duration. They are
 // implicitly assumed to be disjoint when aggregating.
 func (container *ContainerState) AddSample(sample *ContainerUsageSample) bool {
+	return container.AddSampleWithTolerance(sample, 0)
+}
+
+// AddSampleWithTolerance adds a usage sample to the given ContainerState like
+// AddSample, but also accepts samples started up to outOfOrderTolerance
+// before the latest sample of the same resource. Duplicates of the latest
+// sample are still discarded. Out-of-order memory samples count towards the
+// peak of the current memory aggregation interval.
+func (container *ContainerState) AddSampleWithTolerance(sample *ContainerUsageSample, outOfOrderTolerance time.Duration) bool {
 	switch sample.Resource {
 	case ResourceCPU:
-		return container.addCPUSample(sample)
+		return container.addCPUSample(sample, outOfOrderTolerance)
 	case ResourceMemory:
-		return container.addMemorySample(sample, false)
+		return container.addMemorySample(sample, false, outOfOrderTolerance)
+	case ResourceEphemeralStorage:
+		return container.addEphemeralStorageSample(sample, outOfOrderTolerance)
 	default:
 		return false
 	}
 }
+
+// inStartupWindow returns true if the given time falls into the startup
+// window of the container.
+func (container *ContainerState) inStartupWindow(ts time.Time) bool {
+	return !ts.Before(container.startupStart) && ts.Before(container.startupEnd)
+}
+
+// hasSamples returns true if any CPU or memory usage sample of the container
+// was aggregated.
+func (container *ContainerState) hasSamples() bool {
+	return !container.LastCPUSampleStart.IsZero() || !container.lastMemorySampleStart.IsZero()
+}
+
+// lastSampleStart returns the start of the latest CPU, memory or ephemeral
+// storage usage sample of the container, or the zero time if it has none.
+func (container *ContainerState) lastSampleStart() time.Time {
+	latest := container.LastCPUSampleStart
+	for _, ts := range []time.Time{container.lastMemorySampleStart, container.lastEphemeralStorageSampleStart} {
+		if ts.After(latest) {
+			latest = ts
+		}
+	}
+	return latest
+}
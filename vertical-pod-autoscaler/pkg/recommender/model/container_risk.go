@@ -0,0 +1,88 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"cmp"
+	"slices"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// riskPercentile is the percentile of the usage of a container compared
+// against its request by GetOverutilizedContainers.
+const riskPercentile = 0.99
+
+// ContainerRiskReport describes a container whose request is close to or
+// below the P99 of its usage.
+type ContainerRiskReport struct {
+	ContainerID ContainerID
+	// Request is the current request of the container.
+	Request ResourceAmount
+	// Recommendation is the P99 of the usage in the aggregation of the
+	// container.
+	Recommendation ResourceAmount
+}
+
+// GetOverutilizedContainers returns the containers at risk of running out of
+// the given resource, sorted by the container ID. A container is at risk when
+// the P99 of the usage in its aggregation is above (1 - riskFraction) of its
+// request. Containers without a request for the resource or without samples
+// are skipped. Only CPU and memory are supported, nil is returned for other
+// resources.
+func (cluster *clusterState) GetOverutilizedContainers(resourceName apiv1.ResourceName, riskFraction float64) []ContainerRiskReport {
+	resource := ResourceName(resourceName)
+	if resource != ResourceCPU && resource != ResourceMemory {
+		return nil
+	}
+	reports := []ContainerRiskReport{}
+	for podID, pod := range cluster.pods {
+		for containerName, container := range pod.Containers {
+			request := container.Request[resource]
+			if request <= 0 {
+				continue
+			}
+			key := cluster.MakeAggregateStateKey(pod, containerName)
+			aggregation, found := cluster.aggregateStates.get(key)
+			if !found {
+				continue
+			}
+			unlock := cluster.aggregateStates.lockSamples(key)
+			var recommendation ResourceAmount
+			if resource == ResourceCPU && !aggregation.AggregateCPUUsage.IsEmpty() {
+				recommendation = CPUAmountFromCores(aggregation.AggregateCPUUsage.Percentile(riskPercentile))
+			} else if resource == ResourceMemory && !aggregation.AggregateMemoryPeaks.IsEmpty() {
+				recommendation = MemoryAmountFromBytes(aggregation.AggregateMemoryPeaks.Percentile(riskPercentile))
+			}
+			unlock()
+			if recommendation > 0 && float64(recommendation) > float64(request)*(1-riskFraction) {
+				reports = append(reports, ContainerRiskReport{
+					ContainerID:    ContainerID{PodID: podID, ContainerName: containerName},
+					Request:        request,
+					Recommendation: recommendation,
+				})
+			}
+		}
+	}
+	slices.SortFunc(reports, func(a, b ContainerRiskReport) int {
+		return cmp.Or(
+			cmp.Compare(a.ContainerID.Namespace, b.ContainerID.Namespace),
+			cmp.Compare(a.ContainerID.PodName, b.ContainerID.PodName),
+			cmp.Compare(a.ContainerID.ContainerName, b.ContainerID.ContainerName))
+	})
+	return reports
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestGetOverutilizedContainers(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	memoryContainerID := testContainerID
+	cpuContainerID := ContainerID{testPodID, "container-cpu"}
+	zeroRequestContainerID := ContainerID{testPodID, "container-zero-request"}
+	request := Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(1e9)}
+	for containerID, containerRequest := range map[ContainerID]Resources{
+		memoryContainerID:      request,
+		cpuContainerID:         request,
+		zeroRequestContainerID: {},
+	} {
+		_, err := cluster.AddOrUpdateContainer(containerID, containerRequest)
+		assert.NoError(t, err)
+	}
+	for _, containerID := range []ContainerID{memoryContainerID, zeroRequestContainerID} {
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+			MeasureStart: testTimestamp, Usage: MemoryAmountFromBytes(9e8), Resource: ResourceMemory}, containerID}))
+	}
+	// The container has no memory samples.
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp, Usage: CPUAmountFromCores(0.9), Resource: ResourceCPU}, cpuContainerID}))
+
+	reports := cluster.GetOverutilizedContainers(apiv1.ResourceMemory, 0.2)
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, memoryContainerID, reports[0].ContainerID)
+		assert.Equal(t, request[ResourceMemory], reports[0].Request)
+		assert.Greater(t, reports[0].Recommendation, MemoryAmountFromBytes(9e8))
+		assert.Less(t, reports[0].Recommendation, MemoryAmountFromBytes(1e9))
+	}
+	// The P99 of memory usage is below the request.
+	assert.Empty(t, cluster.GetOverutilizedContainers(apiv1.ResourceMemory, 0))
+
+	reports = cluster.GetOverutilizedContainers(apiv1.ResourceCPU, 0.2)
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, cpuContainerID, reports[0].ContainerID)
+		assert.Equal(t, request[ResourceCPU], reports[0].Request)
+	}
+
+	assert.Nil(t, cluster.GetOverutilizedContainers(apiv1.ResourceStorage, 0.2))
+}
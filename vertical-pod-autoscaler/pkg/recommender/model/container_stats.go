@@ -0,0 +1,103 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// ContainerStats summarizes the usage history of a container. The usage
+// values are computed from the histograms of the container's aggregation, so
+// they are approximated to the histogram buckets and the memory values
+// describe the peaks of the memory aggregation intervals.
+type ContainerStats struct {
+	MinCPU     ResourceAmount
+	MaxCPU     ResourceAmount
+	MeanCPU    ResourceAmount
+	P95CPU     ResourceAmount
+	MinMemory  ResourceAmount
+	MaxMemory  ResourceAmount
+	MeanMemory ResourceAmount
+	P95Memory  ResourceAmount
+	// SampleCount is the number of CPU samples in the aggregation.
+	SampleCount int
+	// OOMCount is the number of OOM events recorded for the container.
+	OOMCount int
+}
+
+// GetContainerStats returns the summary of the usage history of the given
+// container. All values are zero if the container has no samples. Returns
+// an error if the container doesn't exist.
+func (cluster *clusterState) GetContainerStats(containerID ContainerID) (ContainerStats, error) {
+	pod, podExists := cluster.pods[containerID.PodID]
+	if !podExists {
+		return ContainerStats{}, NewPodNotFoundError(containerID.PodID)
+	}
+	container, containerExists := pod.Containers[containerID.ContainerName]
+	if !containerExists {
+		return ContainerStats{}, NewContainerNotFoundError(containerID)
+	}
+	stats := ContainerStats{}
+	aggregationKey := cluster.MakeAggregateStateKey(pod, containerID.ContainerName)
+	if aggregation, found := cluster.aggregateStates.get(aggregationKey); found {
+		unlock := cluster.aggregateStates.lockSamples(aggregationKey)
+		var err error
+		stats, err = aggregation.Stats()
+		unlock()
+		if err != nil {
+			return ContainerStats{}, err
+		}
+	}
+	stats.OOMCount = container.oomCount
+	return stats, nil
+}
+
+// Stats returns the summary of the CPU and memory histograms of the
+// aggregation. OOMCount is not set, as OOMs are tracked per container.
+func (a *AggregateContainerState) Stats() (ContainerStats, error) {
+	cpu, err := newHistogramView(a, apiv1.ResourceCPU)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	memory, err := newHistogramView(a, apiv1.ResourceMemory)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	stats := ContainerStats{SampleCount: a.TotalSamplesCount}
+	stats.MinCPU, stats.MaxCPU, stats.MeanCPU, stats.P95CPU = summarizeHistogram(cpu)
+	stats.MinMemory, stats.MaxMemory, stats.MeanMemory, stats.P95Memory = summarizeHistogram(memory)
+	return stats, nil
+}
+
+// summarizeHistogram returns the minimum, maximum, mean and P95 of the
+// histogram. The minimum and the maximum are the bounds of the lowest and
+// the highest non-empty buckets and the mean uses the bucket midpoints.
+func summarizeHistogram(view HistogramView) (minimum, maximum, mean, p95 ResourceAmount) {
+	buckets := view.Buckets()
+	if len(buckets) == 0 || view.TotalWeight() <= 0 {
+		return 0, 0, 0, 0
+	}
+	weightedSum := 0.0
+	for _, bucket := range buckets {
+		weightedSum += bucket.Weight * float64(bucket.Start+bucket.End) / 2
+	}
+	minimum = buckets[0].Start
+	maximum = buckets[len(buckets)-1].End
+	mean = resourceAmountFromFloat(weightedSum / view.TotalWeight())
+	p95 = view.Percentile(0.95)
+	return minimum, maximum, mean, p95
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetContainerStats(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	_, err := cluster.GetContainerStats(testContainerID)
+	assert.Error(t, err)
+	addTestPod(cluster)
+	_, err = cluster.GetContainerStats(testContainerID)
+	assert.Error(t, err)
+	addTestContainer(t, cluster)
+
+	// No samples.
+	stats, err := cluster.GetContainerStats(testContainerID)
+	assert.NoError(t, err)
+	assert.Equal(t, ContainerStats{}, stats)
+
+	for i, cores := range []float64{1, 1, 1, 3} {
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+			MeasureStart: testTimestamp.Add(time.Duration(i) * time.Minute), Usage: CPUAmountFromCores(cores), Resource: ResourceCPU}, testContainerID}))
+	}
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp, Usage: MemoryAmountFromBytes(1e9), Resource: ResourceMemory}, testContainerID}))
+	assert.NoError(t, cluster.RecordOOM(testContainerID, testTimestamp.Add(time.Minute), MemoryAmountFromBytes(1e9)))
+
+	stats, err = cluster.GetContainerStats(testContainerID)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stats.SampleCount)
+	assert.Equal(t, 1, stats.OOMCount)
+	// The values are approximated to the histogram buckets, which are 5% wide.
+	assert.InEpsilon(t, float64(CPUAmountFromCores(1)), float64(stats.MinCPU), 0.05)
+	assert.InEpsilon(t, float64(CPUAmountFromCores(3)), float64(stats.MaxCPU), 0.05)
+	assert.InEpsilon(t, float64(CPUAmountFromCores(1.5)), float64(stats.MeanCPU), 0.05)
+	assert.InEpsilon(t, float64(CPUAmountFromCores(3)), float64(stats.P95CPU), 0.05)
+	// The OOM replaced the peak of the memory aggregation interval with the
+	// bumped up memory.
+	oomMemory := float64(MemoryAmountFromBytes(1e9 * GetAggregationsConfig().OOMBumpUpRatio))
+	assert.InEpsilon(t, oomMemory, float64(stats.MinMemory), 0.05)
+	assert.InEpsilon(t, oomMemory, float64(stats.MaxMemory), 0.05)
+	assert.InEpsilon(t, oomMemory, float64(stats.MeanMemory), 0.05)
+	assert.InEpsilon(t, oomMemory, float64(stats.P95Memory), 0.05)
+	assert.LessOrEqual(t, stats.MinCPU, stats.MeanCPU)
+	assert.LessOrEqual(t, stats.MeanCPU, stats.MaxCPU)
+}
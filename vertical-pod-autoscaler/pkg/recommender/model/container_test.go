@@ -194,3 +194,49 @@ func TestRecordOOMInNewWindow(t *testing.T) {
 	test.mockMemoryHistogram.On("AddSample", 2400.0*mb, 1.0, memoryAggregationWindowEnd)
 	assert.NoError(t, test.container.RecordOOM(testTimestamp.Add(2*memoryAggregationInterval), ResourceAmount(1000*mb)))
 }
+
+func TestRecordRestart(t *testing.T) {
+	container := NewContainerState(testRequest, nil)
+	assert.Equal(t, 0, container.RestartsSince(testTimestamp))
+	for i := 0; i < 3; i++ {
+		container.RecordRestart(testTimestamp.Add(time.Duration(i) * time.Minute))
+	}
+	assert.Equal(t, 3, container.RestartsSince(testTimestamp))
+	assert.Equal(t, 1, container.RestartsSince(testTimestamp.Add(2*time.Minute)))
+
+	// Only the most recent restarts are kept.
+	for i := 0; i < RestartHistorySize; i++ {
+		container.RecordRestart(testTimestamp.Add(time.Hour + time.Duration(i)*time.Minute))
+	}
+	assert.Equal(t, RestartHistorySize, container.RestartsSince(testTimestamp))
+	assert.Equal(t, RestartHistorySize, container.RestartsSince(testTimestamp.Add(time.Hour)))
+}
+
+func TestSustainedCPUThrottling(t *testing.T) {
+	container := NewContainerState(testRequest, nil)
+	_, sustained := container.SustainedCPUThrottling(0.1, 3)
+	assert.False(t, sustained)
+
+	for i, fraction := range []float64{0.05, 0.2, 0.3, 0.4} {
+		assert.NoError(t, container.RecordCPUThrottling(testTimestamp.Add(time.Duration(i)*time.Minute), fraction))
+	}
+	fraction, sustained := container.SustainedCPUThrottling(0.1, 3)
+	assert.True(t, sustained)
+	assert.InDelta(t, 0.3, fraction, 1e-9)
+	// One of the last four observations doesn't exceed the threshold.
+	_, sustained = container.SustainedCPUThrottling(0.1, 4)
+	assert.False(t, sustained)
+	_, sustained = container.SustainedCPUThrottling(0.35, 1)
+	assert.True(t, sustained)
+
+	// Only the most recent observations are kept.
+	for i := 0; i < ThrottlingHistorySize; i++ {
+		assert.NoError(t, container.RecordCPUThrottling(testTimestamp.Add(time.Hour+time.Duration(i)*time.Minute), 0.5))
+	}
+	fraction, sustained = container.SustainedCPUThrottling(0.1, ThrottlingHistorySize+1)
+	assert.True(t, sustained)
+	assert.InDelta(t, 0.5, fraction, 1e-9)
+
+	assert.Error(t, container.RecordCPUThrottling(testTimestamp.Add(2*time.Hour), 1.5))
+	assert.Error(t, container.RecordCPUThrottling(testTimestamp, 0.5))
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// CPUSaturationWindow is the window over which the CPU saturation of
+	// containers is averaged.
+	CPUSaturationWindow = time.Hour
+	// MinCPUSaturationSamples is the minimum number of CPU saturation
+	// observations within CPUSaturationWindow for a container to be reported
+	// by GetContainersByCPUSaturation.
+	MinCPUSaturationSamples = 5
+)
+
+// CPUSaturationReport describes the CPU saturation of a container.
+type CPUSaturationReport struct {
+	ContainerID ContainerID
+	// AverageFraction is the average CPU usage fraction observed within the
+	// last CPUSaturationWindow.
+	AverageFraction float64
+}
+
+// cpuSaturationSample is a single CPU saturation observation.
+type cpuSaturationSample struct {
+	timestamp time.Time
+	fraction  float64
+}
+
+// RecordCPUSaturation records the fraction of the available CPU used by the
+// container with the given ID, observed at the given time.
+func (cluster *clusterState) RecordCPUSaturation(containerID ContainerID, timestamp time.Time, cpuUsageFraction float64) error {
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
+	container := cluster.GetContainer(containerID)
+	if container == nil {
+		return NewContainerNotFoundError(containerID)
+	}
+	if err := container.RecordCPUSaturation(timestamp, cpuUsageFraction); err != nil {
+		return fmt.Errorf("error while recording CPU saturation for %v: %w", containerID, err)
+	}
+	return nil
+}
+
+// GetContainersByCPUSaturation returns up to top containers with the highest
+// average CPU saturation over the last CPUSaturationWindow, most saturated
+// first. Containers with fewer than MinCPUSaturationSamples observations
+// within the window are skipped.
+func (cluster *clusterState) GetContainersByCPUSaturation(top int) []CPUSaturationReport {
+	now := time.Now()
+	reports := []CPUSaturationReport{}
+	for podID, pod := range cluster.pods {
+		for containerName, container := range pod.Containers {
+			average, count := container.averageCPUSaturation(now.Add(-CPUSaturationWindow))
+			if count < MinCPUSaturationSamples {
+				continue
+			}
+			reports = append(reports, CPUSaturationReport{
+				ContainerID:     ContainerID{PodID: podID, ContainerName: containerName},
+				AverageFraction: average,
+			})
+		}
+	}
+	slices.SortFunc(reports, func(a, b CPUSaturationReport) int {
+		return cmp.Or(
+			cmp.Compare(b.AverageFraction, a.AverageFraction),
+			cmp.Compare(a.ContainerID.Namespace, b.ContainerID.Namespace),
+			cmp.Compare(a.ContainerID.PodName, b.ContainerID.PodName),
+			cmp.Compare(a.ContainerID.ContainerName, b.ContainerID.ContainerName))
+	})
+	if top < len(reports) {
+		reports = reports[:max(top, 0)]
+	}
+	return reports
+}
+
+// RecordCPUSaturation records the fraction of the available CPU used by the
+// container, observed at the given time. Observations must be recorded in
+// chronological order. Observations older than CPUSaturationWindow before
+// the latest one are dropped.
+func (container *ContainerState) RecordCPUSaturation(timestamp time.Time, cpuUsageFraction float64) error {
+	if cpuUsageFraction < 0 {
+		return fmt.Errorf("negative CPU usage fraction %v", cpuUsageFraction)
+	}
+	if last := len(container.cpuSaturation) - 1; last >= 0 && !timestamp.After(container.cpuSaturation[last].timestamp) {
+		return fmt.Errorf("CPU saturation observation at %v is not newer than the previous one at %v", timestamp, container.cpuSaturation[last].timestamp)
+	}
+	expired := 0
+	for expired < len(container.cpuSaturation) && !container.cpuSaturation[expired].timestamp.After(timestamp.Add(-CPUSaturationWindow)) {
+		expired++
+	}
+	container.cpuSaturation = append(container.cpuSaturation[expired:], cpuSaturationSample{timestamp: timestamp, fraction: cpuUsageFraction})
+	return nil
+}
+
+// averageCPUSaturation returns the average CPU usage fraction and the number
+// of observations after the given time.
+func (container *ContainerState) averageCPUSaturation(after time.Time) (float64, int) {
+	sum, count := 0.0, 0
+	for _, sample := range container.cpuSaturation {
+		if sample.timestamp.After(after) {
+			sum += sample.fraction
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return sum / float64(count), count
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetContainersByCPUSaturation(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	containerIDs := []ContainerID{
+		{testPodID, "container-1"},
+		{testPodID, "container-2"},
+		{testPodID, "container-3"},
+		{testPodID, "container-4"},
+	}
+	for _, containerID := range containerIDs {
+		_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+		assert.NoError(t, err)
+	}
+	now := time.Now()
+	record := func(containerID ContainerID, fractions ...float64) {
+		for i, fraction := range fractions {
+			ts := now.Add(time.Duration(i-len(fractions)) * time.Minute)
+			assert.NoError(t, cluster.RecordCPUSaturation(containerID, ts, fraction))
+		}
+	}
+	record(containerIDs[0], 0.5, 0.5, 0.5, 0.5, 0.5)
+	record(containerIDs[1], 0.9, 0.8, 0.9, 0.8, 0.9, 0.8)
+	// Too few samples.
+	record(containerIDs[2], 1, 1, 1, 1)
+	// The first sample is older than the window, leaving too few samples.
+	assert.NoError(t, cluster.RecordCPUSaturation(containerIDs[3], now.Add(-2*CPUSaturationWindow), 1))
+	record(containerIDs[3], 1, 1, 1, 1)
+
+	reports := cluster.GetContainersByCPUSaturation(10)
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, containerIDs[1], reports[0].ContainerID)
+		assert.InDelta(t, 0.85, reports[0].AverageFraction, 1e-9)
+		assert.Equal(t, containerIDs[0], reports[1].ContainerID)
+		assert.InDelta(t, 0.5, reports[1].AverageFraction, 1e-9)
+	}
+	reports = cluster.GetContainersByCPUSaturation(1)
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, containerIDs[1], reports[0].ContainerID)
+	}
+	assert.Empty(t, cluster.GetContainersByCPUSaturation(0))
+
+	assert.Error(t, cluster.RecordCPUSaturation(ContainerID{testPodID, "missing"}, now, 0.5))
+	assert.Error(t, cluster.RecordCPUSaturation(containerIDs[0], now, -0.1))
+	assert.Error(t, cluster.RecordCPUSaturation(containerIDs[0], now.Add(-time.Hour), 0.5))
+}
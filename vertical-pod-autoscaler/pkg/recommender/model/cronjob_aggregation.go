@@ -0,0 +1,93 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	vpa_utils "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+const (
+	// CronJobAggregationLabel is the label replacing the labels specific to a
+	// single Job in the aggregation keys of pods of CronJobs aggregated
+	// together. Its value is the name of the CronJob.
+	CronJobAggregationLabel = "vpa.autoscaling.k8s.io/cronjob-name"
+	// Unprefixed variants of batchv1.JobNameLabel and batchv1.ControllerUidLabel,
+	// still set by the Job controller.
+	legacyJobNameLabel       = "job-name"
+	legacyControllerUIDLabel = "controller-uid"
+)
+
+// cronJobName returns the name of the CronJob which created the Job owning a
+// pod with the given labels. The CronJob controller names Jobs after the
+// CronJob followed by a dash and the scheduled time in minutes, which is used
+// to recognize them. Returns false if the pod doesn't belong to such a Job.
+func cronJobName(podLabels labels.Set) (string, bool) {
+	jobName, found := podLabels[batchv1.JobNameLabel]
+	if !found {
+		jobName, found = podLabels[legacyJobNameLabel]
+	}
+	if !found {
+		return "", false
+	}
+	separator := strings.LastIndex(jobName, "-")
+	if separator <= 0 || separator == len(jobName)-1 {
+		return "", false
+	}
+	for _, c := range jobName[separator+1:] {
+		if c < '0' || c > '9' {
+			return "", false
+		}
+	}
+	return jobName[:separator], true
+}
+
+// aggregationLabels returns the labels used to aggregate the usage samples of
+// the containers of a pod with the given labels. Pods of Jobs created by a
+// CronJob controlled by a VPA with CronJobAggregation enabled use the name of
+// the CronJob instead of the labels specific to their Job, so that all runs
+// of the CronJob share the aggregations. Other pods use their own labels.
+func (cluster *clusterState) aggregationLabels(podID PodID, podLabels labels.Set) labels.Set {
+	cronJob, isCronJobPod := cronJobName(podLabels)
+	if !isCronJobPod {
+		return podLabels
+	}
+	cronJobAggregation := false
+	for _, vpa := range cluster.vpas {
+		if vpa_utils.PodLabelsMatchVPA(podID.Namespace, podLabels, vpa.ID.Namespace, vpa.PodSelector) {
+			cronJobAggregation = vpa.CronJobAggregation
+			break
+		}
+	}
+	if !cronJobAggregation {
+		return podLabels
+	}
+	result := make(labels.Set, len(podLabels))
+	for key, value := range podLabels {
+		switch key {
+		case batchv1.JobNameLabel, batchv1.ControllerUidLabel, legacyJobNameLabel, legacyControllerUIDLabel:
+			continue
+		}
+		result[key] = value
+	}
+	result[CronJobAggregationLabel] = cronJob
+	return result
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestCronJobName(t *testing.T) {
+	testCases := []struct {
+		name           string
+		podLabels      labels.Set
+		expectedName   string
+		expectedResult bool
+	}{
+		{"CronJob pod", labels.Set{"batch.kubernetes.io/job-name": "backup-28912345"}, "backup", true},
+		{"legacy label", labels.Set{"job-name": "db-backup-28912345"}, "db-backup", true},
+		{"Job not created by a CronJob", labels.Set{"job-name": "migration"}, "", false},
+		{"non-numeric suffix", labels.Set{"job-name": "backup-abc"}, "", false},
+		{"empty suffix", labels.Set{"job-name": "backup-"}, "", false},
+		{"not a Job pod", labels.Set{"app": "backup"}, "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, ok := cronJobName(tc.podLabels)
+			assert.Equal(t, tc.expectedResult, ok)
+			assert.Equal(t, tc.expectedName, name)
+		})
+	}
+}
+
+func TestCronJobAggregation(t *testing.T) {
+	cronJobRunLabels := func(run int) labels.Set {
+		jobName := fmt.Sprintf("backup-%d", 28912345+run)
+		uid := fmt.Sprintf("uid-%d", run)
+		return labels.Set{
+			"label-1":                            "value-1",
+			"batch.kubernetes.io/job-name":       jobName,
+			"job-name":                           jobName,
+			"batch.kubernetes.io/controller-uid": uid,
+			"controller-uid":                     uid,
+		}
+	}
+	for _, tc := range []struct {
+		name                 string
+		annotations          vpaAnnotationsMap
+		expectedAggregations int
+	}{
+		{"runs aggregated together", vpaAnnotationsMap{CronJobAggregationAnnotation: "true"}, 1},
+		{"separate aggregation per run", vpaAnnotationsMap{}, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			vpa := addVpa(cluster, testVpaID, tc.annotations, testSelectorStr, testTargetRef)
+			for run := 0; run < 3; run++ {
+				podID := PodID{testPodID.Namespace, fmt.Sprintf("backup-%d-abcd%d", 28912345+run, run)}
+				containerID := ContainerID{podID, "container-1"}
+				assert.NoError(t, cluster.AddOrUpdatePod(podID, cronJobRunLabels(run), apiv1.PodRunning))
+				_, err := cluster.AddOrUpdateContainer(containerID, testRequest)
+				assert.NoError(t, err)
+				sample := makeTestUsageSample()
+				sample.Container = containerID
+				sample.MeasureStart = testTimestamp.Add(time.Duration(run) * time.Hour)
+				assert.NoError(t, cluster.AddSample(sample))
+				// The finished run is deleted before the next one starts.
+				cluster.DeletePod(podID)
+			}
+			assert.Equal(t, tc.expectedAggregations, cluster.StateMapSize())
+			assert.Len(t, vpa.aggregateContainerStates, tc.expectedAggregations)
+			totalSamples := 0
+			for _, state := range vpa.aggregateContainerStates {
+				totalSamples += state.TotalSamplesCount
+			}
+			assert.Equal(t, 3, totalSamples)
+			if tc.expectedAggregations == 1 {
+				for key := range vpa.aggregateContainerStates {
+					assert.Equal(t, "backup", key.Labels().Get(CronJobAggregationLabel))
+					assert.False(t, key.Labels().Has("job-name"))
+				}
+			}
+		})
+	}
+}
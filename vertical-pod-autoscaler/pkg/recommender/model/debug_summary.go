@@ -0,0 +1,91 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// PrintDebugSummary writes a human-readable summary of the cluster state to
+// w, meant for operators rather than for parsing: a table with one row per
+// VPA, followed by the aggregations not linked to any VPA and the pods not
+// matching any VPA.
+func (cluster *clusterState) PrintDebugSummary(w io.Writer) error {
+	now := time.Now()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tNAME\tPODS\tAGGREGATIONS\tRECOMMENDATION\tAGE")
+	vpaIDs := make([]VpaID, 0, len(cluster.vpas))
+	for vpaID := range cluster.vpas {
+		vpaIDs = append(vpaIDs, vpaID)
+	}
+	sort.Slice(vpaIDs, func(i, j int) bool {
+		if vpaIDs[i].Namespace != vpaIDs[j].Namespace {
+			return vpaIDs[i].Namespace < vpaIDs[j].Namespace
+		}
+		return vpaIDs[i].VpaName < vpaIDs[j].VpaName
+	})
+	for _, vpaID := range vpaIDs {
+		vpa := cluster.vpas[vpaID]
+		recommendation := "none"
+		if vpa.HasRecommendation() {
+			recommendation = "present"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%v\n", vpaID.Namespace, vpaID.VpaName, vpa.PodCount,
+			len(vpa.aggregateContainerStates), recommendation, vpa.CreationAge(now).Truncate(time.Second))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	orphanedAggregations := []string{}
+	cluster.ForEachAggregation(func(key AggregateStateKey, aggregation *AggregateContainerState) bool {
+		unlock := cluster.aggregateStates.lockSamples(key)
+		if !aggregation.IsUnderVPA {
+			orphanedAggregations = append(orphanedAggregations, fmt.Sprintf("%s/%s {%s}", key.Namespace(), key.ContainerName(), key.Labels()))
+		}
+		unlock()
+		return true
+	})
+	sort.Strings(orphanedAggregations)
+	if err := printDebugSection(w, "Orphaned aggregations", orphanedAggregations); err != nil {
+		return err
+	}
+
+	stalePods := []string{}
+	for _, podID := range cluster.GetOrphanedPods() {
+		stalePods = append(stalePods, fmt.Sprintf("%s/%s", podID.Namespace, podID.PodName))
+	}
+	sort.Strings(stalePods)
+	return printDebugSection(w, "Pods not matching any VPA", stalePods)
+}
+
+// printDebugSection writes a titled list of items for PrintDebugSummary.
+func printDebugSection(w io.Writer, title string, items []string) error {
+	if _, err := fmt.Fprintf(w, "\n%s (%d):\n", title, len(items)); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if _, err := fmt.Fprintf(w, "  %s\n", item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestPrintDebugSummary(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	addVpa(cluster, VpaID{"namespace-1", "vpa-without-pods"}, testAnnotations, "label-1 = other-value", testTargetRef)
+	// A pod not matching any VPA, whose container uses an orphaned aggregation.
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, emptyLabels, apiv1.PodRunning))
+	_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID3, "container-2"}, testRequest)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, cluster.PrintDebugSummary(&buf))
+	out := buf.String()
+	assert.Regexp(t, regexp.MustCompile(`(?m)^namespace-1\s+vpa-1\s+1\s+1\s+none\s`), out)
+	assert.Regexp(t, regexp.MustCompile(`(?m)^namespace-1\s+vpa-without-pods\s+0\s+0\s+none\s`), out)
+	assert.Contains(t, out, "Orphaned aggregations (1):\n  namespace-1/container-2")
+	assert.Contains(t, out, "Pods not matching any VPA (1):\n  namespace-1/"+testPodID3.PodName)
+}
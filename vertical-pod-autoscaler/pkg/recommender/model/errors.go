@@ -18,6 +18,7 @@ package model
 
 import (
 	"fmt"
+	"time"
 )
 
 // KeyError is returned when the mapping key was not found.
@@ -33,3 +34,266 @@ func NewKeyError(key interface{}) KeyError {
 func (e KeyError) Error() string {
 	return fmt.Sprintf("KeyError: %s", e.key)
 }
+
+// SampleThrottledError is returned when a usage sample is dropped because the
+// rate limit of the aggregation it belongs to was exceeded. It is not a sign
+// of a problem with the sample itself.
+type SampleThrottledError struct {
+	containerID ContainerID
+}
+
+// NewSampleThrottledError returns a new SampleThrottledError.
+func NewSampleThrottledError(containerID ContainerID) SampleThrottledError {
+	return SampleThrottledError{containerID}
+}
+
+func (e SampleThrottledError) Error() string {
+	return fmt.Sprintf("sample of container %s/%s/%s throttled", e.containerID.Namespace, e.containerID.PodName, e.containerID.ContainerName)
+}
+
+// RateLimitedError is returned when a mutation of the cluster state is
+// rejected because its rate limit was exceeded and too many mutations are
+// already waiting.
+type RateLimitedError struct {
+	operation string
+}
+
+// NewRateLimitedError returns a new RateLimitedError.
+func NewRateLimitedError(operation string) RateLimitedError {
+	return RateLimitedError{operation}
+}
+
+func (e RateLimitedError) Error() string {
+	return fmt.Sprintf("%s rate limited: too many operations waiting", e.operation)
+}
+
+// MultipleMatchesError is returned when a lookup expected to find a single
+// object finds more of them.
+type MultipleMatchesError struct {
+	key     interface{}
+	matches int
+}
+
+// NewMultipleMatchesError returns a new MultipleMatchesError.
+func NewMultipleMatchesError(key interface{}, matches int) MultipleMatchesError {
+	return MultipleMatchesError{key, matches}
+}
+
+func (e MultipleMatchesError) Error() string {
+	return fmt.Sprintf("MultipleMatchesError: %d matches for %v", e.matches, e.key)
+}
+
+// PodNotFoundError is returned when a pod is not present in the cluster
+// state.
+type PodNotFoundError struct {
+	PodID PodID
+}
+
+// NewPodNotFoundError returns a new PodNotFoundError.
+func NewPodNotFoundError(podID PodID) PodNotFoundError {
+	return PodNotFoundError{podID}
+}
+
+func (e PodNotFoundError) Error() string {
+	return fmt.Sprintf("pod %s/%s not found", e.PodID.Namespace, e.PodID.PodName)
+}
+
+// Unwrap returns the KeyError of the pod, for callers which check for a
+// KeyError.
+func (e PodNotFoundError) Unwrap() error {
+	return NewKeyError(e.PodID)
+}
+
+// ContainerNotFoundError is returned when a container is not present in its
+// pod in the cluster state.
+type ContainerNotFoundError struct {
+	ContainerID ContainerID
+}
+
+// NewContainerNotFoundError returns a new ContainerNotFoundError.
+func NewContainerNotFoundError(containerID ContainerID) ContainerNotFoundError {
+	return ContainerNotFoundError{containerID}
+}
+
+func (e ContainerNotFoundError) Error() string {
+	return fmt.Sprintf("container %s/%s/%s not found", e.ContainerID.Namespace, e.ContainerID.PodName, e.ContainerID.ContainerName)
+}
+
+// Unwrap returns the KeyError of the container, for callers which check for a
+// KeyError.
+func (e ContainerNotFoundError) Unwrap() error {
+	return NewKeyError(e.ContainerID.ContainerName)
+}
+
+// VpaNotFoundError is returned when a VPA is not present in the cluster
+// state.
+type VpaNotFoundError struct {
+	VpaID VpaID
+}
+
+// NewVpaNotFoundError returns a new VpaNotFoundError.
+func NewVpaNotFoundError(vpaID VpaID) VpaNotFoundError {
+	return VpaNotFoundError{vpaID}
+}
+
+func (e VpaNotFoundError) Error() string {
+	return fmt.Sprintf("VPA %s/%s not found", e.VpaID.Namespace, e.VpaID.VpaName)
+}
+
+// Unwrap returns the KeyError of the VPA, for callers which check for a
+// KeyError.
+func (e VpaNotFoundError) Unwrap() error {
+	return NewKeyError(e.VpaID)
+}
+
+// TargetRefNotFoundError is returned when no VPA targets the given controller.
+type TargetRefNotFoundError struct {
+	Namespace string
+	Kind      string
+	Name      string
+}
+
+// NewTargetRefNotFoundError returns a new TargetRefNotFoundError.
+func NewTargetRefNotFoundError(namespace, kind, name string) TargetRefNotFoundError {
+	return TargetRefNotFoundError{namespace, kind, name}
+}
+
+func (e TargetRefNotFoundError) Error() string {
+	return fmt.Sprintf("no VPA targets %s %s/%s", e.Kind, e.Namespace, e.Name)
+}
+
+// Unwrap returns the KeyError of the target ref, for callers which check for
+// a KeyError.
+func (e TargetRefNotFoundError) Unwrap() error {
+	return NewKeyError(targetRefKey{namespace: e.Namespace, kind: e.Kind, name: e.Name})
+}
+
+// PodNotControlledError is returned when a pod is not controlled by any VPA.
+type PodNotControlledError struct {
+	PodID PodID
+}
+
+// NewPodNotControlledError returns a new PodNotControlledError.
+func NewPodNotControlledError(podID PodID) PodNotControlledError {
+	return PodNotControlledError{podID}
+}
+
+func (e PodNotControlledError) Error() string {
+	return fmt.Sprintf("pod %s/%s is not controlled by any VPA", e.PodID.Namespace, e.PodID.PodName)
+}
+
+// SampleDiscardedError is returned when a usage sample is invalid, e.g. has
+// a negative usage, or is out of order and is therefore not aggregated.
+type SampleDiscardedError struct {
+	ContainerID  ContainerID
+	Resource     ResourceName
+	MeasureStart time.Time
+}
+
+// NewSampleDiscardedError returns a new SampleDiscardedError for the sample.
+func NewSampleDiscardedError(sample *ContainerUsageSampleWithKey) SampleDiscardedError {
+	return SampleDiscardedError{sample.Container, sample.Resource, sample.MeasureStart}
+}
+
+func (e SampleDiscardedError) Error() string {
+	return fmt.Sprintf("%s sample of container %s/%s/%s started at %v discarded (invalid or out of order)",
+		e.Resource, e.ContainerID.Namespace, e.ContainerID.PodName, e.ContainerID.ContainerName, e.MeasureStart)
+}
+
+// OOMRecordError is returned when an OOM event of an existing container can't
+// be recorded, e.g. because it is too old.
+type OOMRecordError struct {
+	ContainerID ContainerID
+	Timestamp   time.Time
+	// Err is the reason why the OOM event wasn't recorded.
+	Err error
+}
+
+// NewOOMRecordError returns a new OOMRecordError.
+func NewOOMRecordError(containerID ContainerID, timestamp time.Time, err error) OOMRecordError {
+	return OOMRecordError{containerID, timestamp, err}
+}
+
+func (e OOMRecordError) Error() string {
+	return fmt.Sprintf("error while recording OOM of container %s/%s/%s at %v: %v",
+		e.ContainerID.Namespace, e.ContainerID.PodName, e.ContainerID.ContainerName, e.Timestamp, e.Err)
+}
+
+func (e OOMRecordError) Unwrap() error {
+	return e.Err
+}
+
+// ThrottlingRecordError is returned when a CPU throttling observation of an
+// existing container can't be recorded, e.g. because it is out of order.
+type ThrottlingRecordError struct {
+	ContainerID ContainerID
+	Timestamp   time.Time
+	// Err is the reason why the observation wasn't recorded.
+	Err error
+}
+
+// NewThrottlingRecordError returns a new ThrottlingRecordError.
+func NewThrottlingRecordError(containerID ContainerID, timestamp time.Time, err error) ThrottlingRecordError {
+	return ThrottlingRecordError{containerID, timestamp, err}
+}
+
+func (e ThrottlingRecordError) Error() string {
+	return fmt.Sprintf("error while recording CPU throttling of container %s/%s/%s at %v: %v",
+		e.ContainerID.Namespace, e.ContainerID.PodName, e.ContainerID.ContainerName, e.Timestamp, e.Err)
+}
+
+func (e ThrottlingRecordError) Unwrap() error {
+	return e.Err
+}
+
+// NamespaceNotAllowedError is returned when a pod is rejected because its
+// namespace is not allowed in strict namespace mode.
+type NamespaceNotAllowedError struct {
+	PodID PodID
+}
+
+// NewNamespaceNotAllowedError returns a new NamespaceNotAllowedError.
+func NewNamespaceNotAllowedError(podID PodID) NamespaceNotAllowedError {
+	return NamespaceNotAllowedError{podID}
+}
+
+func (e NamespaceNotAllowedError) Error() string {
+	return fmt.Sprintf("pod %s/%s rejected: namespace %s is not allowed in strict namespace mode", e.PodID.Namespace, e.PodID.PodName, e.PodID.Namespace)
+}
+
+// NamespaceChangeError is returned when a pod or a VPA would be renamed into
+// another namespace, which the cluster state doesn't support.
+type NamespaceChangeError struct {
+	// Kind of the renamed object, "pod" or "VPA".
+	Kind         string
+	Namespace    string
+	Name         string
+	NewNamespace string
+}
+
+// NewNamespaceChangeError returns a new NamespaceChangeError.
+func NewNamespaceChangeError(kind, namespace, name, newNamespace string) NamespaceChangeError {
+	return NamespaceChangeError{kind, namespace, name, newNamespace}
+}
+
+func (e NamespaceChangeError) Error() string {
+	return fmt.Sprintf("cannot move %s %s/%s to another namespace %s", e.Kind, e.Namespace, e.Name, e.NewNamespace)
+}
+
+// AlreadyExistsError is returned when a pod or a VPA can't be renamed because
+// an object with the new name already exists.
+type AlreadyExistsError struct {
+	// Kind of the object, "pod" or "VPA".
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// NewAlreadyExistsError returns a new AlreadyExistsError.
+func NewAlreadyExistsError(kind, namespace, name string) AlreadyExistsError {
+	return AlreadyExistsError{kind, namespace, name}
+}
+
+func (e AlreadyExistsError) Error() string {
+	return fmt.Sprintf("%s %s/%s already exists", e.Kind, e.Namespace, e.Name)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestStructuredErrors(t *testing.T) {
+	ctx := context.Background()
+	cluster := NewClusterState(testGcPeriod)
+
+	var podErr PodNotFoundError
+	if assert.ErrorAs(t, cluster.AddSample(makeTestUsageSample()), &podErr) {
+		assert.Equal(t, testPodID, podErr.PodID)
+	}
+
+	addTestPod(cluster)
+	unknownContainerID := ContainerID{testPodID, "unknown"}
+	var containerErr ContainerNotFoundError
+	err := cluster.RecordOOMWithContext(ctx, unknownContainerID, testTimestamp, ResourceAmount(10))
+	if assert.ErrorAs(t, err, &containerErr) {
+		assert.Equal(t, unknownContainerID, containerErr.ContainerID)
+	}
+	assert.EqualError(t, err, "container namespace-1/pod-1/unknown not found")
+	assert.ErrorIs(t, err, NewKeyError("unknown"))
+
+	unknownVpaID := VpaID{"namespace-1", "unknown"}
+	var vpaErr VpaNotFoundError
+	err = cluster.DeleteVpa(unknownVpaID)
+	if assert.ErrorAs(t, err, &vpaErr) {
+		assert.Equal(t, unknownVpaID, vpaErr.VpaID)
+	}
+	assert.EqualError(t, err, "VPA namespace-1/unknown not found")
+
+	var targetRefErr TargetRefNotFoundError
+	_, err = cluster.GetVpaByTargetRef(testTargetRef.Kind, testTargetRef.Name, testVpaID.Namespace)
+	if assert.ErrorAs(t, err, &targetRefErr) {
+		assert.Equal(t, TargetRefNotFoundError{testVpaID.Namespace, testTargetRef.Kind, testTargetRef.Name}, targetRefErr)
+	}
+	assert.ErrorAs(t, err, &KeyError{})
+
+	var notControlledErr PodNotControlledError
+	_, err = cluster.GetRecommendationForPod(testPodID)
+	if assert.ErrorAs(t, err, &notControlledErr) {
+		assert.Equal(t, testPodID, notControlledErr.PodID)
+	}
+	assert.EqualError(t, err, "pod namespace-1/pod-1 is not controlled by any VPA")
+
+	addTestContainer(t, cluster)
+	sample := makeTestUsageSample()
+	assert.NoError(t, cluster.AddSample(sample))
+	var sampleErr SampleDiscardedError
+	err = cluster.AddSample(sample)
+	if assert.ErrorAs(t, err, &sampleErr) {
+		assert.Equal(t, SampleDiscardedError{testContainerID, sample.Resource, sample.MeasureStart}, sampleErr)
+	}
+
+	memorySample := &ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp, Usage: MemoryAmountFromBytes(1e8), Resource: ResourceMemory}, testContainerID}
+	assert.NoError(t, cluster.AddSample(memorySample))
+	var oomErr OOMRecordError
+	oomTime := testTimestamp.Add(-48 * time.Hour)
+	err = cluster.RecordOOMWithContext(ctx, testContainerID, oomTime, ResourceAmount(10))
+	if assert.ErrorAs(t, err, &oomErr) {
+		assert.Equal(t, testContainerID, oomErr.ContainerID)
+		assert.Equal(t, oomTime, oomErr.Timestamp)
+		assert.Error(t, oomErr.Err)
+	}
+
+	// OOM kills reported as crashes fail like OOMs.
+	err = cluster.RecordCrash(testContainerID, oomTime, 137)
+	if assert.ErrorAs(t, err, &oomErr) {
+		assert.Equal(t, testContainerID, oomErr.ContainerID)
+	}
+
+	assert.NoError(t, cluster.RecordCPUThrottling(testContainerID, testTimestamp, 0.5))
+	var throttlingErr ThrottlingRecordError
+	err = cluster.RecordCPUThrottling(testContainerID, testTimestamp, 0.5)
+	if assert.ErrorAs(t, err, &throttlingErr) {
+		assert.Equal(t, testContainerID, throttlingErr.ContainerID)
+		assert.Equal(t, testTimestamp, throttlingErr.Timestamp)
+		assert.Error(t, throttlingErr.Err)
+	}
+
+	otherPodID := PodID{"namespace-1", "pod-2"}
+	assert.NoError(t, cluster.AddOrUpdatePod(otherPodID, testLabels, apiv1.PodRunning))
+	var namespaceChangeErr NamespaceChangeError
+	err = cluster.RenamePod(testPodID, PodID{"namespace-2", "pod-1"})
+	if assert.ErrorAs(t, err, &namespaceChangeErr) {
+		assert.Equal(t, NamespaceChangeError{"pod", "namespace-1", "pod-1", "namespace-2"}, namespaceChangeErr)
+	}
+	var existsErr AlreadyExistsError
+	err = cluster.RenamePod(testPodID, otherPodID)
+	if assert.ErrorAs(t, err, &existsErr) {
+		assert.Equal(t, AlreadyExistsError{"pod", "namespace-1", "pod-2"}, existsErr)
+	}
+	assert.EqualError(t, err, "pod namespace-1/pod-2 already exists")
+
+	addTestVpa(cluster)
+	otherVpaID := VpaID{"namespace-1", "vpa-2"}
+	addVpa(cluster, otherVpaID, testAnnotations, testSelectorStr, testTargetRef)
+	err = cluster.MigrateVpa(testVpaID, VpaID{"namespace-2", "vpa-1"})
+	if assert.ErrorAs(t, err, &namespaceChangeErr) {
+		assert.Equal(t, NamespaceChangeError{"VPA", "namespace-1", "vpa-1", "namespace-2"}, namespaceChangeErr)
+	}
+	assert.EqualError(t, err, "cannot move VPA namespace-1/vpa-1 to another namespace namespace-2")
+	err = cluster.MigrateVpa(testVpaID, otherVpaID)
+	if assert.ErrorAs(t, err, &existsErr) {
+		assert.Equal(t, AlreadyExistsError{"VPA", "namespace-1", "vpa-2"}, existsErr)
+	}
+
+	cluster.SetStrictNamespaceMode([]string{"namespace-2"})
+	var namespaceErr NamespaceNotAllowedError
+	err = cluster.AddOrUpdatePod(testPodID3, testLabels, apiv1.PodRunning)
+	if assert.ErrorAs(t, err, &namespaceErr) {
+		assert.Equal(t, testPodID3, namespaceErr.PodID)
+	}
+
+	_, _, err = cluster.SimulateAdmission(nil)
+	assert.ErrorIs(t, err, ErrNilPod)
+}
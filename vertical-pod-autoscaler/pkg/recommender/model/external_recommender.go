@@ -0,0 +1,54 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+// ExternalRecommender computes recommendations in place of the built-in
+// histogram based recommender for the VPAs it is registered for.
+type ExternalRecommender interface {
+	// GetRecommendation returns the recommendation for the container of the
+	// given VPA whose usage is aggregated in state. The first container
+	// recommendation of the result is used, regardless of its container name.
+	GetRecommendation(ctx context.Context, vpaID VpaID, state *AggregateContainerState) (*vpa_types.RecommendedPodResources, error)
+}
+
+// RegisterExternalRecommender makes the recommender loop delegate computing
+// the recommendations of the given VPA to the given recommender. Registering
+// a nil recommender restores the built-in one. The registration is removed
+// when the VPA is deleted.
+func (cluster *clusterState) RegisterExternalRecommender(vpaID VpaID, recommender ExternalRecommender) {
+	cluster.externalRecommendersMutex.Lock()
+	defer cluster.externalRecommendersMutex.Unlock()
+	if recommender == nil {
+		delete(cluster.externalRecommenders, vpaID)
+		return
+	}
+	cluster.externalRecommenders[vpaID] = recommender
+}
+
+// GetExternalRecommender returns the external recommender registered for the
+// given VPA, or nil if the built-in recommender should be used.
+func (cluster *clusterState) GetExternalRecommender(vpaID VpaID) ExternalRecommender {
+	cluster.externalRecommendersMutex.RLock()
+	defer cluster.externalRecommendersMutex.RUnlock()
+	return cluster.externalRecommenders[vpaID]
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxGCAgeIntervals is the number of GC intervals after which the cluster
+// state is unhealthy if the aggregations weren't garbage collected.
+const maxGCAgeIntervals = 2
+
+// HealthStatus summarizes the internal health of the cluster state.
+type HealthStatus struct {
+	// Time since the aggregations were last garbage collected.
+	GCAge time.Duration
+	// Interval between garbage collections the GC age is compared to.
+	GCInterval time.Duration
+	// Number of VPAs whose recommendation wasn't recorded for longer than
+	// RecommendationMissingMaxDuration.
+	StaleRecommendations int
+	// Number of aggregations not linked to any VPA.
+	OrphanedAggregations int
+	// Estimated size of the histograms of all aggregations.
+	HistogramMemoryBytes int64
+}
+
+// Err returns an error describing the problem if the cluster state is
+// unhealthy, nil otherwise. Only the GC age is bounded, by maxGCAgeIntervals
+// GC intervals; the other fields are informational.
+func (s HealthStatus) Err() error {
+	if s.GCInterval > 0 && s.GCAge > maxGCAgeIntervals*s.GCInterval {
+		return fmt.Errorf("aggregations not garbage collected for %v, more than %d times the GC interval %v", s.GCAge, maxGCAgeIntervals, s.GCInterval)
+	}
+	return nil
+}
+
+// HealthCheck returns a summary of the internal health of the cluster state.
+func (cluster *clusterState) HealthCheck() HealthStatus {
+	now := time.Now()
+	status := HealthStatus{
+		GCAge:                now.Sub(cluster.lastAggregateContainerStateGC),
+		GCInterval:           cluster.gcInterval,
+		HistogramMemoryBytes: cluster.TotalAggregationMemoryBytes(),
+	}
+	for _, vpa := range cluster.vpas {
+		lastRecommended := vpa.Created
+		if vpa.RecommendationTimestamp != nil {
+			lastRecommended = *vpa.RecommendationTimestamp
+		}
+		if now.Sub(lastRecommended) > RecommendationMissingMaxDuration {
+			status.StaleRecommendations++
+		}
+	}
+	cluster.ForEachAggregation(func(key AggregateStateKey, aggregation *AggregateContainerState) bool {
+		unlock := cluster.aggregateStates.lockSamples(key)
+		if !aggregation.IsUnderVPA {
+			status.OrphanedAggregations++
+		}
+		unlock()
+		return true
+	})
+	return status
+}
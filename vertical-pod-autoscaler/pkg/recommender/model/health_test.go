@@ -0,0 +1,65 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestHealthCheck(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	// The aggregations were never garbage collected.
+	assert.Error(t, cluster.HealthCheck().Err())
+
+	cluster.ForceGC(context.Background(), testControllerFetcher)
+	status := cluster.HealthCheck()
+	assert.NoError(t, status.Err())
+	assert.Less(t, status.GCAge, testGcPeriod)
+	assert.Equal(t, testGcPeriod, status.GCInterval)
+
+	cluster.lastAggregateContainerStateGC = time.Now().Add(-3 * testGcPeriod / 2)
+	assert.NoError(t, cluster.HealthCheck().Err())
+	cluster.lastAggregateContainerStateGC = time.Now().Add(-3 * testGcPeriod)
+	assert.Error(t, cluster.HealthCheck().Err())
+}
+
+func TestHealthCheckCounts(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	// The container of this pod doesn't match the VPA.
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, emptyLabels, apiv1.PodRunning))
+	_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID3, "container-1"}, testRequest)
+	assert.NoError(t, err)
+
+	status := cluster.HealthCheck()
+	assert.Equal(t, 1, status.OrphanedAggregations)
+	assert.Equal(t, 2*GetAggregationsConfig().CPUHistogramOptions.NumBuckets()*bytesPerHistogramBucket+
+		2*GetAggregationsConfig().MemoryHistogramOptions.NumBuckets()*bytesPerHistogramBucket, int(status.HistogramMemoryBytes))
+	// The VPA was created long ago and never got a recommendation.
+	assert.Equal(t, 1, status.StaleRecommendations)
+
+	now := time.Now()
+	vpa.RecommendationTimestamp = &now
+	assert.Equal(t, 0, cluster.HealthCheck().StaleRecommendations)
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+// The binary format produced by MarshalHistogram is:
+//
+//	magic             4 bytes, histogramFormatMagic
+//	version           uvarint
+//	firstSampleStart  time
+//	lastSampleStart   time
+//	totalSamplesCount varint
+//	cpuHistogram      histogram
+//	memoryHistogram   histogram
+//
+// where a time is a single byte (0 for the zero time, 1 otherwise) followed by
+// the number of nanoseconds since the Unix epoch as a varint if it is not zero,
+// and a histogram is:
+//
+//	referenceTimestamp time
+//	totalWeight        8 bytes, little endian IEEE 754 float64
+//	bucketCount        uvarint
+//	buckets            bucketCount pairs of uvarints (index, weight), sorted by index
+//
+// The format only depends on the fields listed above, not on the layout of Go
+// structs. Any change to it requires bumping histogramFormatVersion and
+// keeping a decoder for the older versions.
+const (
+	histogramFormatMagic = "VPAH"
+	// histogramFormatVersion is the version written by MarshalHistogram.
+	histogramFormatVersion = 1
+)
+
+// MarshalHistogram serializes the CPU and memory histograms of the
+// AggregateContainerState together with the sample statistics into a
+// versioned binary format.
+func (a *AggregateContainerState) MarshalHistogram() ([]byte, error) {
+	cpu, err := a.AggregateCPUUsage.SaveToChekpoint()
+	if err != nil {
+		return nil, err
+	}
+	memory, err := a.AggregateMemoryPeaks.SaveToChekpoint()
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(histogramFormatMagic)
+	data = binary.AppendUvarint(data, histogramFormatVersion)
+	data = appendTime(data, a.FirstSampleStart)
+	data = appendTime(data, a.LastSampleStart)
+	data = binary.AppendVarint(data, int64(a.TotalSamplesCount))
+	data = appendHistogramCheckpoint(data, cpu)
+	data = appendHistogramCheckpoint(data, memory)
+	return data, nil
+}
+
+// UnmarshalHistogram loads the data serialized by MarshalHistogram into the
+// AggregateContainerState. Data written by any older version of the format is
+// accepted. Like LoadFromCheckpoint, it should be called on an empty state.
+func (a *AggregateContainerState) UnmarshalHistogram(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(histogramFormatMagic)) {
+		return fmt.Errorf("not a serialized histogram")
+	}
+	r := bytes.NewReader(data[len(histogramFormatMagic):])
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("cannot read histogram format version: %v", err)
+	}
+	switch version {
+	case 1:
+		err = a.unmarshalHistogramV1(r)
+	default:
+		return fmt.Errorf("unsupported histogram format version %d", version)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read histogram format version %d: %v", version, err)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d unexpected trailing bytes in serialized histogram", r.Len())
+	}
+	return nil
+}
+
+func (a *AggregateContainerState) unmarshalHistogramV1(r *bytes.Reader) error {
+	firstSampleStart, err := readTime(r)
+	if err != nil {
+		return err
+	}
+	lastSampleStart, err := readTime(r)
+	if err != nil {
+		return err
+	}
+	totalSamplesCount, err := binary.ReadVarint(r)
+	if err != nil {
+		return err
+	}
+	cpu, err := readHistogramCheckpoint(r)
+	if err != nil {
+		return err
+	}
+	memory, err := readHistogramCheckpoint(r)
+	if err != nil {
+		return err
+	}
+	if err := a.AggregateCPUUsage.LoadFromCheckpoint(cpu); err != nil {
+		return err
+	}
+	if err := a.AggregateMemoryPeaks.LoadFromCheckpoint(memory); err != nil {
+		return err
+	}
+	a.FirstSampleStart = firstSampleStart
+	a.LastSampleStart = lastSampleStart
+	a.TotalSamplesCount = int(totalSamplesCount)
+	return nil
+}
+
+func appendTime(data []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return append(data, 0)
+	}
+	return binary.AppendVarint(append(data, 1), t.UnixNano())
+}
+
+func readTime(r *bytes.Reader) (time.Time, error) {
+	isSet, err := r.ReadByte()
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch isSet {
+	case 0:
+		return time.Time{}, nil
+	case 1:
+		nanos, err := binary.ReadVarint(r)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, nanos), nil
+	default:
+		return time.Time{}, fmt.Errorf("invalid time marker %d", isSet)
+	}
+}
+
+func appendHistogramCheckpoint(data []byte, checkpoint *vpa_types.HistogramCheckpoint) []byte {
+	data = appendTime(data, checkpoint.ReferenceTimestamp.Time)
+	data = binary.LittleEndian.AppendUint64(data, math.Float64bits(checkpoint.TotalWeight))
+	buckets := make([]int, 0, len(checkpoint.BucketWeights))
+	for bucket := range checkpoint.BucketWeights {
+		buckets = append(buckets, bucket)
+	}
+	sort.Ints(buckets)
+	data = binary.AppendUvarint(data, uint64(len(buckets)))
+	for _, bucket := range buckets {
+		data = binary.AppendUvarint(data, uint64(bucket))
+		data = binary.AppendUvarint(data, uint64(checkpoint.BucketWeights[bucket]))
+	}
+	return data
+}
+
+func readHistogramCheckpoint(r *bytes.Reader) (*vpa_types.HistogramCheckpoint, error) {
+	referenceTimestamp, err := readTime(r)
+	if err != nil {
+		return nil, err
+	}
+	var totalWeightBits [8]byte
+	if _, err := io.ReadFull(r, totalWeightBits[:]); err != nil {
+		return nil, err
+	}
+	bucketCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	// Every bucket takes at least two bytes.
+	if bucketCount > uint64(r.Len()/2) {
+		return nil, fmt.Errorf("invalid bucket count %d", bucketCount)
+	}
+	checkpoint := &vpa_types.HistogramCheckpoint{
+		TotalWeight:   math.Float64frombits(binary.LittleEndian.Uint64(totalWeightBits[:])),
+		BucketWeights: make(map[int]uint32, bucketCount),
+	}
+	if !referenceTimestamp.IsZero() {
+		checkpoint.ReferenceTimestamp = metav1.NewTime(referenceTimestamp)
+	}
+	for i := uint64(0); i < bucketCount; i++ {
+		bucket, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		weight, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if bucket > math.MaxInt32 || weight > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid bucket %d with weight %d", bucket, weight)
+		}
+		checkpoint.BucketWeights[int(bucket)] = uint32(weight)
+	}
+	return checkpoint, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalHistogramRoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		samples int
+	}{
+		{name: "empty", samples: 0},
+		{name: "sparse", samples: 3},
+		{name: "dense", samples: 2000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := NewAggregateContainerState(DecayingHistogramType)
+			for i := 0; i < tc.samples; i++ {
+				timestamp := testTimestamp.Add(time.Duration(i) * time.Minute)
+				state.AddSample(&ContainerUsageSample{timestamp, CPUAmountFromCores(0.01 * float64(i+1)), ResourceCPU})
+				state.AddSample(&ContainerUsageSample{timestamp, MemoryAmountFromBytes(1e7 * float64(i+1)), ResourceMemory})
+			}
+			data, err := state.MarshalHistogram()
+			assert.NoError(t, err)
+
+			loaded := NewAggregateContainerState(DecayingHistogramType)
+			assert.NoError(t, loaded.UnmarshalHistogram(data))
+			assert.Equal(t, state.TotalSamplesCount, loaded.TotalSamplesCount)
+			assert.True(t, state.FirstSampleStart.Equal(loaded.FirstSampleStart))
+			assert.True(t, state.LastSampleStart.Equal(loaded.LastSampleStart))
+			for _, percentile := range []float64{0.0, 0.5, 0.9, 0.99, 1.0} {
+				assert.InDelta(t, state.AggregateCPUUsage.Percentile(percentile), loaded.AggregateCPUUsage.Percentile(percentile), 1e-9)
+				assert.InDelta(t, state.AggregateMemoryPeaks.Percentile(percentile), loaded.AggregateMemoryPeaks.Percentile(percentile), 1e-9)
+			}
+			// Serializing the loaded state gives the same data.
+			reserialized, err := loaded.MarshalHistogram()
+			assert.NoError(t, err)
+			assert.Equal(t, data, reserialized)
+		})
+	}
+}
+
+func TestUnmarshalHistogramInvalidData(t *testing.T) {
+	state := NewAggregateContainerState(DecayingHistogramType)
+	state.AddSample(&ContainerUsageSample{testTimestamp, CPUAmountFromCores(1.0), ResourceCPU})
+	data, err := state.MarshalHistogram()
+	assert.NoError(t, err)
+
+	unsupportedVersion := append([]byte(histogramFormatMagic), 99)
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "bad magic", data: append([]byte("XXXX"), data[len(histogramFormatMagic):]...)},
+		{name: "unsupported version", data: unsupportedVersion},
+		{name: "truncated", data: data[:len(data)-1]},
+		{name: "trailing bytes", data: append(append([]byte{}, data...), 0)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, NewAggregateContainerState(DecayingHistogramType).UnmarshalHistogram(tc.data))
+		})
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"sort"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/util"
+)
+
+// HistogramBucket is a single non-empty bucket of a HistogramView.
+type HistogramBucket struct {
+	// Start is the lower bound of the values falling into the bucket.
+	Start ResourceAmount
+	// End is the upper bound of the values falling into the bucket. The
+	// last bucket of a histogram has no upper bound, in which case End is
+	// equal to Start.
+	End ResourceAmount
+	// Weight is the cumulative weight of the samples in the bucket.
+	Weight float64
+}
+
+// HistogramView is a read-only snapshot of the CPU or memory histogram of a
+// container's aggregation. It doesn't share any state with the aggregation,
+// so it can be read without holding any locks.
+type HistogramView interface {
+	// Buckets returns the non-empty buckets of the histogram, sorted by
+	// their start.
+	Buckets() []HistogramBucket
+	// TotalWeight returns the total weight of the samples in the histogram.
+	TotalWeight() float64
+	// Percentile returns the value of the given percentile of the
+	// histogram, as computed by the recommender.
+	Percentile(percentile float64) ResourceAmount
+}
+
+type histogramView struct {
+	histogram   util.Histogram
+	toAmount    func(float64) ResourceAmount
+	buckets     []HistogramBucket
+	totalWeight float64
+}
+
+// newHistogramView returns a view of the histogram of the given resource in a
+// copy of the aggregation. The caller must hold the samples lock of the
+// aggregation.
+func newHistogramView(aggregation *AggregateContainerState, resource apiv1.ResourceName) (HistogramView, error) {
+	config := GetAggregationsConfig()
+	// Merging into an empty aggregation of the same type is a deep copy.
+	aggregationCopy := NewAggregateContainerState(config.HistogramType)
+	aggregationCopy.MergeContainerState(aggregation)
+	view := &histogramView{}
+	var options util.HistogramOptions
+	switch ResourceName(resource) {
+	case ResourceCPU:
+		view.histogram = aggregationCopy.AggregateCPUUsage
+		view.toAmount = CPUAmountFromCores
+		options = config.CPUHistogramOptions
+	case ResourceMemory:
+		view.histogram = aggregationCopy.AggregateMemoryPeaks
+		view.toAmount = MemoryAmountFromBytes
+		options = config.MemoryHistogramOptions
+	default:
+		return nil, fmt.Errorf("unsupported resource %q", resource)
+	}
+	if view.histogram.IsEmpty() {
+		return view, nil
+	}
+	checkpoint, err := view.histogram.SaveToChekpoint()
+	if err != nil {
+		return nil, err
+	}
+	// Checkpoint weights are normalized, scale them back so that they sum up
+	// to the total weight.
+	sum := 0.0
+	for _, weight := range checkpoint.BucketWeights {
+		sum += float64(weight)
+	}
+	view.totalWeight = checkpoint.TotalWeight
+	for bucket, weight := range checkpoint.BucketWeights {
+		start := options.GetBucketStart(bucket)
+		end := start
+		if bucket < options.NumBuckets()-1 {
+			end = options.GetBucketStart(bucket + 1)
+		}
+		view.buckets = append(view.buckets, HistogramBucket{
+			Start:  view.toAmount(start),
+			End:    view.toAmount(end),
+			Weight: float64(weight) * checkpoint.TotalWeight / sum,
+		})
+	}
+	sort.Slice(view.buckets, func(i, j int) bool { return view.buckets[i].Start < view.buckets[j].Start })
+	return view, nil
+}
+
+func (v *histogramView) Buckets() []HistogramBucket {
+	return append([]HistogramBucket(nil), v.buckets...)
+}
+
+func (v *histogramView) TotalWeight() float64 {
+	return v.totalWeight
+}
+
+func (v *histogramView) Percentile(percentile float64) ResourceAmount {
+	return v.toAmount(v.histogram.Percentile(percentile))
+}
+
+// GetHistogramForContainer returns a snapshot of the histogram of the given
+// resource in the aggregation of the container. Returns an error if the
+// container doesn't exist or the resource is neither CPU nor memory.
+func (cluster *clusterState) GetHistogramForContainer(containerID ContainerID, resource apiv1.ResourceName) (HistogramView, error) {
+	pod, podExists := cluster.pods[containerID.PodID]
+	if !podExists {
+		return nil, NewPodNotFoundError(containerID.PodID)
+	}
+	if _, containerExists := pod.Containers[containerID.ContainerName]; !containerExists {
+		return nil, NewContainerNotFoundError(containerID)
+	}
+	aggregationKey := cluster.MakeAggregateStateKey(pod, containerID.ContainerName)
+	aggregation, found := cluster.aggregateStates.get(aggregationKey)
+	if !found {
+		return newHistogramView(NewAggregateContainerState(GetAggregationsConfig().HistogramType), resource)
+	}
+	unlock := cluster.aggregateStates.lockSamples(aggregationKey)
+	defer unlock()
+	return newHistogramView(aggregation, resource)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestGetHistogramForContainer(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	_, err := cluster.GetHistogramForContainer(testContainerID, apiv1.ResourceCPU)
+	assert.Error(t, err)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+
+	view, err := cluster.GetHistogramForContainer(testContainerID, apiv1.ResourceCPU)
+	assert.NoError(t, err)
+	assert.Empty(t, view.Buckets())
+	assert.Equal(t, 0.0, view.TotalWeight())
+
+	for i := 0; i < 10; i++ {
+		ts := testTimestamp.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+			MeasureStart: ts, Usage: CPUAmountFromCores(0.1 * float64(i+1)), Resource: ResourceCPU}, testContainerID}))
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+			MeasureStart: ts, Usage: MemoryAmountFromBytes(1e8 * float64(i+1)), Resource: ResourceMemory}, testContainerID}))
+	}
+	aggregation := cluster.findOrCreateAggregateContainerState(testContainerID)
+	for resource, percentile := range map[apiv1.ResourceName]func(float64) ResourceAmount{
+		apiv1.ResourceCPU: func(p float64) ResourceAmount {
+			return CPUAmountFromCores(aggregation.AggregateCPUUsage.Percentile(p))
+		},
+		apiv1.ResourceMemory: func(p float64) ResourceAmount {
+			return MemoryAmountFromBytes(aggregation.AggregateMemoryPeaks.Percentile(p))
+		},
+	} {
+		view, err := cluster.GetHistogramForContainer(testContainerID, resource)
+		assert.NoError(t, err)
+		for _, p := range []float64{0.5, 0.9, 0.95} {
+			assert.Equal(t, percentile(p), view.Percentile(p), "resource %v percentile %v", resource, p)
+		}
+		buckets := view.Buckets()
+		assert.NotEmpty(t, buckets)
+		sum := 0.0
+		for i, bucket := range buckets {
+			assert.LessOrEqual(t, bucket.Start, bucket.End)
+			if i > 0 {
+				assert.Less(t, buckets[i-1].Start, bucket.Start)
+			}
+			sum += bucket.Weight
+		}
+		assert.InDelta(t, view.TotalWeight(), sum, 1e-6*view.TotalWeight())
+	}
+
+	// The view isn't affected by samples added after it was taken.
+	view, err = cluster.GetHistogramForContainer(testContainerID, apiv1.ResourceCPU)
+	assert.NoError(t, err)
+	median := view.Percentile(0.5)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+			MeasureStart: testTimestamp.Add(time.Hour + time.Duration(i)*time.Minute), Usage: CPUAmountFromCores(50), Resource: ResourceCPU}, testContainerID}))
+	}
+	assert.Equal(t, median, view.Percentile(0.5))
+	assert.Less(t, median, CPUAmountFromCores(aggregation.AggregateCPUUsage.Percentile(0.5)))
+
+	_, err = cluster.GetHistogramForContainer(testContainerID, apiv1.ResourceStorage)
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// AssertInvariants fails the test if the cluster state is internally
+// inconsistent:
+//   - every container of every pod has an aggregator. Its aggregation may be
+//     missing once expired, it is recreated by the next sample,
+//   - every aggregation without samples is reachable from at least one pod.
+//     Aggregations left behind by deleted or relabeled pods keep their samples
+//     as history, the empty ones are removed by the garbage collection, so
+//     this is only checked if afterGC is set,
+//   - the aggregations of every VPA are the ones stored for their keys,
+//   - the label set of every pod is present in the label set map.
+//
+// It is only available in tests, to be called after each operation of fuzz
+// and property-based tests.
+func (cluster *clusterState) AssertInvariants(t testing.TB, afterGC bool) {
+	t.Helper()
+	reachable := make(map[AggregateStateKey]bool)
+	for podID, pod := range cluster.pods {
+		if _, found := cluster.labelSetMap[pod.labelSetKey]; !found {
+			t.Errorf("label set %q of pod %s/%s missing from the label set map", pod.labelSetKey, podID.Namespace, podID.PodName)
+		}
+		for containerName, container := range pod.Containers {
+			if container.aggregator == nil {
+				t.Errorf("container %s/%s/%s has no aggregator", podID.Namespace, podID.PodName, containerName)
+				continue
+			}
+			reachable[cluster.MakeAggregateStateKey(pod, containerName)] = true
+		}
+	}
+	cluster.ForEachAggregation(func(key AggregateStateKey, aggregation *AggregateContainerState) bool {
+		if afterGC && !reachable[key] && aggregation.isEmpty() {
+			t.Errorf("empty aggregation %v is not reachable from any pod", key)
+		}
+		return true
+	})
+	for vpaID, vpa := range cluster.vpas {
+		for key, aggregation := range vpa.aggregateContainerStates {
+			stored, found := cluster.aggregateStates.get(key)
+			if !found || stored != aggregation {
+				t.Errorf("aggregation %v of VPA %s/%s is not the aggregation stored for its key", key, vpaID.Namespace, vpaID.VpaName)
+			}
+		}
+	}
+}
+
+// FuzzClusterStateOperations applies sequences of operations encoded in the
+// input to the cluster state and checks its invariants after each of them.
+// Each operation takes two bytes: the operation and its argument.
+func FuzzClusterStateOperations(f *testing.F) {
+	f.Add([]byte{0, 0, 1, 0, 3, 0, 5, 0, 2, 0})
+	f.Add([]byte{3, 1, 0, 1, 1, 1, 5, 1, 4, 1, 0, 2, 6, 0})
+	f.Add([]byte{0, 3, 1, 3, 1, 4, 0, 3, 2, 3, 3, 2, 6, 1})
+	labelSets := []labels.Set{testLabels, {"label-1": "other-value"}, emptyLabels}
+	selectors := []string{testSelectorStr, "label-1 = other-value", "label-2 = value-2"}
+	containerNames := []string{"container-1", "container-2"}
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		ctx := context.Background()
+		cluster := NewClusterState(testGcPeriod)
+		now := testTimestamp
+		for i := 0; i+1 < len(ops); i += 2 {
+			arg := int(ops[i+1])
+			podID := PodID{"namespace-1", fmt.Sprintf("pod-%d", arg%4)}
+			vpaID := VpaID{"namespace-1", fmt.Sprintf("vpa-%d", arg%3)}
+			containerID := ContainerID{podID, containerNames[arg%len(containerNames)]}
+			now = now.Add(time.Minute)
+			switch ops[i] % 7 {
+			case 0:
+				_ = cluster.AddOrUpdatePod(podID, labelSets[arg%len(labelSets)], apiv1.PodRunning)
+			case 1:
+				_, _ = cluster.AddOrUpdateContainer(containerID, testRequest)
+			case 2:
+				cluster.DeletePod(podID)
+			case 3:
+				addVpa(cluster, vpaID, testAnnotations, selectors[arg%len(selectors)], testTargetRef)
+			case 4:
+				_ = cluster.DeleteVpa(vpaID)
+			case 5:
+				_ = cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+					MeasureStart: now, Usage: 1.0, Resource: ResourceCPU}, containerID})
+			case 6:
+				cluster.garbageCollectAggregateCollectionStates(ctx, now.Add(time.Duration(arg)*24*time.Hour), testControllerFetcher)
+			}
+			cluster.AssertInvariants(t, false)
+			cluster.garbageCollectAggregateCollectionStates(ctx, now, testControllerFetcher)
+			cluster.AssertInvariants(t, true)
+		}
+	})
+}
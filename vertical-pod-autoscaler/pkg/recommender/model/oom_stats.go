@@ -0,0 +1,79 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"time"
+)
+
+// OOMHistorySize is the number of the most recent OOM events kept for each
+// aggregation to compute its OOM rate.
+const OOMHistorySize = 16
+
+// OOMRateWindow is the window over which GetContainerOOMStats computes the
+// OOM rate.
+const OOMRateWindow = 24 * time.Hour
+
+// GetContainerOOMStats returns the number of OOM events recorded in the
+// aggregation of the given container and their rate per hour over the last
+// OOMRateWindow. Both are zero if the aggregation doesn't exist. Returns an
+// error if the container doesn't exist.
+func (cluster *clusterState) GetContainerOOMStats(containerID ContainerID) (count int, rate float64, err error) {
+	pod, podExists := cluster.pods[containerID.PodID]
+	if !podExists {
+		return 0, 0, NewPodNotFoundError(containerID.PodID)
+	}
+	if _, containerExists := pod.Containers[containerID.ContainerName]; !containerExists {
+		return 0, 0, NewContainerNotFoundError(containerID)
+	}
+	aggregationKey := cluster.MakeAggregateStateKey(pod, containerID.ContainerName)
+	aggregation, found := cluster.aggregateStates.get(aggregationKey)
+	if !found {
+		return 0, 0, nil
+	}
+	unlock := cluster.aggregateStates.lockSamples(aggregationKey)
+	defer unlock()
+	return aggregation.GetOOMCount(), aggregation.GetOOMRate(OOMRateWindow, time.Now()), nil
+}
+
+// GetOOMCount returns the number of OOM events recorded in the aggregation.
+func (a *AggregateContainerState) GetOOMCount() int {
+	return a.oomCount
+}
+
+// GetOOMRate returns the number of OOM events per hour recorded in the
+// aggregation within the given window before now. Only the OOMHistorySize
+// most recent OOMs are taken into account.
+func (a *AggregateContainerState) GetOOMRate(window time.Duration, now time.Time) float64 {
+	if window <= 0 {
+		return 0
+	}
+	count := 0
+	for i := 0; i < a.oomCount && i < OOMHistorySize; i++ {
+		if a.oomTimes[i].After(now.Add(-window)) && !a.oomTimes[i].After(now) {
+			count++
+		}
+	}
+	return float64(count) / window.Hours()
+}
+
+// recordOOM records an OOM event in the aggregation. Only the OOMHistorySize
+// most recent OOM times are kept.
+func (a *AggregateContainerState) recordOOM(timestamp time.Time) {
+	a.oomTimes[a.oomCount%OOMHistorySize] = timestamp
+	a.oomCount++
+}
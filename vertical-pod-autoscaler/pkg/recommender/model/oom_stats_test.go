@@ -0,0 +1,72 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetContainerOOMStats(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+
+	// No OOMs.
+	count, rate, err := cluster.GetContainerOOMStats(testContainerID)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+	assert.Zero(t, rate)
+
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, cluster.RecordOOM(testContainerID, now.Add(-time.Duration(4-i)*time.Hour), 1000*mb))
+		count, _, err = cluster.GetContainerOOMStats(testContainerID)
+		assert.NoError(t, err)
+		assert.Equal(t, i, count)
+	}
+	_, rate, err = cluster.GetContainerOOMStats(testContainerID)
+	assert.NoError(t, err)
+	assert.InDelta(t, 3/OOMRateWindow.Hours(), rate, 1e-9)
+
+	_, _, err = cluster.GetContainerOOMStats(ContainerID{testPodID, "unknown"})
+	assert.Error(t, err)
+	_, _, err = cluster.GetContainerOOMStats(ContainerID{testPodID3, "container-1"})
+	assert.Error(t, err)
+}
+
+func TestAggregateContainerStateGetOOMRate(t *testing.T) {
+	aggregation := NewAggregateContainerState(DecayingHistogramType)
+	assert.Zero(t, aggregation.GetOOMRate(time.Hour, testTimestamp))
+
+	aggregation.recordOOM(testTimestamp.Add(-2 * time.Hour))
+	aggregation.recordOOM(testTimestamp.Add(-30 * time.Minute))
+	aggregation.recordOOM(testTimestamp.Add(-10 * time.Minute))
+	assert.Equal(t, 3, aggregation.GetOOMCount())
+	assert.InDelta(t, 2.0, aggregation.GetOOMRate(time.Hour, testTimestamp), 1e-9)
+	assert.InDelta(t, 0.75, aggregation.GetOOMRate(4*time.Hour, testTimestamp), 1e-9)
+	assert.Zero(t, aggregation.GetOOMRate(0, testTimestamp))
+
+	// Only the most recent OOMs are kept.
+	for i := 0; i < OOMHistorySize; i++ {
+		aggregation.recordOOM(testTimestamp.Add(-time.Minute))
+	}
+	assert.Equal(t, OOMHistorySize+3, aggregation.GetOOMCount())
+	assert.InDelta(t, float64(OOMHistorySize), aggregation.GetOOMRate(time.Hour, testTimestamp), 1e-9)
+}
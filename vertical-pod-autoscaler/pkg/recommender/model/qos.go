@@ -0,0 +1,106 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	// bestEffortHistoryLengthDivisor is the factor by which the history
+	// length of the aggregations of BestEffort pods is shortened.
+	bestEffortHistoryLengthDivisor = 2
+	// guaranteedHistoryLengthMultiplier is the factor by which the history
+	// length of the aggregations of Guaranteed pods is extended.
+	guaranteedHistoryLengthMultiplier = 2
+)
+
+// SetContainerLimit records the current limits of the container with the
+// given ID. Resources without a limit must be absent. The limits determine
+// the QoS class of the pod, see PodState.QoSClass.
+func (cluster *clusterState) SetContainerLimit(containerID ContainerID, limit Resources) error {
+	if err := cluster.startMutation(); err != nil {
+		return err
+	}
+	defer cluster.inFlightMutations.Done()
+	container := cluster.GetContainer(containerID)
+	if container == nil {
+		return NewContainerNotFoundError(containerID)
+	}
+	container.Limit = limit
+	return nil
+}
+
+// QoSClass returns the Kubernetes QoS class of the pod computed from the
+// CPU and memory requests and limits of its containers. The pod is
+// BestEffort if none of its containers has a request or a limit, Guaranteed
+// if all of them have limits equal to their requests, and Burstable
+// otherwise.
+func (pod *PodState) QoSClass() apiv1.PodQOSClass {
+	bestEffort, guaranteed := true, true
+	for _, container := range pod.Containers {
+		for _, resource := range []ResourceName{ResourceCPU, ResourceMemory} {
+			request, limit := container.Request[resource], container.Limit[resource]
+			if request > 0 || limit > 0 {
+				bestEffort = false
+			}
+			if limit <= 0 || request != limit {
+				guaranteed = false
+			}
+		}
+	}
+	switch {
+	case bestEffort:
+		return apiv1.PodQOSBestEffort
+	case guaranteed:
+		return apiv1.PodQOSGuaranteed
+	}
+	return apiv1.PodQOSBurstable
+}
+
+// qosHistoryLength returns the history length of aggregations of pods in the
+// given QoS class: shorter for BestEffort and longer for Guaranteed pods
+// than the given default.
+func qosHistoryLength(qosClass apiv1.PodQOSClass, historyLength time.Duration) time.Duration {
+	switch qosClass {
+	case apiv1.PodQOSBestEffort:
+		return historyLength / bestEffortHistoryLengthDivisor
+	case apiv1.PodQOSGuaranteed:
+		return historyLength * guaranteedHistoryLengthMultiplier
+	}
+	return historyLength
+}
+
+// getAggregationQoSClasses returns the QoS class of the pods contributing to
+// each aggregation with current pods. If the pods differ, the class with the
+// longest history length is kept.
+func (cluster *clusterState) getAggregationQoSClasses() map[AggregateStateKey]apiv1.PodQOSClass {
+	rank := map[apiv1.PodQOSClass]int{apiv1.PodQOSBestEffort: 0, apiv1.PodQOSBurstable: 1, apiv1.PodQOSGuaranteed: 2}
+	qosClasses := make(map[AggregateStateKey]apiv1.PodQOSClass)
+	for _, pod := range cluster.pods {
+		qosClass := pod.QoSClass()
+		for containerName := range pod.Containers {
+			key := cluster.MakeAggregateStateKey(pod, containerName)
+			if current, found := qosClasses[key]; !found || rank[qosClass] > rank[current] {
+				qosClasses[key] = qosClass
+			}
+		}
+	}
+	return qosClasses
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestPodStateQoSClass(t *testing.T) {
+	request := Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(1e9)}
+	testCases := []struct {
+		name     string
+		requests []Resources
+		limits   []Resources
+		expected apiv1.PodQOSClass
+	}{
+		{
+			name:     "no requests nor limits",
+			requests: []Resources{{}, nil},
+			limits:   []Resources{nil, {}},
+			expected: apiv1.PodQOSBestEffort,
+		},
+		{
+			name:     "limits equal to requests",
+			requests: []Resources{request, request},
+			limits:   []Resources{request, request},
+			expected: apiv1.PodQOSGuaranteed,
+		},
+		{
+			name:     "requests without limits",
+			requests: []Resources{request, request},
+			limits:   []Resources{nil, nil},
+			expected: apiv1.PodQOSBurstable,
+		},
+		{
+			name:     "limits above requests",
+			requests: []Resources{request, request},
+			limits:   []Resources{request, {ResourceCPU: CPUAmountFromCores(2), ResourceMemory: MemoryAmountFromBytes(1e9)}},
+			expected: apiv1.PodQOSBurstable,
+		},
+		{
+			name:     "only some containers with requests",
+			requests: []Resources{request, nil},
+			limits:   []Resources{request, nil},
+			expected: apiv1.PodQOSBurstable,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			pod := addTestPod(cluster)
+			for i, containerName := range []string{"container-1", "container-2"} {
+				containerID := ContainerID{testPodID, containerName}
+				_, err := cluster.AddOrUpdateContainer(containerID, tc.requests[i])
+				assert.NoError(t, err)
+				assert.NoError(t, cluster.SetContainerLimit(containerID, tc.limits[i]))
+			}
+			assert.Equal(t, tc.expected, pod.QoSClass())
+		})
+	}
+	assert.Error(t, NewClusterState(testGcPeriod).SetContainerLimit(testContainerID, Resources{}))
+}
+
+func TestClusterGCAggregateContainerStateQoSClass(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name                 string
+		request              Resources
+		limit                Resources
+		expectDeletedAfter5  bool
+		expectDeletedAfter10 bool
+	}{
+		{
+			name:                 "BestEffort",
+			expectDeletedAfter5:  true,
+			expectDeletedAfter10: true,
+		},
+		{
+			name:                 "Burstable",
+			request:              testRequest,
+			expectDeletedAfter10: true,
+		},
+		{
+			name:    "Guaranteed",
+			request: testRequest,
+			limit:   testRequest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			addTestVpa(cluster)
+			addTestPod(cluster)
+			_, err := cluster.AddOrUpdateContainer(testContainerID, tc.request)
+			assert.NoError(t, err)
+			assert.NoError(t, cluster.SetContainerLimit(testContainerID, tc.limit))
+			usageSample := makeTestUsageSample()
+			assert.NoError(t, cluster.AddSample(usageSample))
+
+			// The default history length is 8 days.
+			cluster.garbageCollectAggregateCollectionStates(ctx, usageSample.MeasureStart.Add(5*24*time.Hour), testControllerFetcher)
+			assert.Equal(t, tc.expectDeletedAfter5, len(cluster.aggregateStates.snapshot()) == 0)
+			cluster.garbageCollectAggregateCollectionStates(ctx, usageSample.MeasureStart.Add(10*24*time.Hour), testControllerFetcher)
+			assert.Equal(t, tc.expectDeletedAfter10, len(cluster.aggregateStates.snapshot()) == 0)
+		})
+	}
+}
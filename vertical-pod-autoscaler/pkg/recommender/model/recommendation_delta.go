@@ -0,0 +1,166 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_utils "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+// GetContainerRecommendationDelta returns the difference between the request
+// of the container and the target recommended for it by the VPA controlling
+// its pod, in millicores for CPU and bytes for memory. Positive values mean
+// the container is over-provisioned, negative values that it is
+// under-provisioned. Resources without a recommended target have a zero
+// delta. Returns an error if the container doesn't exist or there is no
+// recommendation for it.
+func (cluster *clusterState) GetContainerRecommendationDelta(containerID ContainerID) (cpuDelta int64, memoryDelta int64, err error) {
+	container := cluster.GetContainer(containerID)
+	if container == nil {
+		return 0, 0, NewContainerNotFoundError(containerID)
+	}
+	vpa := cluster.podToVpa[containerID.PodID]
+	if vpa == nil {
+		return 0, 0, NewPodNotControlledError(containerID.PodID)
+	}
+	containerRecommendation := vpa_utils.GetRecommendationForContainer(containerID.ContainerName, vpa.Recommendation)
+	if containerRecommendation == nil {
+		return 0, 0, fmt.Errorf("no recommendation for container %s/%s/%s", containerID.Namespace, containerID.PodName, containerID.ContainerName)
+	}
+	if target, found := containerRecommendation.Target[apiv1.ResourceCPU]; found {
+		cpuDelta = int64(container.Request[ResourceCPU]) - target.MilliValue()
+	}
+	if target, found := containerRecommendation.Target[apiv1.ResourceMemory]; found {
+		memoryDelta = int64(container.Request[ResourceMemory]) - target.Value()
+	}
+	return cpuDelta, memoryDelta, nil
+}
+
+// SortContainersByRecommendationDelta sorts the containers in place so that
+// the ones whose requests differ most from their recommendations come first,
+// to prioritize their updates. Containers are ordered by the absolute CPU
+// delta, then by the absolute memory delta, both descending. Containers
+// without a delta, see GetContainerRecommendationDelta, come last.
+func (cluster *clusterState) SortContainersByRecommendationDelta(containerIDs []ContainerID) {
+	type delta struct {
+		cpu, memory int64
+		found       bool
+	}
+	deltas := make(map[ContainerID]delta, len(containerIDs))
+	for _, containerID := range containerIDs {
+		cpuDelta, memoryDelta, err := cluster.GetContainerRecommendationDelta(containerID)
+		deltas[containerID] = delta{cpu: absInt64(cpuDelta), memory: absInt64(memoryDelta), found: err == nil}
+	}
+	slices.SortStableFunc(containerIDs, func(a, b ContainerID) int {
+		deltaA, deltaB := deltas[a], deltas[b]
+		if deltaA.found != deltaB.found {
+			if deltaA.found {
+				return -1
+			}
+			return 1
+		}
+		if c := cmp.Compare(deltaB.cpu, deltaA.cpu); c != 0 {
+			return c
+		}
+		return cmp.Compare(deltaB.memory, deltaA.memory)
+	})
+}
+
+// ContainerUpdateCandidate describes a container whose request diverges from
+// the target recommended for it.
+type ContainerUpdateCandidate struct {
+	ContainerID ContainerID
+	// VpaID is the ID of the VPA controlling the pod of the container.
+	VpaID VpaID
+	// Request is the current CPU and memory request of the container.
+	Request Resources
+	// Recommendation is the recommended CPU and memory target.
+	Recommendation Resources
+	// Delta is the largest relative divergence of the recommended target
+	// from the request, |recommendation - request| / request, over CPU and
+	// memory.
+	Delta float64
+}
+
+// GetContainersNeedingUpdate returns the containers of pods controlled by VPAs
+// in the Auto update mode whose recommended target diverges from their
+// request by more than the tolerance, relative to the request, for CPU or
+// memory. The candidates are sorted by descending Delta, ties by the
+// container ID. Resources without a request or a recommended target are
+// skipped, as are dry-run VPAs.
+func (cluster *clusterState) GetContainersNeedingUpdate(tolerance float64) []ContainerUpdateCandidate {
+	candidates := []ContainerUpdateCandidate{}
+	for _, vpaID := range cluster.FilterVPAsByUpdateMode(vpa_types.UpdateModeAuto) {
+		vpa := cluster.vpas[vpaID]
+		if vpa.DryRun || !vpa.HasRecommendation() {
+			continue
+		}
+		for _, podID := range cluster.GetMatchingPods(vpa) {
+			for containerName, container := range cluster.pods[podID].Containers {
+				containerRecommendation := vpa_utils.GetRecommendationForContainer(containerName, vpa.Recommendation)
+				if containerRecommendation == nil {
+					continue
+				}
+				candidate := ContainerUpdateCandidate{
+					ContainerID:    ContainerID{PodID: podID, ContainerName: containerName},
+					VpaID:          vpaID,
+					Request:        Resources{ResourceCPU: container.Request[ResourceCPU], ResourceMemory: container.Request[ResourceMemory]},
+					Recommendation: Resources{},
+				}
+				if target, found := containerRecommendation.Target[apiv1.ResourceCPU]; found {
+					candidate.Recommendation[ResourceCPU] = ResourceAmount(target.MilliValue())
+				}
+				if target, found := containerRecommendation.Target[apiv1.ResourceMemory]; found {
+					candidate.Recommendation[ResourceMemory] = ResourceAmount(target.Value())
+				}
+				for resource, recommendation := range candidate.Recommendation {
+					request := candidate.Request[resource]
+					if request <= 0 {
+						continue
+					}
+					delta := math.Abs(float64(recommendation-request)) / float64(request)
+					candidate.Delta = max(candidate.Delta, delta)
+				}
+				if candidate.Delta > tolerance {
+					candidates = append(candidates, candidate)
+				}
+			}
+		}
+	}
+	slices.SortFunc(candidates, func(a, b ContainerUpdateCandidate) int {
+		return cmp.Or(
+			cmp.Compare(b.Delta, a.Delta),
+			cmp.Compare(a.ContainerID.Namespace, b.ContainerID.Namespace),
+			cmp.Compare(a.ContainerID.PodName, b.ContainerID.PodName),
+			cmp.Compare(a.ContainerID.ContainerName, b.ContainerID.ContainerName))
+	})
+	return candidates
+}
+
+func absInt64(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
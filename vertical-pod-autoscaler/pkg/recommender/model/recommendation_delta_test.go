@@ -0,0 +1,199 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestGetContainerRecommendationDelta(t *testing.T) {
+	request := Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(1e9)}
+	testCases := []struct {
+		name                string
+		target              apiv1.ResourceList
+		expectedCPUDelta    int64
+		expectedMemoryDelta int64
+	}{
+		{
+			name:                "over-provisioned",
+			target:              test.Resources("500m", "4e8"),
+			expectedCPUDelta:    500,
+			expectedMemoryDelta: 6e8,
+		},
+		{
+			name:                "under-provisioned",
+			target:              test.Resources("1500m", "2e9"),
+			expectedCPUDelta:    -500,
+			expectedMemoryDelta: -1e9,
+		},
+		{
+			name:                "CPU over-provisioned, memory under-provisioned",
+			target:              test.Resources("250m", "3e9"),
+			expectedCPUDelta:    750,
+			expectedMemoryDelta: -2e9,
+		},
+		{
+			name:                "CPU under-provisioned, memory over-provisioned",
+			target:              test.Resources("2", "1e8"),
+			expectedCPUDelta:    -1000,
+			expectedMemoryDelta: 9e8,
+		},
+		{
+			name:   "matching",
+			target: test.Resources("1", "1e9"),
+		},
+		{
+			name:             "memory not recommended",
+			target:           apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")},
+			expectedCPUDelta: 900,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			vpa := addTestVpa(cluster)
+			addTestPod(cluster)
+			_, err := cluster.AddOrUpdateContainer(testContainerID, request)
+			assert.NoError(t, err)
+			vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).Get()
+			vpa.Recommendation.ContainerRecommendations[0].Target = tc.target
+
+			cpuDelta, memoryDelta, err := cluster.GetContainerRecommendationDelta(testContainerID)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCPUDelta, cpuDelta)
+			assert.Equal(t, tc.expectedMemoryDelta, memoryDelta)
+		})
+	}
+}
+
+func TestGetContainerRecommendationDeltaErrors(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	_, _, err := cluster.GetContainerRecommendationDelta(testContainerID)
+	assert.Error(t, err, "missing container")
+
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	_, _, err = cluster.GetContainerRecommendationDelta(testContainerID)
+	assert.ErrorAs(t, err, &PodNotControlledError{}, "no VPA")
+
+	vpa := addTestVpa(cluster)
+	_, _, err = cluster.GetContainerRecommendationDelta(testContainerID)
+	assert.Error(t, err, "no recommendation")
+
+	vpa.Recommendation = test.Recommendation().WithContainer("other-container").WithTarget("1", "1e9").Get()
+	_, _, err = cluster.GetContainerRecommendationDelta(testContainerID)
+	assert.Error(t, err, "no recommendation for the container")
+}
+
+func TestSortContainersByRecommendationDelta(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	requests := map[string]Resources{
+		"small-cpu-delta":      {ResourceCPU: CPUAmountFromCores(1.1), ResourceMemory: MemoryAmountFromBytes(1e9)},
+		"large-cpu-delta":      {ResourceCPU: CPUAmountFromCores(0.1), ResourceMemory: MemoryAmountFromBytes(1e9)},
+		"large-memory-delta":   {ResourceCPU: CPUAmountFromCores(1.1), ResourceMemory: MemoryAmountFromBytes(5e9)},
+		"not-recommended":      {ResourceCPU: CPUAmountFromCores(10), ResourceMemory: MemoryAmountFromBytes(1e9)},
+		"negative-large-delta": {ResourceCPU: CPUAmountFromCores(3), ResourceMemory: MemoryAmountFromBytes(1e9)},
+	}
+	vpa.Recommendation = &vpa_types.RecommendedPodResources{}
+	var containerIDs []ContainerID
+	for _, name := range []string{"not-recommended", "small-cpu-delta", "large-memory-delta", "large-cpu-delta", "negative-large-delta"} {
+		containerID := ContainerID{PodID: testPodID, ContainerName: name}
+		_, err := cluster.AddOrUpdateContainer(containerID, requests[name])
+		assert.NoError(t, err)
+		containerIDs = append(containerIDs, containerID)
+		if name != "not-recommended" {
+			vpa.Recommendation.ContainerRecommendations = append(vpa.Recommendation.ContainerRecommendations,
+				test.Recommendation().WithContainer(name).WithTarget("1", "1e9").GetContainerResources())
+		}
+	}
+
+	cluster.SortContainersByRecommendationDelta(containerIDs)
+	var names []string
+	for _, containerID := range containerIDs {
+		names = append(names, containerID.ContainerName)
+	}
+	assert.Equal(t, []string{"negative-large-delta", "large-cpu-delta", "large-memory-delta", "small-cpu-delta", "not-recommended"}, names)
+}
+
+func TestGetContainersNeedingUpdate(t *testing.T) {
+	request := Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(1e9)}
+	otherVpaID := VpaID{"namespace-1", "vpa-2"}
+	otherPodID := PodID{"namespace-1", "pod-2"}
+	setUp := func(t *testing.T, otherMode vpa_types.UpdateMode) *clusterState {
+		cluster := NewClusterState(testGcPeriod)
+		vpa := addTestVpa(cluster)
+		addTestPod(cluster)
+		_, err := cluster.AddOrUpdateContainer(testContainerID, request)
+		assert.NoError(t, err)
+		vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("1200m", "9e8").Get()
+
+		otherVpa := addVpa(cluster, otherVpaID, testAnnotations, "label-2 = value-2", testTargetRef)
+		otherVpa.SetUpdateMode(&vpa_types.PodUpdatePolicy{UpdateMode: &otherMode})
+		assert.NoError(t, cluster.AddOrUpdatePod(otherPodID, map[string]string{"label-2": "value-2"}, apiv1.PodRunning))
+		_, err = cluster.AddOrUpdateContainer(ContainerID{otherPodID, testContainerID.ContainerName}, request)
+		assert.NoError(t, err)
+		otherVpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("1", "5e8").Get()
+		return cluster
+	}
+
+	cluster := setUp(t, vpa_types.UpdateModeAuto)
+	candidates := cluster.GetContainersNeedingUpdate(0.1)
+	if assert.Len(t, candidates, 2) {
+		// Memory of the other container diverges by half of the request.
+		assert.Equal(t, ContainerID{otherPodID, testContainerID.ContainerName}, candidates[0].ContainerID)
+		assert.Equal(t, otherVpaID, candidates[0].VpaID)
+		assert.InDelta(t, 0.5, candidates[0].Delta, 1e-9)
+		assert.Equal(t, request, candidates[0].Request)
+		assert.Equal(t, Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(5e8)}, candidates[0].Recommendation)
+		// CPU of the test container diverges by a fifth of the request.
+		assert.Equal(t, testContainerID, candidates[1].ContainerID)
+		assert.Equal(t, testVpaID, candidates[1].VpaID)
+		assert.InDelta(t, 0.2, candidates[1].Delta, 1e-9)
+	}
+
+	candidates = cluster.GetContainersNeedingUpdate(0.3)
+	if assert.Len(t, candidates, 1) {
+		assert.Equal(t, otherVpaID, candidates[0].VpaID)
+	}
+	assert.Empty(t, cluster.GetContainersNeedingUpdate(0.5))
+
+	for _, mode := range []vpa_types.UpdateMode{vpa_types.UpdateModeOff, vpa_types.UpdateModeInitial, vpa_types.UpdateModeRecreate} {
+		t.Run(string(mode), func(t *testing.T) {
+			candidates := setUp(t, mode).GetContainersNeedingUpdate(0.1)
+			if assert.Len(t, candidates, 1) {
+				assert.Equal(t, testContainerID, candidates[0].ContainerID)
+			}
+		})
+	}
+
+	// Containers of dry-run VPAs never need an update.
+	cluster = setUp(t, vpa_types.UpdateModeAuto)
+	cluster.vpas[otherVpaID].DryRun = true
+	candidates = cluster.GetContainersNeedingUpdate(0.1)
+	if assert.Len(t, candidates, 1) {
+		assert.Equal(t, testContainerID, candidates[0].ContainerID)
+	}
+}
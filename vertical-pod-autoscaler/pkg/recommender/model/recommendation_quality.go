@@ -0,0 +1,152 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"math"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/util"
+)
+
+// RecommendationQuality describes how trustworthy the recommendation of a VPA is.
+type RecommendationQuality int
+
+const (
+	// Insufficient means that the VPA has no recommendation or some of its
+	// containers have no usage samples.
+	Insufficient RecommendationQuality = iota
+	// Provisional means that the recommendation is based on few samples,
+	// collected over a short time or varying a lot.
+	Provisional
+	// Stable means that the recommendation is based on enough samples which
+	// don't vary a lot.
+	Stable
+	// HighConfidence means that the recommendation is stable, based on plenty
+	// of samples and close to the current requests of the containers.
+	HighConfidence
+)
+
+const (
+	// stableConfidenceThreshold is the lowest RecommendationConfidence of a
+	// Stable recommendation.
+	stableConfidenceThreshold = 0.5
+	// maxStableUsageSpread is the highest ratio of the 90th to the 50th
+	// percentile of the CPU usage and memory peaks of a Stable recommendation.
+	maxStableUsageSpread = 2.0
+	// maxHighConfidenceRequestDeviation is the highest relative difference
+	// between the current requests and the target of a HighConfidence
+	// recommendation.
+	maxHighConfidenceRequestDeviation = 0.1
+)
+
+func (q RecommendationQuality) String() string {
+	switch q {
+	case Insufficient:
+		return "Insufficient"
+	case Provisional:
+		return "Provisional"
+	case Stable:
+		return "Stable"
+	case HighConfidence:
+		return "HighConfidence"
+	}
+	return "Unknown"
+}
+
+// GetRecommendationQuality returns the quality tier of the recommendation of
+// the VPA with the given ID. It is based on the number and age of the usage
+// samples (see AggregateContainerState.RecommendationConfidence), the spread
+// of the usage and the difference between the current requests of the
+// matching pods and the recommended target.
+func (cluster *clusterState) GetRecommendationQuality(vpaID VpaID) (RecommendationQuality, error) {
+	vpa, vpaExists := cluster.vpas[vpaID]
+	if !vpaExists {
+		return Insufficient, NewVpaNotFoundError(vpaID)
+	}
+	if vpa.Recommendation == nil || len(vpa.Recommendation.ContainerRecommendations) == 0 {
+		return Insufficient, nil
+	}
+	aggregations := vpa.AggregateStateByContainerName()
+	if len(aggregations) == 0 {
+		return Insufficient, nil
+	}
+	confidence := 1.0
+	for _, aggregation := range aggregations {
+		if aggregation.TotalSamplesCount == 0 {
+			return Insufficient, nil
+		}
+		if usageSpread(aggregation.AggregateCPUUsage) > maxStableUsageSpread ||
+			usageSpread(aggregation.AggregateMemoryPeaks) > maxStableUsageSpread {
+			return Provisional, nil
+		}
+		confidence = math.Min(confidence, aggregation.RecommendationConfidence())
+	}
+	if confidence < stableConfidenceThreshold {
+		return Provisional, nil
+	}
+	if confidence < HighConfidenceThreshold || !cluster.requestsCloseToTarget(vpa) {
+		return Stable, nil
+	}
+	return HighConfidence, nil
+}
+
+// usageSpread returns the ratio of the 90th to the 50th percentile of the
+// histogram, or 1 if the histogram is empty.
+func usageSpread(histogram util.Histogram) float64 {
+	median := histogram.Percentile(0.5)
+	if median <= 0 {
+		return 1
+	}
+	return histogram.Percentile(0.9) / median
+}
+
+// requestsCloseToTarget returns true if the CPU and memory requests of all
+// containers of the pods matching the VPA differ from the recommended target
+// by at most maxHighConfidenceRequestDeviation.
+func (cluster *clusterState) requestsCloseToTarget(vpa *Vpa) bool {
+	targets := make(map[string]apiv1.ResourceList)
+	for _, containerRecommendation := range vpa.Recommendation.ContainerRecommendations {
+		targets[containerRecommendation.ContainerName] = containerRecommendation.Target
+	}
+	for _, podID := range cluster.GetMatchingPods(vpa) {
+		for containerName, container := range cluster.pods[podID].Containers {
+			target, found := targets[containerName]
+			if !found {
+				continue
+			}
+			if !isCloseToTarget(CoresFromCPUAmount(container.Request[ResourceCPU]), target, apiv1.ResourceCPU) ||
+				!isCloseToTarget(BytesFromMemoryAmount(container.Request[ResourceMemory]), target, apiv1.ResourceMemory) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isCloseToTarget returns true if the request, in cores for CPU and bytes for
+// memory, differs from the target of the resource by at most
+// maxHighConfidenceRequestDeviation. Resources without a target are ignored.
+func isCloseToTarget(request float64, target apiv1.ResourceList, resource apiv1.ResourceName) bool {
+	quantity, found := target[resource]
+	if !found || quantity.IsZero() {
+		return true
+	}
+	targetValue := quantity.AsApproximateFloat64()
+	return math.Abs(request-targetValue)/targetValue <= maxHighConfidenceRequestDeviation
+}
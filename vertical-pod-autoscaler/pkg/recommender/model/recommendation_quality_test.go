@@ -0,0 +1,94 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestGetRecommendationQuality(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	request := Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(1e9)}
+	_, err := cluster.AddOrUpdateContainer(testContainerID, request)
+	assert.NoError(t, err)
+	samples := 0
+	addSamplesUpTo := func(count int) {
+		for ; samples < count; samples++ {
+			ts := testTimestamp.Add(time.Duration(samples) * time.Minute)
+			for _, sample := range []ContainerUsageSample{
+				{MeasureStart: ts, Usage: CPUAmountFromCores(1), Resource: ResourceCPU},
+				{MeasureStart: ts, Usage: MemoryAmountFromBytes(1e9), Resource: ResourceMemory},
+			} {
+				assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{sample, testContainerID}))
+			}
+		}
+	}
+	assertQuality := func(expected RecommendationQuality) {
+		t.Helper()
+		quality, err := cluster.GetRecommendationQuality(testVpaID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, quality, "got %v after %d samples", quality, samples)
+	}
+
+	// No recommendation yet.
+	assertQuality(Insufficient)
+	vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("1", "1e9").Get()
+	// No samples yet.
+	assertQuality(Insufficient)
+	addSamplesUpTo(10)
+	assertQuality(Provisional)
+	addSamplesUpTo(1000)
+	assertQuality(Stable)
+	addSamplesUpTo(4000)
+	assertQuality(HighConfidence)
+
+	// Requests far from the target are not trusted.
+	_, err = cluster.AddOrUpdateContainer(testContainerID, Resources{ResourceCPU: CPUAmountFromCores(2), ResourceMemory: MemoryAmountFromBytes(1e9)})
+	assert.NoError(t, err)
+	assertQuality(Stable)
+
+	_, err = cluster.GetRecommendationQuality(VpaID{"namespace-1", "unknown"})
+	assert.Error(t, err)
+}
+
+func TestGetRecommendationQualityVaryingUsage(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("1", "1e9").Get()
+	for i := 0; i < 4000; i++ {
+		usage := 0.1
+		if i%2 == 0 {
+			usage = 5
+		}
+		sample := makeTestUsageSample()
+		sample.MeasureStart = testTimestamp.Add(time.Duration(i) * time.Minute)
+		sample.Usage = CPUAmountFromCores(usage)
+		assert.NoError(t, cluster.AddSample(sample))
+	}
+	quality, err := cluster.GetRecommendationQuality(testVpaID)
+	assert.NoError(t, err)
+	assert.Equal(t, Provisional, quality)
+}
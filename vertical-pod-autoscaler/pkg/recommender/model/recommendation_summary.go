@@ -0,0 +1,77 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	vpa_utils "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+// RecommendationSummary summarizes the recommendations of all VPAs in the
+// cluster.
+type RecommendationSummary struct {
+	TotalVPAs                 int
+	VPAsWithRecommendation    int
+	VPAsWithoutRecommendation int
+	// Number of VPAs with a recommendation that wasn't recorded for longer
+	// than RecommendationMissingMaxDuration.
+	VPAsWithStaleRecommendation int
+	// Sum of the CPU requests minus the recommended CPU targets over all
+	// containers of all pods matching a VPA with a recommendation. Negative
+	// when the containers are underprovisioned.
+	TotalCPUSavingsMillicores int64
+	// Sum of the memory requests minus the recommended memory targets,
+	// computed like TotalCPUSavingsMillicores.
+	TotalMemorySavingsBytes int64
+}
+
+// GetRecommendationSummary returns a fleet-wide summary of the
+// recommendations. Containers without a recommendation, and resources
+// without a request or a recommended target, don't contribute to the
+// savings.
+func (cluster *clusterState) GetRecommendationSummary() RecommendationSummary {
+	now := time.Now()
+	summary := RecommendationSummary{TotalVPAs: len(cluster.vpas)}
+	for _, vpa := range cluster.vpas {
+		if !vpa.HasRecommendation() {
+			summary.VPAsWithoutRecommendation++
+			continue
+		}
+		summary.VPAsWithRecommendation++
+		if !cluster.IsRecommendationFresh(vpa.ID, RecommendationMissingMaxDuration, now) {
+			summary.VPAsWithStaleRecommendation++
+		}
+		for _, podID := range cluster.GetMatchingPods(vpa) {
+			for containerName, container := range cluster.pods[podID].Containers {
+				containerRecommendation := vpa_utils.GetRecommendationForContainer(containerName, vpa.Recommendation)
+				if containerRecommendation == nil {
+					continue
+				}
+				if target, found := containerRecommendation.Target[apiv1.ResourceCPU]; found && container.Request[ResourceCPU] > 0 {
+					summary.TotalCPUSavingsMillicores += int64(container.Request[ResourceCPU]) - target.MilliValue()
+				}
+				if target, found := containerRecommendation.Target[apiv1.ResourceMemory]; found && container.Request[ResourceMemory] > 0 {
+					summary.TotalMemorySavingsBytes += int64(container.Request[ResourceMemory]) - target.Value()
+				}
+			}
+		}
+	}
+	return summary
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestGetRecommendationSummary(t *testing.T) {
+	request := Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(1e9)}
+	testCases := []struct {
+		name                  string
+		target                apiv1.ResourceList
+		expectedCPUSavings    int64
+		expectedMemorySavings int64
+	}{
+		{
+			name:                  "overprovisioned",
+			target:                test.Resources("400m", "6e8"),
+			expectedCPUSavings:    2 * 600,
+			expectedMemorySavings: 2 * 4e8,
+		},
+		{
+			name:                  "underprovisioned",
+			target:                test.Resources("1500m", "2e9"),
+			expectedCPUSavings:    2 * -500,
+			expectedMemorySavings: 2 * -1e9,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			vpa := addTestVpa(cluster)
+			// This VPA never got a recommendation.
+			addVpa(cluster, VpaID{"namespace-1", "vpa-2"}, testAnnotations, "label-2 = value-2", testTargetRef)
+			for _, podID := range []PodID{testPodID, testPodID3} {
+				assert.NoError(t, cluster.AddOrUpdatePod(podID, testLabels, apiv1.PodRunning))
+				_, err := cluster.AddOrUpdateContainer(ContainerID{podID, testContainerID.ContainerName}, request)
+				assert.NoError(t, err)
+			}
+			vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).Get()
+			vpa.Recommendation.ContainerRecommendations[0].Target = tc.target
+			now := time.Now()
+			vpa.RecommendationTimestamp = &now
+
+			summary := cluster.GetRecommendationSummary()
+			assert.Equal(t, RecommendationSummary{
+				TotalVPAs:                 2,
+				VPAsWithRecommendation:    1,
+				VPAsWithoutRecommendation: 1,
+				TotalCPUSavingsMillicores: tc.expectedCPUSavings,
+				TotalMemorySavingsBytes:   tc.expectedMemorySavings,
+			}, summary)
+
+			stale := now.Add(-2 * RecommendationMissingMaxDuration)
+			vpa.RecommendationTimestamp = &stale
+			assert.Equal(t, 1, cluster.GetRecommendationSummary().VPAsWithStaleRecommendation)
+		})
+	}
+}
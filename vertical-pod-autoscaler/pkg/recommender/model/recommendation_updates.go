@@ -0,0 +1,82 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/klog/v2"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+// RecommendationUpdatesBufferSize is the number of notifications the channel
+// returned by RecommendationUpdates can hold. Notifications which don't fit
+// are dropped.
+const RecommendationUpdatesBufferSize = 1000
+
+// RecommendationUpdates returns a channel receiving the ID of a VPA whenever
+// RecordRecommendation stores a recommendation different from the last one
+// notified for that VPA. The channel is created by the first call, no
+// notifications are sent before. It is closed by CloseRecommendationUpdates.
+func (cluster *clusterState) RecommendationUpdates() <-chan VpaID {
+	cluster.recommendationUpdatesMutex.Lock()
+	defer cluster.recommendationUpdatesMutex.Unlock()
+	if cluster.recommendationUpdates == nil {
+		cluster.recommendationUpdates = make(chan VpaID, RecommendationUpdatesBufferSize)
+		if cluster.recommendationUpdatesClosed {
+			close(cluster.recommendationUpdates)
+		}
+	}
+	return cluster.recommendationUpdates
+}
+
+// CloseRecommendationUpdates closes the channel returned by
+// RecommendationUpdates. No notifications are sent afterwards.
+func (cluster *clusterState) CloseRecommendationUpdates() {
+	cluster.recommendationUpdatesMutex.Lock()
+	defer cluster.recommendationUpdatesMutex.Unlock()
+	if cluster.recommendationUpdatesClosed {
+		return
+	}
+	cluster.recommendationUpdatesClosed = true
+	if cluster.recommendationUpdates != nil {
+		close(cluster.recommendationUpdates)
+	}
+}
+
+// notifyRecommendationUpdate sends the ID of the VPA to the channel returned by
+// RecommendationUpdates if its recommendation changed since it was last
+// notified. Does nothing if RecommendationUpdates was never called.
+func (cluster *clusterState) notifyRecommendationUpdate(vpa *Vpa) {
+	cluster.recommendationUpdatesMutex.Lock()
+	defer cluster.recommendationUpdatesMutex.Unlock()
+	if cluster.recommendationUpdates == nil || cluster.recommendationUpdatesClosed {
+		return
+	}
+	if previous, found := cluster.notifiedRecommendations[vpa.ID]; found && apiequality.Semantic.DeepEqual(previous, vpa.Recommendation) {
+		return
+	}
+	select {
+	case cluster.recommendationUpdates <- vpa.ID:
+		if cluster.notifiedRecommendations == nil {
+			cluster.notifiedRecommendations = make(map[VpaID]*vpa_types.RecommendedPodResources)
+		}
+		cluster.notifiedRecommendations[vpa.ID] = vpa.Recommendation.DeepCopy()
+	default:
+		klog.V(2).InfoS("Recommendation updates channel is full, dropping notification", "vpa", klog.KRef(vpa.ID.Namespace, vpa.ID.VpaName))
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestRecommendationUpdates(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+
+	// Nothing is notified before the first subscription.
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("50m", "200G").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	vpa.Recommendation = nil
+	updates := cluster.RecommendationUpdates()
+	assert.Empty(t, updates)
+
+	// Empty recommendations are not notified.
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	assert.Empty(t, updates)
+
+	// Writing the same recommendation twice notifies it once.
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("100m", "200G").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp))
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("100m", "200G").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(time.Minute)))
+	assert.Len(t, updates, 1)
+	assert.Equal(t, testVpaID, <-updates)
+
+	// A changed recommendation is notified again.
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("200m", "200G").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(2*time.Minute)))
+	assert.Len(t, updates, 1)
+	assert.Equal(t, testVpaID, <-updates)
+
+	// No notifications are sent once the channel is closed.
+	cluster.CloseRecommendationUpdates()
+	cluster.CloseRecommendationUpdates()
+	vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("300m", "200G").Get()
+	assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(3*time.Minute)))
+	_, open := <-updates
+	assert.False(t, open)
+}
+
+func TestRecommendationUpdatesConcurrent(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	var vpas []*Vpa
+	for i := 0; i < 20; i++ {
+		vpa := addVpa(cluster, VpaID{"namespace-1", fmt.Sprintf("vpa-%d", i)}, testAnnotations, testSelectorStr, testTargetRef)
+		vpa.Recommendation = test.Recommendation().WithContainer("test").WithTarget("100m", "200G").Get()
+		vpas = append(vpas, vpa)
+	}
+	updates := cluster.RecommendationUpdates()
+
+	// Notifications are sent concurrently, as by the workers updating VPAs,
+	// and the channel is closed while they are sent.
+	var wg sync.WaitGroup
+	for _, vpa := range vpas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cluster.notifyRecommendationUpdate(vpa)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		cluster.CloseRecommendationUpdates()
+	}()
+	wg.Wait()
+
+	notified := 0
+	for range updates {
+		notified++
+	}
+	assert.LessOrEqual(t, notified, len(vpas))
+}
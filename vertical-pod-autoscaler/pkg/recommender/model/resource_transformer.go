@@ -0,0 +1,60 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// ResourceTransformer converts the usage reported by a monitoring system to
+// the unit of the resource in the model, i.e. millicores for CPU and bytes
+// for memory.
+type ResourceTransformer func(ResourceAmount) ResourceAmount
+
+// CoresToMillicores converts a CPU usage reported in whole cores to
+// millicores.
+func CoresToMillicores(cores ResourceAmount) ResourceAmount {
+	return cores * 1000
+}
+
+// RegisterResourceTransformer makes AddSample convert the usage of the
+// samples of the given resource with the transformer before storing them.
+// Registering a transformer replaces the previous one of the resource; a nil
+// transformer removes it.
+func (cluster *clusterState) RegisterResourceTransformer(resource apiv1.ResourceName, transform ResourceTransformer) {
+	cluster.resourceTransformersMutex.Lock()
+	defer cluster.resourceTransformersMutex.Unlock()
+	if transform == nil {
+		delete(cluster.resourceTransformers, ResourceName(resource))
+		return
+	}
+	cluster.resourceTransformers[ResourceName(resource)] = transform
+}
+
+// transformSample returns the sample with its usage converted by the
+// transformer registered for its resource. The given sample is not modified.
+func (cluster *clusterState) transformSample(sample *ContainerUsageSampleWithKey) *ContainerUsageSampleWithKey {
+	cluster.resourceTransformersMutex.RLock()
+	transform := cluster.resourceTransformers[sample.Resource]
+	cluster.resourceTransformersMutex.RUnlock()
+	if transform == nil {
+		return sample
+	}
+	transformed := *sample
+	transformed.Usage = transform(sample.Usage)
+	return &transformed
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestRegisterResourceTransformer(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	cluster.RegisterResourceTransformer(apiv1.ResourceCPU, CoresToMillicores)
+	cluster.RegisterResourceTransformer(apiv1.ResourceMemory, func(kib ResourceAmount) ResourceAmount { return kib * 1024 })
+
+	for i := 0; i < 10; i++ {
+		ts := testTimestamp.Add(time.Duration(i) * time.Hour)
+		// 2 cores and 512 MiB, reported in cores and KiB.
+		cpuSample := &ContainerUsageSampleWithKey{ContainerUsageSample{ts, 2, ResourceCPU}, testContainerID}
+		assert.NoError(t, cluster.AddSample(cpuSample))
+		assert.Equal(t, ResourceAmount(2), cpuSample.Usage)
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{ts, 512 * 1024, ResourceMemory}, testContainerID}))
+	}
+	aggregation, found := cluster.aggregateStates.get(cluster.aggregateStateKeyForContainerID(testContainerID))
+	if assert.True(t, found) {
+		assert.InEpsilon(t, 2.0, aggregation.AggregateCPUUsage.Percentile(0.9), 0.05)
+		assert.InEpsilon(t, 512.0*1024*1024, aggregation.AggregateMemoryPeaks.Percentile(0.9), 0.05)
+	}
+
+	// Removed transformers no longer apply.
+	cluster.RegisterResourceTransformer(apiv1.ResourceCPU, nil)
+	ts := testTimestamp.Add(10 * time.Hour)
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{ts, 2, ResourceCPU}, testContainerID}))
+	assert.Less(t, aggregation.AggregateCPUUsage.Percentile(0), 0.1)
+}
+
+func TestCoresToMillicores(t *testing.T) {
+	assert.Equal(t, CPUAmountFromCores(3), CoresToMillicores(3))
+	assert.Equal(t, ResourceAmount(0), CoresToMillicores(0))
+}
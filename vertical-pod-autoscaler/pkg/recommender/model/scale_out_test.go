@@ -0,0 +1,101 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// SimulateScaleOut adds n pods named namePrefix-0 to namePrefix-<n-1> to the
+// namespace of the template pod, with the labels, phase and containers of the
+// template pod. The containers get copies of the requests of the template
+// containers but no samples. It is only available in tests, for load testing
+// AddOrUpdatePod and AddOrUpdateContainer.
+func (cluster *clusterState) SimulateScaleOut(n int, templatePodID PodID, namePrefix string) error {
+	template, found := cluster.pods[templatePodID]
+	if !found {
+		return NewKeyError(templatePodID)
+	}
+	podLabels := cluster.labelSetMap[template.labelSetKey]
+	for i := 0; i < n; i++ {
+		podID := PodID{Namespace: templatePodID.Namespace, PodName: fmt.Sprintf("%s-%d", namePrefix, i)}
+		if _, found := cluster.pods[podID]; found {
+			return fmt.Errorf("cannot scale out pod %s/%s: pod %s/%s already exists", templatePodID.Namespace, templatePodID.PodName, podID.Namespace, podID.PodName)
+		}
+		if err := cluster.AddOrUpdatePod(podID, podLabels, template.Phase); err != nil {
+			return err
+		}
+		for containerName, container := range template.Containers {
+			if _, err := cluster.AddOrUpdateContainer(ContainerID{PodID: podID, ContainerName: containerName}, maps.Clone(container.Request)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestSimulateScaleOut(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+
+	assert.NoError(t, cluster.SimulateScaleOut(3, testPodID, "clone"))
+	assert.Len(t, cluster.Pods(), 4)
+	for i := 0; i < 3; i++ {
+		podID := PodID{testPodID.Namespace, fmt.Sprintf("clone-%d", i)}
+		clone, found := cluster.Pods()[podID]
+		assert.True(t, found)
+		assert.Equal(t, apiv1.PodRunning, clone.Phase)
+		assert.Equal(t, testRequest, clone.Containers[testContainerID.ContainerName].Request)
+	}
+	// The clones match the VPA of the template pod and share its aggregation.
+	assert.Equal(t, 4, vpa.PodCount)
+	assert.Equal(t, 1, cluster.StateMapSize())
+
+	assert.Error(t, cluster.SimulateScaleOut(1, testPodID, "clone"))
+	assert.Error(t, cluster.SimulateScaleOut(1, testPodID3, "clone"))
+}
+
+// Measures the time of adding pods with SimulateScaleOut for growing numbers
+// of pods. The time per pod should not depend on the number of pods.
+func BenchmarkSimulateScaleOut(b *testing.B) {
+	for _, podCount := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("pods=%d", podCount), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				cluster := NewClusterState(testGcPeriod)
+				addTestVpa(cluster)
+				addTestPod(cluster)
+				if _, err := cluster.AddOrUpdateContainer(testContainerID, testRequest); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if err := cluster.SimulateScaleOut(podCount, testPodID, "clone"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*podCount), "ns/pod")
+		})
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"strings"
+)
+
+// ScopedClusterState is a view of a ClusterState restricted to the namespaces
+// with a given prefix. Its read methods (VPAs, Pods and GetMatchingPods) only
+// return objects from the matching namespaces, while all other methods,
+// including the ones modifying the state, operate on the full cluster state.
+type ScopedClusterState interface {
+	ClusterState
+	// NamespacePrefix returns the prefix of the namespaces in the scope.
+	NamespacePrefix() string
+}
+
+type scopedClusterState struct {
+	ClusterState
+	namespacePrefix string
+}
+
+// WithNamespacePrefix returns a view of the cluster state restricted to the
+// namespaces starting with the given prefix.
+func (cluster *clusterState) WithNamespacePrefix(prefix string) ScopedClusterState {
+	return &scopedClusterState{
+		ClusterState:    cluster,
+		namespacePrefix: prefix,
+	}
+}
+
+func (scope *scopedClusterState) NamespacePrefix() string {
+	return scope.namespacePrefix
+}
+
+func (scope *scopedClusterState) inScope(namespace string) bool {
+	return strings.HasPrefix(namespace, scope.namespacePrefix)
+}
+
+// VPAs returns the VPAs in the namespaces of the scope.
+func (scope *scopedClusterState) VPAs() map[VpaID]*Vpa {
+	vpas := make(map[VpaID]*Vpa)
+	for vpaID, vpa := range scope.ClusterState.VPAs() {
+		if scope.inScope(vpaID.Namespace) {
+			vpas[vpaID] = vpa
+		}
+	}
+	return vpas
+}
+
+// Pods returns the pods in the namespaces of the scope.
+func (scope *scopedClusterState) Pods() map[PodID]*PodState {
+	pods := make(map[PodID]*PodState)
+	for podID, pod := range scope.ClusterState.Pods() {
+		if scope.inScope(podID.Namespace) {
+			pods[podID] = pod
+		}
+	}
+	return pods
+}
+
+// GetMatchingPods returns the pods matching the given VPA in the namespaces of
+// the scope.
+func (scope *scopedClusterState) GetMatchingPods(vpa *Vpa) []PodID {
+	matchingPods := []PodID{}
+	for _, podID := range scope.ClusterState.GetMatchingPods(vpa) {
+		if scope.inScope(podID.Namespace) {
+			matchingPods = append(matchingPods, podID)
+		}
+	}
+	return matchingPods
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestWithNamespacePrefix(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	teamAVpa := VpaID{"team-a-frontend", "vpa-1"}
+	teamBVpa := VpaID{"team-b-backend", "vpa-1"}
+	teamAPod := PodID{"team-a-frontend", "pod-1"}
+	teamBPod := PodID{"team-b-backend", "pod-1"}
+	for _, vpaID := range []VpaID{teamAVpa, teamBVpa} {
+		addVpa(cluster, vpaID, testAnnotations, testSelectorStr, testTargetRef)
+	}
+	for _, podID := range []PodID{teamAPod, teamBPod} {
+		assert.NoError(t, cluster.AddOrUpdatePod(podID, testLabels, apiv1.PodRunning))
+	}
+
+	teamA := cluster.WithNamespacePrefix("team-a-")
+	teamB := cluster.WithNamespacePrefix("team-b-")
+	assert.Equal(t, "team-a-", teamA.NamespacePrefix())
+
+	assert.Equal(t, []VpaID{teamAVpa}, slices.Collect(maps.Keys(teamA.VPAs())))
+	assert.Equal(t, []VpaID{teamBVpa}, slices.Collect(maps.Keys(teamB.VPAs())))
+	for vpaID := range teamA.VPAs() {
+		assert.NotContains(t, teamB.VPAs(), vpaID)
+	}
+	assert.Equal(t, []PodID{teamAPod}, slices.Collect(maps.Keys(teamA.Pods())))
+	assert.Equal(t, []PodID{teamBPod}, slices.Collect(maps.Keys(teamB.Pods())))
+	assert.Equal(t, []PodID{teamAPod}, teamA.GetMatchingPods(cluster.VPAs()[teamAVpa]))
+	assert.Empty(t, teamB.GetMatchingPods(cluster.VPAs()[teamAVpa]))
+
+	// Writes through a scope operate on the full cluster state.
+	otherPod := PodID{"team-b-backend", "pod-2"}
+	assert.NoError(t, teamA.AddOrUpdatePod(otherPod, testLabels, apiv1.PodRunning))
+	assert.Contains(t, cluster.Pods(), otherPod)
+	assert.Contains(t, teamB.Pods(), otherPod)
+	assert.NotContains(t, teamA.Pods(), otherPod)
+	teamA.DeletePod(teamBPod)
+	assert.NotContains(t, teamB.Pods(), teamBPod)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// startupRecommendationPercentile is the percentile of the startup usage
+// returned by GetStartupRecommendation.
+const startupRecommendationPercentile = 0.95
+
+// RecordContainerStartup marks [startTime, endTime) as the startup window of
+// the container. Usage samples started within the window are excluded from
+// the steady-state histograms of the container's aggregation and aggregated
+// in its startup histograms instead. Recording a new window replaces the
+// previous one.
+func (cluster *clusterState) RecordContainerStartup(containerID ContainerID, startTime time.Time, endTime time.Time) error {
+	pod, podExists := cluster.pods[containerID.PodID]
+	if !podExists {
+		return NewPodNotFoundError(containerID.PodID)
+	}
+	container, containerExists := pod.Containers[containerID.ContainerName]
+	if !containerExists {
+		return NewContainerNotFoundError(containerID)
+	}
+	if !endTime.After(startTime) {
+		return fmt.Errorf("startup of container %v ends at %v, not after its start at %v", containerID, endTime, startTime)
+	}
+	container.startupStart = startTime
+	container.startupEnd = endTime
+	return nil
+}
+
+// GetStartupRecommendation returns the P95 of the CPU and memory usage
+// observed during the startup of the containers of the given aggregation.
+// Resources without startup samples are omitted. Returns an error if the
+// aggregation doesn't exist.
+func (cluster *clusterState) GetStartupRecommendation(key AggregateStateKey) (Resources, error) {
+	aggregation, found := cluster.aggregateStates.get(key)
+	if !found {
+		return nil, NewKeyError(key)
+	}
+	unlock := cluster.aggregateStates.lockSamples(key)
+	defer unlock()
+	recommendation := Resources{}
+	if aggregation.startupCPUUsage != nil && !aggregation.startupCPUUsage.IsEmpty() {
+		recommendation[ResourceCPU] = CPUAmountFromCores(aggregation.startupCPUUsage.Percentile(startupRecommendationPercentile))
+	}
+	if aggregation.startupMemoryUsage != nil && !aggregation.startupMemoryUsage.IsEmpty() {
+		recommendation[ResourceMemory] = MemoryAmountFromBytes(aggregation.startupMemoryUsage.Percentile(startupRecommendationPercentile))
+	}
+	return recommendation, nil
+}
+
+// addStartupSample aggregates a single usage sample taken during the startup
+// of a container. Unlike AddSample, memory samples are aggregated as they
+// are, not as peaks of aggregation intervals.
+func (a *AggregateContainerState) addStartupSample(sample *ContainerUsageSample) {
+	if a.startupCPUUsage == nil {
+		// Reuse the histogram construction of a new aggregation.
+		empty := NewAggregateContainerState(GetAggregationsConfig().HistogramType)
+		a.startupCPUUsage = empty.AggregateCPUUsage
+		a.startupMemoryUsage = empty.AggregateMemoryPeaks
+	}
+	switch sample.Resource {
+	case ResourceCPU:
+		a.startupCPUUsage.AddSample(CoresFromCPUAmount(sample.Usage), minSampleWeight, sample.MeasureStart)
+	case ResourceMemory:
+		a.startupMemoryUsage.AddSample(BytesFromMemoryAmount(sample.Usage), 1.0, sample.MeasureStart)
+	default:
+		panic(fmt.Sprintf("addStartupSample doesn't support resource '%s'", sample.Resource))
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordContainerStartup(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	assert.EqualError(t, cluster.RecordContainerStartup(testContainerID, testTimestamp, testTimestamp.Add(time.Minute)), "pod namespace-1/pod-1 not found")
+	addTestPod(cluster)
+	assert.Error(t, cluster.RecordContainerStartup(testContainerID, testTimestamp, testTimestamp.Add(time.Minute)))
+	addTestContainer(t, cluster)
+	assert.Error(t, cluster.RecordContainerStartup(testContainerID, testTimestamp, testTimestamp))
+	assert.NoError(t, cluster.RecordContainerStartup(testContainerID, testTimestamp, testTimestamp.Add(time.Minute)))
+}
+
+func TestStartupSamplesAreExcludedFromSteadyState(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	startupEnd := testTimestamp.Add(2 * time.Minute)
+	assert.NoError(t, cluster.RecordContainerStartup(testContainerID, testTimestamp, startupEnd))
+
+	// A spike during the startup.
+	for i, cores := range []float64{4, 3} {
+		assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+			MeasureStart: testTimestamp.Add(time.Duration(i) * time.Minute), Usage: CPUAmountFromCores(cores), Resource: ResourceCPU}, testContainerID}))
+	}
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: testTimestamp, Usage: MemoryAmountFromBytes(4e9), Resource: ResourceMemory}, testContainerID}))
+	// Steady state.
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: startupEnd, Usage: CPUAmountFromCores(0.1), Resource: ResourceCPU}, testContainerID}))
+	assert.NoError(t, cluster.AddSample(&ContainerUsageSampleWithKey{ContainerUsageSample{
+		MeasureStart: startupEnd, Usage: MemoryAmountFromBytes(1e8), Resource: ResourceMemory}, testContainerID}))
+
+	key := cluster.aggregateStateKeyForContainerID(testContainerID)
+	aggregation, found := cluster.aggregateStates.get(key)
+	if assert.True(t, found) {
+		assert.Equal(t, 1, aggregation.TotalSamplesCount)
+		assert.Less(t, aggregation.AggregateCPUUsage.Percentile(1.0), 0.2)
+		assert.Less(t, aggregation.AggregateMemoryPeaks.Percentile(1.0), 2e8)
+	}
+
+	recommendation, err := cluster.GetStartupRecommendation(key)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, recommendation[ResourceCPU], CPUAmountFromCores(3))
+	assert.GreaterOrEqual(t, recommendation[ResourceMemory], MemoryAmountFromBytes(4e9))
+}
+
+func TestGetStartupRecommendationWithoutStartupSamples(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddSample(makeTestUsageSample()))
+
+	key := cluster.aggregateStateKeyForContainerID(testContainerID)
+	recommendation, err := cluster.GetStartupRecommendation(key)
+	assert.NoError(t, err)
+	assert.Empty(t, recommendation)
+
+	_, err = cluster.GetStartupRecommendation(cluster.MakeAggregateStateKey(cluster.pods[testPodID], "unknown"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
+)
+
+// StatusFieldManager is the field manager owning the recommendations applied
+// by FlushRecommendationsToStatus.
+const StatusFieldManager = "vpa-recommender"
+
+// FlushRecommendationsToStatus writes the recommendations of all VPAs which
+// have one to the status of their API objects, using server-side apply. Only
+// recommendations which changed since they were last flushed successfully are
+// written. Failures don't stop flushing the other VPAs; all of them are
+// returned together.
+func (cluster *clusterState) FlushRecommendationsToStatus(ctx context.Context, client versioned.Interface) error {
+	flushed := make(map[VpaID]*vpa_types.RecommendedPodResources, len(cluster.vpas))
+	var errs []error
+	for vpaID, vpa := range cluster.vpas {
+		if vpa.Recommendation == nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if previous, found := cluster.flushedRecommendations[vpaID]; found && apiequality.Semantic.DeepEqual(previous, vpa.Recommendation) {
+			flushed[vpaID] = previous
+			continue
+		}
+		if err := applyRecommendationToStatus(ctx, client, vpaID, vpa.Recommendation); err != nil {
+			errs = append(errs, fmt.Errorf("cannot flush recommendation of VPA %s/%s: %w", vpaID.Namespace, vpaID.VpaName, err))
+			continue
+		}
+		klog.V(4).InfoS("Flushed recommendation to VPA status", "vpa", klog.KRef(vpaID.Namespace, vpaID.VpaName))
+		flushed[vpaID] = vpa.Recommendation.DeepCopy()
+	}
+	cluster.flushedRecommendations = flushed
+	return errors.Join(errs...)
+}
+
+// applyRecommendationToStatus sets the recommendation in the status of the
+// VPA API object with the given ID.
+func applyRecommendationToStatus(ctx context.Context, client versioned.Interface, vpaID VpaID, recommendation *vpa_types.RecommendedPodResources) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"apiVersion": vpa_types.SchemeGroupVersion.String(),
+		"kind":       "VerticalPodAutoscaler",
+		"metadata": map[string]interface{}{
+			"name":      vpaID.VpaName,
+			"namespace": vpaID.Namespace,
+		},
+		"status": map[string]interface{}{
+			"recommendation": recommendation,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	force := true
+	_, err = client.AutoscalingV1().VerticalPodAutoscalers(vpaID.Namespace).Patch(ctx, vpaID.VpaName, types.ApplyPatchType, patch,
+		metav1.PatchOptions{FieldManager: StatusFieldManager, Force: &force}, "status")
+	return err
+}
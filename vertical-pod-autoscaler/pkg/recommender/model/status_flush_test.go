@@ -0,0 +1,86 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned/fake"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestFlushRecommendationsToStatus(t *testing.T) {
+	ctx := context.Background()
+	cluster := NewClusterState(testGcPeriod)
+	otherVpaID := VpaID{"namespace-1", "vpa-2"}
+	noRecommendationVpaID := VpaID{"namespace-1", "vpa-3"}
+	vpa := addTestVpa(cluster)
+	otherVpa := addVpa(cluster, otherVpaID, testAnnotations, testSelectorStr, testTargetRef)
+	addVpa(cluster, noRecommendationVpaID, testAnnotations, testSelectorStr, testTargetRef)
+	vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("1", "1Gi").Get()
+	otherVpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("2", "2Gi").Get()
+
+	client := fake.NewSimpleClientset()
+	failing := map[string]bool{}
+	var patched []string
+	client.PrependReactor("patch", "verticalpodautoscalers", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchAction)
+		assert.Equal(t, types.ApplyPatchType, patchAction.GetPatchType())
+		assert.Equal(t, "status", patchAction.GetSubresource())
+		if failing[patchAction.GetName()] {
+			return true, nil, fmt.Errorf("patch failed")
+		}
+		var applied vpa_types.VerticalPodAutoscaler
+		assert.NoError(t, json.Unmarshal(patchAction.GetPatch(), &applied))
+		assert.Equal(t, patchAction.GetName(), applied.Name)
+		assert.Equal(t, cluster.VPAs()[VpaID{applied.Namespace, applied.Name}].Recommendation, applied.Status.Recommendation)
+		patched = append(patched, patchAction.GetName())
+		return true, &applied, nil
+	})
+
+	// Only VPAs with recommendations are flushed.
+	assert.NoError(t, cluster.FlushRecommendationsToStatus(ctx, client))
+	assert.ElementsMatch(t, []string{testVpaID.VpaName, otherVpaID.VpaName}, patched)
+
+	// Unchanged recommendations are not flushed again.
+	patched = nil
+	assert.NoError(t, cluster.FlushRecommendationsToStatus(ctx, client))
+	assert.Empty(t, patched)
+
+	vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("3", "1Gi").Get()
+	assert.NoError(t, cluster.FlushRecommendationsToStatus(ctx, client))
+	assert.Equal(t, []string{testVpaID.VpaName}, patched)
+
+	// Failed flushes are retried.
+	patched = nil
+	failing[otherVpaID.VpaName] = true
+	otherVpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).WithTarget("4", "1Gi").Get()
+	assert.Error(t, cluster.FlushRecommendationsToStatus(ctx, client))
+	assert.Empty(t, patched)
+	failing[otherVpaID.VpaName] = false
+	assert.NoError(t, cluster.FlushRecommendationsToStatus(ctx, client))
+	assert.Equal(t, []string{otherVpaID.VpaName}, patched)
+}
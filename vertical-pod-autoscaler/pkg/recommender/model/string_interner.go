@@ -0,0 +1,49 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// stringInterner deduplicates equal strings, so that only a single copy of
+// each of them is retained. Label keys and values such as "app" or "tier" are
+// repeated in most of the pods in the cluster. It is safe for concurrent use.
+type stringInterner struct {
+	strings sync.Map
+}
+
+// intern returns the canonical copy of the given string.
+func (i *stringInterner) intern(s string) string {
+	if canonical, found := i.strings.Load(s); found {
+		return canonical.(string)
+	}
+	canonical, _ := i.strings.LoadOrStore(s, s)
+	return canonical.(string)
+}
+
+// internLabels returns a copy of the given label set using the canonical
+// copies of its keys and values.
+func (i *stringInterner) internLabels(labelSet labels.Set) labels.Set {
+	result := make(labels.Set, len(labelSet))
+	for key, value := range labelSet {
+		result[i.intern(key)] = i.intern(value)
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const commonLabelsPodCount = 10000
+
+// Returns labels of the i-th pod, sharing the keys with all other pods and
+// most of the values with pods of the same app. Every string is a distinct
+// copy, like the ones decoded from API objects.
+func commonPodLabels(i int) labels.Set {
+	return labels.Set{
+		strings.Clone("app"):               fmt.Sprintf("app-%d", i%10),
+		strings.Clone("version"):           fmt.Sprintf("v%d", i%3),
+		strings.Clone("tier"):              strings.Clone("backend"),
+		strings.Clone("pod-template-hash"): fmt.Sprintf("%x", i),
+	}
+}
+
+func TestStringInterner(t *testing.T) {
+	interner := &stringInterner{}
+	first := interner.intern(strings.Clone("app"))
+	second := interner.intern(strings.Clone("app"))
+	assert.Equal(t, "app", second)
+	assert.Equal(t, unsafe.StringData(first), unsafe.StringData(second))
+
+	labelSet := interner.internLabels(labels.Set{strings.Clone("app"): strings.Clone("web")})
+	assert.Equal(t, labels.Set{"app": "web"}, labelSet)
+	for key := range labelSet {
+		assert.Equal(t, unsafe.StringData(first), unsafe.StringData(key))
+	}
+}
+
+func TestLabelSetMapSharesLabelStrings(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, cluster.AddOrUpdatePod(PodID{"namespace-1", fmt.Sprintf("pod-%d", i)}, commonPodLabels(i), apiv1.PodRunning))
+	}
+	assert.Equal(t, 100, cluster.LabelSetMapSize())
+	canonical := map[string]*byte{}
+	for _, labelSet := range cluster.labelSetMap {
+		for key, value := range labelSet {
+			for _, s := range []string{key, value} {
+				if data, found := canonical[s]; found {
+					assert.Equal(t, data, unsafe.StringData(s), "label string %q is not shared", s)
+				} else {
+					canonical[s] = unsafe.StringData(s)
+				}
+			}
+		}
+	}
+
+	// Pods with equal labels share a single label set.
+	assert.NoError(t, cluster.AddOrUpdatePod(PodID{"namespace-1", "pod-copy"}, commonPodLabels(0), apiv1.PodRunning))
+	assert.Equal(t, 100, cluster.LabelSetMapSize())
+}
+
+// Measures the memory retained by the label sets of pods sharing common label
+// keys and values.
+func BenchmarkAddOrUpdatePodCommonLabels(b *testing.B) {
+	b.ReportAllocs()
+	podLabels := make([]labels.Set, commonLabelsPodCount)
+	for i := range podLabels {
+		podLabels[i] = commonPodLabels(i)
+	}
+	var retainedBytes int64
+	for n := 0; n < b.N; n++ {
+		cluster := NewClusterState(testGcPeriod)
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		for i, podLabel := range podLabels {
+			_ = cluster.AddOrUpdatePod(PodID{"namespace-1", fmt.Sprintf("pod-%d", i)}, podLabel, apiv1.PodRunning)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		retainedBytes += int64(after.HeapAlloc) - int64(before.HeapAlloc)
+		runtime.KeepAlive(cluster)
+	}
+	b.ReportMetric(float64(retainedBytes)/float64(b.N*commonLabelsPodCount), "retained-B/pod")
+}
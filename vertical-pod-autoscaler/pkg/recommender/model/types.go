@@ -19,6 +19,8 @@ package model
 import (
 	"fmt"
 	"math"
+	"net/url"
+	"strings"
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -42,6 +44,8 @@ const (
 	ResourceCPU ResourceName = "cpu"
 	// ResourceMemory represents memory, in bytes. (500Gi = 500GiB = 500 * 1024 * 1024 * 1024).
 	ResourceMemory ResourceName = "memory"
+	// ResourceEphemeralStorage represents local ephemeral storage, in bytes.
+	ResourceEphemeralStorage ResourceName = "ephemeral-storage"
 	// MaxResourceAmount is the maximum allowed value of resource amount.
 	MaxResourceAmount = ResourceAmount(1e14)
 )
@@ -118,6 +122,9 @@ func ResourcesAsResourceList(resources Resources, humanizeMemory bool, roundCPUM
 				klog.V(4).InfoS("Converting raw value to humanized value", "rawValue", rawValues, "humanizedValue", humanizedValue)
 				quantity = resource.MustParse(humanizedValue)
 			}
+		case ResourceEphemeralStorage:
+			newKey = apiv1.ResourceEphemeralStorage
+			quantity = QuantityFromMemoryAmount(resourceAmount)
 		default:
 			klog.ErrorS(nil, "Cannot translate resource name", "resourceName", key)
 			continue
@@ -136,6 +143,8 @@ func ResourceNamesApiToModel(resources []apiv1.ResourceName) *[]ResourceName {
 			result = append(result, ResourceCPU)
 		case apiv1.ResourceMemory:
 			result = append(result, ResourceMemory)
+		case apiv1.ResourceEphemeralStorage:
+			result = append(result, ResourceEphemeralStorage)
 		default:
 			klog.ErrorS(nil, "Cannot translate resource name", "resourceName", resource)
 			continue
@@ -215,3 +224,78 @@ type VpaID struct {
 	Namespace string
 	VpaName   string
 }
+
+// MarshalText encodes the pod ID as "namespace/name", with both segments
+// path-escaped, so that it can be used as a key of JSON objects.
+func (id PodID) MarshalText() ([]byte, error) {
+	return marshalIDSegments(id.Namespace, id.PodName), nil
+}
+
+// UnmarshalText decodes a pod ID encoded with MarshalText.
+func (id *PodID) UnmarshalText(text []byte) error {
+	segments, err := unmarshalIDSegments(text, 2)
+	if err != nil {
+		return fmt.Errorf("invalid pod ID: %w", err)
+	}
+	*id = PodID{Namespace: segments[0], PodName: segments[1]}
+	return nil
+}
+
+// MarshalText encodes the container ID as "namespace/pod/container", with all
+// segments path-escaped, so that it can be used as a key of JSON objects.
+func (id ContainerID) MarshalText() ([]byte, error) {
+	return marshalIDSegments(id.Namespace, id.PodName, id.ContainerName), nil
+}
+
+// UnmarshalText decodes a container ID encoded with MarshalText.
+func (id *ContainerID) UnmarshalText(text []byte) error {
+	segments, err := unmarshalIDSegments(text, 3)
+	if err != nil {
+		return fmt.Errorf("invalid container ID: %w", err)
+	}
+	*id = ContainerID{PodID: PodID{Namespace: segments[0], PodName: segments[1]}, ContainerName: segments[2]}
+	return nil
+}
+
+// MarshalText encodes the VPA ID as "namespace/name", with both segments
+// path-escaped, so that it can be used as a key of JSON objects.
+func (id VpaID) MarshalText() ([]byte, error) {
+	return marshalIDSegments(id.Namespace, id.VpaName), nil
+}
+
+// UnmarshalText decodes a VPA ID encoded with MarshalText.
+func (id *VpaID) UnmarshalText(text []byte) error {
+	segments, err := unmarshalIDSegments(text, 2)
+	if err != nil {
+		return fmt.Errorf("invalid VPA ID: %w", err)
+	}
+	*id = VpaID{Namespace: segments[0], VpaName: segments[1]}
+	return nil
+}
+
+// marshalIDSegments joins the path-escaped segments of an ID with slashes.
+// Escaping keeps segments containing slashes unambiguous.
+func marshalIDSegments(segments ...string) []byte {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+	return []byte(strings.Join(escaped, "/"))
+}
+
+// unmarshalIDSegments splits an ID encoded with marshalIDSegments into its
+// unescaped segments. Returns an error unless there are exactly count of them.
+func unmarshalIDSegments(text []byte, count int) ([]string, error) {
+	segments := strings.Split(string(text), "/")
+	if len(segments) != count {
+		return nil, fmt.Errorf("%q has %d segments, expected %d", text, len(segments), count)
+	}
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", text, err)
+		}
+		segments[i] = unescaped
+	}
+	return segments, nil
+}
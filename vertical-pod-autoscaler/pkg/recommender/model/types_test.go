@@ -17,6 +17,7 @@ limitations under the License.
 package model
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -758,3 +759,77 @@ func TestResourceAmountFromFloat(t *testing.T) {
 		})
 	}
 }
+
+func TestIDJSONRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name        string
+		containerID ContainerID
+	}{
+		{
+			name:        "plain names",
+			containerID: ContainerID{PodID{"namespace-1", "pod-1"}, "container-1"},
+		},
+		{
+			name:        "special characters",
+			containerID: ContainerID{PodID{"name space", "pod%1?#"}, "container:1.ü"},
+		},
+		{
+			name:        "empty names",
+			containerID: ContainerID{PodID{"", ""}, ""},
+		},
+		{
+			name:        "multi-segment namespace",
+			containerID: ContainerID{PodID{"team/namespace/1", "pod/1"}, "container/1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			podID := tc.containerID.PodID
+			vpaID := VpaID{Namespace: podID.Namespace, VpaName: podID.PodName}
+
+			vpas := map[VpaID]int{vpaID: 1}
+			data, err := json.Marshal(vpas)
+			assert.NoError(t, err)
+			decodedVpas := map[VpaID]int{}
+			assert.NoError(t, json.Unmarshal(data, &decodedVpas))
+			assert.Equal(t, vpas, decodedVpas)
+
+			pods := map[PodID]int{podID: 1}
+			data, err = json.Marshal(pods)
+			assert.NoError(t, err)
+			decodedPods := map[PodID]int{}
+			assert.NoError(t, json.Unmarshal(data, &decodedPods))
+			assert.Equal(t, pods, decodedPods)
+
+			containers := map[ContainerID]int{tc.containerID: 1}
+			data, err = json.Marshal(containers)
+			assert.NoError(t, err)
+			decodedContainers := map[ContainerID]int{}
+			assert.NoError(t, json.Unmarshal(data, &decodedContainers))
+			assert.Equal(t, containers, decodedContainers)
+
+			// IDs are also encoded as strings outside of keys.
+			data, err = json.Marshal([]VpaID{vpaID})
+			assert.NoError(t, err)
+			var decodedVpaIDs []VpaID
+			assert.NoError(t, json.Unmarshal(data, &decodedVpaIDs))
+			assert.Equal(t, []VpaID{vpaID}, decodedVpaIDs)
+		})
+	}
+}
+
+func TestIDUnmarshalTextErrors(t *testing.T) {
+	var vpaID VpaID
+	assert.NoError(t, vpaID.UnmarshalText([]byte("namespace-1/vpa-1")))
+	assert.Equal(t, VpaID{"namespace-1", "vpa-1"}, vpaID)
+	assert.Error(t, vpaID.UnmarshalText([]byte("vpa-1")))
+	assert.Error(t, vpaID.UnmarshalText([]byte("namespace-1/vpa%zz")))
+
+	var podID PodID
+	assert.Error(t, podID.UnmarshalText([]byte("namespace-1/pod-1/container-1")))
+
+	var containerID ContainerID
+	assert.NoError(t, containerID.UnmarshalText([]byte("namespace-1/pod-1/container-1")))
+	assert.Equal(t, ContainerID{PodID{"namespace-1", "pod-1"}, "container-1"}, containerID)
+	assert.Error(t, containerID.UnmarshalText([]byte("namespace-1/pod-1")))
+}
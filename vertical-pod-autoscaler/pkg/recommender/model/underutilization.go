@@ -0,0 +1,97 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"cmp"
+	"slices"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	vpa_utils "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
+)
+
+// VpaUnderutilizationReport lists the underutilized containers of a VPA.
+type VpaUnderutilizationReport struct {
+	VpaID VpaID
+	// Containers maps the names of the underutilized containers to the
+	// utilization fraction, i.e. the recommended target divided by the
+	// request, of each of their underutilized resources.
+	Containers map[string]map[ResourceName]float64
+}
+
+// GetUnderutilizedVPAs returns the VPAs with underutilized containers, sorted
+// by the VPA ID. A resource of a container is underutilized when the target
+// recommended for it is below (1 - thresholdFraction) of its request. CPU and
+// memory are checked independently, and only the underutilized ones are
+// reported. When pods of a VPA request different amounts for a container, the
+// smallest request is used. VPAs without a recommendation are skipped.
+func (cluster *clusterState) GetUnderutilizedVPAs(thresholdFraction float64) []VpaUnderutilizationReport {
+	reports := []VpaUnderutilizationReport{}
+	for _, vpa := range cluster.vpas {
+		if vpa.Recommendation == nil {
+			continue
+		}
+		requests := make(map[string]Resources)
+		for _, podID := range cluster.GetMatchingPods(vpa) {
+			for containerName, container := range cluster.pods[podID].Containers {
+				request, found := requests[containerName]
+				if !found {
+					request = Resources{}
+					requests[containerName] = request
+				}
+				for _, resource := range []ResourceName{ResourceCPU, ResourceMemory} {
+					if current, found := request[resource]; !found || container.Request[resource] < current {
+						request[resource] = container.Request[resource]
+					}
+				}
+			}
+		}
+		containers := make(map[string]map[ResourceName]float64)
+		for containerName, request := range requests {
+			containerRecommendation := vpa_utils.GetRecommendationForContainer(containerName, vpa.Recommendation)
+			if containerRecommendation == nil {
+				continue
+			}
+			fractions := make(map[ResourceName]float64)
+			if target, found := containerRecommendation.Target[apiv1.ResourceCPU]; found && request[ResourceCPU] > 0 {
+				fractions[ResourceCPU] = float64(target.MilliValue()) / float64(request[ResourceCPU])
+			}
+			if target, found := containerRecommendation.Target[apiv1.ResourceMemory]; found && request[ResourceMemory] > 0 {
+				fractions[ResourceMemory] = float64(target.Value()) / float64(request[ResourceMemory])
+			}
+			for resource, fraction := range fractions {
+				if fraction >= 1-thresholdFraction {
+					delete(fractions, resource)
+				}
+			}
+			if len(fractions) > 0 {
+				containers[containerName] = fractions
+			}
+		}
+		if len(containers) > 0 {
+			reports = append(reports, VpaUnderutilizationReport{VpaID: vpa.ID, Containers: containers})
+		}
+	}
+	slices.SortFunc(reports, func(a, b VpaUnderutilizationReport) int {
+		if c := cmp.Compare(a.VpaID.Namespace, b.VpaID.Namespace); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.VpaID.VpaName, b.VpaID.VpaName)
+	})
+	return reports
+}
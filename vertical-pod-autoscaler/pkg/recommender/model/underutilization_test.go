@@ -0,0 +1,89 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestGetUnderutilizedVPAs(t *testing.T) {
+	request := Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(1e9)}
+	testCases := []struct {
+		name     string
+		target   apiv1.ResourceList
+		expected map[ResourceName]float64
+	}{
+		{
+			name:     "CPU underutilized",
+			target:   test.Resources("400m", "8e8"),
+			expected: map[ResourceName]float64{ResourceCPU: 0.4},
+		},
+		{
+			name:     "memory underutilized",
+			target:   test.Resources("900m", "2e8"),
+			expected: map[ResourceName]float64{ResourceMemory: 0.2},
+		},
+		{
+			name:     "both underutilized",
+			target:   test.Resources("400m", "2e8"),
+			expected: map[ResourceName]float64{ResourceCPU: 0.4, ResourceMemory: 0.2},
+		},
+		{
+			name:   "within threshold",
+			target: test.Resources("600m", "5e8"),
+		},
+		{
+			name:   "over-utilized",
+			target: test.Resources("2", "2e9"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			vpa := addTestVpa(cluster)
+			addTestPod(cluster)
+			_, err := cluster.AddOrUpdateContainer(testContainerID, request)
+			assert.NoError(t, err)
+			vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).Get()
+			vpa.Recommendation.ContainerRecommendations[0].Target = tc.target
+
+			reports := cluster.GetUnderutilizedVPAs(0.5)
+			if tc.expected == nil {
+				assert.Empty(t, reports)
+				return
+			}
+			if assert.Len(t, reports, 1) {
+				assert.Equal(t, testVpaID, reports[0].VpaID)
+				assert.Equal(t, map[string]map[ResourceName]float64{testContainerID.ContainerName: tc.expected}, reports[0].Containers)
+			}
+		})
+	}
+}
+
+func TestGetUnderutilizedVPAsWithoutRecommendation(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestVpa(cluster)
+	addTestPod(cluster)
+	_, err := cluster.AddOrUpdateContainer(testContainerID, Resources{ResourceCPU: CPUAmountFromCores(1), ResourceMemory: MemoryAmountFromBytes(1e9)})
+	assert.NoError(t, err)
+	assert.Empty(t, cluster.GetUnderutilizedVPAs(0.5))
+}
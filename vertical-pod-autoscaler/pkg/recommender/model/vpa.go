@@ -17,19 +17,44 @@ limitations under the License.
 package model
 
 import (
+	"fmt"
+	"math"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	autoscaling "k8s.io/api/autoscaling/v1"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
 
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	metrics_quality "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/metrics/quality"
 	vpa_api_util "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/vpa"
 )
 
+const (
+	// SmoothingWindowAnnotation is the VPA annotation holding the number of
+	// recommendation cycles over which recommendations are smoothed using an
+	// exponential moving average. Values lower than 2 disable smoothing.
+	SmoothingWindowAnnotation = "vpa.autoscaling.k8s.io/smoothing-window"
+	// NeverDecreaseBelowRequestAnnotation is the VPA annotation which, when set
+	// to "true", prevents the recommended CPU and memory from dropping below
+	// the current requests of the containers.
+	NeverDecreaseBelowRequestAnnotation = "vpa.autoscaling.k8s.io/never-decrease-below-request"
+	// CronJobAggregationAnnotation is the VPA annotation which, when set to
+	// "true", makes all runs of a CronJob matched by the VPA share the
+	// aggregations, instead of using separate aggregations for each Job.
+	CronJobAggregationAnnotation = "vpa.autoscaling.k8s.io/cronjob-aggregation"
+	// HistoryLengthAnnotation is the VPA annotation holding how long the
+	// aggregations used by the VPA are kept after their last sample, e.g.
+	// "14d" or "36h". Overrides the memory aggregation window length.
+	HistoryLengthAnnotation = "vpa.autoscaling.k8s.io/history-length"
+)
+
 // Map from VPA annotation key to value.
 type vpaAnnotationsMap map[string]string
 
@@ -91,6 +116,9 @@ type Vpa struct {
 	Conditions vpaConditionsMap
 	// Most recently computed recommendation. Can be nil.
 	Recommendation *vpa_types.RecommendedPodResources
+	// RecommendationTimestamp is the time when the recommendation was last
+	// recorded. Nil if no recommendation was recorded yet.
+	RecommendationTimestamp *time.Time
 	// All container aggregations that contribute to this VPA.
 	// TODO: Garbage collect old AggregateContainerStates.
 	aggregateContainerStates aggregateContainerStatesMap
@@ -109,8 +137,36 @@ type Vpa struct {
 	APIVersion string
 	// TargetRef points to the controller managing the set of pods.
 	TargetRef *autoscaling.CrossVersionObjectReference
+	// AdditionalTargetRefs point to further controllers managing pods of the
+	// VPA. They are not part of the VPA API yet and are only set with
+	// ClusterState.SetAdditionalTargetRefs.
+	AdditionalTargetRefs []autoscaling.CrossVersionObjectReference
 	// PodCount contains number of live Pods matching a given VPA object.
 	PodCount int
+	// SmoothingWindow is the number of recommendation cycles over which
+	// recommendations are smoothed. Smoothing is disabled if lower than 2.
+	SmoothingWindow int
+	// NeverDecreaseBelowRequest indicates that recommendations must not drop
+	// below the current requests of the containers.
+	NeverDecreaseBelowRequest bool
+	// CronJobAggregation indicates that the pods of all Jobs created by a
+	// CronJob matched by the VPA are aggregated together.
+	CronJobAggregation bool
+	// HistoryLength is how long the aggregations used by the VPA are kept
+	// after their last sample. Zero means the memory aggregation window
+	// length.
+	HistoryLength time.Duration
+	// Detached VPAs don't use any aggregations until they are reattached.
+	detached bool
+	// ResourceBudget caps the total recommendation summed over all pods
+	// matched by the VPA. Nil means no budget.
+	ResourceBudget *apiv1.ResourceList
+	// DryRun is true if recommendations of this VPA must never be applied to
+	// pods. See vpa_api_util.DryRunAnnotation.
+	DryRun bool
+	// Exponential moving average of the recommendations recorded so far.
+	// Nil if smoothing is disabled or no recommendation was recorded yet.
+	smoothedRecommendation *vpa_types.RecommendedPodResources
 }
 
 // NewVpa returns a new Vpa with a given ID and pod selector. Doesn't set the
@@ -148,7 +204,7 @@ func (vpa *Vpa) SetAPIVersion(to string) {
 // UseAggregationIfMatching checks if the given aggregation matches (contributes to) this VPA
 // and adds it to the set of VPA's aggregations if that is the case.
 func (vpa *Vpa) UseAggregationIfMatching(aggregationKey AggregateStateKey, aggregation *AggregateContainerState) {
-	if vpa.UsesAggregation(aggregationKey) {
+	if vpa.detached || vpa.UsesAggregation(aggregationKey) {
 		// Already linked, we can return quickly.
 		return
 	}
@@ -174,6 +230,133 @@ func (vpa *Vpa) UpdateRecommendation(recommendation *vpa_types.RecommendedPodRes
 	vpa.Recommendation = recommendation
 }
 
+// SetSmoothingWindow updates the smoothing window of the VPA based on the
+// SmoothingWindowAnnotation. Invalid values disable smoothing.
+func (vpa *Vpa) SetSmoothingWindow(annotations vpaAnnotationsMap) {
+	window := 0
+	if value, found := annotations[SmoothingWindowAnnotation]; found {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			klog.V(1).InfoS("Ignoring invalid smoothing window annotation", "vpa", klog.KRef(vpa.ID.Namespace, vpa.ID.VpaName), "value", value, "error", err)
+		} else {
+			window = parsed
+		}
+	}
+	if window < 2 {
+		vpa.smoothedRecommendation = nil
+	}
+	vpa.SmoothingWindow = window
+}
+
+// SetNeverDecreaseBelowRequest updates the request floor policy of the VPA
+// based on the NeverDecreaseBelowRequestAnnotation.
+func (vpa *Vpa) SetNeverDecreaseBelowRequest(annotations vpaAnnotationsMap) {
+	value, found := annotations[NeverDecreaseBelowRequestAnnotation]
+	if !found {
+		vpa.NeverDecreaseBelowRequest = false
+		return
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		klog.V(1).InfoS("Ignoring invalid never-decrease-below-request annotation", "vpa", klog.KRef(vpa.ID.Namespace, vpa.ID.VpaName), "value", value, "error", err)
+	}
+	vpa.NeverDecreaseBelowRequest = enabled
+}
+
+// SetCronJobAggregation updates whether the runs of CronJobs are aggregated
+// together based on the CronJobAggregationAnnotation.
+func (vpa *Vpa) SetCronJobAggregation(annotations vpaAnnotationsMap) {
+	value, found := annotations[CronJobAggregationAnnotation]
+	if !found {
+		vpa.CronJobAggregation = false
+		return
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		klog.V(1).InfoS("Ignoring invalid cronjob-aggregation annotation", "vpa", klog.KRef(vpa.ID.Namespace, vpa.ID.VpaName), "value", value, "error", err)
+	}
+	vpa.CronJobAggregation = enabled
+}
+
+// SetHistoryLength updates the history length of the VPA based on the
+// HistoryLengthAnnotation. Invalid or non-positive values are ignored.
+func (vpa *Vpa) SetHistoryLength(annotations vpaAnnotationsMap) {
+	vpa.HistoryLength = 0
+	value, found := annotations[HistoryLengthAnnotation]
+	if !found {
+		return
+	}
+	historyLength, err := parseHistoryLength(value)
+	if err != nil {
+		klog.V(1).InfoS("Ignoring invalid history-length annotation", "vpa", klog.KRef(vpa.ID.Namespace, vpa.ID.VpaName), "value", value, "error", err)
+		return
+	}
+	vpa.HistoryLength = historyLength
+}
+
+// parseHistoryLength parses a positive duration in the format accepted by
+// time.ParseDuration, or a whole number of days with the "d" suffix.
+func parseHistoryLength(value string) (time.Duration, error) {
+	var historyLength time.Duration
+	if days, found := strings.CutSuffix(value, "d"); found {
+		parsed, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		historyLength = time.Duration(parsed) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, err
+		}
+		historyLength = parsed
+	}
+	if historyLength <= 0 {
+		return 0, fmt.Errorf("history length %q is not positive", value)
+	}
+	return historyLength, nil
+}
+
+// smoothRecommendation blends the current recommendation in place with the
+// exponential moving average of the previous ones. Does nothing if smoothing
+// is disabled.
+func (vpa *Vpa) smoothRecommendation() {
+	if vpa.SmoothingWindow < 2 || vpa.Recommendation == nil {
+		return
+	}
+	alpha := 2.0 / float64(vpa.SmoothingWindow+1)
+	recommendation := vpa.Recommendation
+	for i := range recommendation.ContainerRecommendations {
+		containerRecommendation := &recommendation.ContainerRecommendations[i]
+		previous := vpa_api_util.GetRecommendationForContainer(containerRecommendation.ContainerName, vpa.smoothedRecommendation)
+		if previous == nil {
+			continue
+		}
+		blendResourceList(containerRecommendation.Target, previous.Target, alpha)
+		blendResourceList(containerRecommendation.LowerBound, previous.LowerBound, alpha)
+		blendResourceList(containerRecommendation.UpperBound, previous.UpperBound, alpha)
+	}
+	vpa.smoothedRecommendation = recommendation.DeepCopy()
+}
+
+// blendResourceList replaces each quantity in current with the weighted
+// average alpha * current + (1 - alpha) * previous. Quantities missing in
+// previous are left unchanged.
+func blendResourceList(current, previous apiv1.ResourceList, alpha float64) {
+	for resourceName, quantity := range current {
+		previousQuantity, found := previous[resourceName]
+		if !found {
+			continue
+		}
+		blended := alpha*quantity.AsApproximateFloat64() + (1-alpha)*previousQuantity.AsApproximateFloat64()
+		if resourceName == apiv1.ResourceCPU {
+			current[resourceName] = *resource.NewMilliQuantity(int64(blended*1000), quantity.Format)
+		} else {
+			current[resourceName] = *resource.NewQuantity(int64(blended), quantity.Format)
+		}
+	}
+}
+
 // UsesAggregation returns true iff an aggregation with the given key contributes to the VPA.
 func (vpa *Vpa) UsesAggregation(aggregationKey AggregateStateKey) bool {
 	_, exists := vpa.aggregateContainerStates[aggregationKey]
@@ -190,12 +373,35 @@ func (vpa *Vpa) DeleteAggregation(aggregationKey AggregateStateKey) {
 	delete(vpa.aggregateContainerStates, aggregationKey)
 }
 
+// DetachAggregations deletes all aggregations used by this VPA and stops it
+// from using new ones until AttachAggregations is called.
+func (vpa *Vpa) DetachAggregations() {
+	for aggregationKey := range vpa.aggregateContainerStates {
+		vpa.DeleteAggregation(aggregationKey)
+	}
+	vpa.detached = true
+}
+
+// AttachAggregations allows a detached VPA to use aggregations again and links
+// it to all matching aggregations from the given map.
+func (vpa *Vpa) AttachAggregations(aggregateContainerStateMap aggregateContainerStatesMap) {
+	vpa.detached = false
+	for aggregationKey, aggregation := range aggregateContainerStateMap {
+		vpa.UseAggregationIfMatching(aggregationKey, aggregation)
+	}
+}
+
+// IsDetached returns true if the VPA was detached from its aggregations.
+func (vpa *Vpa) IsDetached() bool {
+	return vpa.detached
+}
+
 // MergeCheckpointedState adds checkpointed VPA aggregations to the given aggregateStateMap.
 func (vpa *Vpa) MergeCheckpointedState(aggregateContainerStateMap ContainerNameToAggregateStateMap) {
 	for containerName, aggregation := range vpa.ContainersInitialAggregateState {
 		aggregateContainerState, found := aggregateContainerStateMap[containerName]
 		if !found {
-			aggregateContainerState = NewAggregateContainerState()
+			aggregateContainerState = NewAggregateContainerState(GetAggregationsConfig().HistogramType)
 			aggregateContainerStateMap[containerName] = aggregateContainerState
 		}
 		aggregateContainerState.MergeContainerState(aggregation)
@@ -210,6 +416,12 @@ func (vpa *Vpa) AggregateStateByContainerName() ContainerNameToAggregateStateMap
 	return containerNameToAggregateStateMap
 }
 
+// CreationAge returns the time elapsed between the creation of the VPA object
+// and now.
+func (vpa *Vpa) CreationAge(now time.Time) time.Duration {
+	return now.Sub(vpa.Created)
+}
+
 // HasRecommendation returns if the VPA object contains any recommendation
 func (vpa *Vpa) HasRecommendation() bool {
 	return (vpa.Recommendation != nil) && len(vpa.Recommendation.ContainerRecommendations) > 0
@@ -250,6 +462,30 @@ func (vpa *Vpa) SetUpdateMode(updatePolicy *vpa_types.PodUpdatePolicy) {
 	}
 }
 
+// hasUpdateMode returns true if the VPA is in the given update mode. VPAs
+// which don't specify the update mode are in the default Auto mode.
+func (vpa *Vpa) hasUpdateMode(mode vpa_types.UpdateMode) bool {
+	if vpa.UpdateMode == nil || *vpa.UpdateMode == "" {
+		return mode == vpa_types.UpdateModeAuto
+	}
+	return *vpa.UpdateMode == mode
+}
+
+const (
+	noPodsMatchedReason  = "NoPodsMatched"
+	noPodsMatchedMessage = "No pods match this VPA object"
+)
+
+// updateNoPodsMatchedCondition sets the NoPodsMatched condition if the VPA
+// matches no pods according to PodCount and removes it otherwise.
+func (vpa *Vpa) updateNoPodsMatchedCondition() {
+	if vpa.PodCount > 0 {
+		delete(vpa.Conditions, vpa_types.NoPodsMatched)
+		return
+	}
+	vpa.Conditions.Set(vpa_types.NoPodsMatched, true, noPodsMatchedReason, noPodsMatchedMessage)
+}
+
 // UpdateConditions updates the conditions of VPA objects based on it's state.
 // PodsMatched is passed to indicate if there are currently active pods in the
 // cluster matching this VPA.
@@ -259,8 +495,8 @@ func (vpa *Vpa) UpdateConditions(podsMatched bool) {
 	if podsMatched {
 		delete(vpa.Conditions, vpa_types.NoPodsMatched)
 	} else {
-		reason = "NoPodsMatched"
-		msg = "No pods match this VPA object"
+		reason = noPodsMatchedReason
+		msg = noPodsMatchedMessage
 		vpa.Conditions.Set(vpa_types.NoPodsMatched, true, reason, msg)
 	}
 	if vpa.HasRecommendation() {
@@ -268,7 +504,23 @@ func (vpa *Vpa) UpdateConditions(podsMatched bool) {
 	} else {
 		vpa.Conditions.Set(vpa_types.RecommendationProvided, false, reason, msg)
 	}
+	if confidence, found := vpa.RecommendationConfidence(); found && vpa.HasRecommendation() && confidence > HighConfidenceThreshold {
+		vpa.Conditions.Set(vpa_types.HighConfidence, true, "", fmt.Sprintf("Recommendation confidence is %.2f", confidence))
+	} else {
+		delete(vpa.Conditions, vpa_types.HighConfidence)
+	}
+}
 
+// RecommendationConfidence returns the lowest RecommendationConfidence of
+// the aggregations of all containers of the VPA. Returns false as the second
+// value if the VPA has no aggregations.
+func (vpa *Vpa) RecommendationConfidence() (float64, bool) {
+	lowest, found := 1.0, false
+	for _, aggregation := range vpa.AggregateStateByContainerName() {
+		lowest = math.Min(lowest, aggregation.RecommendationConfidence())
+		found = true
+	}
+	return lowest, found
 }
 
 // AsStatus returns this objects equivalent of VPA Status. UpdateConditions
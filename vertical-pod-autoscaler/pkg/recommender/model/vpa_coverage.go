@@ -0,0 +1,53 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+// CoverageStats describes which part of the pods tracked by the cluster state
+// is managed by VPA objects.
+type CoverageStats struct {
+	// TotalPods is the number of tracked pods.
+	TotalPods int
+	// ManagedPods is the number of tracked pods controlled by a VPA.
+	ManagedPods int
+	// TotalContainers is the number of containers of the tracked pods.
+	TotalContainers int
+	// ManagedContainers is the number of containers of the pods controlled
+	// by a VPA.
+	ManagedContainers int
+	// CoverageFraction is ManagedPods divided by TotalPods, or 0 if there
+	// are no pods.
+	CoverageFraction float64
+}
+
+// GetVpaCoverageStats returns the number of tracked pods and containers and
+// how many of them are managed, i.e. their pod is controlled by a VPA
+// according to GetControllingVPA.
+func (cluster *clusterState) GetVpaCoverageStats() CoverageStats {
+	stats := CoverageStats{}
+	for _, pod := range cluster.pods {
+		stats.TotalPods++
+		stats.TotalContainers += len(pod.Containers)
+		if cluster.GetControllingVPA(pod) != nil {
+			stats.ManagedPods++
+			stats.ManagedContainers += len(pod.Containers)
+		}
+	}
+	if stats.TotalPods > 0 {
+		stats.CoverageFraction = float64(stats.ManagedPods) / float64(stats.TotalPods)
+	}
+	return stats
+}
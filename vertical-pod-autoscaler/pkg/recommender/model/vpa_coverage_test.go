@@ -0,0 +1,57 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestGetVpaCoverageStats(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	assert.Equal(t, CoverageStats{}, cluster.GetVpaCoverageStats())
+
+	addTestPod(cluster)
+	addTestContainer(t, cluster)
+	assert.NoError(t, cluster.AddOrUpdatePod(testPodID3, emptyLabels, apiv1.PodRunning))
+	_, err := cluster.AddOrUpdateContainer(ContainerID{testPodID3, "container-1"}, testRequest)
+	assert.NoError(t, err)
+	_, err = cluster.AddOrUpdateContainer(ContainerID{testPodID3, "container-2"}, testRequest)
+	assert.NoError(t, err)
+
+	// No VPAs.
+	assert.Equal(t, CoverageStats{TotalPods: 2, TotalContainers: 3}, cluster.GetVpaCoverageStats())
+
+	// The VPA matches one of the pods.
+	addTestVpa(cluster)
+	assert.Equal(t, CoverageStats{
+		TotalPods:         2,
+		ManagedPods:       1,
+		TotalContainers:   3,
+		ManagedContainers: 1,
+		CoverageFraction:  0.5,
+	}, cluster.GetVpaCoverageStats())
+
+	// All pods are matched.
+	addVpa(cluster, VpaID{testPodID3.Namespace, "vpa-all"}, testAnnotations, "", testTargetRef)
+	stats := cluster.GetVpaCoverageStats()
+	assert.Equal(t, 2, stats.ManagedPods)
+	assert.Equal(t, 3, stats.ManagedContainers)
+	assert.Equal(t, 1.0, stats.CoverageFraction)
+}
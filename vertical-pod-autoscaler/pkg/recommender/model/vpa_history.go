@@ -0,0 +1,100 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"time"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+// VpaHistorySize is the number of the most recent recommendations kept for
+// each VPA, see GetVpaHistory.
+const VpaHistorySize = 32
+
+// HistoricalRecommendation is a recommendation recorded for a VPA by
+// RecordRecommendation.
+type HistoricalRecommendation struct {
+	// Timestamp is the time the recommendation was recorded at.
+	Timestamp time.Time
+	// Recommendation is a copy of the recommended resources.
+	Recommendation *vpa_types.RecommendedPodResources
+	// PodCount is the number of pods in the cluster state when the
+	// recommendation was recorded.
+	PodCount int
+}
+
+// vpaHistory is a circular buffer of the VpaHistorySize most recent
+// recommendations of a VPA. The i-th recommendation is stored in
+// entries[i%VpaHistorySize].
+type vpaHistory struct {
+	entries [VpaHistorySize]HistoricalRecommendation
+	count   int
+}
+
+func (h *vpaHistory) add(entry HistoricalRecommendation) {
+	h.entries[h.count%VpaHistorySize] = entry
+	h.count++
+}
+
+// latest returns up to limit most recent entries, oldest first. A
+// non-positive limit returns all kept entries.
+func (h *vpaHistory) latest(limit int) []HistoricalRecommendation {
+	n := min(h.count, VpaHistorySize)
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	result := make([]HistoricalRecommendation, 0, n)
+	for i := h.count - n; i < h.count; i++ {
+		result = append(result, h.entries[i%VpaHistorySize])
+	}
+	return result
+}
+
+// GetVpaHistory returns up to limit most recent recommendations recorded for
+// the VPA, oldest first. A non-positive limit returns all of them; only the
+// VpaHistorySize most recent recommendations are kept. Returns an error if
+// the VPA doesn't exist.
+func (cluster *clusterState) GetVpaHistory(vpaID VpaID, limit int) ([]HistoricalRecommendation, error) {
+	if _, vpaExists := cluster.vpas[vpaID]; !vpaExists {
+		return nil, NewVpaNotFoundError(vpaID)
+	}
+	cluster.vpaHistoriesMutex.Lock()
+	defer cluster.vpaHistoriesMutex.Unlock()
+	history, found := cluster.vpaHistories[vpaID]
+	if !found {
+		return []HistoricalRecommendation{}, nil
+	}
+	return history.latest(limit), nil
+}
+
+// recordVpaHistory adds the current recommendation of the VPA to its history.
+func (cluster *clusterState) recordVpaHistory(vpa *Vpa, now time.Time) {
+	entry := HistoricalRecommendation{
+		Timestamp:      now,
+		Recommendation: vpa.Recommendation.DeepCopy(),
+		PodCount:       len(cluster.pods),
+	}
+	cluster.vpaHistoriesMutex.Lock()
+	defer cluster.vpaHistoriesMutex.Unlock()
+	history, found := cluster.vpaHistories[vpa.ID]
+	if !found {
+		history = &vpaHistory{}
+		cluster.vpaHistories[vpa.ID] = history
+	}
+	history.add(entry)
+}
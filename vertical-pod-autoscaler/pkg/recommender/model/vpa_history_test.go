@@ -0,0 +1,107 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+func TestGetVpaHistory(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	vpa := addTestVpa(cluster)
+	addTestPod(cluster)
+
+	history, err := cluster.GetVpaHistory(testVpaID, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+
+	recordCount := VpaHistorySize + 3
+	for i := 0; i < recordCount; i++ {
+		vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).
+			WithTarget(fmt.Sprintf("%dm", i+1), "1e8").Get()
+		assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(time.Duration(i)*time.Minute)))
+	}
+
+	history, err = cluster.GetVpaHistory(testVpaID, 5)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 5) {
+		for i, entry := range history {
+			index := recordCount - 5 + i
+			assert.Equal(t, testTimestamp.Add(time.Duration(index)*time.Minute), entry.Timestamp)
+			assert.Equal(t, int64(index+1), entry.Recommendation.ContainerRecommendations[0].Target.Cpu().MilliValue())
+			assert.Equal(t, 1, entry.PodCount)
+		}
+	}
+	// The history doesn't share the recommendation with the VPA.
+	assert.NotSame(t, vpa.Recommendation, history[4].Recommendation)
+
+	// Only the VpaHistorySize most recent recommendations are kept.
+	history, err = cluster.GetVpaHistory(testVpaID, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, history, VpaHistorySize) {
+		assert.Equal(t, testTimestamp.Add(time.Duration(recordCount-VpaHistorySize)*time.Minute), history[0].Timestamp)
+	}
+
+	_, err = cluster.GetVpaHistory(VpaID{"namespace-1", "unknown"}, 5)
+	assert.ErrorAs(t, err, &VpaNotFoundError{})
+
+	assert.NoError(t, cluster.DeleteVpa(testVpaID))
+	addTestVpa(cluster)
+	history, err = cluster.GetVpaHistory(testVpaID, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestGetVpaHistoryConcurrentRecording(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	addTestPod(cluster)
+	var vpas []*Vpa
+	for i := 0; i < 20; i++ {
+		vpas = append(vpas, addVpa(cluster, VpaID{"namespace-1", fmt.Sprintf("vpa-%d", i)}, testAnnotations, testSelectorStr, testTargetRef))
+	}
+
+	// Recommendations are recorded concurrently, as by the workers updating
+	// VPAs.
+	var wg sync.WaitGroup
+	for _, vpa := range vpas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				vpa.Recommendation = test.Recommendation().WithContainer(testContainerID.ContainerName).
+					WithTarget(fmt.Sprintf("%dm", i+1), "1e8").Get()
+				assert.NoError(t, cluster.RecordRecommendation(vpa, testTimestamp.Add(time.Duration(i)*time.Minute)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, vpa := range vpas {
+		history, err := cluster.GetVpaHistory(vpa.ID, 0)
+		assert.NoError(t, err)
+		if assert.Len(t, history, 10) {
+			assert.Equal(t, testTimestamp.Add(9*time.Minute), history[9].Timestamp)
+		}
+	}
+}
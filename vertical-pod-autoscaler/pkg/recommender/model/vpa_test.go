@@ -36,7 +36,7 @@ var (
 func TestMergeAggregateContainerState(t *testing.T) {
 
 	containersInitialAggregateState := ContainerNameToAggregateStateMap{}
-	containersInitialAggregateState["test"] = NewAggregateContainerState()
+	containersInitialAggregateState["test"] = NewAggregateContainerState(DecayingHistogramType)
 	vpa := NewVpa(VpaID{}, nil, anyTime)
 	vpa.ContainersInitialAggregateState = containersInitialAggregateState
 
@@ -591,3 +591,50 @@ func (k mockAggregateStateKey) Labels() labels.Labels {
 	labels, _ := labels.ConvertSelectorToLabelsMap(k.labels)
 	return labels
 }
+
+func TestSetHistoryLength(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "14d", expected: 14 * 24 * time.Hour},
+		{value: "36h", expected: 36 * time.Hour},
+		{value: "0d", expected: 0},
+		{value: "-1h", expected: 0},
+		{value: "1.5d", expected: 0},
+		{value: "", expected: 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.value, func(t *testing.T) {
+			vpa := NewVpa(VpaID{Namespace: "test-namespace", VpaName: "my-favourite-vpa"}, labels.Nothing(), anyTime)
+			vpa.SetHistoryLength(vpaAnnotationsMap{HistoryLengthAnnotation: tc.value})
+			assert.Equal(t, tc.expected, vpa.HistoryLength)
+		})
+	}
+}
+
+func TestUpdateConditionsHighConfidence(t *testing.T) {
+	vpa := NewVpa(VpaID{Namespace: "test-namespace", VpaName: "my-favourite-vpa"}, labels.Nothing(), time.Unix(0, 0))
+	vpa.Recommendation = test.Recommendation().WithContainer("container").WithTarget("5", "200").Get()
+	key := aggregateStateKey{namespace: "test-namespace", containerName: "container"}
+
+	// Without aggregations the condition is not set.
+	vpa.UpdateConditions(true)
+	assert.NotContains(t, vpa.Conditions, vpa_types.HighConfidence)
+
+	vpa.aggregateContainerStates[key] = aggregationWithSamples(3*24*60, time.Minute)
+	vpa.UpdateConditions(true)
+	assert.True(t, vpa.Conditions.ConditionActive(vpa_types.HighConfidence))
+	assert.Contains(t, vpa.Conditions[vpa_types.HighConfidence].Message, "Recommendation confidence is")
+
+	// The condition is cleared when the confidence drops.
+	vpa.aggregateContainerStates[key] = aggregationWithSamples(3, time.Minute)
+	vpa.UpdateConditions(true)
+	assert.NotContains(t, vpa.Conditions, vpa_types.HighConfidence)
+
+	// The condition is not set without a recommendation.
+	vpa.aggregateContainerStates[key] = aggregationWithSamples(3*24*60, time.Minute)
+	vpa.Recommendation = nil
+	vpa.UpdateConditions(true)
+	assert.NotContains(t, vpa.Conditions, vpa_types.HighConfidence)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	vpa_types_v1beta1 "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1beta1"
+)
+
+// AddOrUpdateVpaFromUnstructured adds or updates the VPA described by the given
+// object of any supported version of the VPA API (v1beta1, v1beta2 or v1),
+// see AddOrUpdateVpa. The fields shared by all versions are read as in v1.
+// The pod selector of v1beta1 objects is read from the object, for other
+// versions it is obtained from the fetcher set with SetVpaSelectorFetcher.
+func (cluster *clusterState) AddOrUpdateVpaFromUnstructured(obj *unstructured.Unstructured) error {
+	gvk := obj.GroupVersionKind()
+	if gvk.Group != vpa_types.SchemeGroupVersion.Group || gvk.Kind != "VerticalPodAutoscaler" {
+		return fmt.Errorf("cannot add %s %s/%s: not a VerticalPodAutoscaler", gvk, obj.GetNamespace(), obj.GetName())
+	}
+	apiObject := &vpa_types.VerticalPodAutoscaler{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), apiObject); err != nil {
+		return fmt.Errorf("cannot parse VPA %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+	}
+	vpaID := VpaID{Namespace: apiObject.Namespace, VpaName: apiObject.Name}
+	var selector labels.Selector
+	switch gvk.Version {
+	case "v1beta1":
+		v1beta1Object := &vpa_types_v1beta1.VerticalPodAutoscaler{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), v1beta1Object); err != nil {
+			return fmt.Errorf("cannot parse VPA %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+		}
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(v1beta1Object.Spec.Selector); err != nil {
+			return fmt.Errorf("invalid selector of VPA %s/%s: %w", obj.GetNamespace(), obj.GetName(), err)
+		}
+	case "v1beta2", vpa_types.SchemeGroupVersion.Version:
+		selector = cluster.getVpaSelector(context.Background(), vpaID, apiObject)
+	default:
+		return fmt.Errorf("cannot add VPA %s/%s: unsupported API version %s", obj.GetNamespace(), obj.GetName(), gvk.Version)
+	}
+	apiObject.SetGroupVersionKind(schema.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind})
+	return cluster.AddOrUpdateVpa(apiObject, selector)
+}
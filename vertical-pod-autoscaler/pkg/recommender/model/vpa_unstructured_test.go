@@ -0,0 +1,109 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+func makeUnstructuredVpa(apiVersion string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       "VerticalPodAutoscaler",
+		"metadata": map[string]interface{}{
+			"namespace": testVpaID.Namespace,
+			"name":      testVpaID.VpaName,
+		},
+		"spec": spec,
+	}}
+}
+
+func TestAddOrUpdateVpaFromUnstructured(t *testing.T) {
+	commonSpec := func() map[string]interface{} {
+		return map[string]interface{}{
+			"updatePolicy": map[string]interface{}{"updateMode": "Initial"},
+			"resourcePolicy": map[string]interface{}{
+				"containerPolicies": []interface{}{
+					map[string]interface{}{"containerName": testContainerID.ContainerName, "mode": "Off"},
+				},
+			},
+		}
+	}
+	v1beta1Spec := commonSpec()
+	v1beta1Spec["selector"] = map[string]interface{}{
+		"matchLabels": map[string]interface{}{"label-1": "value-1"},
+	}
+	v1Spec := commonSpec()
+	v1Spec["targetRef"] = map[string]interface{}{
+		"kind":       testTargetRef.Kind,
+		"name":       testTargetRef.Name,
+		"apiVersion": testTargetRef.APIVersion,
+	}
+	selector, err := labels.Parse(testSelectorStr)
+	assert.NoError(t, err)
+
+	var vpas []*Vpa
+	for _, obj := range []*unstructured.Unstructured{
+		makeUnstructuredVpa("autoscaling.k8s.io/v1beta1", v1beta1Spec),
+		makeUnstructuredVpa("autoscaling.k8s.io/v1beta2", v1Spec),
+		makeUnstructuredVpa("autoscaling.k8s.io/v1", v1Spec),
+	} {
+		t.Run(obj.GetAPIVersion(), func(t *testing.T) {
+			cluster := NewClusterState(testGcPeriod)
+			cluster.SetVpaSelectorFetcher(func(context.Context, *vpa_types.VerticalPodAutoscaler) labels.Selector {
+				return selector
+			})
+			addTestPod(cluster)
+			_, err := cluster.AddOrUpdateContainer(testContainerID, testRequest)
+			assert.NoError(t, err)
+			assert.NoError(t, cluster.AddOrUpdateVpaFromUnstructured(obj))
+			vpa, found := cluster.VPAs()[testVpaID]
+			if assert.True(t, found) {
+				assert.Equal(t, obj.GroupVersionKind().Version, vpa.APIVersion)
+				vpas = append(vpas, vpa)
+			}
+		})
+	}
+	if !assert.Len(t, vpas, 3) {
+		return
+	}
+	for _, vpa := range vpas {
+		assert.Equal(t, selector.String(), vpa.PodSelector.String())
+		assert.Equal(t, vpa_types.UpdateModeInitial, *vpa.UpdateMode)
+		assert.Equal(t, vpas[0].ResourcePolicy, vpa.ResourcePolicy)
+		assert.Equal(t, 1, vpa.PodCount)
+		assert.Len(t, vpa.aggregateContainerStates, 1)
+	}
+}
+
+func TestAddOrUpdateVpaFromUnstructuredErrors(t *testing.T) {
+	cluster := NewClusterState(testGcPeriod)
+	assert.Error(t, cluster.AddOrUpdateVpaFromUnstructured(makeUnstructuredVpa("autoscaling.k8s.io/v2", map[string]interface{}{})))
+	assert.Error(t, cluster.AddOrUpdateVpaFromUnstructured(makeUnstructuredVpa("example.com/v1", map[string]interface{}{})))
+	invalidSelector := map[string]interface{}{"selector": map[string]interface{}{
+		"matchExpressions": []interface{}{map[string]interface{}{"key": "label-1", "operator": "Bogus"}},
+	}}
+	assert.Error(t, cluster.AddOrUpdateVpaFromUnstructured(makeUnstructuredVpa("autoscaling.k8s.io/v1beta1", invalidSelector)))
+	assert.Empty(t, cluster.VPAs())
+}
@@ -19,6 +19,8 @@ package routines
 import (
 	"context"
 	"flag"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -36,7 +38,8 @@ import (
 )
 
 var (
-	checkpointsWriteTimeout = flag.Duration("checkpoints-timeout", time.Minute, `Timeout for writing checkpoints since the start of the recommender's main loop`)
+	checkpointsWriteTimeout    = flag.Duration("checkpoints-timeout", time.Minute, `Timeout for writing checkpoints since the start of the recommender's main loop`)
+	externalRecommenderTimeout = flag.Duration("external-recommender-timeout", 10*time.Second, `Timeout for computing the recommendation of a single VPA with its external recommender, after which the built-in recommender is used`)
 	// MinCheckpointsPerRun is exported to allow displaying a deprecation warning. TODO (voelzmo): remove this flag and the warning in a future release.
 	MinCheckpointsPerRun = flag.Int("min-checkpoints", 10, "Minimum number of checkpoints to write per recommender's main loop. WARNING: this flag is deprecated and doesn't have any effect. It will be removed in a future release. Refer to update-worker-count to influence the minimum number of checkpoints written per loop.")
 )
@@ -50,7 +53,7 @@ type Recommender interface {
 	// GetClusterStateFeeder returns ClusterStateFeeder used by Recommender
 	GetClusterStateFeeder() input.ClusterStateFeeder
 	// UpdateVPAs computes recommendations and sends VPAs status updates to API Server
-	UpdateVPAs()
+	UpdateVPAs(ctx context.Context)
 	// MaintainCheckpoints stores current checkpoints in API Server and garbage collect old ones
 	// MaintainCheckpoints writes checkpoints for at least `update-worker-count` number of VPAs.
 	// Checkpoints are written until ctx permits or all checkpoints are written.
@@ -80,11 +83,53 @@ func (r *recommender) GetClusterStateFeeder() input.ClusterStateFeeder {
 	return r.clusterStateFeeder
 }
 
-func processVPAUpdate(r *recommender, vpa *model.Vpa, observedVpa *v1.VerticalPodAutoscaler) {
-	resources := r.podResourceRecommender.GetRecommendedPodResources(GetContainerNameToAggregateStateMap(vpa))
+// getRecommendation computes the recommendation of the VPA using the external
+// recommender registered for it, if any. The built-in recommender is used if
+// there is none or if it fails or doesn't finish within
+// external-recommender-timeout.
+func (r *recommender) getRecommendation(ctx context.Context, vpa *model.Vpa) *v1.RecommendedPodResources {
+	containerNameToAggregateStateMap := GetContainerNameToAggregateStateMap(vpa)
+	if externalRecommender := r.clusterState.GetExternalRecommender(vpa.ID); externalRecommender != nil {
+		externalCtx, cancelFunc := context.WithTimeout(ctx, *externalRecommenderTimeout)
+		recommendation, err := getExternalRecommendation(externalCtx, externalRecommender, vpa.ID, containerNameToAggregateStateMap)
+		cancelFunc()
+		if err == nil {
+			return recommendation
+		}
+		klog.ErrorS(err, "External recommender failed, falling back to the built-in recommender", "vpa", klog.KRef(vpa.ID.Namespace, vpa.ID.VpaName))
+	}
+	resources := r.podResourceRecommender.GetRecommendedPodResources(containerNameToAggregateStateMap)
+	return logic.MapToListOfRecommendedContainerResources(resources)
+}
+
+// getExternalRecommendation asks the external recommender for the
+// recommendation of each container, sorted by the container name.
+func getExternalRecommendation(ctx context.Context, externalRecommender model.ExternalRecommender, vpaID model.VpaID, containerNameToAggregateStateMap model.ContainerNameToAggregateStateMap) (*v1.RecommendedPodResources, error) {
+	containerNames := make([]string, 0, len(containerNameToAggregateStateMap))
+	for containerName := range containerNameToAggregateStateMap {
+		containerNames = append(containerNames, containerName)
+	}
+	sort.Strings(containerNames)
+	result := &v1.RecommendedPodResources{ContainerRecommendations: make([]v1.RecommendedContainerResources, 0, len(containerNames))}
+	for _, containerName := range containerNames {
+		recommendation, err := externalRecommender.GetRecommendation(ctx, vpaID, containerNameToAggregateStateMap[containerName])
+		if err != nil {
+			return nil, fmt.Errorf("cannot get recommendation for container %s: %w", containerName, err)
+		}
+		if recommendation == nil || len(recommendation.ContainerRecommendations) == 0 {
+			return nil, fmt.Errorf("no recommendation for container %s", containerName)
+		}
+		containerRecommendation := recommendation.ContainerRecommendations[0].DeepCopy()
+		containerRecommendation.ContainerName = containerName
+		result.ContainerRecommendations = append(result.ContainerRecommendations, *containerRecommendation)
+	}
+	return result, nil
+}
+
+func processVPAUpdate(ctx context.Context, r *recommender, vpa *model.Vpa, observedVpa *v1.VerticalPodAutoscaler) {
 	had := vpa.HasRecommendation()
 
-	listOfResourceRecommendation := logic.MapToListOfRecommendedContainerResources(resources)
+	listOfResourceRecommendation := r.getRecommendation(ctx, vpa)
 
 	for _, postProcessor := range r.recommendationPostProcessor {
 		listOfResourceRecommendation = postProcessor.Process(observedVpa, listOfResourceRecommendation)
@@ -115,7 +160,7 @@ func processVPAUpdate(r *recommender, vpa *model.Vpa, observedVpa *v1.VerticalPo
 }
 
 // UpdateVPAs update VPA CRD objects' status.
-func (r *recommender) UpdateVPAs() {
+func (r *recommender) UpdateVPAs(ctx context.Context) {
 	cnt := metrics_recommender.NewObjectCounter()
 	defer cnt.Observe()
 
@@ -140,7 +185,7 @@ func (r *recommender) UpdateVPAs() {
 				if !found {
 					return
 				}
-				processVPAUpdate(r, vpa, observedVpa)
+				processVPAUpdate(ctx, r, vpa, observedVpa)
 				cnt.Add(vpa)
 			}
 		}()
@@ -158,6 +203,28 @@ func (r *recommender) UpdateVPAs() {
 	wg.Wait()
 }
 
+// recordNamespaceStats reports the stats of all namespaces containing VPA objects.
+func (r *recommender) recordNamespaceStats() {
+	namespaceStats := make(map[string]model.NamespaceStats)
+	for vpaID := range r.clusterState.VPAs() {
+		if _, found := namespaceStats[vpaID.Namespace]; !found {
+			namespaceStats[vpaID.Namespace] = r.clusterState.GetNamespaceStats(vpaID.Namespace)
+		}
+	}
+	metrics_recommender.RecordNamespaceStats(namespaceStats)
+}
+
+// recordOOMRates reports the OOM rates of all aggregations.
+func (r *recommender) recordOOMRates() {
+	now := time.Now()
+	var rates []float64
+	r.clusterState.ForEachAggregation(func(_ model.AggregateStateKey, aggregation *model.AggregateContainerState) bool {
+		rates = append(rates, aggregation.GetOOMRate(model.OOMRateWindow, now))
+		return true
+	})
+	metrics_recommender.ObserveAggregationOOMRates(rates)
+}
+
 func (r *recommender) MaintainCheckpoints(ctx context.Context) {
 	if r.useCheckpoints {
 		r.checkpointWriter.StoreCheckpoints(ctx, r.updateWorkerCount)
@@ -187,14 +254,25 @@ func (r *recommender) RunOnce() {
 	timer.ObserveStep("LoadMetrics")
 	klog.V(3).InfoS("ClusterState is tracking", "pods", len(r.clusterState.Pods()), "vpas", len(r.clusterState.VPAs()))
 
-	r.UpdateVPAs()
+	r.UpdateVPAs(ctx)
 	timer.ObserveStep("UpdateVPAs")
 
+	r.recordNamespaceStats()
+
+	metrics_recommender.RecordOrphanedPodsCount(len(r.clusterState.GetOrphanedPods()))
+	metrics_recommender.RecordVpaCoverageStats(r.clusterState.GetVpaCoverageStats())
+	metrics_recommender.RecordEmptyVpaCount(r.clusterState.EmptyVpaCount())
+	metrics_recommender.RecordEmptyVpas(r.clusterState.GetEmptyVpas())
+	r.recordOOMRates()
+	r.clusterState.DeleteOrphanedPods(time.Now())
+
 	stepCtx, cancelFunc := context.WithDeadline(ctx, time.Now().Add(*checkpointsWriteTimeout))
 	defer cancelFunc()
 	r.MaintainCheckpoints(stepCtx)
 	timer.ObserveStep("MaintainCheckpoints")
 
+	metrics_recommender.RecordNamespaceSampleCounts(r.clusterState.GetSampleCountByNamespace())
+	metrics_recommender.RecordAggregationMemoryBytes(r.clusterState.TotalAggregationMemoryBytes())
 	r.clusterState.RateLimitedGarbageCollectAggregateCollectionStates(ctx, time.Now(), r.controllerFetcher)
 	timer.ObserveStep("GarbageCollect")
 	klog.V(3).InfoS("ClusterState is tracking", "aggregateContainerStates", r.clusterState.StateMapSize())
@@ -0,0 +1,134 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routines
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/logic"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
+	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/utils/test"
+)
+
+type fakePodResourceRecommender struct{}
+
+func (fakePodResourceRecommender) GetRecommendedPodResources(containerNameToAggregateStateMap model.ContainerNameToAggregateStateMap) logic.RecommendedPodResources {
+	result := make(logic.RecommendedPodResources)
+	for containerName := range containerNameToAggregateStateMap {
+		resources := model.Resources{model.ResourceCPU: model.CPUAmountFromCores(1), model.ResourceMemory: model.MemoryAmountFromBytes(1e9)}
+		result[containerName] = logic.RecommendedContainerResources{Target: resources, LowerBound: resources, UpperBound: resources}
+	}
+	return result
+}
+
+type fakeExternalRecommender struct {
+	recommendation *vpa_types.RecommendedPodResources
+	err            error
+}
+
+func (f *fakeExternalRecommender) GetRecommendation(_ context.Context, _ model.VpaID, _ *model.AggregateContainerState) (*vpa_types.RecommendedPodResources, error) {
+	return f.recommendation, f.err
+}
+
+// blockingExternalRecommender doesn't return until its context is done.
+type blockingExternalRecommender struct{}
+
+func (blockingExternalRecommender) GetRecommendation(ctx context.Context, _ model.VpaID, _ *model.AggregateContainerState) (*vpa_types.RecommendedPodResources, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGetRecommendationWithExternalRecommender(t *testing.T) {
+	cluster := model.NewClusterState(time.Minute)
+	vpaObject := test.VerticalPodAutoscaler().WithNamespace("namespace-1").WithName("vpa-1").WithContainer("container-1").Get()
+	selector, err := labels.Parse("app=test")
+	assert.NoError(t, err)
+	assert.NoError(t, cluster.AddOrUpdateVpa(vpaObject, selector))
+	podID := model.PodID{Namespace: "namespace-1", PodName: "pod-1"}
+	assert.NoError(t, cluster.AddOrUpdatePod(podID, labels.Set{"app": "test"}, v1.PodRunning))
+	_, err = cluster.AddOrUpdateContainer(model.ContainerID{PodID: podID, ContainerName: "container-1"}, model.Resources{})
+	assert.NoError(t, err)
+	vpaID := model.VpaID{Namespace: "namespace-1", VpaName: "vpa-1"}
+	vpa := cluster.VPAs()[vpaID]
+	r := &recommender{clusterState: cluster, podResourceRecommender: fakePodResourceRecommender{}}
+
+	builtIn := r.getRecommendation(context.Background(), vpa)
+	builtInCPU := builtIn.ContainerRecommendations[0].Target[v1.ResourceCPU]
+	assert.Zero(t, builtInCPU.Cmp(resource.MustParse("1")))
+
+	external := &fakeExternalRecommender{
+		recommendation: test.Recommendation().WithContainer("other-name").WithTarget("2", "2Gi").Get(),
+	}
+	cluster.RegisterExternalRecommender(vpaID, external)
+	recommendation := r.getRecommendation(context.Background(), vpa)
+	assert.Len(t, recommendation.ContainerRecommendations, 1)
+	assert.Equal(t, "container-1", recommendation.ContainerRecommendations[0].ContainerName)
+	assert.Equal(t, test.Resources("2", "2Gi"), recommendation.ContainerRecommendations[0].Target)
+
+	// Falls back to the built-in recommender if the external one fails.
+	external.err = fmt.Errorf("external recommender error")
+	assert.Equal(t, builtIn, r.getRecommendation(context.Background(), vpa))
+	external.err = nil
+	external.recommendation = nil
+	assert.Equal(t, builtIn, r.getRecommendation(context.Background(), vpa))
+
+	cluster.RegisterExternalRecommender(vpaID, nil)
+	assert.Nil(t, cluster.GetExternalRecommender(vpaID))
+}
+
+func TestGetRecommendationWithHangingExternalRecommender(t *testing.T) {
+	oldTimeout := *externalRecommenderTimeout
+	*externalRecommenderTimeout = 10 * time.Millisecond
+	defer func() { *externalRecommenderTimeout = oldTimeout }()
+
+	cluster := model.NewClusterState(time.Minute)
+	vpaObject := test.VerticalPodAutoscaler().WithNamespace("namespace-1").WithName("vpa-1").WithContainer("container-1").Get()
+	selector, err := labels.Parse("app=test")
+	assert.NoError(t, err)
+	assert.NoError(t, cluster.AddOrUpdateVpa(vpaObject, selector))
+	podID := model.PodID{Namespace: "namespace-1", PodName: "pod-1"}
+	assert.NoError(t, cluster.AddOrUpdatePod(podID, labels.Set{"app": "test"}, v1.PodRunning))
+	_, err = cluster.AddOrUpdateContainer(model.ContainerID{PodID: podID, ContainerName: "container-1"}, model.Resources{})
+	assert.NoError(t, err)
+	vpaID := model.VpaID{Namespace: "namespace-1", VpaName: "vpa-1"}
+	vpa := cluster.VPAs()[vpaID]
+	r := &recommender{clusterState: cluster, podResourceRecommender: fakePodResourceRecommender{}}
+	builtIn := r.getRecommendation(context.Background(), vpa)
+
+	// The external recommender error is wrapped.
+	_, err = getExternalRecommendation(context.Background(), &fakeExternalRecommender{err: context.Canceled}, vpaID, GetContainerNameToAggregateStateMap(vpa))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Falls back to the built-in recommender once the timeout expires.
+	cluster.RegisterExternalRecommender(vpaID, blockingExternalRecommender{})
+	assert.Equal(t, builtIn, r.getRecommendation(context.Background(), vpa))
+
+	// Falls back to the built-in recommender if the loop context is done.
+	*externalRecommenderTimeout = time.Hour
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	cancelFunc()
+	assert.Equal(t, builtIn, r.getRecommendation(ctx, vpa))
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
+)
+
+// NewBoundedHistogram returns a new Histogram instance using given options,
+// which never keeps more than maxBuckets non-empty buckets in memory.
+// Requires maxBuckets >= 1.
+func NewBoundedHistogram(options HistogramOptions, maxBuckets int) Histogram {
+	if maxBuckets < 1 {
+		panic("maxBuckets must be positive")
+	}
+	return &boundedHistogram{
+		options:    options,
+		maxBuckets: maxBuckets,
+	}
+}
+
+// A sparse implementation of the Histogram interface that caps the number of
+// stored buckets. Samples are bucketed using the given options, but only the
+// non-empty buckets are kept. Whenever the number of non-empty buckets exceeds
+// maxBuckets, the two adjacent buckets spanning the narrowest (relative) range
+// of values are merged into a single wider bucket.
+// Percentile() returns the upper bound of the corresponding bucket, or a value
+// interpolated linearly within the bucket if it was created by merging.
+// Note: unlike decayingHistogram, the weights of samples do not decay.
+type boundedHistogram struct {
+	// Bucketing scheme.
+	options HistogramOptions
+	// Maximum number of non-empty buckets kept in memory.
+	maxBuckets int
+	// Non-empty buckets, sorted by the first original bucket they cover.
+	// Ranges of the buckets never overlap.
+	buckets []boundedBucket
+	// Total cumulative weight of samples in all buckets.
+	totalWeight float64
+}
+
+// boundedBucket is a (possibly merged) range of original buckets
+// [first..last] together with the cumulative weight of samples in the range.
+type boundedBucket struct {
+	first  int
+	last   int
+	weight float64
+}
+
+func (h *boundedHistogram) AddSample(value float64, weight float64, time time.Time) {
+	if weight < 0.0 {
+		panic("sample weight must be non-negative")
+	}
+	bucket := h.options.FindBucket(value)
+	h.addWeight(bucket, bucket, weight)
+	h.compact()
+}
+
+func (h *boundedHistogram) SubtractSample(value float64, weight float64, time time.Time) {
+	if weight < 0.0 {
+		panic("sample weight must be non-negative")
+	}
+	epsilon := h.options.Epsilon()
+	h.totalWeight = safeSubtract(h.totalWeight, weight, epsilon)
+	i, found := h.findBucket(h.options.FindBucket(value))
+	if !found {
+		return
+	}
+	h.buckets[i].weight = safeSubtract(h.buckets[i].weight, weight, epsilon)
+	if h.buckets[i].weight == 0.0 {
+		h.buckets = append(h.buckets[:i], h.buckets[i+1:]...)
+	}
+}
+
+func (h *boundedHistogram) Merge(other Histogram) {
+	o := other.(*boundedHistogram)
+	if h.options != o.options {
+		panic("can't merge histograms with different options")
+	}
+	for _, b := range o.buckets {
+		h.addWeight(b.first, b.last, b.weight)
+	}
+	h.compact()
+}
+
+func (h *boundedHistogram) Percentile(percentile float64) float64 {
+	if h.IsEmpty() {
+		return 0.0
+	}
+	partialSum := 0.0
+	threshold := percentile * h.totalWeight
+	i := 0
+	for ; i < len(h.buckets)-1; i++ {
+		if partialSum+h.buckets[i].weight >= threshold {
+			break
+		}
+		partialSum += h.buckets[i].weight
+	}
+	b := h.buckets[i]
+	end := h.bucketEnd(b.last)
+	if b.first == b.last {
+		return end
+	}
+	// Interpolate within the merged bucket.
+	return interpolate(h.options.GetBucketStart(b.first), end, (threshold-partialSum)/b.weight)
+}
+
+func (h *boundedHistogram) InterpolatedPercentile(percentile float64) float64 {
+	if h.IsEmpty() {
+		return 0.0
+	}
+	partialSum := 0.0
+	threshold := percentile * h.totalWeight
+	i := 0
+	for ; i < len(h.buckets)-1; i++ {
+		if partialSum+h.buckets[i].weight >= threshold {
+			break
+		}
+		partialSum += h.buckets[i].weight
+	}
+	b := h.buckets[i]
+	return interpolate(h.options.GetBucketStart(b.first), h.bucketEnd(b.last), (threshold-partialSum)/b.weight)
+}
+
+func (h *boundedHistogram) IsEmpty() bool {
+	return len(h.buckets) == 0
+}
+
+func (h *boundedHistogram) BucketCount() int {
+	return len(h.buckets)
+}
+
+func (h *boundedHistogram) String() string {
+	lines := []string{
+		fmt.Sprintf("buckets: %d, maxBuckets: %d, totalWeight: %.3f",
+			len(h.buckets), h.maxBuckets, h.totalWeight),
+		"%-tile\tvalue",
+	}
+	for i := 0; i <= 100; i += 5 {
+		lines = append(lines, fmt.Sprintf("%d\t%.3f", i, h.Percentile(0.01*float64(i))))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (h *boundedHistogram) Equals(other Histogram) bool {
+	h2, typesMatch := other.(*boundedHistogram)
+	if !typesMatch || h.options != h2.options || h.maxBuckets != h2.maxBuckets || len(h.buckets) != len(h2.buckets) {
+		return false
+	}
+	for i, b := range h.buckets {
+		b2 := h2.buckets[i]
+		diff := b.weight - b2.weight
+		if b.first != b2.first || b.last != b2.last || diff > 1e-15 || diff < -1e-15 {
+			return false
+		}
+	}
+	return true
+}
+
+// SaveToChekpoint spreads the weight of merged buckets evenly across the
+// original buckets they cover, so that the checkpoint can be loaded by any
+// histogram using the same options.
+func (h *boundedHistogram) SaveToChekpoint() (*vpa_types.HistogramCheckpoint, error) {
+	result := vpa_types.HistogramCheckpoint{
+		BucketWeights: make(map[int]uint32),
+	}
+	result.TotalWeight = h.totalWeight
+	max := 0.
+	for _, b := range h.buckets {
+		if w := b.weight / float64(b.last-b.first+1); w > max {
+			max = w
+		}
+	}
+	ratio := float64(MaxCheckpointWeight) / max
+	for _, b := range h.buckets {
+		newWeight := uint32(round(b.weight / float64(b.last-b.first+1) * ratio))
+		if newWeight == 0 {
+			continue
+		}
+		for bucket := b.first; bucket <= b.last; bucket++ {
+			result.BucketWeights[bucket] = newWeight
+		}
+	}
+	return &result, nil
+}
+
+func (h *boundedHistogram) LoadFromCheckpoint(checkpoint *vpa_types.HistogramCheckpoint) error {
+	if checkpoint == nil {
+		return fmt.Errorf("cannot load from empty checkpoint")
+	}
+	if checkpoint.TotalWeight < 0.0 {
+		return fmt.Errorf("cannot load checkpoint with negative weight %v", checkpoint.TotalWeight)
+	}
+	sum := int64(0)
+	for bucket, weight := range checkpoint.BucketWeights {
+		sum += int64(weight)
+		if bucket >= h.options.NumBuckets() {
+			return fmt.Errorf("checkpoint has bucket %v that is exceeding histogram buckets %v", bucket, h.options.NumBuckets())
+		}
+		if bucket < 0 {
+			return fmt.Errorf("checkpoint has a negative bucket %v", bucket)
+		}
+	}
+	if sum == 0 {
+		return nil
+	}
+	ratio := checkpoint.TotalWeight / float64(sum)
+	for bucket, weight := range checkpoint.BucketWeights {
+		h.addWeight(bucket, bucket, float64(weight)*ratio)
+	}
+	h.compact()
+	return nil
+}
+
+// findBucket returns the index of the stored bucket covering the given
+// original bucket and true, or the index at which such a bucket would be
+// inserted and false.
+func (h *boundedHistogram) findBucket(bucket int) (int, bool) {
+	i := sort.Search(len(h.buckets), func(i int) bool {
+		return h.buckets[i].last >= bucket
+	})
+	return i, i < len(h.buckets) && h.buckets[i].first <= bucket
+}
+
+// addWeight adds weight to the range of original buckets [first..last].
+// Stored buckets overlapping the range are merged together with it.
+func (h *boundedHistogram) addWeight(first, last int, weight float64) {
+	h.totalWeight += weight
+	i, _ := h.findBucket(first)
+	merged := boundedBucket{first: first, last: last, weight: weight}
+	j := i
+	for ; j < len(h.buckets) && h.buckets[j].first <= last; j++ {
+		if h.buckets[j].first < merged.first {
+			merged.first = h.buckets[j].first
+		}
+		if h.buckets[j].last > merged.last {
+			merged.last = h.buckets[j].last
+		}
+		merged.weight += h.buckets[j].weight
+	}
+	if merged.weight < h.options.Epsilon() {
+		return
+	}
+	h.buckets = append(h.buckets[:i], append([]boundedBucket{merged}, h.buckets[j:]...)...)
+}
+
+// compact merges adjacent buckets until at most maxBuckets remain. Each step
+// merges the pair of neighbours which spans the narrowest relative range of
+// values, which keeps the precision of percentiles as high as possible.
+func (h *boundedHistogram) compact() {
+	for len(h.buckets) > h.maxBuckets {
+		best := 0
+		bestWidth := 0.0
+		for i := 0; i < len(h.buckets)-1; i++ {
+			width := h.relativeWidth(h.buckets[i].first, h.buckets[i+1].last)
+			if i == 0 || width < bestWidth {
+				best, bestWidth = i, width
+			}
+		}
+		h.buckets[best].last = h.buckets[best+1].last
+		h.buckets[best].weight += h.buckets[best+1].weight
+		h.buckets = append(h.buckets[:best+1], h.buckets[best+2:]...)
+	}
+}
+
+// relativeWidth returns the ratio of the end to the start of the range of
+// values covered by the original buckets [first..last].
+func (h *boundedHistogram) relativeWidth(first, last int) float64 {
+	start := h.options.GetBucketStart(first)
+	end := h.bucketEnd(last)
+	if start <= 0.0 {
+		return math.Inf(1)
+	}
+	return end / start
+}
+
+// bucketEnd returns the end of the original bucket. The last bucket doesn't
+// have an upper bound, so its start is returned instead.
+func (h *boundedHistogram) bucketEnd(bucket int) float64 {
+	if bucket < h.options.NumBuckets()-1 {
+		return h.options.GetBucketStart(bucket + 1)
+	}
+	return h.options.GetBucketStart(bucket)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// Test options for bounded histograms, resembling the CPU histogram options.
+	testBoundedHistogramOptions, _ = NewExponentialHistogramOptions(1000.0, 0.01, 1.05, weightEpsilon)
+)
+
+// Verifies that the bounded histogram never keeps more than maxBuckets buckets.
+func TestBoundedHistogramCapsBuckets(t *testing.T) {
+	h := NewBoundedHistogram(testBoundedHistogramOptions, 10)
+	assert.Zero(t, h.BucketCount())
+	for i := 1; i <= 1000; i++ {
+		h.AddSample(0.01*float64(i), 1.0, anyTime)
+	}
+	assert.LessOrEqual(t, len(h.(*boundedHistogram).buckets), 10)
+	assert.Equal(t, len(h.(*boundedHistogram).buckets), h.BucketCount())
+	assert.InEpsilon(t, 1000.0, h.(*boundedHistogram).totalWeight, valueEpsilon)
+}
+
+// Verifies that the bounded histogram gives exactly the same percentiles as
+// the regular histogram as long as no buckets were merged.
+func TestBoundedHistogramWithoutMergingMatchesHistogram(t *testing.T) {
+	exact := NewHistogram(testHistogramOptions)
+	bounded := NewBoundedHistogram(testHistogramOptions, 20)
+	for i := 1; i <= 4; i++ {
+		exact.AddSample(float64(i), float64(i), anyTime)
+		bounded.AddSample(float64(i), float64(i), anyTime)
+	}
+	for p := 0.0; p <= 1.0; p += 0.1 {
+		assert.InEpsilon(t, exact.Percentile(p), bounded.Percentile(p), valueEpsilon)
+	}
+}
+
+// Verifies that the 90th percentile of the bounded histogram is within 5% of
+// the exact value after buckets were merged.
+func TestBoundedHistogramPercentileAfterMerging(t *testing.T) {
+	exact := NewHistogram(testBoundedHistogramOptions)
+	bounded := NewBoundedHistogram(testBoundedHistogramOptions, 16)
+	for i := 0; i < 10000; i++ {
+		// Values spread between 0.1 and 10 cores, with higher values being rarer.
+		value := 0.1 + 9.9*float64(i%100)*float64(i%100)/1e4
+		exact.AddSample(value, 1.0, anyTime)
+		bounded.AddSample(value, 1.0, anyTime)
+	}
+	assert.Len(t, bounded.(*boundedHistogram).buckets, 16)
+	assert.InEpsilon(t, exact.Percentile(0.9), bounded.Percentile(0.9), 0.05)
+}
+
+// Verifies that the interpolated percentiles of the bounded histogram fall
+// between the start and the end of the bucket containing the percentile.
+func TestBoundedHistogramInterpolatedPercentile(t *testing.T) {
+	bounded := NewBoundedHistogram(testBoundedHistogramOptions, 16)
+	assert.Equal(t, 0.0, bounded.InterpolatedPercentile(0.5))
+	for i := 0; i < 10000; i++ {
+		bounded.AddSample(0.1+9.9*float64(i%100)*float64(i%100)/1e4, 1.0, anyTime)
+	}
+	for p := 0.0; p <= 1.0; p += 0.01 {
+		value := bounded.InterpolatedPercentile(p)
+		threshold := p * bounded.(*boundedHistogram).totalWeight
+		partialSum := 0.0
+		for _, b := range bounded.(*boundedHistogram).buckets {
+			partialSum += b.weight
+			if partialSum >= threshold {
+				assert.GreaterOrEqual(t, value, testBoundedHistogramOptions.GetBucketStart(b.first), "percentile %v", p)
+				assert.LessOrEqual(t, value, bounded.(*boundedHistogram).bucketEnd(b.last), "percentile %v", p)
+				break
+			}
+		}
+	}
+}
+
+// Verifies that subtracting all samples leaves the bounded histogram empty.
+func TestBoundedHistogramSubtractSample(t *testing.T) {
+	h := NewBoundedHistogram(testHistogramOptions, 2)
+	h.AddSample(1.0, 1.0, anyTime)
+	h.AddSample(5.0, 2.0, anyTime)
+	h.AddSample(9.0, 3.0, anyTime)
+	assert.False(t, h.IsEmpty())
+	h.SubtractSample(1.0, 1.0, anyTime)
+	h.SubtractSample(5.0, 2.0, anyTime)
+	h.SubtractSample(9.0, 3.0, anyTime)
+	assert.True(t, h.IsEmpty())
+	assert.Equal(t, 0.0, h.Percentile(0.9))
+}
+
+// Verifies that merging two bounded histograms is equivalent to adding all
+// samples to a single one.
+func TestBoundedHistogramMerge(t *testing.T) {
+	h1 := NewBoundedHistogram(testHistogramOptions, 3)
+	h2 := NewBoundedHistogram(testHistogramOptions, 3)
+	expected := NewBoundedHistogram(testHistogramOptions, 3)
+	for i := 1; i <= 4; i++ {
+		h1.AddSample(float64(i), 1.0, anyTime)
+		expected.AddSample(float64(i), 1.0, anyTime)
+	}
+	for i := 5; i <= 8; i++ {
+		h2.AddSample(float64(i), 1.0, anyTime)
+		expected.AddSample(float64(i), 1.0, anyTime)
+	}
+	h1.Merge(h2)
+	assert.InEpsilon(t, expected.Percentile(0.5), h1.Percentile(0.5), 0.2)
+	assert.LessOrEqual(t, len(h1.(*boundedHistogram).buckets), 3)
+}
+
+// Verifies that a bounded histogram survives a round trip through a checkpoint.
+func TestBoundedHistogramSaveAndLoadCheckpoint(t *testing.T) {
+	h := NewBoundedHistogram(testHistogramOptions, 20)
+	h.AddSample(1.0, 1.0, anyTime)
+	h.AddSample(2.0, 2.0, anyTime)
+	h.AddSample(3.0, 3.0, anyTime)
+	checkpoint, err := h.SaveToChekpoint()
+	assert.NoError(t, err)
+
+	loaded := NewBoundedHistogram(testHistogramOptions, 20)
+	assert.NoError(t, loaded.LoadFromCheckpoint(checkpoint))
+	assert.InEpsilon(t, h.Percentile(0.5), loaded.Percentile(0.5), valueEpsilon)
+	assert.InEpsilon(t, h.Percentile(0.9), loaded.Percentile(0.9), valueEpsilon)
+}
@@ -63,6 +63,10 @@ func (h *decayingHistogram) Percentile(percentile float64) float64 {
 	return h.histogram.Percentile(percentile)
 }
 
+func (h *decayingHistogram) InterpolatedPercentile(percentile float64) float64 {
+	return h.histogram.InterpolatedPercentile(percentile)
+}
+
 func (h *decayingHistogram) AddSample(value float64, weight float64, time time.Time) {
 	h.histogram.AddSample(value, weight*h.decayFactor(time), time)
 }
@@ -39,6 +39,14 @@ type Histogram interface {
 	// If the histogram is empty, Percentile() returns 0.0.
 	Percentile(percentile float64) float64
 
+	// Returns an approximation of the given percentile of the distribution
+	// like Percentile(), but interpolated linearly between the start and the
+	// end of the bucket containing the percentile, assuming the samples are
+	// spread evenly within the bucket. Unlike Percentile() it changes
+	// gradually as samples shift between buckets.
+	// If the histogram is empty, InterpolatedPercentile() returns 0.0.
+	InterpolatedPercentile(percentile float64) float64
+
 	// Add a sample with a given value and weight.
 	AddSample(value float64, weight float64, time time.Time)
 
@@ -53,6 +61,9 @@ type Histogram interface {
 	// Returns true if the histogram is empty.
 	IsEmpty() bool
 
+	// Returns the number of buckets the histogram keeps in memory.
+	BucketCount() int
+
 	// Returns true if the histogram is equal to another one. The two
 	// histograms must use the same HistogramOptions object (not two
 	// different copies).
@@ -72,6 +83,30 @@ type Histogram interface {
 	LoadFromCheckpoint(*vpa_types.HistogramCheckpoint) error
 }
 
+// Average returns the average of the samples in the histogram, weighted by
+// their weights, using the given options to determine the bucket boundaries.
+// Consistently with Percentile(), the value of each sample is the end of its
+// bucket. If the histogram is empty, Average() returns 0.0.
+func Average(h Histogram, options HistogramOptions) (float64, error) {
+	checkpoint, err := h.SaveToChekpoint()
+	if err != nil {
+		return 0.0, err
+	}
+	sum, totalWeight := 0.0, 0.0
+	for bucket, weight := range checkpoint.BucketWeights {
+		value := options.GetBucketStart(bucket)
+		if bucket < options.NumBuckets()-1 {
+			value = options.GetBucketStart(bucket + 1)
+		}
+		sum += value * float64(weight)
+		totalWeight += float64(weight)
+	}
+	if totalWeight == 0.0 {
+		return 0.0, nil
+	}
+	return sum / totalWeight, nil
+}
+
 // NewHistogram returns a new Histogram instance using given options.
 func NewHistogram(options HistogramOptions) Histogram {
 	return &histogram{
@@ -178,10 +213,42 @@ func (h *histogram) Percentile(percentile float64) float64 {
 	return h.options.GetBucketStart(bucket)
 }
 
+func (h *histogram) InterpolatedPercentile(percentile float64) float64 {
+	if h.IsEmpty() {
+		return 0.0
+	}
+	partialSum := 0.0
+	threshold := percentile * h.totalWeight
+	bucket := h.minBucket
+	for ; bucket < h.maxBucket; bucket++ {
+		if partialSum+h.bucketWeight[bucket] >= threshold {
+			break
+		}
+		partialSum += h.bucketWeight[bucket]
+	}
+	start := h.options.GetBucketStart(bucket)
+	if bucket == h.options.NumBuckets()-1 {
+		// The last bucket doesn't have an upper bound.
+		return start
+	}
+	end := h.options.GetBucketStart(bucket + 1)
+	return interpolate(start, end, (threshold-partialSum)/h.bucketWeight[bucket])
+}
+
+// interpolate returns the value at the given fraction of the range between
+// start and end. The fraction is clamped to [0, 1].
+func interpolate(start, end, fraction float64) float64 {
+	return start + (end-start)*max(0.0, min(fraction, 1.0))
+}
+
 func (h *histogram) IsEmpty() bool {
 	return h.bucketWeight[h.minBucket] < h.options.Epsilon()
 }
 
+func (h *histogram) BucketCount() int {
+	return len(h.bucketWeight)
+}
+
 func (h *histogram) String() string {
 	lines := []string{
 		fmt.Sprintf("minBucket: %d, maxBucket: %d, totalWeight: %.3f",
@@ -35,6 +35,12 @@ func (m *MockHistogram) Percentile(percentile float64) float64 {
 	return args.Get(0).(float64)
 }
 
+// InterpolatedPercentile is a mock implementation of Histogram.InterpolatedPercentile.
+func (m *MockHistogram) InterpolatedPercentile(percentile float64) float64 {
+	args := m.Called(percentile)
+	return args.Get(0).(float64)
+}
+
 // AddSample is a mock implementation of Histogram.AddSample.
 func (m *MockHistogram) AddSample(value float64, weight float64, time time.Time) {
 	m.Called(value, weight, time)
@@ -57,6 +63,11 @@ func (m *MockHistogram) Equals(other Histogram) bool {
 	return args.Bool(0)
 }
 
+// BucketCount is a mock implementation of Histogram.BucketCount.
+func (m *MockHistogram) BucketCount() int {
+	return 0
+}
+
 // Merge is a mock implementation of Histogram.Merge.
 func (m *MockHistogram) Merge(other Histogram) {
 	m.Called(other)
@@ -45,6 +45,30 @@ func TestPercentilesEmptyHistogram(t *testing.T) {
 	}
 }
 
+// Verifies that InterpolatedPercentile() returns values interpolated within
+// the buckets on the following histogram: { 1: 1, 2: 2, 3: 3, 4: 4 }, which
+// always fall between the start and the end of the bucket containing the
+// percentile.
+func TestInterpolatedPercentiles(t *testing.T) {
+	h := NewHistogram(testHistogramOptions)
+	assert.Equal(t, 0.0, h.InterpolatedPercentile(0.5))
+	for i := 1; i <= 4; i++ {
+		h.AddSample(float64(i), float64(i), anyTime)
+	}
+	assert.InEpsilon(t, 1.0, h.InterpolatedPercentile(0.0), valueEpsilon)
+	assert.InEpsilon(t, 2.0, h.InterpolatedPercentile(0.1), valueEpsilon)
+	assert.InEpsilon(t, 2.5, h.InterpolatedPercentile(0.2), valueEpsilon)
+	assert.InEpsilon(t, 3.0+2.0/3.0, h.InterpolatedPercentile(0.5), valueEpsilon)
+	assert.InEpsilon(t, 5.0, h.InterpolatedPercentile(1.0), valueEpsilon)
+	for p := 0.0; p <= 1.0; p += 0.01 {
+		end := h.Percentile(p)
+		start := testHistogramOptions.GetBucketStart(testHistogramOptions.FindBucket(end) - 1)
+		value := h.InterpolatedPercentile(p)
+		assert.GreaterOrEqual(t, value, start, "percentile %v", p)
+		assert.LessOrEqual(t, value, end, "percentile %v", p)
+	}
+}
+
 // Verifies that Percentile() returns the correct values of selected
 // percentiles on the following histogram: { 1: 1, 2: 2, 3: 3, 4: 4 }.
 func TestPercentiles(t *testing.T) {
@@ -65,6 +89,21 @@ func TestPercentiles(t *testing.T) {
 	assert.InEpsilon(t, 5, h.Percentile(1.0), valueEpsilon)
 }
 
+// Verifies that Average() weighs the ends of the buckets by their weights.
+func TestAverage(t *testing.T) {
+	h := NewHistogram(testHistogramOptions)
+	average, err := Average(h, testHistogramOptions)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, average)
+	for i := 1; i <= 4; i++ {
+		h.AddSample(float64(i), float64(i), anyTime)
+	}
+	average, err = Average(h, testHistogramOptions)
+	assert.NoError(t, err)
+	// (1*2 + 2*3 + 3*4 + 4*5) / (1 + 2 + 3 + 4)
+	assert.InEpsilon(t, 4, average, valueEpsilon)
+}
+
 // Verifies that querying percentile < 0.0 returns the minimum value in the
 // histogram, while querying percentile > 1.0 returns the maximum of the
 // histogram.
@@ -160,8 +160,13 @@ func (u *updater) RunOnce(ctx context.Context) {
 			continue
 		}
 		if vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeRecreate &&
-			vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeAuto && vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeInPlaceOrRecreate {
-			klog.V(3).InfoS("Skipping VPA object because its mode is not  \"InPlaceOrRecreate\", \"Recreate\" or \"Auto\"", "vpa", klog.KObj(vpa))
+			vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeAuto && vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeInPlaceOrRecreate &&
+			vpa_api_util.GetUpdateMode(vpa) != vpa_types.UpdateModeInPlace {
+			klog.V(3).InfoS("Skipping VPA object because its mode is not  \"InPlace\", \"InPlaceOrRecreate\", \"Recreate\" or \"Auto\"", "vpa", klog.KObj(vpa))
+			continue
+		}
+		if vpa_api_util.IsDryRun(vpa.Annotations) {
+			klog.V(3).InfoS("Skipping VPA object in dry-run mode", "vpa", klog.KObj(vpa))
 			continue
 		}
 		selector, err := u.selectorFetcher.Fetch(ctx, vpa)
@@ -227,7 +232,7 @@ func (u *updater) RunOnce(ctx context.Context) {
 	defer vpasWithInPlaceUpdatedPodsCounter.Observe()
 
 	// NOTE: this loop assumes that controlledPods are filtered
-	// to contain only Pods controlled by a VPA in auto, recreate, or inPlaceOrRecreate mode
+	// to contain only Pods controlled by a VPA in auto, recreate, inPlaceOrRecreate or inPlace mode
 	for vpa, livePods := range controlledPods {
 		vpaSize := len(livePods)
 		controlledPodsCounter.Add(vpaSize, vpaSize)
@@ -244,7 +249,8 @@ func (u *updater) RunOnce(ctx context.Context) {
 		podsForEviction := make([]*apiv1.Pod, 0)
 		updateMode := vpa_api_util.GetUpdateMode(vpa)
 
-		if updateMode == vpa_types.UpdateModeInPlaceOrRecreate && features.Enabled(features.InPlaceOrRecreate) {
+		if updateMode == vpa_types.UpdateModeInPlace ||
+			(updateMode == vpa_types.UpdateModeInPlaceOrRecreate && features.Enabled(features.InPlaceOrRecreate)) {
 			podsForInPlace = u.getPodsUpdateOrder(filterNonInPlaceUpdatablePods(livePods, inPlaceLimiter), vpa)
 			inPlaceUpdatablePodsCounter.Add(vpaSize, len(podsForInPlace))
 		} else {
@@ -269,6 +275,12 @@ func (u *updater) RunOnce(ctx context.Context) {
 				klog.V(0).InfoS("In-place update deferred", "pod", klog.KObj(pod))
 				continue
 			} else if decision == utils.InPlaceEvict {
+				// Pods of a VPA in InPlace mode are never evicted, the resize is
+				// retried in a later loop instead.
+				if updateMode == vpa_types.UpdateModeInPlace {
+					klog.V(2).InfoS("In-place update not possible, skipping eviction fallback", "pod", klog.KObj(pod), "updateMode", updateMode)
+					continue
+				}
 				podsForEviction = append(podsForEviction, pod)
 				continue
 			}
@@ -115,6 +115,24 @@ func TestRunOnce_Mode(t *testing.T) {
 			canEvict:              false,
 			canInPlaceUpdate:      utils.InPlaceDeferred,
 		},
+		{
+			name:                  "with InPlace mode expecting in-place updates",
+			updateMode:            vpa_types.UpdateModeInPlace,
+			expectFetchCalls:      true,
+			expectedEvictionCount: 0,
+			expectedInPlacedCount: 5,
+			canEvict:              true,
+			canInPlaceUpdate:      utils.InPlaceApproved,
+		},
+		{
+			name:                  "with InPlace mode expecting no fallback to evictions",
+			updateMode:            vpa_types.UpdateModeInPlace,
+			expectFetchCalls:      true,
+			expectedEvictionCount: 0,
+			expectedInPlacedCount: 0,
+			canEvict:              true,
+			canInPlaceUpdate:      utils.InPlaceEvict,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -31,6 +31,7 @@ type HealthCheck struct {
 	activityTimeout time.Duration
 	checkTimeout    bool
 	lastActivity    time.Time
+	checks          []func() error
 	mutex           *sync.Mutex
 }
 
@@ -66,11 +67,37 @@ func (hc *HealthCheck) checkLastActivity() (bool, time.Duration) {
 	return timedOut, now.Sub(lastActivity)
 }
 
+// AddCheck adds a check of the health of the monitored component. The
+// component is unhealthy if the check returns an error. The check must be
+// safe to call concurrently with the component.
+func (hc *HealthCheck) AddCheck(check func() error) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	hc.checks = append(hc.checks, check)
+}
+
+// runChecks returns the error of the first failing check, if any.
+func (hc *HealthCheck) runChecks() error {
+	hc.mutex.Lock()
+	checks := hc.checks
+	hc.mutex.Unlock()
+
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ServeHTTP implements http.Handler interface to provide a health-check endpoint.
 func (hc *HealthCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	timedOut, ago := hc.checkLastActivity()
 	if timedOut {
 		http.Error(w, fmt.Sprintf("Error: last activity more than %v ago", ago), http.StatusInternalServerError)
+	} else if err := hc.runChecks(); err != nil {
+		http.Error(w, fmt.Sprintf("Error: %v", err), http.StatusInternalServerError)
 	} else {
 		w.WriteHeader(200)
 		_, err := w.Write([]byte("OK"))
@@ -43,6 +43,8 @@ var (
 		string(vpa_types.UpdateModeInitial),
 		string(vpa_types.UpdateModeRecreate),
 		string(vpa_types.UpdateModeAuto),
+		string(vpa_types.UpdateModeAnnotationRecommendation),
+		string(vpa_types.UpdateModeInPlace),
 	}
 )
 
@@ -83,6 +85,87 @@ var (
 		},
 	)
 
+	aggregationMemoryBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "aggregation_memory_bytes",
+			Help:      "Estimated size of the histograms of the aggregate container states tracked by the recommender",
+		},
+	)
+
+	namespaceRecommendation = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "namespace_recommendation",
+			Help:      "Total resources recommended for pods matched by VPA objects in a namespace, in cores for CPU and bytes for memory.",
+		}, []string{"namespace", "resource"},
+	)
+
+	namespaceSampleCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "namespace_samples_count",
+			Help:      "Number of usage samples aggregated by the recommender in a namespace.",
+		}, []string{"namespace"},
+	)
+
+	namespaceObjectCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "namespace_objects_count",
+			Help:      "Number of VPA objects and pods tracked by the recommender in a namespace.",
+		}, []string{"namespace", "object"},
+	)
+
+	orphanedPodsCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "orphaned_pods_total",
+			Help:      "Number of pods tracked by the recommender which don't match any VPA object.",
+		},
+	)
+
+	aggregationOOMRate = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "aggregation_oom_rate",
+			Help:      "OOM events per hour of the aggregations of containers, over the last day.",
+			Buckets:   []float64{0.0, 0.05, 0.1, 0.25, 0.5, 1.0},
+		},
+	)
+
+	emptyVpasCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "empty_vpas_count",
+			Help:      "Number of VPA objects which have no recommendation.",
+		},
+	)
+
+	namespaceEmptyVpasCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "namespace_empty_vpas_count",
+			Help:      "Number of VPA objects which have no recommendation, by namespace.",
+		}, []string{"namespace"},
+	)
+
+	vpaCoverageObjectCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "vpa_coverage_objects_count",
+			Help:      "Number of pods and containers tracked by the recommender, split by whether they are controlled by a VPA object.",
+		}, []string{"object", "managed"},
+	)
+
+	vpaCoverageFraction = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "vpa_coverage_fraction",
+			Help:      "Fraction of the pods tracked by the recommender which are controlled by a VPA object.",
+		},
+	)
+
 	metricServerResponses = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: metricsNamespace,
@@ -124,7 +207,7 @@ type ObjectCounter struct {
 
 // Register initializes all metrics for VPA Recommender
 func Register() {
-	prometheus.MustRegister(vpaObjectCount, recommendationLatency, functionLatency, aggregateContainerStatesCount, metricServerResponses, prometheusClientRequestsCount, prometheusClientRequestsDuration)
+	prometheus.MustRegister(vpaObjectCount, recommendationLatency, functionLatency, aggregateContainerStatesCount, aggregationMemoryBytes, namespaceRecommendation, namespaceSampleCount, namespaceObjectCount, orphanedPodsCount, aggregationOOMRate, emptyVpasCount, namespaceEmptyVpasCount, vpaCoverageObjectCount, vpaCoverageFraction, metricServerResponses, prometheusClientRequestsCount, prometheusClientRequestsDuration)
 }
 
 // NewExecutionTimer provides a timer for Recommender's RunOnce execution
@@ -142,6 +225,71 @@ func RecordAggregateContainerStatesCount(statesCount int) {
 	aggregateContainerStatesCount.Set(float64(statesCount))
 }
 
+// RecordAggregationMemoryBytes records the estimated size of the aggregate container states
+func RecordAggregationMemoryBytes(bytes int64) {
+	aggregationMemoryBytes.Set(float64(bytes))
+}
+
+// RecordNamespaceStats records the stats of all given namespaces. Namespaces
+// missing from the map are no longer reported.
+func RecordNamespaceStats(stats map[string]model.NamespaceStats) {
+	namespaceRecommendation.Reset()
+	namespaceObjectCount.Reset()
+	for namespace, s := range stats {
+		namespaceRecommendation.WithLabelValues(namespace, string(model.ResourceCPU)).Set(model.CoresFromCPUAmount(s.RecommendedCPU))
+		namespaceRecommendation.WithLabelValues(namespace, string(model.ResourceMemory)).Set(model.BytesFromMemoryAmount(s.RecommendedMemory))
+		namespaceObjectCount.WithLabelValues(namespace, "vpa").Set(float64(s.VpaCount))
+		namespaceObjectCount.WithLabelValues(namespace, "pod").Set(float64(s.PodCount))
+	}
+}
+
+// RecordNamespaceSampleCounts records the number of samples aggregated in each
+// given namespace. Namespaces missing from the map are no longer reported.
+func RecordNamespaceSampleCounts(counts map[string]int) {
+	namespaceSampleCount.Reset()
+	for namespace, count := range counts {
+		namespaceSampleCount.WithLabelValues(namespace).Set(float64(count))
+	}
+}
+
+// RecordOrphanedPodsCount records the number of tracked pods which don't match any VPA.
+func RecordOrphanedPodsCount(count int) {
+	orphanedPodsCount.Set(float64(count))
+}
+
+// ObserveAggregationOOMRates observes the OOM rates of the aggregations, see
+// model.AggregateContainerState.GetOOMRate.
+func ObserveAggregationOOMRates(rates []float64) {
+	for _, rate := range rates {
+		aggregationOOMRate.Observe(rate)
+	}
+}
+
+// RecordEmptyVpaCount records the number of VPA objects without a
+// recommendation.
+func RecordEmptyVpaCount(count int) {
+	emptyVpasCount.Set(float64(count))
+}
+
+// RecordEmptyVpas records the number of the given VPA objects without a
+// recommendation in each namespace.
+func RecordEmptyVpas(vpaIDs []model.VpaID) {
+	namespaceEmptyVpasCount.Reset()
+	for _, vpaID := range vpaIDs {
+		namespaceEmptyVpasCount.WithLabelValues(vpaID.Namespace).Inc()
+	}
+}
+
+// RecordVpaCoverageStats records the number of tracked pods and containers
+// and how many of them are controlled by a VPA.
+func RecordVpaCoverageStats(stats model.CoverageStats) {
+	vpaCoverageObjectCount.WithLabelValues("pod", "true").Set(float64(stats.ManagedPods))
+	vpaCoverageObjectCount.WithLabelValues("pod", "false").Set(float64(stats.TotalPods - stats.ManagedPods))
+	vpaCoverageObjectCount.WithLabelValues("container", "true").Set(float64(stats.ManagedContainers))
+	vpaCoverageObjectCount.WithLabelValues("container", "false").Set(float64(stats.TotalContainers - stats.ManagedContainers))
+	vpaCoverageFraction.Set(stats.CoverageFraction)
+}
+
 // RecordMetricsServerResponse records result of a query to metrics server
 func RecordMetricsServerResponse(err error, clientName string) {
 	metricServerResponses.WithLabelValues(strconv.FormatBool(err != nil), clientName).Inc()
@@ -22,12 +22,25 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
 	apiv1 "k8s.io/api/core/v1"
 
 	vpa_types "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1"
 	"k8s.io/autoscaler/vertical-pod-autoscaler/pkg/recommender/model"
 )
 
+// Label sets of all update modes start at zero, so that stale values are
+// cleared once the last VPA in a mode goes away.
+func TestNewObjectCounterInitializesAllModes(t *testing.T) {
+	counter := NewObjectCounter()
+	for _, mode := range []vpa_types.UpdateMode{vpa_types.UpdateModeAnnotationRecommendation, vpa_types.UpdateModeInPlace} {
+		key := objectCounterKey{mode: string(mode), apiVersion: v1, matchesPods: true}
+		value, found := counter.cnt[key]
+		assert.True(t, found, mode)
+		assert.Zero(t, value, mode)
+	}
+}
+
 func TestObjectCounter(t *testing.T) {
 	updateModeOff := vpa_types.UpdateModeOff
 	updateModeInitial := vpa_types.UpdateModeInitial
@@ -0,0 +1,76 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"fmt"
+
+	controllerfetcher "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/target/controller_fetcher"
+)
+
+// FakeControllerFetcher is a controllerfetcher.ControllerFetcher returning the
+// parent controllers configured with WithController. Controllers which were
+// not configured are reported as missing.
+type FakeControllerFetcher struct {
+	controllers map[controllerfetcher.ControllerKeyWithAPIVersion]fakeControllerResult
+}
+
+type fakeControllerResult struct {
+	parent *controllerfetcher.ControllerKeyWithAPIVersion
+	err    error
+}
+
+// NewFakeControllerFetcher returns a new FakeControllerFetcher without any
+// controllers.
+func NewFakeControllerFetcher() *FakeControllerFetcher {
+	return &FakeControllerFetcher{
+		controllers: make(map[controllerfetcher.ControllerKeyWithAPIVersion]fakeControllerResult),
+	}
+}
+
+// WithController makes the fetcher return the given parent as the topmost
+// well-known or scalable controller of key. The parent can be nil, as for a
+// scalable controller which doesn't exist.
+func (f *FakeControllerFetcher) WithController(key controllerfetcher.ControllerKeyWithAPIVersion, parent *controllerfetcher.ControllerKeyWithAPIVersion) *FakeControllerFetcher {
+	f.controllers[key] = fakeControllerResult{parent: parent}
+	return f
+}
+
+// WithMissingController makes the fetcher report the controller with the
+// given key as not found.
+func (f *FakeControllerFetcher) WithMissingController(key controllerfetcher.ControllerKeyWithAPIVersion) *FakeControllerFetcher {
+	delete(f.controllers, key)
+	return f
+}
+
+// WithControllerError makes the fetcher return the given error for the
+// controller with the given key.
+func (f *FakeControllerFetcher) WithControllerError(key controllerfetcher.ControllerKeyWithAPIVersion, err error) *FakeControllerFetcher {
+	f.controllers[key] = fakeControllerResult{err: err}
+	return f
+}
+
+// FindTopMostWellKnownOrScalable returns the parent configured for the given
+// controller.
+func (f *FakeControllerFetcher) FindTopMostWellKnownOrScalable(_ context.Context, controller *controllerfetcher.ControllerKeyWithAPIVersion) (*controllerfetcher.ControllerKeyWithAPIVersion, error) {
+	result, found := f.controllers[*controller]
+	if !found {
+		return nil, fmt.Errorf("%s %s/%s not found", controller.Kind, controller.Namespace, controller.Name)
+	}
+	return result.parent, result.err
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -40,6 +41,11 @@ import (
 	controllerfetcher "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/target/controller_fetcher"
 )
 
+// DryRunAnnotation is the VPA annotation which, when set to "true", makes the
+// recommender compute recommendations for the VPA without them ever being
+// applied to pods.
+const DryRunAnnotation = "vpa.autoscaling.k8s.io/dry-run"
+
 // VpaWithSelector is a pair of VPA and its selector.
 type VpaWithSelector struct {
 	Vpa      *vpa_types.VerticalPodAutoscaler
@@ -212,6 +218,13 @@ func GetUpdateMode(vpa *vpa_types.VerticalPodAutoscaler) vpa_types.UpdateMode {
 	return *vpa.Spec.UpdatePolicy.UpdateMode
 }
 
+// IsDryRun returns true if the given VPA annotations enable the dry-run mode.
+// Invalid values of DryRunAnnotation are treated as false.
+func IsDryRun(annotations map[string]string) bool {
+	dryRun, _ := strconv.ParseBool(annotations[DryRunAnnotation])
+	return dryRun
+}
+
 // GetContainerResourcePolicy returns the ContainerResourcePolicy for a given policy
 // and container name. It returns nil if there is no policy specified for the container.
 func GetContainerResourcePolicy(containerName string, policy *vpa_types.PodResourcePolicy) *vpa_types.ContainerResourcePolicy {